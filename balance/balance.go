@@ -0,0 +1,132 @@
+// Package balance contains the providers of the funds available in the markets, used for initialize the wallets: the
+// dummy provider read the starting balances from a file, the live provider request them to the private API of the
+// markets
+package balance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"go.uber.org/zap"
+)
+
+// ErrPrivateAPI is returned when the market does not expose the private API needed for retrieve the balances
+var ErrPrivateAPI = errors.New("PRIVATE_API_NOT_SUPPORTED")
+
+// DEFAULT_BALANCE is the amount of the currencies not configured in the dummy provider
+const DEFAULT_BALANCE = 10000
+
+// Provider is implemented by the sources of the funds available in the markets
+type Provider interface {
+	// Balances is delegated to retrieve the amount available of the given currencies (lowercase) in the given market
+	Balances(ctx context.Context, marketName string, currencies []string) (map[string]float64, error)
+}
+
+// Dummy is the provider used for the simulation, the balances are configured for every market and currency
+type Dummy struct {
+	// Default is the amount of the currencies not configured
+	Default float64 `json:"default"`
+	// Markets contains the name of the market as key and the amount of the currencies as value
+	Markets map[string]map[string]float64 `json:"markets"`
+}
+
+// NewDummy is delegated to initialize a dummy provider that give the default balance for every currency
+func NewDummy() Dummy {
+	return Dummy{Default: DEFAULT_BALANCE, Markets: make(map[string]map[string]float64)}
+}
+
+// LoadDummy is delegated to load the dummy provider from the given json file, e.g.:
+// {"default": 0, "markets": {"KRAKEN": {"btc": 1.5, "usd": 20000}}}
+// If the default is not set, DEFAULT_BALANCE is used
+func LoadDummy(filepath string) (Dummy, error) {
+	data, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return Dummy{}, err
+	}
+	var file Dummy
+	file.Default = DEFAULT_BALANCE
+	if err = json.Unmarshal(data, &file); err != nil {
+		return Dummy{}, err
+	}
+	d := NewDummy()
+	d.Default = file.Default
+	// The names of the markets are uppercase, the currencies lowercase
+	for name, coins := range file.Markets {
+		name = strings.ToUpper(name)
+		if d.Markets[name] == nil {
+			d.Markets[name] = make(map[string]float64, len(coins))
+		}
+		for currency, amount := range coins {
+			d.Markets[name][strings.ToLower(currency)] = amount
+		}
+	}
+	return d, nil
+}
+
+// Balances return the configured amount of the given currencies, or the default one
+func (d Dummy) Balances(ctx context.Context, marketName string, currencies []string) (map[string]float64, error) {
+	var balances = make(map[string]float64, len(currencies))
+	for _, currency := range currencies {
+		amount, ok := d.Markets[marketName][currency]
+		if !ok {
+			amount = d.Default
+		}
+		balances[currency] = amount
+	}
+	return balances, nil
+}
+
+// Live is the provider that request the balances to the private API of the registered markets. The credentials
+// have to be set in the markets
+type Live struct{}
+
+// Balances return the amount available of the given currencies, the currencies not owned are zero
+func (Live) Balances(ctx context.Context, marketName string, currencies []string) (map[string]float64, error) {
+	exchange, ok := markets.Get(marketName)
+	if !ok {
+		return nil, errors.New("market [" + marketName + "] is not registered")
+	}
+	trader, ok := exchange.(markets.Trader)
+	if !ok {
+		return nil, ErrPrivateAPI
+	}
+	available, err := trader.GetBalances(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var balances = make(map[string]float64, len(currencies))
+	for _, currency := range currencies {
+		balances[currency] = available[currency]
+	}
+	return balances, nil
+}
+
+// InitWallets is delegated to initialize the wallet of every market with the balances of the given currencies
+// retrieved from the provider. The wallet of the markets that fail is empty, so they are not used for trade until
+// the next initialization, and an error is returned
+func InitWallets(ctx context.Context, provider Provider, marketsData []market.Market, currencies []string) error {
+	var failed []string
+	for i := range marketsData {
+		name := marketsData[i].MarketName
+		marketsData[i].Wallet = market.Wallet{MarketName: name, Coins: make(map[string]float64, len(currencies))}
+		balances, err := provider.Balances(ctx, name, currencies)
+		if err != nil {
+			zap.S().Warnf("Unable to retrieve the balances of [%s]: %s", name, err.Error())
+			failed = append(failed, name)
+			continue
+		}
+		for currency, amount := range balances {
+			marketsData[i].Wallet.Coins[currency] = amount
+		}
+		zap.S().Infof("Balances of [%s]: %v", name, marketsData[i].Wallet.Coins)
+	}
+	if len(failed) > 0 {
+		return errors.New("unable to retrieve the balances of [" + strings.Join(failed, ",") + "]")
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package balance
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"github.com/alessiosavi/GoArbitrage/markets/fakeserver"
+	"github.com/alessiosavi/GoArbitrage/markets/kraken"
+)
+
+func Test_LoadDummy(t *testing.T) {
+	type TestCase struct {
+		File     string
+		Market   string
+		Expected map[string]float64
+		Error    bool
+		Number   int
+	}
+
+	currencies := []string{"btc", "usd"}
+	cases := []TestCase{
+		{File: `{"default": 0, "markets": {"kraken": {"BTC": 1.5, "usd": 20000}}}`, Market: "KRAKEN", Expected: map[string]float64{"btc": 1.5, "usd": 20000}, Number: 1},
+		{File: `{"default": 0, "markets": {"kraken": {"BTC": 1.5}}}`, Market: "KRAKEN", Expected: map[string]float64{"btc": 1.5, "usd": 0}, Number: 2},
+		{File: `{"default": 0, "markets": {"kraken": {"BTC": 1.5}}}`, Market: "BITFINEX", Expected: map[string]float64{"btc": 0, "usd": 0}, Number: 3},
+		// Without the default, the markets not configured receive the default balance
+		{File: `{"markets": {"KRAKEN": {"btc": 2}}}`, Market: "OKCOIN", Expected: map[string]float64{"btc": DEFAULT_BALANCE, "usd": DEFAULT_BALANCE}, Number: 4},
+		{File: `{}`, Market: "KRAKEN", Expected: map[string]float64{"btc": DEFAULT_BALANCE, "usd": DEFAULT_BALANCE}, Number: 5},
+		{File: `{"markets": []}`, Error: true, Number: 6},
+	}
+
+	dir, err := ioutil.TempDir("", "balances")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "balances.json")
+	for _, c := range cases {
+		if err = ioutil.WriteFile(file, []byte(c.File), 0644); err != nil {
+			t.Fatal(err)
+		}
+		dummy, err := LoadDummy(file)
+		if (err != nil) != c.Error {
+			t.Errorf("Received %v, expected error %v [test n. %d]", err, c.Error, c.Number)
+		}
+		if c.Error {
+			continue
+		}
+		if balances, _ := dummy.Balances(context.Background(), c.Market, currencies); !reflect.DeepEqual(balances, c.Expected) {
+			t.Errorf("Received %v, expected %v [test n. %d]", balances, c.Expected, c.Number)
+		}
+	}
+	if _, err = LoadDummy(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+// failingProvider return the balances only for the given market
+type failingProvider struct {
+	Market string
+}
+
+func (p failingProvider) Balances(ctx context.Context, marketName string, currencies []string) (map[string]float64, error) {
+	if marketName != p.Market {
+		return nil, errors.New("EAPI:Invalid key")
+	}
+	return NewDummy().Balances(ctx, marketName, currencies)
+}
+
+func Test_InitWallets(t *testing.T) {
+	marketsData := []market.Market{{MarketName: "KRAKEN"}, {MarketName: "BITFINEX"}}
+	if err := InitWallets(context.Background(), failingProvider{Market: "KRAKEN"}, marketsData, []string{"btc", "usd"}); err == nil {
+		t.Error("Expected an error for the market without balances")
+	}
+	expected := []market.Wallet{
+		{MarketName: "KRAKEN", Coins: map[string]float64{"btc": DEFAULT_BALANCE, "usd": DEFAULT_BALANCE}},
+		{MarketName: "BITFINEX", Coins: map[string]float64{}},
+	}
+	for i := range marketsData {
+		if !reflect.DeepEqual(marketsData[i].Wallet, expected[i]) {
+			t.Errorf("Received %v, expected %v [test n. %d]", marketsData[i].Wallet, expected[i], i+1)
+		}
+	}
+}
+
+func Test_LiveBalances(t *testing.T) {
+	server := fakeserver.New()
+	defer server.Close()
+	server.Handle("/0/private/Balance", fakeserver.Response{StatusCode: 200, Body: []byte(`{"error":[],"result":{"XXBT":"1.5","ZUSD":"100.25","XETH":"0"}}`)})
+
+	exchange, _ := markets.Get("KRAKEN")
+	k := exchange.(*kraken.Kraken)
+	k.Init()
+	k.SetBaseURL(server.URL)
+	k.SetHTTPClient(server.Client())
+	k.SetCredentials(markets.Credentials{Key: "key", Secret: "c2VjcmV0"})
+
+	balances, err := Live{}.Balances(context.Background(), "KRAKEN", []string{"btc", "usd", "ltc"})
+	expected := map[string]float64{"btc": 1.5, "usd": 100.25, "ltc": 0}
+	if err != nil || !reflect.DeepEqual(balances, expected) {
+		t.Errorf("Received %v (%v), expected %v", balances, err, expected)
+	}
+	if _, err = (Live{}).Balances(context.Background(), "UNKNOWN", []string{"btc"}); err == nil {
+		t.Error("Expected an error for a market not registered")
+	}
+}
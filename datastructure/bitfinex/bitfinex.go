@@ -1,6 +1,8 @@
 // This package will contains all the datastructure necessary for deal with Bitfinex market, internally
 package bitfinex
 
+import "time"
+
 type BitfinexPairsList struct {
 	Pairs []string `json:"pairs"`
 }
@@ -17,12 +19,15 @@ type BitfinexPair struct {
 }
 
 type BitfinexOrder struct {
-	Price  string `json:"price"`
-	Volume string `json:"amount"`
+	Price     string `json:"price"`
+	Volume    string `json:"amount"`
+	Timestamp string `json:"timestamp"`
 }
 
 type BitfinexOrderBook struct {
 	Pair string          `json:"pair"`
 	Bids []BitfinexOrder `json:"bids"`
 	Asks []BitfinexOrder `json:"asks"`
+	// Received is the local time when the order book was received
+	Received time.Time `json:"received"`
 }
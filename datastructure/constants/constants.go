@@ -7,3 +7,6 @@ const GEMINI_PATH string = `./data/GEMINI/`
 const KRAKEN_PATH string = `./data/KRAKEN/`
 
 const TIMEOUT_REQ = 2
+
+// DEFAULT_DEPTH is the number of levels of the order book requested to the markets
+const DEFAULT_DEPTH = 10
@@ -1,5 +1,7 @@
 package gemini
 
+import "time"
+
 type GeminiPairsList struct {
 	Pairs []string `json:"pairs"`
 }
@@ -14,6 +16,8 @@ type GeminiOrderBook struct {
 	Pair string        `json:"pair"`
 	Bids []GeminiOrder `json:"bids"`
 	Asks []GeminiOrder `json:"asks"`
+	// Received is the local time when the order book was received
+	Received time.Time `json:"received"`
 }
 
 type GeminiPairs struct {
@@ -24,3 +28,32 @@ type GeminiPairs struct {
 	MinOrderIncrement float32 `json:"min_order_increment"`
 	MinPriceIncrement float32 `json:"min_price_increment"`
 }
+
+// GeminiOrderStatus is the state of an order returned by the private API
+type GeminiOrderStatus struct {
+	OrderID           string `json:"order_id"`
+	Symbol            string `json:"symbol"`
+	Side              string `json:"side"`
+	Price             string `json:"price"`
+	AvgExecutionPrice string `json:"avg_execution_price"`
+	IsLive            bool   `json:"is_live"`
+	IsCancelled       bool   `json:"is_cancelled"`
+	ExecutedAmount    string `json:"executed_amount"`
+	RemainingAmount   string `json:"remaining_amount"`
+	OriginalAmount    string `json:"original_amount"`
+}
+
+// GeminiBalance is the balance of a currency
+type GeminiBalance struct {
+	Type      string `json:"type"`
+	Currency  string `json:"currency"`
+	Amount    string `json:"amount"`
+	Available string `json:"available"`
+}
+
+// GeminiError is the response of the private API in case of error
+type GeminiError struct {
+	Result  string `json:"result"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
@@ -7,6 +7,7 @@ import (
 
 type KrakenPair struct {
 	Altname           string      `json:"altname"`
+	Wsname            string      `json:"wsname"`
 	Base              string      `json:"base"`
 	Quote             string      `json:"quote"`
 	PairDecimals      int         `json:"pair_decimals"`
@@ -21,6 +22,8 @@ type KrakenOrderBook struct {
 	Pair string        `json:"pair"`
 	Asks []KrakenOrder `json:"asks"`
 	Bids []KrakenOrder `json:"bids"`
+	// Received is the local time when the order book was received
+	Received time.Time `json:"received"`
 }
 
 type KrakenOrder struct {
@@ -72,3 +75,35 @@ func (b *KrakenOrder) UnmarshalJSON(data []byte) error {
 	b.Timestamp = time.Unix(t, 0)
 	return nil
 }
+
+// PrivateResponse is the envelope of the responses of the private API
+type PrivateResponse struct {
+	Error  []string        `json:"error"`
+	Result json.RawMessage `json:"result"`
+}
+
+// AddOrderResult contains the ids of the orders placed
+type AddOrderResult struct {
+	Txid []string `json:"txid"`
+}
+
+// OrderInfo contains the state of an order returned by QueryOrders
+type OrderInfo struct {
+	// Status is pending, open, closed, canceled or expired
+	Status string `json:"status"`
+	Vol    string `json:"vol"`
+	// VolExec is the volume executed, Price the average price of the executions
+	VolExec string `json:"vol_exec"`
+	Price   string `json:"price"`
+	Descr   struct {
+		Pair      string `json:"pair"`
+		Type      string `json:"type"`
+		Ordertype string `json:"ordertype"`
+		Price     string `json:"price"`
+	} `json:"descr"`
+}
+
+// CancelOrderResult contains the number of orders canceled
+type CancelOrderResult struct {
+	Count int `json:"count"`
+}
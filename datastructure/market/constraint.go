@@ -0,0 +1,100 @@
+package market
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// epsilon is used for avoid that the float error move a value to the previous/next increment
+const epsilon = 1e-9
+
+// OrderConstraint contains the rules that an order of a pair have to respect in order to be accepted by the market.
+// A zero value means that the market does not have the related rule
+type OrderConstraint struct {
+	// MinVolume is the minimum amount of base currency of an order
+	MinVolume float64 `json:"min_volume"`
+	// MaxVolume is the maximum amount of base currency of an order
+	MaxVolume float64 `json:"max_volume"`
+	// VolumeIncrement is the lot size, the volume have to be a multiple of this value
+	VolumeIncrement float64 `json:"volume_increment"`
+	// PriceIncrement is the tick size, the price have to be a multiple of this value
+	PriceIncrement float64 `json:"price_increment"`
+	// PricePrecision is the maximum number of significant digits of the price
+	PricePrecision int `json:"price_precision"`
+}
+
+// RoundVolume is delegated to round down the volume to the lot size
+func (c OrderConstraint) RoundVolume(volume float64) float64 {
+	return floorIncrement(volume, c.VolumeIncrement)
+}
+
+// RoundPrice is delegated to round the price to the tick size and to the significant digits. The buy price is rounded
+// up and the sell price is rounded down, so the rounded order is never better than the original one
+func (c OrderConstraint) RoundPrice(price float64, buy bool) float64 {
+	if buy {
+		return ceilSignificant(ceilIncrement(price, c.PriceIncrement), c.PricePrecision)
+	}
+	return floorSignificant(floorIncrement(price, c.PriceIncrement), c.PricePrecision)
+}
+
+// floorIncrement is delegated to round down the value to a multiple of the given increment
+func floorIncrement(value, increment float64) float64 {
+	if increment <= 0 {
+		return value
+	}
+	return multiple(math.Floor(value/increment+epsilon), increment)
+}
+
+// ceilIncrement is delegated to round up the value to a multiple of the given increment
+func ceilIncrement(value, increment float64) float64 {
+	if increment <= 0 {
+		return value
+	}
+	return multiple(math.Ceil(value/increment-epsilon), increment)
+}
+
+// multiple return the given multiple of the increment, rounded to the decimals of the increment in order to remove
+// the float error of the product (3 * 0.1 = 0.30000000000000004)
+func multiple(n, increment float64) float64 {
+	formatted := strconv.FormatFloat(increment, 'f', -1, 64)
+	var decimals int
+	if i := strings.IndexByte(formatted, '.'); i >= 0 {
+		decimals = len(formatted) - i - 1
+	}
+	scale := math.Pow10(decimals)
+	return math.Round(n*increment*scale) / scale
+}
+
+// floorSignificant is delegated to round down the value to the given number of significant digits
+func floorSignificant(value float64, digits int) float64 {
+	if digits <= 0 || value <= 0 {
+		return value
+	}
+	exponent := significantExponent(value, digits)
+	return unscale(math.Floor(value*math.Pow10(exponent)+epsilon), exponent)
+}
+
+// ceilSignificant is delegated to round up the value to the given number of significant digits
+func ceilSignificant(value float64, digits int) float64 {
+	if digits <= 0 || value <= 0 {
+		return value
+	}
+	exponent := significantExponent(value, digits)
+	return unscale(math.Ceil(value*math.Pow10(exponent)-epsilon), exponent)
+}
+
+// significantExponent return the power of 10 that move the given number of significant digits before the decimal
+// point
+func significantExponent(value float64, digits int) int {
+	return digits - 1 - int(math.Floor(math.Log10(value)))
+}
+
+// unscale is delegated to divide the value by the given power of 10. The negative powers are not exact, so the value
+// is multiplied by the opposite one
+func unscale(value float64, exponent int) float64 {
+	if exponent < 0 {
+		return value * math.Pow10(-exponent)
+	}
+	return value / math.Pow10(exponent)
+}
@@ -1,5 +1,7 @@
 package market
 
+import "time"
+
 type Market struct {
 	// Name of the market
 	MarketName string `json:"market_name"`
@@ -8,7 +10,25 @@ type Market struct {
 	Bids     map[string][]MarketOrder `json:"bids"`
 	MakerFee float64                  `json:"maker_fee"`
 	TakerFee float64                  `json:"taker_fee"`
-	Wallet   Wallet
+	// Fees contains the fee schedule of the market, used for calculate the fee of the orders
+	Fees MarketFee `json:"fees"`
+	// Volume30d is the volume traded in the last 30 days, used for select the fee tier
+	Volume30d float64 `json:"volume_30d"`
+	// Constraints contains the standard pair as a key and the order rules (lot/tick size, min/max order) as value
+	Constraints map[string]OrderConstraint `json:"constraints"`
+	// Symbols contains the standard pair as a key and the currencies of the pair as value
+	Symbols map[string]Symbol `json:"symbols"`
+	// Times contains the coin pair as a key and the times of the order book as value
+	Times  map[string]BookTime `json:"times"`
+	Wallet Wallet
+}
+
+// BookTime contains the times of the order book of a pair
+type BookTime struct {
+	// Exchange is the time of the order book sent by the market, zero if the market does not send it
+	Exchange time.Time `json:"exchange"`
+	// Received is the local time when the order book was received
+	Received time.Time `json:"received"`
 }
 
 type MarketOrder struct {
@@ -17,12 +37,22 @@ type MarketOrder struct {
 	MinVolume float64 `json:"min_volume"`
 }
 
+// FeeTier contains the maker and taker fee applied starting from the given 30 days volume
+type FeeTier struct {
+	Volume float64 `json:"volume"`
+	Maker  float64 `json:"maker"`
+	Taker  float64 `json:"taker"`
+}
+
 // MarketFee struct will save the type of the fee for every pairs.
 // If IsPercent is true, than the fee will be calculated as a percent.
-// In other case, we have to subtract the value cause is the pure fee
+// In other case, we have to subtract the value cause is the pure fee.
+// Tiers contains the default schedule of the market, sorted by volume. Pairs contains the standard pair as a key
+// and the schedule that override the default one for the given pair
 type MarketFee struct {
-	IsPercent bool               `json:"is_percent"`
-	Value     map[string]float64 `json:"value"`
+	IsPercent bool                 `json:"is_percent"`
+	Tiers     []FeeTier            `json:"tiers"`
+	Pairs     map[string][]FeeTier `json:"pairs"`
 }
 
 // Wallet is delegated to save the coins related to the market
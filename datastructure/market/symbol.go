@@ -0,0 +1,25 @@
+package market
+
+import "strings"
+
+// Symbol rappresent the two currencies exchanged in a pair, using the lowercase tickers.
+// The Base is the currency bought/sold, the Quote is the currency used for pay/receive the Base
+type Symbol struct {
+	Base  string `json:"base"`
+	Quote string `json:"quote"`
+}
+
+// NewSymbol is delegated to initialize a new symbol with the given currencies
+func NewSymbol(base, quote string) Symbol {
+	return Symbol{Base: strings.ToLower(base), Quote: strings.ToLower(quote)}
+}
+
+// String return the standard pair used as key across all the markets (e.g. `btcusd`)
+func (s Symbol) String() string {
+	return s.Base + s.Quote
+}
+
+// IsValid is delegated to verify that both the currencies are initialized
+func (s Symbol) IsValid() bool {
+	return s.Base != "" && s.Quote != ""
+}
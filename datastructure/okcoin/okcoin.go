@@ -22,4 +22,42 @@ type OkCoinOrderBook struct {
 	Asks      [][]string `json:"asks"`
 	Bids      [][]string `json:"bids"`
 	Timestamp time.Time  `json:"timestamp"`
+	// Received is the local time when the order book was received
+	Received time.Time `json:"received"`
+}
+
+// OkCoinOrderResult is the response of the placement and of the cancellation of an order
+type OkCoinOrderResult struct {
+	OrderID      string `json:"order_id"`
+	ClientOid    string `json:"client_oid"`
+	Result       bool   `json:"result"`
+	ErrorCode    string `json:"error_code"`
+	ErrorMessage string `json:"error_message"`
+}
+
+// OkCoinOrderStatus is the state of an order
+type OkCoinOrderStatus struct {
+	OrderID      string `json:"order_id"`
+	InstrumentID string `json:"instrument_id"`
+	Side         string `json:"side"`
+	Price        string `json:"price"`
+	Size         string `json:"size"`
+	FilledSize   string `json:"filled_size"`
+	PriceAvg     string `json:"price_avg"`
+	// State is -2 failed, -1 canceled, 0 open, 1 partially filled, 2 filled, 3 submitting, 4 canceling
+	State string `json:"state"`
+}
+
+// OkCoinAccount is the balance of a currency in the spot account
+type OkCoinAccount struct {
+	Currency  string `json:"currency"`
+	Balance   string `json:"balance"`
+	Hold      string `json:"hold"`
+	Available string `json:"available"`
+}
+
+// OkCoinError is the response of the private API in case of error
+type OkCoinError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
 }
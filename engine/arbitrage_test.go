@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"math"
+	"testing"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+)
+
+var testSymbol = market.NewSymbol("btc", "usd")
+
+// initMarket is delegated to initialize a synthetic market with the given book for the test symbol
+func initMarket(name string, asks, bids []market.MarketOrder, fee float64) market.Market {
+	pair := testSymbol.String()
+	return market.Market{
+		MarketName: name,
+		Asks:       map[string][]market.MarketOrder{pair: asks},
+		Bids:       map[string][]market.MarketOrder{pair: bids},
+		TakerFee:   fee,
+		Wallet:     market.Wallet{MarketName: name, Coins: map[string]float64{"btc": 100, "usd": 100000}},
+	}
+}
+
+func Test_FindOpportunities(t *testing.T) {
+	type TestCase struct {
+		Markets    []market.Market
+		Found      bool
+		MarketBuy  string
+		MarketSell string
+		BuyPrice   float64
+		SellPrice  float64
+		Volume     float64
+		Number     int
+	}
+
+	cases := []TestCase{
+		// Lowest ask on A, highest bid on B
+		{Markets: []market.Market{
+			initMarket("A", []market.MarketOrder{{Price: 100, Volume: 1}}, []market.MarketOrder{{Price: 99, Volume: 1}}, 0),
+			initMarket("B", []market.MarketOrder{{Price: 106, Volume: 1}}, []market.MarketOrder{{Price: 105, Volume: 2}}, 0)},
+			Found: true, MarketBuy: "A", MarketSell: "B", BuyPrice: 100, SellPrice: 105, Volume: 1, Number: 1},
+		// Same books in the opposite order
+		{Markets: []market.Market{
+			initMarket("B", []market.MarketOrder{{Price: 106, Volume: 1}}, []market.MarketOrder{{Price: 105, Volume: 2}}, 0),
+			initMarket("A", []market.MarketOrder{{Price: 100, Volume: 1}}, []market.MarketOrder{{Price: 99, Volume: 1}}, 0)},
+			Found: true, MarketBuy: "A", MarketSell: "B", BuyPrice: 100, SellPrice: 105, Volume: 1, Number: 2},
+		// No cross between the books: the best bid (100.5 on B) is lower than the best ask (101 on A)
+		{Markets: []market.Market{
+			initMarket("A", []market.MarketOrder{{Price: 101, Volume: 1}}, []market.MarketOrder{{Price: 100, Volume: 1}}, 0),
+			initMarket("B", []market.MarketOrder{{Price: 102, Volume: 1}}, []market.MarketOrder{{Price: 100.5, Volume: 1}}, 0)},
+			Found: false, Number: 3},
+		// Three markets, lowest ask on C and highest bid on A
+		{Markets: []market.Market{
+			initMarket("A", []market.MarketOrder{{Price: 112, Volume: 1}}, []market.MarketOrder{{Price: 110, Volume: 0.5}}, 0.1),
+			initMarket("B", []market.MarketOrder{{Price: 105, Volume: 1}}, []market.MarketOrder{{Price: 104, Volume: 1}}, 0.1),
+			initMarket("C", []market.MarketOrder{{Price: 101, Volume: 3}}, []market.MarketOrder{{Price: 100, Volume: 1}}, 0.1)},
+			Found: true, MarketBuy: "C", MarketSell: "A", BuyPrice: 101, SellPrice: 110, Volume: 0.5, Number: 4},
+		// Fees remove the profit
+		{Markets: []market.Market{
+			initMarket("A", []market.MarketOrder{{Price: 100, Volume: 1}}, []market.MarketOrder{{Price: 99, Volume: 1}}, 0.26),
+			initMarket("B", []market.MarketOrder{{Price: 101, Volume: 1}}, []market.MarketOrder{{Price: 100.2, Volume: 1}}, 0.26)},
+			Found: false, Number: 5},
+		// Empty book on one market
+		{Markets: []market.Market{
+			initMarket("A", nil, nil, 0),
+			initMarket("B", []market.MarketOrder{{Price: 101, Volume: 1}}, []market.MarketOrder{{Price: 100, Volume: 1}}, 0)},
+			Found: false, Number: 6},
+	}
+
+	for _, c := range cases {
+		opportunities := findOpportunities(testSymbol, c.Markets)
+		found := len(opportunities) > 0
+		if found != c.Found {
+			t.Errorf("Received %v, expected %v [test n. %d]", found, c.Found, c.Number)
+			continue
+		}
+		if !found {
+			continue
+		}
+		o := opportunities[0]
+		buy, sell := o.buyIndex, o.sellIndex
+		if o.MarketBuy != c.MarketBuy || o.MarketSell != c.MarketSell {
+			t.Errorf("Received buy %s sell %s, expected buy %s sell %s [test n. %d]", o.MarketBuy, o.MarketSell, c.MarketBuy, c.MarketSell, c.Number)
+		}
+		if c.Markets[buy].MarketName != o.MarketBuy || c.Markets[sell].MarketName != o.MarketSell {
+			t.Errorf("Index of the markets does not match the opportunity [test n. %d]", c.Number)
+		}
+		if o.BuyPrice != c.BuyPrice || o.SellPrice != c.SellPrice || o.Volume != c.Volume {
+			t.Errorf("Received %+v, expected buy price %f sell price %f volume %f [test n. %d]", o, c.BuyPrice, c.SellPrice, c.Volume, c.Number)
+		}
+		if o.Earning <= 0 {
+			t.Errorf("Received a not positive earning %f [test n. %d]", o.Earning, c.Number)
+		}
+
+		// The earning reported have to be the same applied to the wallets
+		buyWallet := copyCoins(c.Markets[buy].Wallet.Coins)
+		sellWallet := copyCoins(c.Markets[sell].Wallet.Coins)
+		if err := executeOpportunity(&c.Markets[buy], &c.Markets[sell], &o, testSymbol); err != nil || math.Abs(o.Realized-o.Earning) > 1e-9 {
+			t.Errorf("Received %v realized %f, expected earning %f [test n. %d]", err, o.Realized, o.Earning, c.Number)
+		}
+		quoteDelta := c.Markets[buy].Wallet.Coins["usd"] - buyWallet["usd"] + c.Markets[sell].Wallet.Coins["usd"] - sellWallet["usd"]
+		baseDelta := c.Markets[buy].Wallet.Coins["btc"] - buyWallet["btc"] + c.Markets[sell].Wallet.Coins["btc"] - sellWallet["btc"]
+		if math.Abs(quoteDelta-o.Earning) > 1e-9 {
+			t.Errorf("Wallet changed by %f, earning reported %f [test n. %d]", quoteDelta, o.Earning, c.Number)
+		}
+		if math.Abs(baseDelta) > 1e-9 {
+			t.Errorf("Base currency changed by %f [test n. %d]", baseDelta, c.Number)
+		}
+	}
+}
+
+func Test_FindOpportunitiesAllPairs(t *testing.T) {
+	type TestCase struct {
+		MarketBuy  string
+		MarketSell string
+		Earning    float64
+		Number     int
+	}
+
+	markets := []market.Market{
+		initMarket("A", []market.MarketOrder{{Price: 103, Volume: 1}}, []market.MarketOrder{{Price: 102, Volume: 1}}, 0),
+		initMarket("B", []market.MarketOrder{{Price: 100, Volume: 1}}, []market.MarketOrder{{Price: 99, Volume: 1}}, 0),
+		initMarket("C", []market.MarketOrder{{Price: 108, Volume: 1}}, []market.MarketOrder{{Price: 107, Volume: 1}}, 0),
+		initMarket("D", []market.MarketOrder{{Price: 101, Volume: 1}}, []market.MarketOrder{{Price: 104, Volume: 1}}, 0),
+	}
+	// A running min/max would evaluate only B -> C. Every buy lower than a bid of another market is reported.
+	// Opportunities with the same earning keep the evaluation order
+	cases := []TestCase{
+		{MarketBuy: "B", MarketSell: "C", Earning: 7, Number: 1},
+		{MarketBuy: "D", MarketSell: "C", Earning: 6, Number: 2},
+		{MarketBuy: "A", MarketSell: "C", Earning: 4, Number: 3},
+		{MarketBuy: "B", MarketSell: "D", Earning: 4, Number: 4},
+		{MarketBuy: "B", MarketSell: "A", Earning: 2, Number: 5},
+		{MarketBuy: "A", MarketSell: "D", Earning: 1, Number: 6},
+		{MarketBuy: "D", MarketSell: "A", Earning: 1, Number: 7},
+	}
+
+	opportunities := findOpportunities(testSymbol, markets)
+	if len(opportunities) != len(cases) {
+		t.Fatalf("Received %d opportunities, expected %d: %+v", len(opportunities), len(cases), opportunities)
+	}
+	for i, c := range cases {
+		o := opportunities[i]
+		if o.MarketBuy != c.MarketBuy || o.MarketSell != c.MarketSell || math.Abs(o.Earning-c.Earning) > 1e-9 {
+			t.Errorf("Received %s -> %s (%f), expected %s -> %s (%f) [test n. %d]", o.MarketBuy, o.MarketSell, o.Earning, c.MarketBuy, c.MarketSell, c.Earning, c.Number)
+		}
+		if markets[o.buyIndex].MarketName != o.MarketBuy || markets[o.sellIndex].MarketName != o.MarketSell {
+			t.Errorf("Index of the markets does not match the opportunity [test n. %d]", c.Number)
+		}
+	}
+}
+
+func copyCoins(coins map[string]float64) map[string]float64 {
+	var c = make(map[string]float64, len(coins))
+	for key, value := range coins {
+		c[key] = value
+	}
+	return c
+}
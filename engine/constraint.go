@@ -0,0 +1,33 @@
+package engine
+
+import (
+	"errors"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+)
+
+// epsilon is used for avoid that the float error move a value to the previous/next increment
+const epsilon = 1e-9
+
+// OrderValidator is delegated to adapt the orders of an arbitrage to the rules of the buy and the sell market
+type OrderValidator struct {
+	Buy  market.OrderConstraint
+	Sell market.OrderConstraint
+}
+
+// Validate is delegated to round the given volume and prices to the increments of the markets.
+// The volume is rounded down to the lot size of both the markets, the buy price is rounded up and the sell price is
+// rounded down, so the rounded orders are never better than the original one.
+// An error is returned if the rounded volume is lower than the minimum order or greater than the maximum order
+func (v OrderValidator) Validate(volume, buyPrice, sellPrice float64) (float64, float64, float64, error) {
+	volume = v.Sell.RoundVolume(v.Buy.RoundVolume(volume))
+	if volume <= 0 || volume < v.Buy.MinVolume || volume < v.Sell.MinVolume {
+		return 0, 0, 0, errors.New("VOLUME_UNDER_MIN")
+	}
+	if (v.Buy.MaxVolume > 0 && volume > v.Buy.MaxVolume) || (v.Sell.MaxVolume > 0 && volume > v.Sell.MaxVolume) {
+		return 0, 0, 0, errors.New("VOLUME_OVER_MAX")
+	}
+	buyPrice = v.Buy.RoundPrice(buyPrice, true)
+	sellPrice = v.Sell.RoundPrice(sellPrice, false)
+	return volume, buyPrice, sellPrice, nil
+}
@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"math"
+	"testing"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+)
+
+func Test_OrderValidator(t *testing.T) {
+	type TestCase struct {
+		Validator OrderValidator
+		Volume    float64
+		BuyPrice  float64
+		SellPrice float64
+		Expected  []float64
+		Error     bool
+		Number    int
+	}
+
+	cases := []TestCase{
+		// No rules
+		{Validator: OrderValidator{}, Volume: 1.23456, BuyPrice: 100.123, SellPrice: 101.987,
+			Expected: []float64{1.23456, 100.123, 101.987}, Number: 1},
+		// Lot and tick size, the buy price is rounded up and the sell price is rounded down
+		{Validator: OrderValidator{Buy: market.OrderConstraint{VolumeIncrement: 0.01, PriceIncrement: 0.1}, Sell: market.OrderConstraint{VolumeIncrement: 0.001, PriceIncrement: 0.01}},
+			Volume: 1.23456, BuyPrice: 100.123, SellPrice: 101.987, Expected: []float64{1.23, 100.2, 101.98}, Number: 2},
+		// Value already rounded
+		{Validator: OrderValidator{Buy: market.OrderConstraint{VolumeIncrement: 0.1, PriceIncrement: 0.01}, Sell: market.OrderConstraint{VolumeIncrement: 0.1, PriceIncrement: 0.01}},
+			Volume: 0.3, BuyPrice: 100.01, SellPrice: 100.03, Expected: []float64{0.3, 100.01, 100.03}, Number: 3},
+		// Significant digits
+		{Validator: OrderValidator{Buy: market.OrderConstraint{PricePrecision: 5}, Sell: market.OrderConstraint{PricePrecision: 5}},
+			Volume: 1, BuyPrice: 7123.456, SellPrice: 7150.987, Expected: []float64{1, 7123.5, 7150.9}, Number: 4},
+		// Under the min of the sell market
+		{Validator: OrderValidator{Buy: market.OrderConstraint{MinVolume: 0.001}, Sell: market.OrderConstraint{MinVolume: 0.01}},
+			Volume: 0.005, BuyPrice: 100, SellPrice: 101, Error: true, Number: 5},
+		// Under the min after the rounding
+		{Validator: OrderValidator{Buy: market.OrderConstraint{MinVolume: 0.1, VolumeIncrement: 0.1}},
+			Volume: 0.0999, BuyPrice: 100, SellPrice: 101, Error: true, Number: 6},
+		// Over the max of the buy market
+		{Validator: OrderValidator{Buy: market.OrderConstraint{MaxVolume: 2}},
+			Volume: 2.5, BuyPrice: 100, SellPrice: 101, Error: true, Number: 7},
+	}
+
+	for _, c := range cases {
+		volume, buyPrice, sellPrice, err := c.Validator.Validate(c.Volume, c.BuyPrice, c.SellPrice)
+		if (err != nil) != c.Error {
+			t.Errorf("Received error %v, expected error %v [test n. %d]", err, c.Error, c.Number)
+			continue
+		}
+		if c.Error {
+			continue
+		}
+		received := []float64{volume, buyPrice, sellPrice}
+		for i := range received {
+			if math.Abs(received[i]-c.Expected[i]) > 1e-9 {
+				t.Errorf("Received %v, expected %v [test n. %d]", received, c.Expected, c.Number)
+				break
+			}
+		}
+	}
+}
+
+func Test_FindOpportunitiesConstraints(t *testing.T) {
+	type TestCase struct {
+		Buy    market.OrderConstraint
+		Sell   market.OrderConstraint
+		Found  bool
+		Volume float64
+		Number int
+	}
+
+	cases := []TestCase{
+		{Found: true, Volume: 0.55, Number: 1},
+		// The volume is rounded to the lot size
+		{Buy: market.OrderConstraint{VolumeIncrement: 0.1}, Found: true, Volume: 0.5, Number: 2},
+		// Under the min order
+		{Sell: market.OrderConstraint{MinVolume: 1}, Found: false, Number: 3},
+		// Over the max order
+		{Buy: market.OrderConstraint{MaxVolume: 0.5}, Found: false, Number: 4},
+		// The rounding of the prices remove the profit
+		{Buy: market.OrderConstraint{PriceIncrement: 1}, Sell: market.OrderConstraint{PriceIncrement: 1}, Found: false, Number: 5},
+	}
+
+	for _, c := range cases {
+		buy := initMarket("A", []market.MarketOrder{{Price: 100.2, Volume: 0.55}}, nil, 0)
+		sell := initMarket("B", nil, []market.MarketOrder{{Price: 100.8, Volume: 1}}, 0)
+		buy.Constraints = map[string]market.OrderConstraint{testSymbol.String(): c.Buy}
+		sell.Constraints = map[string]market.OrderConstraint{testSymbol.String(): c.Sell}
+		opportunities := findOpportunities(testSymbol, []market.Market{buy, sell})
+		if found := len(opportunities) > 0; found != c.Found {
+			t.Errorf("Received %v, expected %v [test n. %d]", found, c.Found, c.Number)
+			continue
+		}
+		if c.Found && math.Abs(opportunities[0].Volume-c.Volume) > 1e-9 {
+			t.Errorf("Received %v, expected %v [test n. %d]", opportunities[0].Volume, c.Volume, c.Number)
+		}
+	}
+}
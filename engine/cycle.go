@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"math"
+	"time"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/fees"
+)
+
+// edge is the conversion of a currency into another one, executed on a market by a taker order on a pair, or the
+// transfer of a currency from a market to another one
+type edge struct {
+	Market string
+	// ToMarket is the destination market of a transfer, empty for the orders
+	ToMarket string
+	// Pair is the standard pair of the order
+	Pair string
+	From string
+	To   string
+	// Buy is true if the base currency is bought (the asks are lifted), false if it is sold (the bids are hit)
+	Buy bool
+	// levels are the orders consumed, from the best price
+	levels []market.MarketOrder
+	// fee is the taker fee in percent
+	fee float64
+	// time is the time of the order book
+	time market.BookTime
+}
+
+// target return the market where the To currency is received
+func (e edge) target() string {
+	if e.ToMarket != "" {
+		return e.ToMarket
+	}
+	return e.Market
+}
+
+// rate return the amount of To currency received for a unit of From currency at the given level, after fees
+func (e edge) rate(level int) float64 {
+	price := e.levels[level].Price
+	if e.Buy {
+		return (1 - e.fee/100) / price
+	}
+	return price * (1 - e.fee/100)
+}
+
+// capacity return the amount of From currency that can be converted at the given level
+func (e edge) capacity(level int) float64 {
+	if e.Buy {
+		return e.levels[level].Volume * e.levels[level].Price
+	}
+	return e.levels[level].Volume
+}
+
+// marketEdges is delegated to create the conversions allowed by the order books of the given market: for every pair
+// the base can be sold for the quote (hitting the bids) and the quote can be used for buy the base (lifting the asks).
+// The order books are retrieved with the standard pair, as saved by GetMarketsData
+func marketEdges(m market.Market) []edge {
+	var edges []edge
+	for pair, symbol := range m.Symbols {
+		if !symbol.IsValid() {
+			continue
+		}
+		asks, bids := m.Asks[pair], m.Bids[pair]
+		fee := fees.PercentRate(m, pair, fees.Taker)
+		bookTime := m.Times[pair]
+		if len(bids) > 0 && bids[0].Price > 0 {
+			edges = append(edges, edge{Market: m.MarketName, Pair: pair, From: symbol.Base, To: symbol.Quote, levels: bids, fee: fee, time: bookTime})
+		}
+		if len(asks) > 0 && asks[0].Price > 0 {
+			edges = append(edges, edge{Market: m.MarketName, Pair: pair, From: symbol.Quote, To: symbol.Base, Buy: true, levels: asks, fee: fee, time: bookTime})
+		}
+	}
+	return edges
+}
+
+// cycleLeg is a leg of a cycle, the amounts are expressed in the From and To currencies
+type cycleLeg struct {
+	Market string `json:"market"`
+	// ToMarket is the destination market of a transfer
+	ToMarket string `json:"to_market,omitempty"`
+	Pair     string `json:"pair,omitempty"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	// Side is `buy` or `sell`, referred to the base currency of the pair, or `transfer`
+	Side      string  `json:"side"`
+	AmountIn  float64 `json:"amount_in"`
+	AmountOut float64 `json:"amount_out"`
+	// Levels is the number of levels consumed in the order book
+	Levels int `json:"levels"`
+	// BookTime is the time of the order book used for the leg
+	BookTime market.BookTime `json:"book_time"`
+}
+
+// cycleOpportunity is a sequence of conversions that start and end with the same currency, saved in the
+// opportunities log together with the two legs opportunities
+type cycleOpportunity struct {
+	Type string `json:"type"`
+	// Currency is the currency used for start the cycle, the amounts and the earning are expressed in it
+	Currency  string     `json:"currency"`
+	Legs      []cycleLeg `json:"legs"`
+	AmountIn  float64    `json:"amount_in"`
+	AmountOut float64    `json:"amount_out"`
+	Earning   float64    `json:"earning"`
+	// Return is the earning in percent of the amount used
+	Return float64 `json:"return"`
+	Time   int64   `json:"time"`
+	// Stale is true if the order books violate the staleness policy, saved only if the policy does not reject them
+	Stale bool `json:"stale"`
+}
+
+// walkCycle is delegated to find the amount that maximise the earning of the given cycle, walking level by level
+// the order books of the legs. The marginal return of the cycle is decreasing along the books, so the walk stop
+// at the first combination of levels that is not profitable. Return the opportunity, false if the cycle is not
+// profitable
+func walkCycle(kind string, edges []edge) (cycleOpportunity, bool) {
+	n := len(edges)
+	level := make([]int, n)
+	remaining := make([]float64, n)
+	legs := make([]cycleLeg, n)
+	for k := range edges {
+		remaining[k] = edges[k].capacity(0)
+		side := "sell"
+		switch {
+		case edges[k].ToMarket != "":
+			side = "transfer"
+		case edges[k].Buy:
+			side = "buy"
+		}
+		legs[k] = cycleLeg{Market: edges[k].Market, ToMarket: edges[k].ToMarket, Pair: edges[k].Pair, From: edges[k].From, To: edges[k].To, Side: side, BookTime: edges[k].time}
+	}
+	// scale contains the amount entering every leg for a unit entering the cycle
+	scale := make([]float64, n)
+
+walk:
+	for {
+		product := 1.0
+		for k := range edges {
+			scale[k] = product
+			product *= edges[k].rate(level[k])
+		}
+		if product <= 1+epsilon {
+			break
+		}
+		// The amount is limited by the level with the lowest capacity
+		amount := math.Inf(1)
+		bottleneck := 0
+		for k := range edges {
+			if a := remaining[k] / scale[k]; a < amount {
+				amount = a
+				bottleneck = k
+			}
+		}
+		for k := range edges {
+			in := amount * scale[k]
+			legs[k].AmountIn += in
+			legs[k].AmountOut += in * edges[k].rate(level[k])
+			legs[k].Levels = level[k] + 1
+			remaining[k] -= in
+		}
+		// The exhausted levels are consumed, the walk end with the order book of a leg
+		for k := range edges {
+			if k == bottleneck || remaining[k] <= epsilon {
+				level[k]++
+				if level[k] == len(edges[k].levels) {
+					break walk
+				}
+				remaining[k] = edges[k].capacity(level[k])
+			}
+		}
+	}
+
+	if legs[0].AmountIn <= 0 {
+		return cycleOpportunity{}, false
+	}
+	o := cycleOpportunity{Type: kind, Currency: edges[0].From, Legs: legs, AmountIn: legs[0].AmountIn, AmountOut: legs[n-1].AmountOut}
+	o.Earning = o.AmountOut - o.AmountIn
+	o.Return = o.Earning / o.AmountIn * 100
+	o.Time = time.Now().UnixNano()
+	return o, o.Earning > 0
+}
@@ -0,0 +1,71 @@
+package engine
+
+import "github.com/alessiosavi/GoArbitrage/datastructure/market"
+
+// depthResult contains the result of the walk of the order books
+type depthResult struct {
+	// Volume is the amount of coin that maximise the net profit
+	Volume float64
+	// BuyPrice is the volume weighted average price paid for buy the Volume
+	BuyPrice float64
+	// SellPrice is the volume weighted average price received for sell the Volume
+	SellPrice float64
+	// BuyLevels is the number of levels consumed in the buy order book
+	BuyLevels int
+	// SellLevels is the number of levels consumed in the sell order book
+	SellLevels int
+}
+
+// walkOrderBooks is delegated to walk level by level the given order books in order to find the volume that
+// maximise the net profit after fees. The buyOrders are the orders used for buy the coin (best price first),
+// the sellOrders are the orders used for sell the coin (best price first). The fees are expressed in percent.
+// The profit of every unit is decreasing along the books, so we can stop at the first level that is not profitable
+func walkOrderBooks(buyOrders, sellOrders []market.MarketOrder, buyFee, sellFee float64) depthResult {
+	var result depthResult
+	var buyTotal, sellTotal float64
+	var i, j int
+	var buyRemaining, sellRemaining float64
+
+	if len(buyOrders) > 0 {
+		buyRemaining = buyOrders[0].Volume
+	}
+	if len(sellOrders) > 0 {
+		sellRemaining = sellOrders[0].Volume
+	}
+
+	for i < len(buyOrders) && j < len(sellOrders) {
+		buyCost := buyOrders[i].Price + percent(buyOrders[i].Price, buyFee)
+		sellGain := sellOrders[j].Price - percent(sellOrders[j].Price, sellFee)
+		if sellGain <= buyCost {
+			break
+		}
+		volume := getMin(buyRemaining, sellRemaining)
+		result.Volume += volume
+		buyTotal += volume * buyOrders[i].Price
+		sellTotal += volume * sellOrders[j].Price
+		buyRemaining -= volume
+		sellRemaining -= volume
+		result.BuyLevels = i + 1
+		result.SellLevels = j + 1
+
+		// Move to the next level of the exhausted book
+		if buyRemaining <= 0 {
+			i++
+			if i < len(buyOrders) {
+				buyRemaining = buyOrders[i].Volume
+			}
+		}
+		if sellRemaining <= 0 {
+			j++
+			if j < len(sellOrders) {
+				sellRemaining = sellOrders[j].Volume
+			}
+		}
+	}
+
+	if result.Volume > 0 {
+		result.BuyPrice = buyTotal / result.Volume
+		result.SellPrice = sellTotal / result.Volume
+	}
+	return result
+}
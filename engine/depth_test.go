@@ -0,0 +1,54 @@
+package engine
+
+import (
+	"math"
+	"testing"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+)
+
+func Test_WalkOrderBooks(t *testing.T) {
+	type TestCase struct {
+		Buy      []market.MarketOrder
+		Sell     []market.MarketOrder
+		BuyFee   float64
+		SellFee  float64
+		Expected depthResult
+		Number   int
+	}
+
+	cases := []TestCase{
+		// Only the first level is profitable
+		{Buy: []market.MarketOrder{{Price: 100, Volume: 1}, {Price: 105, Volume: 1}},
+			Sell:     []market.MarketOrder{{Price: 102, Volume: 2}, {Price: 90, Volume: 1}},
+			Expected: depthResult{Volume: 1, BuyPrice: 100, SellPrice: 102, BuyLevels: 1, SellLevels: 1}, Number: 1},
+		// Two levels of buy against one level of sell
+		{Buy: []market.MarketOrder{{Price: 100, Volume: 1}, {Price: 101, Volume: 1}},
+			Sell:     []market.MarketOrder{{Price: 110, Volume: 3}},
+			Expected: depthResult{Volume: 2, BuyPrice: 100.5, SellPrice: 110, BuyLevels: 2, SellLevels: 1}, Number: 2},
+		// Fees remove the profit
+		{Buy: []market.MarketOrder{{Price: 100, Volume: 1}},
+			Sell:     []market.MarketOrder{{Price: 100.3, Volume: 1}},
+			BuyFee:   0.2,
+			SellFee:  0.2,
+			Expected: depthResult{}, Number: 3},
+		// Fees stop the walk at the second level
+		{Buy: []market.MarketOrder{{Price: 100, Volume: 1}, {Price: 100.5, Volume: 1}},
+			Sell:     []market.MarketOrder{{Price: 101, Volume: 1}, {Price: 100.9, Volume: 1}},
+			BuyFee:   0.2,
+			SellFee:  0.2,
+			Expected: depthResult{Volume: 1, BuyPrice: 100, SellPrice: 101, BuyLevels: 1, SellLevels: 1}, Number: 4},
+		// Empty book
+		{Buy: nil, Sell: []market.MarketOrder{{Price: 100, Volume: 1}}, Expected: depthResult{}, Number: 5},
+	}
+
+	for _, c := range cases {
+		result := walkOrderBooks(c.Buy, c.Sell, c.BuyFee, c.SellFee)
+		if math.Abs(result.Volume-c.Expected.Volume) > 1e-9 ||
+			math.Abs(result.BuyPrice-c.Expected.BuyPrice) > 1e-9 ||
+			math.Abs(result.SellPrice-c.Expected.SellPrice) > 1e-9 ||
+			result.BuyLevels != c.Expected.BuyLevels || result.SellLevels != c.Expected.SellLevels {
+			t.Errorf("Received %+v, expected %+v [test n. %d]", result, c.Expected, c.Number)
+		}
+	}
+}
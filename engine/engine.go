@@ -1,32 +1,71 @@
 package engine
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/alessiosavi/GoArbitrage/datastructure/market"
-	"github.com/alessiosavi/GoArbitrage/markets/bitfinex"
-	"github.com/alessiosavi/GoArbitrage/markets/gemini"
-	"github.com/alessiosavi/GoArbitrage/markets/kraken"
-	"github.com/alessiosavi/GoArbitrage/markets/okcoin"
+	"github.com/alessiosavi/GoArbitrage/fees"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"github.com/alessiosavi/GoArbitrage/rebalance"
+	"github.com/alessiosavi/GoArbitrage/simulator"
 	"go.uber.org/zap"
 )
 
+// OpportunitiesFile is the file where the opportunities found are appended
+var OpportunitiesFile = "data.json"
+
+// WalletsFile is the file where the wallets of the markets are saved when the arbitrage is stopped
+var WalletsFile = "wallets.json"
+
+// venues contains the simulated venue of every market, kept for the whole run so the ids and the history of the
+// executions persist between the scans. The mutex serialize the executions, that change the wallets of the markets
+var (
+	venues      = make(map[string]*simulator.Venue)
+	venuesMutex sync.Mutex
+)
+
+// Inventory is the rebalancer updated with the wallets once per tick by Rebalance, the pairs paused are not scanned.
+// Nil disable the rebalancing
+var Inventory *rebalance.Rebalancer
+
+// CROSS_EXCHANGE is the type of the opportunities that buy a pair on a market and sell it on another one
+const CROSS_EXCHANGE = "cross_exchange"
+
 type opportunity struct {
+	Type          string          `json:"type"`
 	MarketBuy     string          `json:"market_buy"`
 	MarketSell    string          `json:"market_sell"`
 	Pair          string          `json:"pair"`
 	BuyPrice      float64         `json:"buy_price"`
 	SellPrice     float64         `json:"sell_price"`
 	Volume        float64         `json:"volume"`
+	BuyTotal      float64         `json:"buy_total"`
+	SellTotal     float64         `json:"sell_total"`
+	BuyFee        float64         `json:"buy_fee"`
+	SellFee       float64         `json:"sell_fee"`
 	Earning       float64         `json:"earning"`
 	Time          int64           `json:"time"`
 	CurrentWallet []market.Wallet `json:"wallet"`
+	// BuyBookTime and SellBookTime are the times of the order books used for the legs
+	BuyBookTime  market.BookTime `json:"buy_book_time"`
+	SellBookTime market.BookTime `json:"sell_book_time"`
+	// Stale is true if the order books violate the staleness policy, saved only if the policy does not reject them
+	Stale bool `json:"stale"`
+	// Executions contains the orders executed by the simulated venues, Realized the earning of the fills
+	Executions []simulator.Execution `json:"executions"`
+	Realized   float64               `json:"realized"`
+	// index of the buy and sell market in the evaluated markets
+	buyIndex  int
+	sellIndex int
 }
 
 // GetCommonCoin : is delegated to retrieve the common pairs for the given markets
@@ -67,185 +106,183 @@ func GetCommonCoin(markets ...market.Market) []string {
 			commonPairs = append(commonPairs, key)
 		}
 	}
+	// Keep the pairs always in the same order
+	sort.Strings(commonPairs)
 	zap.S().Infof("Common pairs: %v", commonPairs)
 	return commonPairs
 }
 
-// Arbitrage is delegated to find the most relevant buy/sell opportunities for the given pair
-func Arbitrage(pair string, markets *[]market.Market) {
-	var err error
-	var wg sync.WaitGroup
-	// Execute HTTP request in parallel
-	start := time.Now()
-	for i := range *markets {
-		switch (*markets)[i].MarketName {
-		case "KRAKEN":
-			wg.Add(1)
-			go func(i int, wg *sync.WaitGroup) {
-				defer wg.Done()
-				var kraken kraken.Kraken
-				var w market.Wallet = (*markets)[i].Wallet
-				pair := kraken.ParsePair(pair)
-				var makerFee, takerFee float64
-				makerFee = (*markets)[i].MakerFee
-				takerFee = (*markets)[i].TakerFee
-				if kraken.GetOrderBook(pair) == nil {
-					(*markets)[i], err = kraken.GetMarketData(pair)
-					if err != nil {
-						log.Println("Unable to retrieve KRAKEN data ", err)
-						return
-					}
-					(*markets)[i].Wallet = w
-					(*markets)[i].MakerFee = makerFee
-					(*markets)[i].TakerFee = takerFee
-
-				}
-			}(i, &wg)
-		case "OKCOIN":
-			wg.Add(1)
-			go func(i int, wg *sync.WaitGroup) {
-				defer wg.Done()
-				var okcoin okcoin.OkCoin
-				var w market.Wallet = (*markets)[i].Wallet
-				var makerFee, takerFee float64
-				makerFee = (*markets)[i].MakerFee
-				takerFee = (*markets)[i].TakerFee
-				pair := okcoin.ParsePair(pair)
-				if okcoin.GetOrderBook(pair) == nil {
-					(*markets)[i], err = okcoin.GetMarketData(pair)
-					if err != nil {
-						log.Println("Unable to retrieve OKCOIN data ", err)
-						return
-					}
-					(*markets)[i].Wallet = w
-					(*markets)[i].MakerFee = makerFee
-					(*markets)[i].TakerFee = takerFee
-				}
-			}(i, &wg)
-		case "BITFINEX":
-			wg.Add(1)
-			go func(i int, wg *sync.WaitGroup) {
-				time.Sleep(time.Second * 2)
-				defer wg.Done()
-				var bitfinex bitfinex.Bitfinex
-				var w market.Wallet = (*markets)[i].Wallet
-				var makerFee, takerFee float64
-				makerFee = (*markets)[i].MakerFee
-				takerFee = (*markets)[i].TakerFee
-				if bitfinex.GetOrderBook(pair) == nil {
-					(*markets)[i], err = bitfinex.GetMarketData(pair)
-					if err != nil {
-						log.Println("Unable to retrieve BITFINEX data ", err)
-						return
-					}
-					(*markets)[i].Wallet = w
-					(*markets)[i].MakerFee = makerFee
-					(*markets)[i].TakerFee = takerFee
-				}
-			}(i, &wg)
-		case "GEMINI":
-			wg.Add(1)
-			go func(i int, wg *sync.WaitGroup) {
-				defer wg.Done()
-				var gemini gemini.Gemini
-				var w market.Wallet = (*markets)[i].Wallet
-				var makerFee, takerFee float64
-				makerFee = (*markets)[i].MakerFee
-				takerFee = (*markets)[i].TakerFee
-				if gemini.GetOrderBook(pair) == nil {
-					(*markets)[i], err = gemini.GetMarketData(pair)
-					if err != nil {
-						log.Println("Unable to retrieve GEMINI data: ", err)
-						return
-					}
-					(*markets)[i].Wallet = w
-					(*markets)[i].MakerFee = makerFee
-					(*markets)[i].TakerFee = takerFee
-				}
-			}(i, &wg)
+// GetCommonSymbols is delegated to retrieve the currencies of the pairs in common for the given markets
+func GetCommonSymbols(markets ...market.Market) []market.Symbol {
+	var symbols []market.Symbol
+	for _, pair := range GetCommonCoin(markets...) {
+		for i := range markets {
+			if symbol, ok := markets[i].Symbols[pair]; ok && symbol.IsValid() {
+				symbols = append(symbols, symbol)
+				break
+			}
 		}
 	}
-	wg.Wait()
+	return symbols
+}
+
+// Arbitrage is delegated to find the most relevant buy/sell opportunities for the given pair.
+// The context is the deadline of the scan: the markets that does not respond in time are not evaluated
+func Arbitrage(ctx context.Context, symbol market.Symbol, markets *[]market.Market) {
+	var pair string = symbol.String()
+	if Inventory != nil && Inventory.Paused(symbol) {
+		zap.S().Debugf("Pair [%s] paused, skipping the scan", pair)
+		return
+	}
+	// Execute HTTP request in parallel
+	start := time.Now()
+	*markets = updateMarkets(ctx, symbol, *markets)
 	zap.S().Info("Time execution: ", time.Since(start))
-	var minBuy *market.Market = &(*markets)[0]
-	var maxSell *market.Market = &(*markets)[0]
+	if ctx.Err() == context.Canceled {
+		zap.S().Infof("Scan of pair [%s] cancelled", pair)
+		return
+	}
 
-	var pair1, pair2, pair3 string
+	opportunities := findOpportunities(symbol, *markets)
+	if len(opportunities) == 0 {
+		return
+	}
+	zap.S().Debugf("All the data: %+v", opportunities)
+	// The opportunities are sorted by earning
+	o := opportunities[0]
 	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("\nArbitrage opportunity for pair [%s] with volume: %f\n", pair, o.Volume))
+	sb.WriteString(fmt.Sprintf("Buy: %f Sell: %f | Difference: %f\n", o.BuyTotal, o.SellTotal, o.Earning))
+	sb.WriteString(fmt.Sprintf("Buy Market: %s VWAP: %f Volume: %f\n", o.MarketBuy, o.BuyPrice, o.Volume))
+	sb.WriteString(fmt.Sprintf("Sell Market: %s VWAP: %f Volume: %f\n", o.MarketSell, o.SellPrice, o.Volume))
+	zap.S().Info(sb.String())
+
+	minBuy := &(*markets)[o.buyIndex]
+	maxSell := &(*markets)[o.sellIndex]
+	zap.S().Infof("Before the execution:  \nMinBuy: %+v \nMaxSell: %+v ", minBuy.Wallet, maxSell.Wallet)
+	if err := executeOpportunity(minBuy, maxSell, &o, symbol); err != nil {
+		zap.S().Warnf("Execution of pair [%s] buying on [%s] and selling on [%s] failed: %s", pair, o.MarketBuy, o.MarketSell, err.Error())
+	}
+	zap.S().Infof("After the execution:  \nMinBuy: %+v \nMaxSell: %+v ", minBuy.Wallet, maxSell.Wallet)
+	o.CurrentWallet = getWalletFromMarkets(*markets)
+	saveOpportunity(o)
+}
+
+// Rebalance is delegated to update the Inventory with the wallets of the given markets: the transfers arrived are
+// settled and the new ones are planned, in paper mode changing the wallets. It is called once per tick by the
+// goroutine that execute the scans, so the wallets are never changed during a scan
+func Rebalance(markets []market.Market) {
+	if Inventory != nil {
+		Inventory.Update(now(), markets)
+	}
+}
+
+// findOpportunities is delegated to evaluate every ordered pair of markets (buy on the first, sell on the second)
+// for the given pair. Return the profitable opportunities sorted by earning, the most relevant first
+func findOpportunities(symbol market.Symbol, markets []market.Market) []opportunity {
 	var opportunities []opportunity
-	for i := 1; i < len(*markets); i++ {
-		pair1 = parsePair(pair, (*markets)[i])
-		pair2 = parsePair(pair, *maxSell)
-		pair3 = parsePair(pair, *minBuy)
-		_ = len((*markets)[i].Bids[pair1])
-		zap.S().Debugf("Checking markets [%s] against [%s] with pair: [%s] for BUY", (*markets)[i].MarketName, minBuy.MarketName, pair1)
-		if len((*markets)[i].Bids[pair1]) > 0 && len(minBuy.Bids[pair3]) > 0 && len(((*markets)[i].Asks[pair1])) > 0 && len(maxSell.Asks[pair2]) > 0 {
-			if ((*markets)[i].Bids[pair1][0].Price) < minBuy.Bids[pair3][0].Price && ((*markets)[i].MarketName != maxSell.MarketName) {
-				zap.S().Debugf("Market [%s] have a LESSER price than [%s] FOR BUY", (*markets)[i].MarketName, minBuy.MarketName)
-				minBuy = &(*markets)[i]
-				minBuy.MakerFee = (*markets)[i].MakerFee
-				minBuy.TakerFee = (*markets)[i].TakerFee
+	for buy := range markets {
+		for sell := range markets {
+			if buy == sell {
+				continue
 			}
-			zap.S().Debugf("Checking markets [%s] against [%s] with pair: [%s] for SELL", (*markets)[i].MarketName, maxSell.MarketName, pair2)
-			if (*markets)[i].Asks[pair1][0].Price > maxSell.Asks[pair2][0].Price && (*markets)[i].MarketName != maxSell.MarketName {
-				zap.S().Debugf("Market [%s] have a GREATER price than [%s] FOR SELL", (*markets)[i].MarketName, maxSell.MarketName)
-				maxSell = &(*markets)[i]
-				maxSell.MakerFee = (*markets)[i].MakerFee
-				maxSell.TakerFee = (*markets)[i].TakerFee
-			}
-			if minBuy.MarketName != maxSell.MarketName {
-				pair2 = parsePair(pair, *maxSell)
-				pair3 = parsePair(pair, *minBuy)
-				volume := getMin(maxSell.Asks[pair2][0].Volume, minBuy.Bids[pair3][0].Volume)
-				buyTotal := volume * minBuy.Bids[pair3][0].Price
-				buyTotal += percent(buyTotal, minBuy.TakerFee)
-				sellTotal := volume * maxSell.Asks[pair2][0].Price
-				sellTotal += percent(sellTotal, maxSell.TakerFee)
-				if sellTotal-buyTotal > 0 {
-					sb.WriteString(fmt.Sprintf("\nArbitrage opportunity for pair [%s] with volume: %f\n", pair, volume))
-					sb.WriteString(fmt.Sprintf("Buy: %f Sell: %f | Difference: %f\n", buyTotal, sellTotal, sellTotal-buyTotal))
-					sb.WriteString(fmt.Sprintf("Buy Market: %s Price: %f Volume: %f\n", minBuy.MarketName, minBuy.Bids[pair3][0].Price, volume))
-					sb.WriteString(fmt.Sprintf("Sell Market: %s Price: %f Volume: %f\n", maxSell.MarketName, maxSell.Asks[pair2][0].Price, volume))
-					zap.S().Info(sb.String())
-					sb.Reset()
-					var o opportunity
-					o.BuyPrice = minBuy.Asks[pair3][0].Price
-					o.SellPrice = maxSell.Bids[pair2][0].Price
-					o.Pair = pair
-					o.Volume = volume
-					o.MarketBuy = minBuy.MarketName
-					o.MarketSell = maxSell.MarketName
-					o.Earning = sellTotal - buyTotal
-					o.Time = time.Now().UnixNano()
-					opportunities = append(opportunities, o)
-				}
+			if o, found := evaluateOpportunity(symbol, markets[buy], markets[sell]); found {
+				o.buyIndex = buy
+				o.sellIndex = sell
+				opportunities = append(opportunities, o)
 			}
 		}
 	}
-	if len(opportunities) > 0 {
-		var index = 0
-		// Iterate the opportunities in order to extract only the most relevant
-		for i := 1; i < len(opportunities); i++ {
-			if opportunities[i].Earning > opportunities[index].Earning && opportunities[index].Earning > 0 {
-				index = i
-			}
-		}
+	sort.SliceStable(opportunities, func(i, j int) bool {
+		return opportunities[i].Earning > opportunities[j].Earning
+	})
+	return opportunities
+}
 
-		zap.S().Infof("Found the best opportunities for index %d: %+v", index, opportunities[index])
-		zap.S().Debugf("All the data: %+v", opportunities)
-		zap.S().Infof("Before the reduce:  \nMinBuy: %+v \nMaxSell: %+v ", minBuy.Wallet, maxSell.Wallet)
-		reduceWalletBalance(minBuy, maxSell, opportunities[index], pair)
-		zap.S().Infof("After the reduce:  \nMinBuy: %+v \nMaxSell: %+v ", minBuy.Wallet, maxSell.Wallet)
-		opportunities[index].CurrentWallet = getWalletFromMarkets(*markets)
-		if data, err := json.Marshal(opportunities[index]); err == nil {
-			if f, err := os.OpenFile("data.json", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err == nil {
-				defer f.Close()
-				// writing the arbitrage opportunity
-				if _, err := f.Write(data); err != nil {
-					zap.S().Warnf("Unable to write to the data: %s", err.Error())
-				} else {
-					f.WriteString(",\n")
-				}
+// evaluateOpportunity is delegated to score the arbitrage that buy the pair on the buy market and sell it on the
+// sell market. Buying always lift the asks, selling always hit the bids. The volume is limited by the funds of the
+// wallets: the quote currency of the buy market and the base currency of the sell market
+func evaluateOpportunity(symbol market.Symbol, buy, sell market.Market) (opportunity, bool) {
+	asks, _ := getOrders(symbol, buy)
+	_, bids := getOrders(symbol, sell)
+	asks, bids = capFunds(symbol, buy, sell, asks, bids)
+	if len(asks) == 0 || len(bids) == 0 {
+		return opportunity{}, false
+	}
+	zap.S().Debugf("Checking pair [%s] buying on [%s] at %f and selling on [%s] at %f", symbol, buy.MarketName, asks[0].Price, sell.MarketName, bids[0].Price)
+	pair := symbol.String()
+	buyTime, sellTime := getBookTime(symbol, buy), getBookTime(symbol, sell)
+	stale := Staleness.Check(buyTime, sellTime)
+	if stale != nil && Staleness.Reject {
+		zap.S().Debugf("Discarding pair [%s] buying on [%s] and selling on [%s]: %s", pair, buy.MarketName, sell.MarketName, stale.Error())
+		return opportunity{}, false
+	}
+	depth := walkOrderBooks(asks, bids, fees.PercentRate(buy, pair, fees.Taker), fees.PercentRate(sell, pair, fees.Taker))
+	if depth.Volume <= 0 {
+		return opportunity{}, false
+	}
+
+	// Round the orders to the rules of the markets, the profit is calculated on the rounded orders
+	validator := OrderValidator{Buy: buy.Constraints[pair], Sell: sell.Constraints[pair]}
+	volume, buyPrice, sellPrice, err := validator.Validate(depth.Volume, depth.BuyPrice, depth.SellPrice)
+	if err != nil {
+		zap.S().Debugf("Discarding pair [%s] buying on [%s] and selling on [%s]: %s", pair, buy.MarketName, sell.MarketName, err.Error())
+		return opportunity{}, false
+	}
+	calculator := PnLCalculator{Pair: pair, Buy: buy, Sell: sell}
+	pnl := calculator.Calculate(volume, buyPrice, sellPrice)
+	if pnl.Profit() <= 0 {
+		return opportunity{}, false
+	}
+
+	var o opportunity
+	o.Type = CROSS_EXCHANGE
+	o.BuyPrice = buyPrice
+	o.SellPrice = sellPrice
+	o.BuyTotal = pnl.Buy.Net
+	o.SellTotal = pnl.Sell.Net
+	o.BuyFee = pnl.Buy.Fee
+	o.SellFee = pnl.Sell.Fee
+	o.Pair = pair
+	o.Volume = volume
+	o.MarketBuy = buy.MarketName
+	o.MarketSell = sell.MarketName
+	o.Earning = pnl.Profit()
+	o.Time = time.Now().UnixNano()
+	o.BuyBookTime = buyTime
+	o.SellBookTime = sellTime
+	if stale != nil {
+		zap.S().Warnf("Opportunity on pair [%s] buying on [%s] and selling on [%s] flagged: %s", pair, buy.MarketName, sell.MarketName, stale.Error())
+		o.Stale = true
+	}
+	return o, true
+}
+
+// getBookTime is delegated to retrieve the times of the order book of the given pair for the given market
+func getBookTime(symbol market.Symbol, m market.Market) market.BookTime {
+	return m.Times[parsePair(symbol, m)]
+}
+
+// getOrders is delegated to retrieve the asks and the bids of the given pair for the given market
+func getOrders(symbol market.Symbol, m market.Market) ([]market.MarketOrder, []market.MarketOrder) {
+	pair := parsePair(symbol, m)
+	return m.Asks[pair], m.Bids[pair]
+}
+
+// saveMutex serialize the writes of the opportunities, saved by the pairs scan and by the cycles scans
+var saveMutex sync.Mutex
+
+// saveOpportunity is delegated to append the given opportunity (cross exchange or cycle) to the data file. The
+// opportunity and the separator are written together, so the concurrent scans does not interleave the records
+func saveOpportunity(o interface{}) {
+	if data, err := json.Marshal(o); err == nil {
+		saveMutex.Lock()
+		defer saveMutex.Unlock()
+		if f, err := os.OpenFile(OpportunitiesFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err == nil {
+			defer f.Close()
+			// writing the arbitrage opportunity
+			if _, err := f.Write(append(data, ",\n"...)); err != nil {
+				zap.S().Warnf("Unable to write to the data: %s", err.Error())
 			}
 		}
 	}
@@ -265,6 +302,15 @@ func dumpWallet(markets []market.Market) string {
 	return s
 }
 
+// SaveWallets is delegated to save the wallets of the given markets into the wallets file
+func SaveWallets(markets []market.Market) error {
+	data, err := json.MarshalIndent(getWalletFromMarkets(markets), "", " ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(WalletsFile, data, 0644)
+}
+
 func getWalletFromMarkets(markets []market.Market) []market.Wallet {
 	var wallets []market.Wallet = make([]market.Wallet, len(markets))
 	for i := range markets {
@@ -273,32 +319,44 @@ func getWalletFromMarkets(markets []market.Market) []market.Wallet {
 	return wallets
 }
 
-// reduceWalletBalance is delegated to remove the amount of coin from the sell market and increase the one related to the buy market
-// If we are dealing with `ethusd` transaction, than we need to increase the `eth` and reduce the `usd`
-func reduceWalletBalance(buy, sell *market.Market, operation opportunity, pair string) (market.Market, market.Market) {
-
-	// a := "eth1btc"
-	// b := a[len(a)-3:]// btc
-	// c := a[:len(a)-len(b)] //eth1
-
-	quoteCurrency := pair[len(pair)-3:]                 //b
-	baseCurrency := pair[:len(pair)-len(quoteCurrency)] //c
-	volume := operation.Volume
-	buyPrice := operation.BuyPrice
-	sellPrice := operation.SellPrice
-
-	buy.Wallet.Coins[quoteCurrency] -= volume * buyPrice
-	buy.Wallet.Coins[baseCurrency] += volume
-
-	sell.Wallet.Coins[quoteCurrency] += volume * sellPrice
-	sell.Wallet.Coins[baseCurrency] -= volume
-
-	return *buy, *sell
+// executeOpportunity is delegated to execute the given opportunity on the simulated venues of the markets: the
+// volume is bought lifting the asks of the buy market and the volume filled is sold hitting the bids of the sell
+// market. The wallets are changed only by the fills, the executions are saved in the opportunity together with the
+// realized earning. The legs rejected by the venue (e.g. insufficient funds) are recorded and the error returned
+func executeOpportunity(buy, sell *market.Market, o *opportunity, symbol market.Symbol) error {
+	venuesMutex.Lock()
+	defer venuesMutex.Unlock()
+	asks, _ := getOrders(symbol, *buy)
+	_, bids := getOrders(symbol, *sell)
+	bought, err := venue(buy).Submit(simulator.Order{Symbol: symbol, Side: simulator.Buy, Type: simulator.Market, Volume: o.Volume}, asks)
+	o.Executions = append(o.Executions, bought)
+	if err != nil || bought.Filled <= 0 {
+		return err
+	}
+	sold, err := venue(sell).Submit(simulator.Order{Symbol: symbol, Side: simulator.Sell, Type: simulator.Market, Volume: bought.Filled}, bids)
+	o.Executions = append(o.Executions, sold)
+	if err != nil {
+		return err
+	}
+	o.Realized = sold.Net - bought.Net
+	return nil
+}
 
+// venue is delegated to retrieve the venue of the given market, created at the first execution and bound to the
+// last data of the market. The caller have to hold the venuesMutex
+func venue(m *market.Market) *simulator.Venue {
+	v, ok := venues[m.MarketName]
+	if !ok {
+		v = simulator.New(m)
+		venues[m.MarketName] = v
+	}
+	v.Bind(m)
+	return v
 }
 
-func percent(percent float64, all float64) float64 {
-	return (all * percent) / float64(100)
+// percent is delegated to calculate the given percent of the amount
+func percent(amount float64, rate float64) float64 {
+	return (amount * rate) / float64(100)
 }
 
 func getMin(a, b float64) float64 {
@@ -308,19 +366,99 @@ func getMin(a, b float64) float64 {
 	return b
 }
 
-// parsePair is delegated to modify the standard lowercase pair into the related pair for the given market
-func parsePair(pair string, market market.Market) string {
-	switch market.MarketName {
-	case "KRAKEN":
-		var kraken kraken.Kraken
-		pair = kraken.ParsePair(pair)
-	case "OKCOIN":
-		var okcoin okcoin.OkCoin
-		pair = okcoin.ParsePair(pair)
-	case "BITFINEX":
-		// Nothing
-	case "GEMINI":
-		// Nothing
+// getExchange is delegated to retrieve the adapter registered for the given market
+func getExchange(name string) (markets.Exchange, error) {
+	exchange, ok := markets.Get(name)
+	if !ok {
+		return nil, errors.New("market [" + name + "] is not registered")
+	}
+	return exchange, nil
+}
+
+// snapshot contains the order book of a market retrieved by a fetch. The market is never modified after that is
+// sent, so it can be read by the engine without synchronization
+type snapshot struct {
+	// index is the position of the market in the markets evaluated by the engine
+	index  int
+	market market.Market
+	err    error
+}
+
+// updateMarkets is delegated to retrieve in parallel the order book of the given pair for every market.
+// Every fetch send an immutable snapshot over the channel, the engine assemble them into a new view of the markets.
+// The markets that fail to retrieve the data, or that are still running when the context is done, are abandoned:
+// their order book is removed from the view, so they are not evaluated with old data
+func updateMarkets(ctx context.Context, symbol market.Symbol, current []market.Market) []market.Market {
+	var view = make([]market.Market, len(current))
+	copy(view, current)
+	var updated = make([]bool, len(current))
+	// The channel is buffered, so the abandoned fetches can always send the result and terminate
+	results := make(chan snapshot, len(current))
+	var started int
+	for i := range current {
+		exchange, err := getExchange(current[i].MarketName)
+		if err != nil {
+			zap.S().Warn(err.Error())
+			continue
+		}
+		started++
+		go fetchSnapshot(ctx, exchange, symbol, i, results)
+	}
+collect:
+	for ; started > 0; started-- {
+		select {
+		case s := <-results:
+			if s.err != nil {
+				zap.S().Warnf("Unable to retrieve %s data: %s", view[s.index].MarketName, s.err.Error())
+				continue
+			}
+			view[s.index] = mergeSnapshot(view[s.index], s.market)
+			updated[s.index] = true
+		case <-ctx.Done():
+			zap.S().Warnf("Scan of pair [%s] stopped, %d markets abandoned: %s", symbol, started, ctx.Err().Error())
+			break collect
+		}
+	}
+	for i := range view {
+		if !updated[i] {
+			view[i].Asks = nil
+			view[i].Bids = nil
+		}
+	}
+	return view
+}
+
+// fetchSnapshot is delegated to retrieve the order book of the given pair and send the market data over the channel.
+// The order book is not requested if it is already kept updated by the stream of the market
+func fetchSnapshot(ctx context.Context, exchange markets.Exchange, symbol market.Symbol, index int, results chan<- snapshot) {
+	pair := exchange.EncodeSymbol(symbol)
+	if streamer, ok := exchange.(markets.Streamer); !ok || !streamer.Streaming(pair) {
+		if err := exchange.GetOrderBook(ctx, pair); err != nil {
+			results <- snapshot{index: index, err: err}
+			return
+		}
+	}
+	data, err := exchange.GetMarketData(pair)
+	results <- snapshot{index: index, market: data, err: err}
+}
+
+// mergeSnapshot is delegated to create the market with the order book of the snapshot.
+// The wallet, the fees, the traded volume, the order rules and the symbols of the previous market are preserved
+func mergeSnapshot(previous, data market.Market) market.Market {
+	data.Wallet = previous.Wallet
+	data.MakerFee = previous.MakerFee
+	data.TakerFee = previous.TakerFee
+	data.Fees = previous.Fees
+	data.Volume30d = previous.Volume30d
+	data.Constraints = previous.Constraints
+	data.Symbols = previous.Symbols
+	return data
+}
+
+// parsePair is delegated to convert the given symbol into the related pair for the given market
+func parsePair(symbol market.Symbol, market market.Market) string {
+	if exchange, err := getExchange(market.MarketName); err == nil {
+		return exchange.EncodeSymbol(symbol)
 	}
-	return pair
+	return symbol.String()
 }
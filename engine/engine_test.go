@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/simulator"
 )
 
 // initOrder is delegated to initalize a new map with the given key
@@ -43,3 +44,48 @@ func Test_GetCommonCoinKO(t *testing.T) {
 		t.Error("Pairs -> ", commmonPairs, " Len: ", len(commmonPairs))
 	}
 }
+
+func Test_ExecuteOpportunity(t *testing.T) {
+	type TestCase struct {
+		USD        float64
+		Error      error
+		Executions int
+		// ExpectedBuy and ExpectedSell are the wallets after the execution
+		ExpectedBuy  map[string]float64
+		ExpectedSell map[string]float64
+		Number       int
+	}
+
+	symbol := market.NewSymbol("algo", "usdt")
+	defer func(v map[string]*simulator.Venue) { venues = v }(venues)
+	venues = make(map[string]*simulator.Venue)
+	cases := []TestCase{
+		// 10 algo bought at 2 (5 at 1.9 and 5 at 2.1) and sold at 3
+		{USD: 100, Executions: 2, ExpectedBuy: map[string]float64{"algo": 110, "usdt": 80}, ExpectedSell: map[string]float64{"algo": 90, "usdt": 130}, Number: 1},
+		// The buy market does not have the usdt for the fills, the wallets are not changed
+		{USD: 10, Error: simulator.ErrInsufficientFunds, Executions: 1, ExpectedBuy: map[string]float64{"algo": 100, "usdt": 10}, ExpectedSell: map[string]float64{"algo": 100, "usdt": 100}, Number: 2},
+	}
+	for _, c := range cases {
+		var buy = market.Market{MarketName: "KRAKEN", Wallet: market.Wallet{Coins: map[string]float64{"algo": 100, "usdt": c.USD}},
+			Asks: map[string][]market.MarketOrder{symbol.String(): {{Price: 1.9, Volume: 5}, {Price: 2.1, Volume: 10}}}}
+		var sell = market.Market{MarketName: "OKCOIN", Wallet: market.Wallet{Coins: map[string]float64{"algo": 100, "usdt": 100}},
+			Bids: map[string][]market.MarketOrder{symbol.String(): {{Price: 3, Volume: 20}}}}
+		o := opportunity{BuyPrice: 2, SellPrice: 3, BuyTotal: 20, SellTotal: 30, Volume: 10}
+		if err := executeOpportunity(&buy, &sell, &o, symbol); err != c.Error || len(o.Executions) != c.Executions {
+			t.Errorf("Received %v with %d executions, expected %v with %d [test n. %d]", err, len(o.Executions), c.Error, c.Executions, c.Number)
+		}
+		if !reflect.DeepEqual(buy.Wallet.Coins, c.ExpectedBuy) {
+			t.Errorf("Received %v, expected %v [test n. %d]", buy.Wallet.Coins, c.ExpectedBuy, c.Number)
+		}
+		if !reflect.DeepEqual(sell.Wallet.Coins, c.ExpectedSell) {
+			t.Errorf("Received %v, expected %v [test n. %d]", sell.Wallet.Coins, c.ExpectedSell, c.Number)
+		}
+		// The venue of the market is kept between the executions, the ids are not reused
+		if o.Executions[0].ID != c.Number {
+			t.Errorf("Received id %d, expected %d [test n. %d]", o.Executions[0].ID, c.Number, c.Number)
+		}
+	}
+	if buys, sells := len(venues["KRAKEN"].Executions()), len(venues["OKCOIN"].Executions()); buys != 2 || sells != 1 {
+		t.Errorf("Received %d and %d executions, expected %d and %d", buys, sells, 2, 1)
+	}
+}
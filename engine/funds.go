@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/fees"
+)
+
+// capFunds is delegated to truncate the order books of the legs to the funds available in the wallets: the asks of
+// the buy market to the volume that can be paid with the quote currency, fee included, and the bids of the sell
+// market to the base currency owned. The markets without a wallet are not capped
+func capFunds(symbol market.Symbol, buy, sell market.Market, asks, bids []market.MarketOrder) ([]market.MarketOrder, []market.MarketOrder) {
+	pair := symbol.String()
+	if buy.Wallet.Coins != nil {
+		// The flat fee is paid once, the percent fee on every level
+		funds := buy.Wallet.Coins[symbol.Quote]
+		if !fees.IsPercent(buy, pair) {
+			funds -= fees.Rate(buy, pair, fees.Taker)
+		}
+		asks = capNotional(asks, funds, fees.PercentRate(buy, pair, fees.Taker))
+	}
+	if sell.Wallet.Coins != nil {
+		bids = capVolume(bids, sell.Wallet.Coins[symbol.Base])
+	}
+	return asks, bids
+}
+
+// capNotional is delegated to truncate the orders to the volume that can be bought with the given funds, paying the
+// given fee (percent) on every level. The last level is reduced to the volume that can be paid
+func capNotional(orders []market.MarketOrder, funds, fee float64) []market.MarketOrder {
+	var capped []market.MarketOrder
+	for _, order := range orders {
+		if funds <= epsilon {
+			break
+		}
+		cost := order.Price + percent(order.Price, fee)
+		if order.Volume*cost > funds {
+			order.Volume = funds / cost
+		}
+		funds -= order.Volume * cost
+		capped = append(capped, order)
+	}
+	return capped
+}
+
+// capVolume is delegated to truncate the orders to the given volume. The last level is reduced to the volume left
+func capVolume(orders []market.MarketOrder, volume float64) []market.MarketOrder {
+	var capped []market.MarketOrder
+	for _, order := range orders {
+		if volume <= epsilon {
+			break
+		}
+		if order.Volume > volume {
+			order.Volume = volume
+		}
+		volume -= order.Volume
+		capped = append(capped, order)
+	}
+	return capped
+}
@@ -0,0 +1,143 @@
+package engine
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"github.com/alessiosavi/GoArbitrage/rebalance"
+)
+
+func Test_FindOpportunitiesFunds(t *testing.T) {
+	type TestCase struct {
+		// Quote is the usd of the buy market, Base the btc of the sell market
+		Quote  float64
+		Base   float64
+		Fee    float64
+		Flat   bool
+		Wallet bool
+		Found  bool
+		Volume float64
+		Number int
+	}
+
+	cases := []TestCase{
+		{Quote: 100000, Base: 100, Wallet: true, Found: true, Volume: 2, Number: 1},
+		// The first level is bought entirely, the second one with the funds left
+		{Quote: 150, Base: 100, Wallet: true, Found: true, Volume: 1 + 50.0/101, Number: 2},
+		{Quote: 100000, Base: 0.5, Wallet: true, Found: true, Volume: 0.5, Number: 3},
+		{Quote: 0, Base: 100, Wallet: true, Found: false, Number: 4},
+		{Quote: 100000, Base: 0, Wallet: true, Found: false, Number: 5},
+		// The percent fee is paid with the quote currency
+		{Quote: 101, Base: 100, Fee: 1, Wallet: true, Found: true, Volume: 1, Number: 6},
+		// The flat fee is paid once
+		{Quote: 101, Base: 100, Fee: 1, Flat: true, Wallet: true, Found: true, Volume: 1, Number: 7},
+		// The markets without a wallet are not capped
+		{Wallet: false, Found: true, Volume: 2, Number: 8},
+	}
+
+	for _, c := range cases {
+		buy := initMarket("A", []market.MarketOrder{{Price: 100, Volume: 1}, {Price: 101, Volume: 1}}, []market.MarketOrder{{Price: 90, Volume: 2}}, c.Fee)
+		sell := initMarket("B", []market.MarketOrder{{Price: 120, Volume: 2}}, []market.MarketOrder{{Price: 110, Volume: 2}}, 0)
+		if c.Flat {
+			buy.TakerFee = 0
+			buy.Fees = market.MarketFee{IsPercent: false, Tiers: []market.FeeTier{{Taker: c.Fee}}}
+		}
+		buy.Wallet.Coins = map[string]float64{"usd": c.Quote}
+		sell.Wallet.Coins = map[string]float64{"btc": c.Base}
+		if !c.Wallet {
+			buy.Wallet.Coins, sell.Wallet.Coins = nil, nil
+		}
+		opportunities := findOpportunities(testSymbol, []market.Market{buy, sell})
+		if (len(opportunities) > 0) != c.Found {
+			t.Errorf("Received %d opportunities, expected found %v [test n. %d]", len(opportunities), c.Found, c.Number)
+			continue
+		}
+		if !c.Found {
+			continue
+		}
+		o := opportunities[0]
+		if math.Abs(o.Volume-c.Volume) > 1e-9 {
+			t.Errorf("Received %v, expected %v [test n. %d]", o.Volume, c.Volume, c.Number)
+		}
+		if c.Wallet && o.BuyTotal > c.Quote+1e-9 {
+			t.Errorf("Received a buy of %f, expected at most %f [test n. %d]", o.BuyTotal, c.Quote, c.Number)
+		}
+	}
+}
+
+func Test_CapVolume(t *testing.T) {
+	type TestCase struct {
+		Volume   float64
+		Expected []market.MarketOrder
+		Number   int
+	}
+
+	orders := []market.MarketOrder{{Price: 110, Volume: 1}, {Price: 109, Volume: 2}}
+	cases := []TestCase{
+		{Volume: 0, Expected: nil, Number: 1},
+		{Volume: 0.5, Expected: []market.MarketOrder{{Price: 110, Volume: 0.5}}, Number: 2},
+		{Volume: 1, Expected: []market.MarketOrder{{Price: 110, Volume: 1}}, Number: 3},
+		{Volume: 2, Expected: []market.MarketOrder{{Price: 110, Volume: 1}, {Price: 109, Volume: 1}}, Number: 4},
+		{Volume: 10, Expected: orders, Number: 5},
+	}
+
+	for _, c := range cases {
+		capped := capVolume(orders, c.Volume)
+		if len(capped) != len(c.Expected) {
+			t.Errorf("Received %v, expected %v [test n. %d]", capped, c.Expected, c.Number)
+			continue
+		}
+		for i := range capped {
+			if capped[i] != c.Expected[i] {
+				t.Errorf("Received %v, expected %v [test n. %d]", capped, c.Expected, c.Number)
+			}
+		}
+	}
+	if orders[0].Volume != 1 || orders[1].Volume != 2 {
+		t.Errorf("The order book was modified: %v", orders)
+	}
+}
+
+func Test_ArbitragePaused(t *testing.T) {
+	dir, err := ioutil.TempDir("", "arbitrage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(file string) { OpportunitiesFile = file }(OpportunitiesFile)
+	OpportunitiesFile = path.Join(dir, "data.json")
+	defer func() { Inventory = nil }()
+	// The threshold avoid any transfer
+	Inventory = rebalance.New(rebalance.Config{Threshold: 1000}, true)
+
+	exchanges := []*fakeExchange{{name: "PAUSED_A", price: 100}, {name: "PAUSED_B", price: 110}}
+	var view []market.Market
+	for _, exchange := range exchanges {
+		exchange.Init()
+		markets.Register(exchange)
+		view = append(view, market.Market{MarketName: exchange.name, Wallet: market.Wallet{MarketName: exchange.name, Coins: map[string]float64{"btc": 0, "usd": 100000}}})
+	}
+	// No market own the base currency, the order books are not requested
+	Rebalance(view)
+	Arbitrage(context.Background(), testSymbol, &view)
+	if exchanges[0].requests() != 0 || exchanges[1].requests() != 0 {
+		t.Errorf("Received %d and %d requests, expected none [test n. %d]", exchanges[0].requests(), exchanges[1].requests(), 1)
+	}
+	view[1].Wallet.Coins["btc"] = 1
+	// The pair is resumed only by the next update of the inventory
+	Arbitrage(context.Background(), testSymbol, &view)
+	if exchanges[0].requests() != 0 || exchanges[1].requests() != 0 {
+		t.Errorf("Received %d and %d requests, expected none [test n. %d]", exchanges[0].requests(), exchanges[1].requests(), 2)
+	}
+	Rebalance(view)
+	Arbitrage(context.Background(), testSymbol, &view)
+	if exchanges[0].requests() != 1 || exchanges[1].requests() != 1 {
+		t.Errorf("Received %d and %d requests, expected one for market [test n. %d]", exchanges[0].requests(), exchanges[1].requests(), 3)
+	}
+}
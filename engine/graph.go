@@ -0,0 +1,223 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"go.uber.org/zap"
+)
+
+// MULTI_HOP is the type of the opportunities that move the currencies between the markets
+const MULTI_HOP = "multi_hop"
+
+// TransferFee is the fee, in percent of the amount, applied for move a currency from a market to another one
+var TransferFee float64
+
+// graph contains the currencies of the markets as nodes, the orders and the transfers as edges
+type graph struct {
+	// nodes contains the nodes in the format `MARKET:currency`, sorted
+	nodes []string
+	index map[string]int
+	edges []edge
+	// from and to contains the nodes of every edge
+	from []int
+	to   []int
+	// weights contains the weight of every edge: -log of the rate of the best level
+	weights []float64
+}
+
+// node return the name of the node of the given currency in the given market
+func node(marketName, currency string) string {
+	return marketName + ":" + currency
+}
+
+// newGraph is delegated to build the graph of the given markets. Every pair of a market allow to sell the base and
+// to buy the base, every currency traded in two markets can be transferred between them
+func newGraph(markets []market.Market) *graph {
+	var edges []edge
+	currencies := make(map[string][]string)
+	for _, m := range markets {
+		marketEdges := marketEdges(m)
+		seen := make(map[string]bool)
+		for _, e := range marketEdges {
+			for _, currency := range []string{e.From, e.To} {
+				if !seen[currency] {
+					seen[currency] = true
+					currencies[currency] = append(currencies[currency], m.MarketName)
+				}
+			}
+		}
+		edges = append(edges, marketEdges...)
+	}
+	for currency, names := range currencies {
+		for _, from := range names {
+			for _, to := range names {
+				if from != to {
+					transfer := []market.MarketOrder{{Price: 1, Volume: math.Inf(1)}}
+					edges = append(edges, edge{Market: from, ToMarket: to, From: currency, To: currency, levels: transfer, fee: TransferFee})
+				}
+			}
+		}
+	}
+
+	g := &graph{index: make(map[string]int)}
+	for _, e := range edges {
+		for _, n := range []string{node(e.Market, e.From), node(e.target(), e.To)} {
+			if _, ok := g.index[n]; !ok {
+				g.index[n] = len(g.nodes)
+				g.nodes = append(g.nodes, n)
+			}
+		}
+	}
+	// The nodes and the edges are sorted for find always the same cycles
+	sort.Strings(g.nodes)
+	for i, n := range g.nodes {
+		g.index[n] = i
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		a, b := edges[i], edges[j]
+		if a.Market != b.Market {
+			return a.Market < b.Market
+		}
+		if a.ToMarket != b.ToMarket {
+			return a.ToMarket < b.ToMarket
+		}
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		return a.To < b.To
+	})
+	for _, e := range edges {
+		g.edges = append(g.edges, e)
+		g.from = append(g.from, g.index[node(e.Market, e.From)])
+		g.to = append(g.to, g.index[node(e.target(), e.To)])
+		g.weights = append(g.weights, -math.Log(e.rate(0)))
+	}
+	return g
+}
+
+// negativeCycles is delegated to find the cycles with a negative weight (the product of the rates is greater than 1)
+// using Bellman-Ford. All the nodes start from distance 0, as if a source is connected to every node. The cycles are
+// extracted from the predecessors after the last pass, every cycle start from its lowest node
+func (g *graph) negativeCycles() [][]int {
+	n := len(g.nodes)
+	distance := make([]float64, n)
+	predecessor := make([]int, n)
+	for i := range predecessor {
+		predecessor[i] = -1
+	}
+	relaxed := false
+	for pass := 0; pass < n; pass++ {
+		relaxed = false
+		for i := range g.edges {
+			if d := distance[g.from[i]] + g.weights[i]; d < distance[g.to[i]]-epsilon {
+				distance[g.to[i]] = d
+				predecessor[g.to[i]] = i
+				relaxed = true
+			}
+		}
+		if !relaxed {
+			return nil
+		}
+	}
+
+	// The predecessors form a graph where every node has at most one incoming edge, its cycles are negative
+	var cycles [][]int
+	state := make([]int, n)
+	for start := range g.nodes {
+		var visited []int
+		current := start
+		for current != -1 && state[current] == 0 {
+			state[current] = 1
+			visited = append(visited, current)
+			if predecessor[current] == -1 {
+				current = -1
+			} else {
+				current = g.from[predecessor[current]]
+			}
+		}
+		// A node visited in this walk close a new cycle
+		if current != -1 && state[current] == 1 {
+			var cycle []int
+			for v := current; ; {
+				cycle = append(cycle, predecessor[v])
+				v = g.from[predecessor[v]]
+				if v == current {
+					break
+				}
+			}
+			cycles = append(cycles, g.rotate(cycle))
+		}
+		for _, v := range visited {
+			state[v] = 2
+		}
+	}
+	return cycles
+}
+
+// rotate is delegated to put the edges of the cycle, collected backward, in the order of execution starting from the
+// lowest node
+func (g *graph) rotate(cycle []int) []int {
+	for i, j := 0, len(cycle)-1; i < j; i, j = i+1, j-1 {
+		cycle[i], cycle[j] = cycle[j], cycle[i]
+	}
+	lowest := 0
+	for i := range cycle {
+		if g.from[cycle[i]] < g.from[cycle[lowest]] {
+			lowest = i
+		}
+	}
+	return append(cycle[lowest:], cycle[:lowest]...)
+}
+
+// MultiHop is delegated to find the profitable cycles that span several markets, moving the currencies between
+// them. The most profitable opportunity is saved in the opportunities file
+func MultiHop(markets []market.Market) {
+	opportunities := findMultiHop(markets)
+	if len(opportunities) == 0 {
+		return
+	}
+	zap.S().Debugf("All the cycles: %+v", opportunities)
+	o := opportunities[0]
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("\nMulti hop opportunity starting with [%s] on [%s]: %f\n", o.Currency, o.Legs[0].Market, o.AmountIn))
+	sb.WriteString(fmt.Sprintf("Out: %f | Difference: %f (%f%%)\n", o.AmountOut, o.Earning, o.Return))
+	for _, leg := range o.Legs {
+		if leg.ToMarket != "" {
+			sb.WriteString(fmt.Sprintf("TRANSFER %f %s: %s -> %s\n", leg.AmountIn, leg.From, leg.Market, leg.ToMarket))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("%s %s on %s: %f %s -> %f %s\n", strings.ToUpper(leg.Side), leg.Pair, leg.Market, leg.AmountIn, leg.From, leg.AmountOut, leg.To))
+	}
+	zap.S().Info(sb.String())
+	saveOpportunity(o)
+}
+
+// findMultiHop is delegated to find the negative cycles of the graph of the given markets that contains at least a
+// transfer (the cycles within a single market are found by the triangular scan) and walk their order books.
+// Return the profitable opportunities sorted by return, the most relevant first
+func findMultiHop(markets []market.Market) []cycleOpportunity {
+	g := newGraph(markets)
+	var opportunities []cycleOpportunity
+	for _, cycle := range g.negativeCycles() {
+		edges := make([]edge, len(cycle))
+		var transfer bool
+		for i, e := range cycle {
+			edges[i] = g.edges[e]
+			transfer = transfer || edges[i].ToMarket != ""
+		}
+		if !transfer {
+			continue
+		}
+		if o, found := evaluateCycle(MULTI_HOP, edges); found {
+			opportunities = append(opportunities, o)
+		}
+	}
+	sort.SliceStable(opportunities, func(i, j int) bool {
+		return opportunities[i].Return > opportunities[j].Return
+	})
+	return opportunities
+}
@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+)
+
+func Test_FindMultiHop(t *testing.T) {
+	type TestCase struct {
+		Markets     []market.Market
+		TransferFee float64
+		Found       bool
+		Legs        []string
+		AmountIn    float64
+		AmountOut   float64
+		Number      int
+	}
+
+	current := time.Now()
+	btcusd, btceur, ethbtc, etheur := market.NewSymbol("btc", "usd"), market.NewSymbol("btc", "eur"), market.NewSymbol("eth", "btc"), market.NewSymbol("eth", "eur")
+	orders := func(price, volume float64) []market.MarketOrder {
+		return []market.MarketOrder{{Price: price, Volume: volume}}
+	}
+	defer func(fee float64) { TransferFee = fee }(TransferFee)
+	// The transfers does not have an order book, they are not stale
+	defer func(policy StalenessPolicy) { Staleness = policy }(Staleness)
+	Staleness = StalenessPolicy{MaxAge: 10 * time.Second, Reject: true}
+
+	cases := []TestCase{
+		// Buy on A at 100 and sell on B at 105, the cycle start from the lowest node (A:btc)
+		{Markets: []market.Market{
+			initPairsMarket("A", map[market.Symbol]book{btcusd: {Asks: orders(100, 1), Bids: orders(99, 1), Time: current}}, 0),
+			initPairsMarket("B", map[market.Symbol]book{btcusd: {Asks: orders(106, 1), Bids: orders(105, 2), Time: current}}, 0)},
+			Found: true, Legs: []string{"A:btc transfer", "B:btc sell", "B:usd transfer", "A:usd buy"}, AmountIn: 100. / 105, AmountOut: 1, Number: 1},
+		// The transfer fees remove the profit
+		{Markets: []market.Market{
+			initPairsMarket("A", map[market.Symbol]book{btcusd: {Asks: orders(100, 1), Bids: orders(99, 1), Time: current}}, 0),
+			initPairsMarket("B", map[market.Symbol]book{btcusd: {Asks: orders(106, 1), Bids: orders(105, 2), Time: current}}, 0)},
+			TransferFee: 3, Found: false, Number: 2},
+		// No spread between the markets
+		{Markets: []market.Market{
+			initPairsMarket("A", map[market.Symbol]book{btcusd: {Asks: orders(100, 1), Bids: orders(99, 1), Time: current}}, 0),
+			initPairsMarket("B", map[market.Symbol]book{btcusd: {Asks: orders(101, 1), Bids: orders(99.5, 2), Time: current}}, 0)},
+			Found: false, Number: 3},
+		// The cycle within a single market is left to the triangular scan
+		{Markets: []market.Market{
+			initPairsMarket("A", map[market.Symbol]book{
+				btceur: {Asks: orders(10000, 1), Bids: orders(9990, 1), Time: current},
+				ethbtc: {Asks: orders(0.02, 10), Bids: orders(0.0199, 10), Time: current},
+				etheur: {Asks: orders(210, 20), Bids: orders(205, 20), Time: current}}, 0)},
+			Found: false, Number: 4},
+		// BTC->ETH on A, ETH->EUR->BTC on B: 1 / 0.02 * 205 / 10000 = 1.025, limited by the 10 ETH on sale on A
+		{Markets: []market.Market{
+			initPairsMarket("A", map[market.Symbol]book{
+				btceur: {Asks: orders(10100, 1), Bids: orders(10000, 1), Time: current},
+				ethbtc: {Asks: orders(0.02, 10), Bids: orders(0.0199, 10), Time: current}}, 0),
+			initPairsMarket("B", map[market.Symbol]book{
+				btceur: {Asks: orders(10000, 1), Bids: orders(9990, 1), Time: current},
+				etheur: {Asks: orders(210, 20), Bids: orders(205, 20), Time: current}}, 0)},
+			Found: true, Legs: []string{"A:btc buy", "A:eth transfer", "B:eth sell", "B:eur buy", "B:btc transfer"}, AmountIn: 0.2, AmountOut: 0.205, Number: 5},
+	}
+
+	for _, c := range cases {
+		TransferFee = c.TransferFee
+		opportunities := findMultiHop(c.Markets)
+		found := len(opportunities) > 0
+		if found != c.Found {
+			t.Errorf("Received %v, expected %v [test n. %d]", found, c.Found, c.Number)
+			continue
+		}
+		if !found {
+			continue
+		}
+		o := opportunities[0]
+		var legs []string
+		for _, leg := range o.Legs {
+			legs = append(legs, leg.Market+":"+leg.From+" "+leg.Side)
+		}
+		if o.Type != MULTI_HOP || len(legs) != len(c.Legs) {
+			t.Errorf("Received %v, expected %v [test n. %d]", legs, c.Legs, c.Number)
+			continue
+		}
+		for i := range legs {
+			if legs[i] != c.Legs[i] {
+				t.Errorf("Received %v, expected %v [test n. %d]", legs, c.Legs, c.Number)
+				break
+			}
+		}
+		if math.Abs(o.AmountIn-c.AmountIn) > 1e-9 || math.Abs(o.AmountOut-c.AmountOut) > 1e-9 {
+			t.Errorf("Received %f -> %f, expected %f -> %f [test n. %d]", o.AmountIn, o.AmountOut, c.AmountIn, c.AmountOut, c.Number)
+		}
+	}
+}
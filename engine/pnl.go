@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/fees"
+)
+
+// Leg contains the amounts, in quote currency, of one side of the arbitrage
+type Leg struct {
+	// Gross is the amount traded (price * volume)
+	Gross float64 `json:"gross"`
+	// Fee is the fee paid to the market
+	Fee float64 `json:"fee"`
+	// Net is the amount that leave the wallet for the buy leg (Gross + Fee) or that enter the wallet for the
+	// sell leg (Gross - Fee)
+	Net float64 `json:"net"`
+}
+
+// PnL contains the buy and the sell leg of an arbitrage
+type PnL struct {
+	Buy  Leg `json:"buy"`
+	Sell Leg `json:"sell"`
+}
+
+// Profit return the amount earned by the arbitrage after the fees
+func (p PnL) Profit() float64 {
+	return p.Sell.Net - p.Buy.Net
+}
+
+// PnLCalculator is delegated to calculate the profit and loss of an arbitrage of the given pair, buying on the
+// Buy market and selling on the Sell market. The fees are retrieved from the fee schedule of the markets
+type PnLCalculator struct {
+	Pair string
+	Buy  market.Market
+	Sell market.Market
+}
+
+// Calculate is delegated to calculate the legs of the arbitrage for the given volume and average prices.
+// Both the orders are taker orders
+func (c PnLCalculator) Calculate(volume, buyPrice, sellPrice float64) PnL {
+	return PnL{
+		Buy:  buyLeg(volume*buyPrice, fees.Compute(c.Buy, c.Pair, fees.Taker, volume*buyPrice)),
+		Sell: sellLeg(volume*sellPrice, fees.Compute(c.Sell, c.Pair, fees.Taker, volume*sellPrice)),
+	}
+}
+
+// buyLeg is delegated to create the buy leg: the fee is paid in addition to the amount bought
+func buyLeg(gross, fee float64) Leg {
+	return Leg{Gross: gross, Fee: fee, Net: gross + fee}
+}
+
+// sellLeg is delegated to create the sell leg: the fee is subtracted from the amount received
+func sellLeg(gross, fee float64) Leg {
+	return Leg{Gross: gross, Fee: fee, Net: gross - fee}
+}
@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"math"
+	"testing"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+)
+
+func Test_PnLCalculator(t *testing.T) {
+	type TestCase struct {
+		Buy       market.Market
+		Sell      market.Market
+		Volume    float64
+		BuyPrice  float64
+		SellPrice float64
+		Expected  PnL
+		Profit    float64
+		Number    int
+	}
+
+	flat := market.MarketFee{IsPercent: false, Tiers: []market.FeeTier{{Volume: 0, Maker: 1, Taker: 2}}}
+	cases := []TestCase{
+		// Without fees the net is the gross
+		{Buy: market.Market{}, Sell: market.Market{}, Volume: 2, BuyPrice: 100, SellPrice: 105,
+			Expected: PnL{Buy: Leg{Gross: 200, Fee: 0, Net: 200}, Sell: Leg{Gross: 210, Fee: 0, Net: 210}}, Profit: 10, Number: 1},
+		// The fee is added to the buy and subtracted from the sell
+		{Buy: market.Market{TakerFee: 0.1}, Sell: market.Market{TakerFee: 0.2}, Volume: 1, BuyPrice: 100, SellPrice: 105,
+			Expected: PnL{Buy: Leg{Gross: 100, Fee: 0.1, Net: 100.1}, Sell: Leg{Gross: 105, Fee: 0.21, Net: 104.79}}, Profit: 4.69, Number: 2},
+		// The fees remove the profit
+		{Buy: market.Market{TakerFee: 0.26}, Sell: market.Market{TakerFee: 0.26}, Volume: 1, BuyPrice: 100, SellPrice: 100.5,
+			Expected: PnL{Buy: Leg{Gross: 100, Fee: 0.26, Net: 100.26}, Sell: Leg{Gross: 100.5, Fee: 0.2613, Net: 100.2387}}, Profit: -0.0213, Number: 3},
+		// Flat fee
+		{Buy: market.Market{Fees: flat}, Sell: market.Market{Fees: flat}, Volume: 0.5, BuyPrice: 100, SellPrice: 110,
+			Expected: PnL{Buy: Leg{Gross: 50, Fee: 2, Net: 52}, Sell: Leg{Gross: 55, Fee: 2, Net: 53}}, Profit: 1, Number: 4},
+	}
+
+	for _, c := range cases {
+		calculator := PnLCalculator{Pair: testSymbol.String(), Buy: c.Buy, Sell: c.Sell}
+		pnl := calculator.Calculate(c.Volume, c.BuyPrice, c.SellPrice)
+		if !equalLeg(pnl.Buy, c.Expected.Buy) || !equalLeg(pnl.Sell, c.Expected.Sell) {
+			t.Errorf("Received %+v, expected %+v [test n. %d]", pnl, c.Expected, c.Number)
+		}
+		if math.Abs(pnl.Profit()-c.Profit) > 1e-9 {
+			t.Errorf("Received %v, expected %v [test n. %d]", pnl.Profit(), c.Profit, c.Number)
+		}
+	}
+}
+
+func Test_Percent(t *testing.T) {
+	type TestCase struct {
+		Amount   float64
+		Rate     float64
+		Expected float64
+		Number   int
+	}
+
+	cases := []TestCase{
+		{Amount: 1000, Rate: 0.26, Expected: 2.6, Number: 1},
+		{Amount: 50, Rate: 10, Expected: 5, Number: 2},
+		{Amount: 50, Rate: 0, Expected: 0, Number: 3},
+	}
+
+	for _, c := range cases {
+		if p := percent(c.Amount, c.Rate); math.Abs(p-c.Expected) > 1e-9 {
+			t.Errorf("Received %v, expected %v [test n. %d]", p, c.Expected, c.Number)
+		}
+	}
+}
+
+func equalLeg(a, b Leg) bool {
+	return math.Abs(a.Gross-b.Gross) < 1e-9 && math.Abs(a.Fee-b.Fee) < 1e-9 && math.Abs(a.Net-b.Net) < 1e-9
+}
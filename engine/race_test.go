@@ -0,0 +1,335 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"github.com/alessiosavi/GoArbitrage/rebalance"
+)
+
+// fakeExchange is an in memory market that generate a new order book for every request
+type fakeExchange struct {
+	name  string
+	price float64
+	mutex sync.RWMutex
+	books map[string][]market.MarketOrder
+	calls int
+}
+
+func (f *fakeExchange) Name() string                              { return f.name }
+func (f *fakeExchange) Init()                                     { f.books = make(map[string][]market.MarketOrder) }
+func (f *fakeExchange) SetFees()                                  {}
+func (f *fakeExchange) SetDepth(depth int)                        {}
+func (f *fakeExchange) SetBaseURL(baseURL string)                 {}
+func (f *fakeExchange) SetHTTPClient(httpClient *http.Client)     {}
+func (f *fakeExchange) GetPairsList(ctx context.Context) error    { return nil }
+func (f *fakeExchange) GetPairsDetails(ctx context.Context) error { return nil }
+func (f *fakeExchange) GetAllOrderBook(ctx context.Context) error { return nil }
+func (f *fakeExchange) GetMarketsData() market.Market             { return market.Market{MarketName: f.name} }
+func (f *fakeExchange) ParsePair(pair string) string              { return pair }
+func (f *fakeExchange) DecodeSymbol(pair string) (market.Symbol, error) {
+	return market.Symbol{}, errors.New("not implemented")
+}
+func (f *fakeExchange) EncodeSymbol(symbol market.Symbol) string { return symbol.String() }
+
+// GetOrderBook save a new order book, the price change at every call
+func (f *fakeExchange) GetOrderBook(ctx context.Context, pair string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.calls++
+	price := f.price + float64(f.calls%10)/10
+	f.books[pair] = []market.MarketOrder{{Price: price, Volume: 1}, {Price: price - 1, Volume: 1}}
+	return nil
+}
+
+// requests return the number of order books requested, read under the lock because the abandoned requests can still
+// be running
+func (f *fakeExchange) requests() int {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return f.calls
+}
+
+// GetMarketData return a copy of the order book, used as ask (first level) and bid (second level)
+func (f *fakeExchange) GetMarketData(pair string) (market.Market, error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	book, ok := f.books[pair]
+	if !ok {
+		return market.Market{}, errors.New("unable to find pair [" + pair + "]")
+	}
+	return market.Market{
+		MarketName: f.name,
+		Asks:       map[string][]market.MarketOrder{pair: {book[0]}},
+		Bids:       map[string][]market.MarketOrder{pair: {book[1]}},
+	}, nil
+}
+
+func Test_ArbitrageRace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "arbitrage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(file string) { OpportunitiesFile = file }(OpportunitiesFile)
+	OpportunitiesFile = path.Join(dir, "data.json")
+
+	exchanges := []*fakeExchange{{name: "FAKE_A", price: 100}, {name: "FAKE_B", price: 105}, {name: "FAKE_C", price: 110}}
+	for _, exchange := range exchanges {
+		exchange.Init()
+		markets.Register(exchange)
+	}
+	symbols := []market.Symbol{market.NewSymbol("btc", "usd"), market.NewSymbol("eth", "usd")}
+
+	// Every goroutine scan its own view of the markets, the exchanges are shared
+	var wg sync.WaitGroup
+	views := make([][]market.Market, 4)
+	for i := range views {
+		for _, exchange := range exchanges {
+			views[i] = append(views[i], market.Market{MarketName: exchange.name, TakerFee: 0.1,
+				Wallet: market.Wallet{MarketName: exchange.name, Coins: map[string]float64{"btc": 100, "eth": 100, "usd": 100000}}})
+		}
+		wg.Add(1)
+		go func(view *[]market.Market) {
+			defer wg.Done()
+			for n := 0; n < 20; n++ {
+				Arbitrage(context.Background(), symbols[n%len(symbols)], view)
+			}
+		}(&views[i])
+	}
+	wg.Wait()
+
+	for i := range views {
+		for j, m := range views[i] {
+			if m.MarketName != exchanges[j].name {
+				t.Errorf("Received %s, expected %s [test n. %d]", m.MarketName, exchanges[j].name, i+1)
+			}
+			if m.TakerFee != 0.1 || m.Wallet.Coins == nil {
+				t.Errorf("Fees or wallet of market %s not preserved [test n. %d]", m.MarketName, i+1)
+			}
+			if len(m.Asks) == 0 || len(m.Bids) == 0 {
+				t.Errorf("Order book of market %s not updated [test n. %d]", m.MarketName, i+1)
+			}
+		}
+		// Buy on A and sell on C at every scan, the usd have to increase
+		var usd float64
+		for _, m := range views[i] {
+			usd += m.Wallet.Coins["usd"]
+		}
+		if usd <= 300000 {
+			t.Errorf("Received %f usd, expected more than %f [test n. %d]", usd, 300000.0, i+1)
+		}
+	}
+}
+
+// slowExchange is a market that does not respond until the context is done
+type slowExchange struct {
+	fakeExchange
+}
+
+func (s *slowExchange) GetOrderBook(ctx context.Context, pair string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func Test_UpdateMarketsDeadline(t *testing.T) {
+	type TestCase struct {
+		Name    string
+		Updated bool
+		Number  int
+	}
+
+	fast := &fakeExchange{name: "FAKE_FAST", price: 100}
+	slow := &slowExchange{fakeExchange{name: "FAKE_SLOW", price: 100}}
+	fast.Init()
+	slow.Init()
+	markets.Register(fast)
+	markets.Register(slow)
+
+	old := map[string][]market.MarketOrder{testSymbol.String(): {{Price: 1, Volume: 1}}}
+	current := []market.Market{
+		{MarketName: "FAKE_SLOW", Asks: old, Bids: old, TakerFee: 0.2},
+		{MarketName: "FAKE_FAST", Asks: old, Bids: old, TakerFee: 0.2},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	view := updateMarkets(ctx, testSymbol, current)
+
+	cases := []TestCase{
+		// The order book of the abandoned market is not used
+		{Name: "FAKE_SLOW", Updated: false, Number: 1},
+		{Name: "FAKE_FAST", Updated: true, Number: 2},
+	}
+	for i, c := range cases {
+		updated := len(view[i].Asks[testSymbol.String()]) > 0
+		if view[i].MarketName != c.Name || updated != c.Updated {
+			t.Errorf("Received %s updated %v, expected %s updated %v [test n. %d]", view[i].MarketName, updated, c.Name, c.Updated, c.Number)
+		}
+		if view[i].TakerFee != 0.2 {
+			t.Errorf("Fee of market %s not preserved [test n. %d]", view[i].MarketName, c.Number)
+		}
+	}
+	// The previous view is not modified
+	if len(current[0].Asks) == 0 || current[1].Asks[testSymbol.String()][0].Price != 1 {
+		t.Errorf("Previous view modified: %+v", current)
+	}
+}
+
+// streamingExchange is a market whose order book is kept updated by a stream
+type streamingExchange struct {
+	fakeExchange
+	streaming bool
+}
+
+func (s *streamingExchange) Stream(ctx context.Context, pairs []string, updates chan<- markets.Update) error {
+	return nil
+}
+func (s *streamingExchange) Streaming(pair string) bool { return s.streaming }
+func (s *streamingExchange) SetStreamURL(url string)    {}
+
+func Test_UpdateMarketsStreaming(t *testing.T) {
+	type TestCase struct {
+		Streaming bool
+		Calls     int
+		Number    int
+	}
+
+	exchange := &streamingExchange{fakeExchange: fakeExchange{name: "FAKE_STREAM", price: 100}}
+	exchange.Init()
+	markets.Register(exchange)
+	// The first book is received from the stream
+	exchange.GetOrderBook(context.Background(), testSymbol.String())
+
+	cases := []TestCase{
+		{Streaming: true, Calls: 1, Number: 1},
+		// The order book is requested when the stream is not synchronized
+		{Streaming: false, Calls: 2, Number: 2},
+	}
+	for _, c := range cases {
+		exchange.streaming = c.Streaming
+		view := updateMarkets(context.Background(), testSymbol, []market.Market{{MarketName: "FAKE_STREAM"}})
+		if len(view[0].Asks[testSymbol.String()]) == 0 {
+			t.Errorf("Order book not updated [test n. %d]", c.Number)
+		}
+		if exchange.requests() != c.Calls {
+			t.Errorf("Received %d, expected %d [test n. %d]", exchange.requests(), c.Calls, c.Number)
+		}
+	}
+}
+
+func Test_SaveOpportunityConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "arbitrage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(file string) { OpportunitiesFile = file }(OpportunitiesFile)
+	OpportunitiesFile = path.Join(dir, "data.json")
+
+	// The pairs scan and the cycles scans save the opportunities at the same time
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for n := 0; n < 50; n++ {
+				if i == 0 {
+					saveOpportunity(opportunity{Type: CROSS_EXCHANGE, Volume: float64(n)})
+				} else {
+					saveOpportunity(cycleOpportunity{Type: MULTI_HOP, Legs: make([]cycleLeg, 4)})
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	data, err := ioutil.ReadFile(OpportunitiesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved []map[string]interface{}
+	if err = json.Unmarshal([]byte("["+strings.TrimSuffix(string(data), ",\n")+"]"), &saved); err != nil {
+		t.Fatalf("Received %v, expected the records not interleaved", err)
+	}
+	if len(saved) != 150 {
+		t.Errorf("Received %d records, expected %d", len(saved), 150)
+	}
+}
+
+func Test_WatchInventoryRace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "arbitrage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(file string) { OpportunitiesFile = file }(OpportunitiesFile)
+	OpportunitiesFile = path.Join(dir, "data.json")
+	defer func() { Inventory = nil }()
+	Inventory = rebalance.New(rebalance.Config{Threshold: rebalance.DEFAULT_THRESHOLD}, true)
+
+	exchanges := []*fakeExchange{{name: "WATCH_A", price: 100}, {name: "WATCH_B", price: 110}}
+	for _, exchange := range exchanges {
+		exchange.Init()
+		markets.Register(exchange)
+	}
+	// The transfers rebalance the btc and the usd between the markets in paper mode, changing the wallets
+	view := []market.Market{
+		{MarketName: "WATCH_A", Wallet: market.Wallet{MarketName: "WATCH_A", Coins: map[string]float64{"btc": 0, "usd": 10000}}},
+		{MarketName: "WATCH_B", Wallet: market.Wallet{MarketName: "WATCH_B", Coins: map[string]float64{"btc": 100, "usd": 0}}},
+	}
+	symbol := market.NewSymbol("btc", "usd")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := make(chan markets.Update)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		Watch(ctx, updates, []market.Symbol{symbol}, &view, 2*time.Millisecond, time.Second)
+	}()
+	// The cycles scan and the report of the inventory run together with the stream
+	go func() {
+		defer wg.Done()
+		for ctx.Err() == nil {
+			var data []market.Market
+			for _, exchange := range exchanges {
+				data = append(data, exchange.GetMarketsData())
+			}
+			MultiHop(data)
+			Inventory.Paused(symbol)
+			Inventory.Pending()
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	for n := 0; n < 30; n++ {
+		updates <- markets.Update{Market: exchanges[n%2].name, Symbol: symbol}
+		time.Sleep(3 * time.Millisecond)
+	}
+	cancel()
+	wg.Wait()
+
+	if len(Inventory.History()) == 0 {
+		t.Error("Expected the transfers planned by the watch")
+	}
+	if exchanges[0].requests() == 0 || exchanges[1].requests() == 0 {
+		t.Errorf("Received %d and %d requests, expected the scans of the watch", exchanges[0].requests(), exchanges[1].requests())
+	}
+	for _, m := range view {
+		for currency, amount := range m.Wallet.Coins {
+			if amount < -epsilon {
+				t.Errorf("Received %f %s on %s, expected a positive amount", amount, currency, m.MarketName)
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"errors"
+	"time"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+)
+
+// ErrStaleBook is returned when the order book of a leg is older than the max age
+var ErrStaleBook = errors.New("STALE_ORDER_BOOK")
+
+// ErrSkewedBooks is returned when the order books of the legs are too far apart in time
+var ErrSkewedBooks = errors.New("SKEWED_ORDER_BOOKS")
+
+// StalenessPolicy contains the limits on the times of the order books used for evaluate an opportunity
+type StalenessPolicy struct {
+	// MaxAge is the max time since the order book of a leg was received, 0 disable the check
+	MaxAge time.Duration
+	// MaxSkew is the max difference between the times of the order books of the legs, 0 disable the check
+	MaxSkew time.Duration
+	// Reject discard the opportunities that violate the limits, otherwise they are only flagged as stale
+	Reject bool
+}
+
+// Staleness is the policy applied by the engine to the opportunities found
+var Staleness = StalenessPolicy{Reject: true}
+
+// now is the clock used for calculate the age of the order books, replaced in the tests
+var now = time.Now
+
+// Check is delegated to verify the times of the order books of the buy and the sell leg. The age is calculated from
+// the local receive time, or from the time sent by the market when the receive time is missing. The legs without any
+// time are stale when the max age is set. The skew use the times sent by the markets when both the legs have it, the
+// receive times otherwise
+func (p StalenessPolicy) Check(buy, sell market.BookTime) error {
+	if p.MaxAge > 0 {
+		current := now()
+		for _, t := range []market.BookTime{buy, sell} {
+			updated := t.Received
+			if updated.IsZero() {
+				updated = t.Exchange
+			}
+			if updated.IsZero() || current.Sub(updated) > p.MaxAge {
+				return ErrStaleBook
+			}
+		}
+	}
+	if p.MaxSkew > 0 {
+		var skew time.Duration
+		switch {
+		case !buy.Exchange.IsZero() && !sell.Exchange.IsZero():
+			skew = buy.Exchange.Sub(sell.Exchange)
+		case !buy.Received.IsZero() && !sell.Received.IsZero():
+			skew = buy.Received.Sub(sell.Received)
+		}
+		if skew < 0 {
+			skew = -skew
+		}
+		if skew > p.MaxSkew {
+			return ErrSkewedBooks
+		}
+	}
+	return nil
+}
+
+// CheckAll is delegated to verify the times of the order books of all the legs of a cycle, every couple of legs is
+// checked as the buy and the sell leg of an opportunity
+func (p StalenessPolicy) CheckAll(times []market.BookTime) error {
+	for i := range times {
+		for j := i + 1; j < len(times); j++ {
+			if err := p.Check(times[i], times[j]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+)
+
+func Test_StalenessCheck(t *testing.T) {
+	type TestCase struct {
+		Policy   StalenessPolicy
+		Buy      market.BookTime
+		Sell     market.BookTime
+		Expected error
+		Number   int
+	}
+
+	current := time.Date(2020, 4, 9, 15, 0, 0, 0, time.UTC)
+	defer func(clock func() time.Time) { now = clock }(now)
+	now = func() time.Time { return current }
+	ago := func(d time.Duration) time.Time { return current.Add(-d) }
+	policy := StalenessPolicy{MaxAge: 5 * time.Second, MaxSkew: time.Second, Reject: true}
+
+	cases := []TestCase{
+		{Policy: policy, Buy: market.BookTime{Received: ago(time.Second)}, Sell: market.BookTime{Received: ago(1500 * time.Millisecond)}, Expected: nil, Number: 1},
+		// The sell leg is too old
+		{Policy: policy, Buy: market.BookTime{Received: ago(time.Second)}, Sell: market.BookTime{Received: ago(6 * time.Second)}, Expected: ErrStaleBook, Number: 2},
+		// The receive times are too far apart
+		{Policy: policy, Buy: market.BookTime{Received: ago(4 * time.Second)}, Sell: market.BookTime{Received: ago(time.Second)}, Expected: ErrSkewedBooks, Number: 3},
+		// The times of the markets are used when available for both the legs
+		{Policy: policy, Buy: market.BookTime{Exchange: ago(10 * time.Second), Received: ago(time.Second)},
+			Sell: market.BookTime{Exchange: ago(7 * time.Second), Received: ago(time.Second)}, Expected: ErrSkewedBooks, Number: 4},
+		{Policy: policy, Buy: market.BookTime{Exchange: ago(3 * time.Second), Received: ago(4 * time.Second)},
+			Sell: market.BookTime{Received: ago(time.Second)}, Expected: ErrSkewedBooks, Number: 5},
+		{Policy: policy, Buy: market.BookTime{Exchange: ago(3 * time.Second), Received: ago(time.Second)},
+			Sell: market.BookTime{Received: ago(time.Second)}, Expected: nil, Number: 6},
+		// The legs without a time are stale when the max age is set
+		{Policy: policy, Buy: market.BookTime{}, Sell: market.BookTime{Received: ago(time.Second)}, Expected: ErrStaleBook, Number: 7},
+		// Disabled checks
+		{Policy: StalenessPolicy{}, Buy: market.BookTime{Received: ago(time.Hour)}, Sell: market.BookTime{Received: ago(time.Second)}, Expected: nil, Number: 8},
+		{Policy: StalenessPolicy{MaxSkew: time.Second}, Buy: market.BookTime{}, Sell: market.BookTime{Received: ago(time.Second)}, Expected: nil, Number: 9},
+		// Without the receive time, the age is calculated from the time of the market
+		{Policy: policy, Buy: market.BookTime{Exchange: ago(6 * time.Second)}, Sell: market.BookTime{Exchange: ago(6 * time.Second)}, Expected: ErrStaleBook, Number: 10},
+		{Policy: policy, Buy: market.BookTime{Exchange: ago(2 * time.Second)}, Sell: market.BookTime{Exchange: ago(2 * time.Second)}, Expected: nil, Number: 11},
+	}
+	for _, c := range cases {
+		if err := c.Policy.Check(c.Buy, c.Sell); err != c.Expected {
+			t.Errorf("Received %v, expected %v [test n. %d]", err, c.Expected, c.Number)
+		}
+	}
+}
+
+func Test_FindOpportunitiesStale(t *testing.T) {
+	type TestCase struct {
+		Reject bool
+		Found  bool
+		Stale  bool
+		Number int
+	}
+
+	current := time.Now()
+	defer func(policy StalenessPolicy) { Staleness = policy }(Staleness)
+	buy := initMarket("A", []market.MarketOrder{{Price: 100, Volume: 1}}, []market.MarketOrder{{Price: 99, Volume: 1}}, 0)
+	sell := initMarket("B", []market.MarketOrder{{Price: 106, Volume: 1}}, []market.MarketOrder{{Price: 105, Volume: 2}}, 0)
+	buy.Times = map[string]market.BookTime{testSymbol.String(): {Received: current.Add(-time.Minute)}}
+	sell.Times = map[string]market.BookTime{testSymbol.String(): {Received: current}}
+
+	cases := []TestCase{
+		{Reject: true, Found: false, Number: 1},
+		{Reject: false, Found: true, Stale: true, Number: 2},
+	}
+	for _, c := range cases {
+		Staleness = StalenessPolicy{MaxAge: 10 * time.Second, Reject: c.Reject}
+		opportunities := findOpportunities(testSymbol, []market.Market{buy, sell})
+		if found := len(opportunities) > 0; found != c.Found {
+			t.Errorf("Received %v, expected %v [test n. %d]", found, c.Found, c.Number)
+			continue
+		}
+		if c.Found && (opportunities[0].Stale != c.Stale || !opportunities[0].BuyBookTime.Received.Equal(current.Add(-time.Minute))) {
+			t.Errorf("Received %+v, expected a stale opportunity [test n. %d]", opportunities[0], c.Number)
+		}
+	}
+}
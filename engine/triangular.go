@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"go.uber.org/zap"
+)
+
+// TRIANGULAR is the type of the opportunities that convert a currency into two other currencies and back, on the
+// same market
+const TRIANGULAR = "triangular"
+
+// Triangular is delegated to find the triangular arbitrage opportunities (e.g. EUR->BTC->ETH->EUR) between all the
+// pairs of the given market. The most profitable opportunity is saved in the opportunities file
+func Triangular(m market.Market) {
+	opportunities := findTriangles(m)
+	if len(opportunities) == 0 {
+		return
+	}
+	zap.S().Debugf("All the triangles: %+v", opportunities)
+	o := opportunities[0]
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("\nTriangular opportunity on [%s] starting with [%s]: %f\n", m.MarketName, o.Currency, o.AmountIn))
+	sb.WriteString(fmt.Sprintf("Out: %f | Difference: %f (%f%%)\n", o.AmountOut, o.Earning, o.Return))
+	for _, leg := range o.Legs {
+		sb.WriteString(fmt.Sprintf("%s %s: %f %s -> %f %s\n", strings.ToUpper(leg.Side), leg.Pair, leg.AmountIn, leg.From, leg.AmountOut, leg.To))
+	}
+	zap.S().Info(sb.String())
+	saveOpportunity(o)
+}
+
+// findTriangles is delegated to evaluate every cycle of three currencies allowed by the order books of the given
+// market. Every cycle is evaluated once, starting from the lowest currency (the rotations have the same return).
+// Return the profitable opportunities sorted by return (the earnings are in different currencies), the most relevant
+// first
+func findTriangles(m market.Market) []cycleOpportunity {
+	graph := make(map[string][]edge)
+	for _, e := range marketEdges(m) {
+		graph[e.From] = append(graph[e.From], e)
+	}
+	// The pairs are iterated in a random order, the cycles are sorted for have a stable result
+	for currency := range graph {
+		edges := graph[currency]
+		sort.Slice(edges, func(i, j int) bool { return edges[i].To < edges[j].To })
+	}
+
+	var opportunities []cycleOpportunity
+	for start, first := range graph {
+		for _, a := range first {
+			if a.To <= start {
+				continue
+			}
+			for _, b := range graph[a.To] {
+				if b.To <= start {
+					continue
+				}
+				for _, c := range graph[b.To] {
+					if c.To != start {
+						continue
+					}
+					if o, found := evaluateCycle(TRIANGULAR, []edge{a, b, c}); found {
+						opportunities = append(opportunities, o)
+					}
+				}
+			}
+		}
+	}
+	sort.SliceStable(opportunities, func(i, j int) bool {
+		if opportunities[i].Return != opportunities[j].Return {
+			return opportunities[i].Return > opportunities[j].Return
+		}
+		return opportunities[i].Currency < opportunities[j].Currency
+	})
+	return opportunities
+}
+
+// evaluateCycle is delegated to verify the times of the order books of the legs and walk the cycle. The transfers
+// does not have an order book, so they are not checked. The earning is expressed in the start currency
+func evaluateCycle(kind string, edges []edge) (cycleOpportunity, bool) {
+	path := make([]string, 0, len(edges)+1)
+	times := make([]market.BookTime, 0, len(edges))
+	for i := range edges {
+		path = append(path, edges[i].Market+":"+edges[i].From)
+		if edges[i].ToMarket == "" {
+			times = append(times, edges[i].time)
+		}
+	}
+	path = append(path, edges[0].Market+":"+edges[0].From)
+	stale := Staleness.CheckAll(times)
+	if stale != nil && Staleness.Reject {
+		zap.S().Debugf("Discarding cycle [%s]: %s", strings.Join(path, "->"), stale.Error())
+		return cycleOpportunity{}, false
+	}
+	o, found := walkCycle(kind, edges)
+	if !found {
+		return cycleOpportunity{}, false
+	}
+	if stale != nil {
+		zap.S().Warnf("Cycle [%s] flagged: %s", strings.Join(path, "->"), stale.Error())
+		o.Stale = true
+	}
+	return o, true
+}
@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+)
+
+// book contains the orders of a pair of a synthetic market
+type book struct {
+	Asks []market.MarketOrder
+	Bids []market.MarketOrder
+	Time time.Time
+}
+
+// initPairsMarket is delegated to initialize a synthetic market with the given books
+func initPairsMarket(name string, books map[market.Symbol]book, fee float64) market.Market {
+	m := market.Market{
+		MarketName: name,
+		Asks:       make(map[string][]market.MarketOrder),
+		Bids:       make(map[string][]market.MarketOrder),
+		Symbols:    make(map[string]market.Symbol),
+		Times:      make(map[string]market.BookTime),
+		TakerFee:   fee,
+	}
+	for symbol, b := range books {
+		m.Symbols[symbol.String()] = symbol
+		m.Asks[symbol.String()] = b.Asks
+		m.Bids[symbol.String()] = b.Bids
+		m.Times[symbol.String()] = market.BookTime{Received: b.Time}
+	}
+	return m
+}
+
+func Test_FindTriangles(t *testing.T) {
+	type TestCase struct {
+		Books     map[market.Symbol]book
+		Fee       float64
+		Found     bool
+		Path      []string
+		AmountIn  float64
+		AmountOut float64
+		Number    int
+	}
+
+	current := time.Now()
+	btceur, ethbtc, etheur := market.NewSymbol("btc", "eur"), market.NewSymbol("eth", "btc"), market.NewSymbol("eth", "eur")
+	orders := func(price, volume float64) []market.MarketOrder {
+		return []market.MarketOrder{{Price: price, Volume: volume}}
+	}
+	defer func(policy StalenessPolicy) { Staleness = policy }(Staleness)
+	Staleness = StalenessPolicy{MaxAge: 10 * time.Second, Reject: true}
+
+	cases := []TestCase{
+		// BTC->ETH->EUR->BTC: 1 / 0.02 * 205 / 10000 = 1.025, limited by the 10 ETH on sale
+		{Books: map[market.Symbol]book{
+			btceur: {Asks: orders(10000, 1), Bids: orders(9990, 1), Time: current},
+			ethbtc: {Asks: orders(0.02, 10), Bids: orders(0.0199, 10), Time: current},
+			etheur: {Asks: orders(210, 20), Bids: orders(205, 20), Time: current}},
+			Found: true, Path: []string{"btc", "eth", "eur"}, AmountIn: 0.2, AmountOut: 0.205, Number: 1},
+		// The taker fees remove the profit
+		{Books: map[market.Symbol]book{
+			btceur: {Asks: orders(10000, 1), Bids: orders(9990, 1), Time: current},
+			ethbtc: {Asks: orders(0.02, 10), Bids: orders(0.0199, 10), Time: current},
+			etheur: {Asks: orders(210, 20), Bids: orders(205, 20), Time: current}},
+			Fee: 1, Found: false, Number: 2},
+		// The second level of ETH is still profitable (205 / 201), the third one is not
+		{Books: map[market.Symbol]book{
+			btceur: {Asks: orders(10000, 1), Bids: orders(9990, 1), Time: current},
+			ethbtc: {Asks: []market.MarketOrder{{Price: 0.02, Volume: 10}, {Price: 0.0201, Volume: 10}, {Price: 0.0206, Volume: 10}},
+				Bids: orders(0.0199, 10), Time: current},
+			etheur: {Asks: orders(210, 40), Bids: orders(205, 40), Time: current}},
+			Found: true, Path: []string{"btc", "eth", "eur"}, AmountIn: 0.401, AmountOut: 0.41, Number: 3},
+		// The prices are consistent, no cycle is profitable
+		{Books: map[market.Symbol]book{
+			btceur: {Asks: orders(10000, 1), Bids: orders(9990, 1), Time: current},
+			ethbtc: {Asks: orders(0.0201, 10), Bids: orders(0.0199, 10), Time: current},
+			etheur: {Asks: orders(201, 20), Bids: orders(199, 20), Time: current}},
+			Found: false, Number: 4},
+		// The order book of a leg is stale
+		{Books: map[market.Symbol]book{
+			btceur: {Asks: orders(10000, 1), Bids: orders(9990, 1), Time: current.Add(-time.Minute)},
+			ethbtc: {Asks: orders(0.02, 10), Bids: orders(0.0199, 10), Time: current},
+			etheur: {Asks: orders(210, 20), Bids: orders(205, 20), Time: current}},
+			Found: false, Number: 5},
+		// Without the third pair there is no cycle
+		{Books: map[market.Symbol]book{
+			btceur: {Asks: orders(10000, 1), Bids: orders(9990, 1), Time: current},
+			ethbtc: {Asks: orders(0.02, 10), Bids: orders(0.0199, 10), Time: current}},
+			Found: false, Number: 6},
+	}
+
+	for _, c := range cases {
+		opportunities := findTriangles(initPairsMarket("A", c.Books, c.Fee))
+		found := len(opportunities) > 0
+		if found != c.Found {
+			t.Errorf("Received %v, expected %v [test n. %d]", found, c.Found, c.Number)
+			continue
+		}
+		if !found {
+			continue
+		}
+		o := opportunities[0]
+		if o.Type != TRIANGULAR || len(o.Legs) != len(c.Path) {
+			t.Errorf("Received %+v, expected a triangle [test n. %d]", o, c.Number)
+			continue
+		}
+		for i := range o.Legs {
+			if o.Legs[i].From != c.Path[i] || o.Legs[i].To != c.Path[(i+1)%len(c.Path)] {
+				t.Errorf("Received %+v, expected %v [test n. %d]", o.Legs, c.Path, c.Number)
+				break
+			}
+		}
+		if math.Abs(o.AmountIn-c.AmountIn) > 1e-9 || math.Abs(o.AmountOut-c.AmountOut) > 1e-9 {
+			t.Errorf("Received %f -> %f, expected %f -> %f [test n. %d]", o.AmountIn, o.AmountOut, c.AmountIn, c.AmountOut, c.Number)
+		}
+		if math.Abs(o.Earning-(c.AmountOut-c.AmountIn)) > 1e-9 || o.Legs[0].Side != "buy" || o.Legs[1].Side != "sell" {
+			t.Errorf("Received %+v, expected earning %f [test n. %d]", o, c.AmountOut-c.AmountIn, c.Number)
+		}
+	}
+}
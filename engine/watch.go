@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"context"
+	"time"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"go.uber.org/zap"
+)
+
+// DEFAULT_DEBOUNCE is the default time waited after the change of an order book before the scan of the pair,
+// the updates received in the meantime for the same pair trigger a single scan
+const DEFAULT_DEBOUNCE = 50 * time.Millisecond
+
+// scanPair is the scan executed for every pair changed, replaced in the tests
+var scanPair = Arbitrage
+
+// Watch is delegated to scan the pair of every order book changed, instead of scanning all the pairs in sequence.
+// The updates of the same pair received during the debounce are coalesced: the pair is scanned once, at most
+// debounce after the first change. Only the given symbols are evaluated. The scans are executed one at a time,
+// every scan have the given timeout. The method block until the context is done or the updates channel is closed
+func Watch(ctx context.Context, updates <-chan markets.Update, symbols []market.Symbol, marketsData *[]market.Market, debounce, timeout time.Duration) {
+	var allowed = make(map[market.Symbol]bool, len(symbols))
+	for _, symbol := range symbols {
+		allowed[symbol] = true
+	}
+	// pending contains the time of the scan of the pairs changed, order save the pairs by arrival
+	var pending = make(map[market.Symbol]time.Time)
+	var order []market.Symbol
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+			if !allowed[update.Symbol] {
+				continue
+			}
+			if _, ok := pending[update.Symbol]; ok {
+				continue
+			}
+			pending[update.Symbol] = time.Now().Add(debounce)
+			order = append(order, update.Symbol)
+		case <-timer.C:
+		}
+
+		// The inventory is updated once per tick, before the scans of the pairs whose debounce is expired
+		if len(order) > 0 && !time.Now().Before(pending[order[0]]) {
+			Rebalance(*marketsData)
+		}
+		// Scan the pairs whose debounce is expired, the scan can take longer than the debounce of the other pairs
+		for len(order) > 0 && !time.Now().Before(pending[order[0]]) {
+			symbol := order[0]
+			order = order[1:]
+			delete(pending, symbol)
+			scan, cancel := context.WithTimeout(ctx, timeout)
+			zap.S().Debugf("Order book of [%s] changed, scanning", symbol)
+			scanPair(scan, symbol, marketsData)
+			cancel()
+			if ctx.Err() != nil {
+				return
+			}
+		}
+		if len(order) > 0 {
+			// A value left in the channel by the previous deadline only cause an early check
+			timer.Reset(time.Until(pending[order[0]]))
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/markets"
+)
+
+func Test_Watch(t *testing.T) {
+	type TestCase struct {
+		Updates  []market.Symbol
+		Expected []market.Symbol
+		Number   int
+	}
+
+	btc, eth, xrp := market.NewSymbol("btc", "usd"), market.NewSymbol("eth", "usd"), market.NewSymbol("xrp", "usd")
+	cases := []TestCase{
+		// The updates of the same pair are coalesced
+		{Updates: []market.Symbol{btc, btc, btc}, Expected: []market.Symbol{btc}, Number: 1},
+		// The pairs are scanned in order of arrival
+		{Updates: []market.Symbol{eth, btc, eth}, Expected: []market.Symbol{eth, btc}, Number: 2},
+		// The pairs that are not evaluated are ignored
+		{Updates: []market.Symbol{xrp, btc}, Expected: []market.Symbol{btc}, Number: 3},
+	}
+
+	defer func(scan func(context.Context, market.Symbol, *[]market.Market)) { scanPair = scan }(scanPair)
+	var mutex sync.Mutex
+	var scanned []market.Symbol
+	scanPair = func(ctx context.Context, symbol market.Symbol, marketsData *[]market.Market) {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Errorf("Scan of %s without timeout", symbol)
+		}
+		mutex.Lock()
+		scanned = append(scanned, symbol)
+		mutex.Unlock()
+	}
+
+	for _, c := range cases {
+		mutex.Lock()
+		scanned = nil
+		mutex.Unlock()
+		updates := make(chan markets.Update, len(c.Updates))
+		for _, symbol := range c.Updates {
+			updates <- markets.Update{Market: "FAKE", Symbol: symbol}
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			Watch(ctx, updates, []market.Symbol{btc, eth}, &[]market.Market{}, 20*time.Millisecond, time.Second)
+			close(done)
+		}()
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+		<-done
+		mutex.Lock()
+		if len(scanned) != len(c.Expected) {
+			t.Errorf("Received %v, expected %v [test n. %d]", scanned, c.Expected, c.Number)
+		} else {
+			for i := range scanned {
+				if scanned[i] != c.Expected[i] {
+					t.Errorf("Received %v, expected %v [test n. %d]", scanned, c.Expected, c.Number)
+				}
+			}
+		}
+		mutex.Unlock()
+	}
+}
+
+func Test_WatchDebounce(t *testing.T) {
+	defer func(scan func(context.Context, market.Symbol, *[]market.Market)) { scanPair = scan }(scanPair)
+	scans := make(chan time.Time, 10)
+	scanPair = func(ctx context.Context, symbol market.Symbol, marketsData *[]market.Market) {
+		scans <- time.Now()
+	}
+
+	btc := market.NewSymbol("btc", "usd")
+	updates := make(chan markets.Update)
+	done := make(chan struct{})
+	go func() {
+		Watch(context.Background(), updates, []market.Symbol{btc}, &[]market.Market{}, 50*time.Millisecond, time.Second)
+		close(done)
+	}()
+
+	start := time.Now()
+	updates <- markets.Update{Symbol: btc}
+	time.Sleep(10 * time.Millisecond)
+	updates <- markets.Update{Symbol: btc}
+	// The scan is executed after the debounce of the first update
+	scan := <-scans
+	if elapsed := scan.Sub(start); elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Received a scan after %v, expected after %v [test n. %d]", elapsed, 50*time.Millisecond, 1)
+	}
+	// A new update after the scan trigger a new scan
+	updates <- markets.Update{Symbol: btc}
+	<-scans
+	// The watch is stopped by the close of the channel
+	close(updates)
+	<-done
+	if len(scans) != 0 {
+		t.Errorf("Received %d scans, expected %d [test n. %d]", len(scans)+2, 2, 2)
+	}
+}
@@ -0,0 +1,336 @@
+// Package execution contains the coordinator of the live executions: the two legs of an opportunity are placed at the
+// same time on the buy and on the sell market, their fills are tracked and, when a leg fills more than the other, the
+// volume left exposed is closed by a recovery policy (chase the missing leg, hedge it on a third market or unwind the
+// filled one). Every step of the execution is recorded as a transition of a state machine.
+// The package is a library for now: the engine does not use the coordinator and submits the two legs by itself
+package execution
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"go.uber.org/zap"
+)
+
+// ErrInvalidLeg is returned when a leg is without a trader, a price or a volume, or has the wrong side
+var ErrInvalidLeg = errors.New("INVALID_LEG")
+
+// ErrUnrecovered is returned when the recovery policy is not able to close the exposed volume
+var ErrUnrecovered = errors.New("UNRECOVERED_EXPOSURE")
+
+// DEFAULT_FILL_TIMEOUT is the default time waited for the fill of an order before cancel it
+const DEFAULT_FILL_TIMEOUT = 10 * time.Second
+
+// DEFAULT_POLL_INTERVAL is the default interval between the requests of the state of an order
+const DEFAULT_POLL_INTERVAL = 250 * time.Millisecond
+
+// DEFAULT_SLIPPAGE is the default percent of the price conceded for every attempt of the recovery
+const DEFAULT_SLIPPAGE = 0.1
+
+// DEFAULT_ATTEMPTS is the default number of orders placed by the recovery
+const DEFAULT_ATTEMPTS = 3
+
+// tolerance is the volume exposed that is considered float error
+const tolerance = 1e-9
+
+// Policy is the way used for close the volume exposed when only one leg is filled
+type Policy string
+
+const (
+	// Chase place again the volume missing on the market of the leg not filled, conceding the slippage
+	Chase Policy = "chase"
+	// Hedge place the volume missing on the hedge markets, in rotation, conceding the slippage
+	Hedge Policy = "hedge"
+	// Unwind revert the volume exposed on the market of the leg filled, conceding the slippage
+	Unwind Policy = "unwind"
+)
+
+// State is the state of an execution
+type State string
+
+const (
+	// Pending is the state of the execution before placing the legs
+	Pending State = "pending"
+	// Placed means that at least one leg is placed, the fills are tracked
+	Placed State = "placed"
+	// Filled means that both the legs are filled for the same volume (final)
+	Filled State = "filled"
+	// Canceled means that no leg was filled (final)
+	Canceled State = "canceled"
+	// Exposed means that the legs are filled for a different volume
+	Exposed State = "exposed"
+	// Recovering means that the recovery policy is placing the orders for close the volume exposed
+	Recovering State = "recovering"
+	// Recovered means that the volume exposed was closed by the recovery (final)
+	Recovered State = "recovered"
+	// Failed means that the recovery was not able to close the volume exposed (final)
+	Failed State = "failed"
+)
+
+// Venue is a market where the orders can be placed
+type Venue struct {
+	Market string
+	Trader markets.Trader
+}
+
+// Leg is an order of the opportunity, to place on the given venue
+type Leg struct {
+	Venue
+	Order markets.Order
+}
+
+// Report contains the result of an order placed by the coordinator
+type Report struct {
+	Market string              `json:"market"`
+	Order  markets.Order       `json:"order"`
+	ID     string              `json:"id"`
+	Status markets.OrderStatus `json:"status"`
+	// Error is the error returned by the market, the order can be partially filled anyway
+	Error string `json:"error,omitempty"`
+	// Recovery is true for the orders placed by the recovery policy
+	Recovery bool `json:"recovery"`
+}
+
+// Transition is a change of the state of the execution
+type Transition struct {
+	From   State  `json:"from"`
+	To     State  `json:"to"`
+	Reason string `json:"reason,omitempty"`
+	Time   int64  `json:"time"`
+}
+
+// Execution contains the orders placed for an opportunity and the state reached
+type Execution struct {
+	Symbol market.Symbol `json:"symbol"`
+	Policy Policy        `json:"policy"`
+	State  State         `json:"state"`
+	// Orders contains the buy leg, the sell leg and then the orders of the recovery
+	Orders []Report `json:"orders"`
+	// Exposure is the base volume bought and not sold, negative if sold and not bought
+	Exposure    float64      `json:"exposure"`
+	Transitions []Transition `json:"transitions"`
+}
+
+// transition is delegated to move the execution to the given state
+func (e *Execution) transition(to State, reason string) {
+	zap.S().Debugf("Execution of [%s] from [%s] to [%s] %s", e.Symbol, e.State, to, reason)
+	e.Transitions = append(e.Transitions, Transition{From: e.State, To: to, Reason: reason, Time: time.Now().UnixNano()})
+	e.State = to
+}
+
+// Coordinator is delegated to execute the legs of the opportunities and to recover the volume exposed
+type Coordinator struct {
+	Policy Policy
+	// Hedges are the markets used by the Hedge policy
+	Hedges []Venue
+	// FillTimeout is the time waited for the fill of an order, the volume not filled is canceled
+	FillTimeout time.Duration
+	// PollInterval is the interval between the requests of the state of the orders
+	PollInterval time.Duration
+	// Slippage is the percent of the price of the leg conceded for every attempt of the recovery
+	Slippage float64
+	// Attempts is the max number of orders placed by the recovery
+	Attempts int
+}
+
+// New is delegated to initialize a coordinator with the given policy and the default timings
+func New(policy Policy) *Coordinator {
+	return &Coordinator{
+		Policy:       policy,
+		FillTimeout:  DEFAULT_FILL_TIMEOUT,
+		PollInterval: DEFAULT_POLL_INTERVAL,
+		Slippage:     DEFAULT_SLIPPAGE,
+		Attempts:     DEFAULT_ATTEMPTS,
+	}
+}
+
+// Execute is delegated to place the buy and the sell leg at the same time and wait their fills. If a leg is not placed
+// the other one is canceled immediately. If the legs are filled for a different volume, the recovery policy try to
+// close the exposure. The execution is returned also in case of error, with all the orders placed
+func (c *Coordinator) Execute(ctx context.Context, buy, sell Leg) (Execution, error) {
+	if !validLeg(buy, markets.Buy) || !validLeg(sell, markets.Sell) || buy.Order.Symbol != sell.Order.Symbol {
+		return Execution{}, ErrInvalidLeg
+	}
+	e := Execution{Symbol: buy.Order.Symbol, Policy: c.Policy, State: Pending}
+	legs := []Leg{buy, sell}
+	e.Orders = make([]Report, len(legs))
+	var errs = make([]error, len(legs))
+	concurrently(len(legs), func(i int) {
+		e.Orders[i], errs[i] = place(ctx, legs[i].Venue, legs[i].Order)
+	})
+	if errs[0] != nil && errs[1] != nil {
+		e.transition(Canceled, "no leg placed")
+		return e, errs[0]
+	}
+	e.transition(Placed, "")
+
+	// A leg alone is not waited, the order is canceled as soon as possible
+	abort := errs[0] != nil || errs[1] != nil
+	concurrently(len(legs), func(i int) {
+		if errs[i] == nil {
+			c.track(ctx, legs[i].Venue, &e.Orders[i], abort)
+		}
+	})
+	e.Exposure = e.Orders[0].Status.Filled - e.Orders[1].Status.Filled
+	if math.Abs(e.Exposure) <= tolerance {
+		e.Exposure = 0
+		if e.Orders[0].Status.Filled > 0 {
+			e.transition(Filled, "")
+			return e, nil
+		}
+		e.transition(Canceled, "no leg filled")
+		return e, nil
+	}
+	e.transition(Exposed, fmt.Sprintf("bought %f, sold %f", e.Orders[0].Status.Filled, e.Orders[1].Status.Filled))
+	return e, c.recover(ctx, &e, buy, sell)
+}
+
+// recover is delegated to place the orders of the recovery policy until the exposure is closed or the attempts are
+// exhausted. Every attempt concede the slippage to the price of the previous one
+func (c *Coordinator) recover(ctx context.Context, e *Execution, buy, sell Leg) error {
+	e.transition(Recovering, string(c.Policy))
+	for attempt := 1; attempt <= c.Attempts && math.Abs(e.Exposure) > tolerance && ctx.Err() == nil; attempt++ {
+		venue, order, ok := c.recoveryOrder(attempt, e.Exposure, buy, sell)
+		if !ok {
+			break
+		}
+		report, err := place(ctx, venue, order)
+		if err == nil {
+			c.track(ctx, venue, &report, false)
+		}
+		report.Recovery = true
+		e.Orders = append(e.Orders, report)
+		if order.Side == markets.Sell {
+			e.Exposure -= report.Status.Filled
+		} else {
+			e.Exposure += report.Status.Filled
+		}
+	}
+	if math.Abs(e.Exposure) <= tolerance {
+		e.Exposure = 0
+		e.transition(Recovered, "")
+		return nil
+	}
+	e.transition(Failed, fmt.Sprintf("exposure of %f", e.Exposure))
+	zap.S().Errorf("Execution of [%s] exposed for %f after the recovery [%s]", e.Symbol, e.Exposure, c.Policy)
+	return ErrUnrecovered
+}
+
+// recoveryOrder is delegated to create the order of the given attempt of the recovery. A positive exposure (bought
+// and not sold) is closed selling, a negative one buying. Chase and Hedge start from the price of the leg not filled,
+// Unwind from the price of the leg filled
+func (c *Coordinator) recoveryOrder(attempt int, exposure float64, buy, sell Leg) (Venue, markets.Order, bool) {
+	// filled is the leg that filled more than the other one, missing the leg that filled less
+	filled, missing := buy, sell
+	if exposure < 0 {
+		filled, missing = sell, buy
+	}
+	order := markets.Order{Symbol: missing.Order.Symbol, Side: missing.Order.Side, Price: missing.Order.Price, Volume: math.Abs(exposure)}
+	var venue Venue
+	switch c.Policy {
+	case Chase:
+		venue = missing.Venue
+	case Hedge:
+		if len(c.Hedges) == 0 {
+			zap.S().Warnf("No hedge market for the execution of [%s]", order.Symbol)
+			return Venue{}, markets.Order{}, false
+		}
+		venue = c.Hedges[(attempt-1)%len(c.Hedges)]
+	case Unwind:
+		venue = filled.Venue
+		order.Price = filled.Order.Price
+	default:
+		zap.S().Warnf("Unknown recovery policy [%s]", c.Policy)
+		return Venue{}, markets.Order{}, false
+	}
+	slippage := c.Slippage * float64(attempt) / 100
+	if order.Side == markets.Sell {
+		order.Price *= 1 - slippage
+	} else {
+		order.Price *= 1 + slippage
+	}
+	return venue, order, true
+}
+
+// place is delegated to send the order to the venue, the error is saved in the report
+func place(ctx context.Context, venue Venue, order markets.Order) (Report, error) {
+	report := Report{Market: venue.Market, Order: order, Status: markets.OrderStatus{Symbol: order.Symbol, Side: order.Side, Price: order.Price, Volume: order.Volume}}
+	id, err := venue.Trader.PlaceOrder(ctx, order)
+	if err != nil {
+		zap.S().Warnf("Unable to place the %s order of [%s] on [%s]: %s", order.Side, order.Symbol, venue.Market, err.Error())
+		report.Error = err.Error()
+		return report, err
+	}
+	report.ID = id
+	report.Status.ID = id
+	report.Status.State = markets.Open
+	return report, nil
+}
+
+// track is delegated to wait the fill of the order of the report until the fill timeout, then the order is canceled
+// and the final state is saved in the report. If abort is true the order is canceled without waiting. The order is
+// canceled also when the context is done, so no order is left in the order book
+func (c *Coordinator) track(ctx context.Context, venue Venue, report *Report, abort bool) {
+	symbol := report.Order.Symbol
+	if !abort {
+		deadline := time.NewTimer(c.FillTimeout)
+		defer deadline.Stop()
+		ticker := time.NewTicker(c.PollInterval)
+		defer ticker.Stop()
+	wait:
+		for {
+			status, err := venue.Trader.GetOrder(ctx, symbol, report.ID)
+			if err == nil {
+				report.Status = status
+				if status.State != markets.Open {
+					return
+				}
+			}
+			select {
+			case <-ctx.Done():
+				break wait
+			case <-deadline.C:
+				break wait
+			case <-ticker.C:
+			}
+		}
+	}
+	cleanup, cancel := context.WithTimeout(context.Background(), c.FillTimeout)
+	defer cancel()
+	// The order not found is already closed
+	if err := venue.Trader.CancelOrder(cleanup, symbol, report.ID); err != nil && err != markets.ErrOrderNotFound {
+		zap.S().Warnf("Unable to cancel the order [%s] on [%s]: %s", report.ID, venue.Market, err.Error())
+		report.Error = err.Error()
+	}
+	status, err := venue.Trader.GetOrder(cleanup, symbol, report.ID)
+	if err != nil {
+		zap.S().Warnf("Unable to retrieve the order [%s] on [%s]: %s", report.ID, venue.Market, err.Error())
+		report.Error = err.Error()
+		return
+	}
+	report.Status = status
+}
+
+// validLeg is delegated to check that the leg can be placed with the given side
+func validLeg(leg Leg, side markets.Side) bool {
+	return leg.Trader != nil && leg.Order.Side == side && leg.Order.Price > 0 && leg.Order.Volume > 0
+}
+
+// concurrently is delegated to run the given function for every index in a different goroutine, waiting all of them
+func concurrently(n int, f func(i int)) {
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			f(i)
+		}(i)
+	}
+	wg.Wait()
+}
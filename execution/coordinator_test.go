@@ -0,0 +1,230 @@
+package execution
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/markets"
+)
+
+// fakeTrader is a market that fill the n-th order placed for the n-th fraction of fills. The orders filled partially
+// stay open until they are canceled
+type fakeTrader struct {
+	mutex  sync.Mutex
+	fills  []float64
+	fail   bool
+	placed []markets.Order
+	orders map[string]*markets.OrderStatus
+}
+
+func (f *fakeTrader) SetCredentials(credentials markets.Credentials) {}
+
+func (f *fakeTrader) PlaceOrder(ctx context.Context, order markets.Order) (string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.fail {
+		return "", errors.New("EOrder:Insufficient funds")
+	}
+	if f.orders == nil {
+		f.orders = make(map[string]*markets.OrderStatus)
+	}
+	var fill float64
+	if len(f.placed) < len(f.fills) {
+		fill = f.fills[len(f.placed)]
+	}
+	f.placed = append(f.placed, order)
+	id := strconv.Itoa(len(f.placed))
+	status := &markets.OrderStatus{ID: id, Symbol: order.Symbol, Side: order.Side, Price: order.Price, Volume: order.Volume,
+		Filled: order.Volume * fill, AveragePrice: order.Price, State: markets.Open}
+	if fill >= 1 {
+		status.State = markets.Closed
+	}
+	f.orders[id] = status
+	return id, nil
+}
+
+func (f *fakeTrader) GetOrder(ctx context.Context, symbol market.Symbol, id string) (markets.OrderStatus, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	status, ok := f.orders[id]
+	if !ok {
+		return markets.OrderStatus{}, markets.ErrOrderNotFound
+	}
+	return *status, nil
+}
+
+func (f *fakeTrader) CancelOrder(ctx context.Context, symbol market.Symbol, id string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	status, ok := f.orders[id]
+	if !ok || status.State != markets.Open {
+		return markets.ErrOrderNotFound
+	}
+	status.State = markets.Canceled
+	return nil
+}
+
+func (f *fakeTrader) GetBalances(ctx context.Context) (map[string]float64, error) {
+	return nil, nil
+}
+
+// recovery is an order expected from the recovery policy
+type recovery struct {
+	Market string
+	Side   markets.Side
+	Price  float64
+	Volume float64
+}
+
+func Test_Execute(t *testing.T) {
+	type TestCase struct {
+		Policy    Policy
+		BuyFills  []float64
+		SellFills []float64
+		BuyFail   bool
+		SellFail  bool
+		// HedgeFills are the fills of the hedge market, nil for no hedge market
+		HedgeFills []float64
+		States     []State
+		Exposure   float64
+		Recovery   []recovery
+		Error      bool
+		Number     int
+	}
+
+	recovered := []State{Placed, Exposed, Recovering, Recovered}
+	failed := []State{Placed, Exposed, Recovering, Failed}
+	cases := []TestCase{
+		{Policy: Chase, BuyFills: []float64{1}, SellFills: []float64{1}, States: []State{Placed, Filled}, Number: 1},
+		{Policy: Chase, States: []State{Placed, Canceled}, Number: 2},
+		// The sell leg is half filled, the rest is sold on the same market
+		{Policy: Chase, BuyFills: []float64{1}, SellFills: []float64{0.5, 1}, States: recovered,
+			Recovery: []recovery{{Market: "SELL", Side: markets.Sell, Price: 99.99, Volume: 1}}, Number: 3},
+		// Every attempt concede the slippage, the volume sold by the attempts is subtracted
+		{Policy: Chase, BuyFills: []float64{1}, SellFills: []float64{0, 0.5, 1}, States: recovered,
+			Recovery: []recovery{{Market: "SELL", Side: markets.Sell, Price: 99.99, Volume: 2}, {Market: "SELL", Side: markets.Sell, Price: 98.98, Volume: 1}}, Number: 4},
+		{Policy: Chase, BuyFills: []float64{1}, States: failed, Exposure: 2, Error: true,
+			Recovery: []recovery{{Market: "SELL", Side: markets.Sell, Price: 99.99, Volume: 2}, {Market: "SELL", Side: markets.Sell, Price: 98.98, Volume: 2}}, Number: 5},
+		// The buy leg is filled for a quarter, the rest is bought on the third market
+		{Policy: Hedge, BuyFills: []float64{0.25}, SellFills: []float64{1}, HedgeFills: []float64{1}, States: recovered,
+			Recovery: []recovery{{Market: "HEDGE", Side: markets.Buy, Price: 101, Volume: 1.5}}, Number: 6},
+		{Policy: Hedge, BuyFills: []float64{1}, States: failed, Exposure: 2, Error: true, Number: 7},
+		// The sell leg is not placed, the bought volume is sold on the buy market
+		{Policy: Unwind, BuyFills: []float64{1, 1}, SellFail: true, States: recovered,
+			Recovery: []recovery{{Market: "BUY", Side: markets.Sell, Price: 99, Volume: 2}}, Number: 8},
+		// The buy leg is not placed, the volume sold before the cancel is bought back on the sell market
+		{Policy: Unwind, SellFills: []float64{0.5, 1}, BuyFail: true, States: recovered,
+			Recovery: []recovery{{Market: "SELL", Side: markets.Buy, Price: 102.01, Volume: 1}}, Number: 9},
+		{Policy: Unwind, BuyFail: true, States: []State{Placed, Canceled}, Number: 10},
+		{Policy: Unwind, BuyFail: true, SellFail: true, States: []State{Canceled}, Error: true, Number: 11},
+	}
+
+	symbol := market.NewSymbol("btc", "usd")
+	for _, c := range cases {
+		buyer := &fakeTrader{fills: c.BuyFills, fail: c.BuyFail}
+		seller := &fakeTrader{fills: c.SellFills, fail: c.SellFail}
+		traders := map[string]*fakeTrader{"BUY": buyer, "SELL": seller}
+		coordinator := New(c.Policy)
+		coordinator.FillTimeout = 20 * time.Millisecond
+		coordinator.PollInterval = time.Millisecond
+		coordinator.Slippage = 1
+		coordinator.Attempts = 2
+		if c.HedgeFills != nil {
+			traders["HEDGE"] = &fakeTrader{fills: c.HedgeFills}
+			coordinator.Hedges = []Venue{{Market: "HEDGE", Trader: traders["HEDGE"]}}
+		}
+
+		buy := Leg{Venue: Venue{Market: "BUY", Trader: buyer}, Order: markets.Order{Symbol: symbol, Side: markets.Buy, Price: 100, Volume: 2}}
+		sell := Leg{Venue: Venue{Market: "SELL", Trader: seller}, Order: markets.Order{Symbol: symbol, Side: markets.Sell, Price: 101, Volume: 2}}
+		e, err := coordinator.Execute(context.Background(), buy, sell)
+		if (err != nil) != c.Error {
+			t.Errorf("Received %v, expected error %v [test n. %d]", err, c.Error, c.Number)
+		}
+		var states []State
+		for _, transition := range e.Transitions {
+			states = append(states, transition.To)
+		}
+		if !equalStates(states, c.States) || e.State != c.States[len(c.States)-1] {
+			t.Errorf("Received %v, expected %v [test n. %d]", states, c.States, c.Number)
+		}
+		if !equal(e.Exposure, c.Exposure) {
+			t.Errorf("Received %v, expected %v [test n. %d]", e.Exposure, c.Exposure, c.Number)
+		}
+		if len(e.Orders) != 2+len(c.Recovery) {
+			t.Errorf("Received %d orders, expected %d [test n. %d]", len(e.Orders), 2+len(c.Recovery), c.Number)
+			continue
+		}
+		for i, expected := range c.Recovery {
+			report := e.Orders[2+i]
+			if report.Market != expected.Market || report.Order.Side != expected.Side || !equal(report.Order.Price, expected.Price) ||
+				!equal(report.Order.Volume, expected.Volume) || !report.Recovery {
+				t.Errorf("Received %+v, expected %+v [test n. %d]", report, expected, c.Number)
+			}
+		}
+		// No order is left open in the markets
+		for name, trader := range traders {
+			for id, status := range trader.orders {
+				if status.State == markets.Open {
+					t.Errorf("Order %s on %s left open [test n. %d]", id, name, c.Number)
+				}
+			}
+		}
+	}
+}
+
+func Test_ExecuteInvalidLeg(t *testing.T) {
+	type TestCase struct {
+		Buy    Leg
+		Sell   Leg
+		Number int
+	}
+
+	symbol := market.NewSymbol("btc", "usd")
+	trader := &fakeTrader{}
+	buy := Leg{Venue: Venue{Market: "BUY", Trader: trader}, Order: markets.Order{Symbol: symbol, Side: markets.Buy, Price: 100, Volume: 1}}
+	sell := Leg{Venue: Venue{Market: "SELL", Trader: trader}, Order: markets.Order{Symbol: symbol, Side: markets.Sell, Price: 101, Volume: 1}}
+	noTrader := sell
+	noTrader.Trader = nil
+	noVolume := buy
+	noVolume.Order.Volume = 0
+	otherSymbol := sell
+	otherSymbol.Order.Symbol = market.NewSymbol("eth", "usd")
+
+	cases := []TestCase{
+		{Buy: sell, Sell: buy, Number: 1},
+		{Buy: buy, Sell: noTrader, Number: 2},
+		{Buy: noVolume, Sell: sell, Number: 3},
+		{Buy: buy, Sell: otherSymbol, Number: 4},
+	}
+
+	for _, c := range cases {
+		if _, err := New(Chase).Execute(context.Background(), c.Buy, c.Sell); err != ErrInvalidLeg {
+			t.Errorf("Received %v, expected %v [test n. %d]", err, ErrInvalidLeg, c.Number)
+		}
+	}
+	if len(trader.placed) != 0 {
+		t.Errorf("Received %d orders, expected no order placed", len(trader.placed))
+	}
+}
+
+func equalStates(a, b []State) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equal(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
@@ -0,0 +1,80 @@
+// Package fees contains the methods used for calculate the fee applied by a market to an order, using the fee
+// schedule (per pair, tiered by 30 days volume, maker/taker, percent or flat) of the market
+package fees
+
+import (
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+)
+
+// OrderType is the type of the order, used for select the maker or the taker fee
+type OrderType int
+
+const (
+	// Taker is an order that remove liquidity from the order book (market order)
+	Taker OrderType = iota
+	// Maker is an order that add liquidity to the order book (limit order)
+	Maker
+)
+
+// schedule is delegated to retrieve the fee tiers that have to be used for the given pair.
+// The schedule of the pair override the default one of the market
+func schedule(m market.Market, pair string) []market.FeeTier {
+	if tiers, ok := m.Fees.Pairs[pair]; ok && len(tiers) > 0 {
+		return tiers
+	}
+	return m.Fees.Tiers
+}
+
+// selectTier is delegated to retrieve the last tier reached by the given volume. The tiers are sorted by volume,
+// if the volume does not reach any threshold the first tier is used
+func selectTier(tiers []market.FeeTier, volume float64) market.FeeTier {
+	tier := tiers[0]
+	for i := range tiers {
+		if volume >= tiers[i].Volume {
+			tier = tiers[i]
+		}
+	}
+	return tier
+}
+
+// Rate is delegated to retrieve the fee applied by the given market for the given pair and order type, using the
+// 30 days volume of the market for select the tier. The value is a percent or a flat amount (see IsPercent).
+// If the market does not have a fee schedule, the MakerFee/TakerFee (percent) of the market are used
+func Rate(m market.Market, pair string, orderType OrderType) float64 {
+	tiers := schedule(m, pair)
+	if len(tiers) == 0 {
+		if orderType == Maker {
+			return m.MakerFee
+		}
+		return m.TakerFee
+	}
+	tier := selectTier(tiers, m.Volume30d)
+	if orderType == Maker {
+		return tier.Maker
+	}
+	return tier.Taker
+}
+
+// IsPercent return true if the fee of the given market is expressed in percent of the amount traded
+func IsPercent(m market.Market, pair string) bool {
+	return m.Fees.IsPercent || len(schedule(m, pair)) == 0
+}
+
+// PercentRate is delegated to retrieve the fee in percent for the given pair and order type.
+// Flat fees does not depend on the amount traded, so 0 is returned
+func PercentRate(m market.Market, pair string, orderType OrderType) float64 {
+	if !IsPercent(m, pair) {
+		return 0
+	}
+	return Rate(m, pair, orderType)
+}
+
+// Compute is delegated to calculate the fee, in quote currency, applied for an order of the given notional
+// (price * volume) of the given pair
+func Compute(m market.Market, pair string, orderType OrderType, notional float64) float64 {
+	rate := Rate(m, pair, orderType)
+	if IsPercent(m, pair) {
+		return notional * rate / 100
+	}
+	return rate
+}
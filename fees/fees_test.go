@@ -0,0 +1,83 @@
+package fees
+
+import (
+	"math"
+	"testing"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+)
+
+var tiers = []market.FeeTier{
+	{Volume: 0, Maker: 0.16, Taker: 0.26},
+	{Volume: 50000, Maker: 0.14, Taker: 0.24},
+	{Volume: 100000, Maker: 0.12, Taker: 0.22},
+}
+
+func Test_Rate(t *testing.T) {
+	type TestCase struct {
+		Market    market.Market
+		Pair      string
+		OrderType OrderType
+		Expected  float64
+		Number    int
+	}
+
+	percent := market.MarketFee{IsPercent: true, Tiers: tiers,
+		Pairs: map[string][]market.FeeTier{"ethbtc": {{Volume: 0, Maker: 0.2, Taker: 0.2}, {Volume: 50000, Maker: 0.16, Taker: 0.16}}}}
+
+	cases := []TestCase{
+		// First tier
+		{Market: market.Market{Fees: percent}, Pair: "btcusd", OrderType: Taker, Expected: 0.26, Number: 1},
+		{Market: market.Market{Fees: percent}, Pair: "btcusd", OrderType: Maker, Expected: 0.16, Number: 2},
+		// Volume between two tiers
+		{Market: market.Market{Fees: percent, Volume30d: 75000}, Pair: "btcusd", OrderType: Taker, Expected: 0.24, Number: 3},
+		// Volume equal to the threshold
+		{Market: market.Market{Fees: percent, Volume30d: 100000}, Pair: "btcusd", OrderType: Maker, Expected: 0.12, Number: 4},
+		// Volume over the last tier
+		{Market: market.Market{Fees: percent, Volume30d: 1e9}, Pair: "btcusd", OrderType: Taker, Expected: 0.22, Number: 5},
+		// The schedule of the pair override the default one
+		{Market: market.Market{Fees: percent}, Pair: "ethbtc", OrderType: Taker, Expected: 0.2, Number: 6},
+		{Market: market.Market{Fees: percent, Volume30d: 60000}, Pair: "ethbtc", OrderType: Maker, Expected: 0.16, Number: 7},
+		// No schedule, use the fee of the market
+		{Market: market.Market{MakerFee: 0.1, TakerFee: 0.2}, Pair: "btcusd", OrderType: Taker, Expected: 0.2, Number: 8},
+		{Market: market.Market{MakerFee: 0.1, TakerFee: 0.2}, Pair: "btcusd", OrderType: Maker, Expected: 0.1, Number: 9},
+	}
+
+	for _, c := range cases {
+		rate := Rate(c.Market, c.Pair, c.OrderType)
+		if rate != c.Expected {
+			t.Errorf("Received %v, expected %v [test n. %d]", rate, c.Expected, c.Number)
+		}
+	}
+}
+
+func Test_Compute(t *testing.T) {
+	type TestCase struct {
+		Market   market.Market
+		Notional float64
+		Expected float64
+		Percent  float64
+		Number   int
+	}
+
+	flat := market.MarketFee{IsPercent: false, Tiers: []market.FeeTier{{Volume: 0, Maker: 0.5, Taker: 1.5}}}
+	cases := []TestCase{
+		{Market: market.Market{Fees: market.MarketFee{IsPercent: true, Tiers: tiers}}, Notional: 1000, Expected: 2.6, Percent: 0.26, Number: 1},
+		{Market: market.Market{Fees: market.MarketFee{IsPercent: true, Tiers: tiers}, Volume30d: 50000}, Notional: 1000, Expected: 2.4, Percent: 0.24, Number: 2},
+		// Flat fee does not depend on the notional
+		{Market: market.Market{Fees: flat}, Notional: 1000, Expected: 1.5, Percent: 0, Number: 3},
+		{Market: market.Market{Fees: flat}, Notional: 10, Expected: 1.5, Percent: 0, Number: 4},
+		// No schedule, the fee of the market is a percent
+		{Market: market.Market{TakerFee: 0.2}, Notional: 500, Expected: 1, Percent: 0.2, Number: 5},
+	}
+
+	for _, c := range cases {
+		fee := Compute(c.Market, "btcusd", Taker, c.Notional)
+		if math.Abs(fee-c.Expected) > 1e-9 {
+			t.Errorf("Received %v, expected %v [test n. %d]", fee, c.Expected, c.Number)
+		}
+		if rate := PercentRate(c.Market, "btcusd", Taker); rate != c.Percent {
+			t.Errorf("Received %v, expected %v [test n. %d]", rate, c.Percent, c.Number)
+		}
+	}
+}
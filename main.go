@@ -1,22 +1,36 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
+	"github.com/alessiosavi/GoArbitrage/balance"
 	"github.com/alessiosavi/GoArbitrage/datastructure/constants"
 	"github.com/alessiosavi/GoArbitrage/datastructure/market"
 	"github.com/alessiosavi/GoArbitrage/engine"
+	"github.com/alessiosavi/GoArbitrage/markets"
 	"github.com/alessiosavi/GoArbitrage/markets/bitfinex"
 	"github.com/alessiosavi/GoArbitrage/markets/gemini"
 	"github.com/alessiosavi/GoArbitrage/markets/kraken"
 	"github.com/alessiosavi/GoArbitrage/markets/okcoin"
+	"github.com/alessiosavi/GoArbitrage/rebalance"
 	"github.com/alessiosavi/GoArbitrage/utils"
 )
 
+// disabledMarkets contains the markets that are initialized but not used for the arbitrage.
+// GEMINI expose only the sandbox API
+var disabledMarkets = map[string]struct{}{"GEMINI": {}}
+
 func main() {
 
 	loggerMgr := initZapLog(zap.DebugLevel)
@@ -27,57 +41,211 @@ func main() {
 	log.SetFlags(log.LstdFlags | log.Lmicroseconds | log.Lshortfile)
 	initDataFolder()
 
-	// Log configuration
-	var bitfinex bitfinex.Bitfinex
-	bitfinex.Init()
-	bitfinex.GetPairsList()
-	bitfinex.GetAllOrderBook()
-	//log.Println(bitfinex.GetMarketData("etheur"))
-	//log.Println(fmt.Sprintf("Bitfinex %#v\n", bitfinex))
-
-	var okcoin okcoin.OkCoin
-	okcoin.Init()
-	okcoin.GetPairsList()
-	okcoin.GetPairsDetails()
-	okcoin.GetAllOrderBook()
-	//log.Println(okcoin.GetMarketData("ETH-EUR"))
-	// log.Println(fmt.Sprintf("OkCoin %#v\n", okcoin))
-
-	var gemini gemini.Gemini
-	gemini.Init()
-	gemini.GetPairsList()
-	gemini.GetAllOrderBook()
-	gemini.GetPairsDetails()
-	//log.Println(gemini.GetMarketData("bchbtc"))
-	// log.Println(fmt.Sprintf("Gemini %#v\n", gemini))
-
-	var kraken kraken.Kraken
-	kraken.Init()
-	kraken.GetPairsDetails()
-	kraken.GetAllOrderBook()
-	//log.Println(kraken.GetMarketData("ETHEUR"))
-	// log.Println(fmt.Sprintf("Kraken %#v\n", kraken))
-
-	zap.S().Warnf("Bitfinex: %f - %f", bitfinex.MakerFee, bitfinex.TakerFees)
-	zap.S().Warnf("Gemini: %f - %f", gemini.MakerFee, gemini.TakerFees)
-	zap.S().Warnf("OkCoin: %f - %f", okcoin.MakerFee, okcoin.TakerFees)
-	var markets []market.Market
-
-	// markets = append(markets, gemini.GetMarketsData())
-	markets = append(markets, kraken.GetMarketsData())
-	markets = append(markets, bitfinex.GetMarketsData())
-	markets = append(markets, okcoin.GetMarketsData())
-
-	pairs := engine.GetCommonCoin(markets...)
-	currencies := utils.ExtractCurrenciesFromPairs(pairs)
-	market.InitDummyWalletForPairs(&markets, currencies)
-	zap.S().Infof("Common pairs: %v", pairs)
+	depth := flag.String("depth", "", "Levels of the order book to request for every market (e.g. KRAKEN=25,BITFINEX=10)")
+	timeout := flag.Duration("timeout", 5*time.Second, "Deadline of the scan of a pair, the markets that does not respond in time are skipped")
+	stream := flag.Bool("stream", false, "Keep the order books updated through the websocket of the markets and scan only the pairs that change")
+	debounce := flag.Duration("debounce", engine.DEFAULT_DEBOUNCE, "Time waited after the change of an order book before the scan of the pair (only with -stream)")
+	maxAge := flag.Duration("max-age", 10*time.Second, "Max age of the order books used for an opportunity, 0 disable the check")
+	maxSkew := flag.Duration("max-skew", 0, "Max difference between the times of the order books of the legs of an opportunity, 0 disable the check")
+	flagStale := flag.Bool("flag-stale", false, "Save the opportunities with stale order books flagging them, instead of discarding them")
+	triangular := flag.Duration("triangular", 0, "Interval between the scans of the triangular arbitrage within every market, 0 disable the scan")
+	multiHop := flag.Duration("multi-hop", 0, "Interval between the scans of the cycles that span several markets, 0 disable the scan")
+	transferFee := flag.Float64("transfer-fee", 0, "Fee, in percent, applied for move a currency between two markets in the multi hop scan")
+	balances := flag.String("balances", "", "Json file with the starting balances of the markets for the simulation, every currency not configured receive 10000")
+	credentials := flag.String("credentials", "", "Json file with the API key of the markets, used by the private API")
+	liveBalances := flag.Bool("live-balances", false, "Retrieve the balances from the markets using the credentials, instead of the simulated ones")
+	rebalanceConfig := flag.String("rebalance", "", "Json file with the target allocations of the currencies, enable the planning of the transfers between the markets (simulated without -live-balances)")
+	flag.Parse()
+	depths := parseDepth(*depth)
+	engine.Staleness = engine.StalenessPolicy{MaxAge: *maxAge, MaxSkew: *maxSkew, Reject: !*flagStale}
+	engine.TransferFee = *transferFee
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	// Stop gracefully the arbitrage on SIGINT/SIGTERM
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		s := <-signals
+		zap.S().Infof("Received signal [%s], stopping the arbitrage ...", s)
+		stop()
+	}()
+
+	provider, err := initBalanceProvider(*balances, *credentials, *liveBalances)
+	if err != nil {
+		zap.S().Fatalf("Unable to initialize the balances: %s", err.Error())
+	}
+	if *rebalanceConfig != "" {
+		config, err := rebalance.LoadConfig(*rebalanceConfig)
+		if err != nil {
+			zap.S().Fatalf("Unable to load the rebalance configuration: %s", err.Error())
+		}
+		// The transfers are applied to the wallets only in the simulation
+		engine.Inventory = rebalance.New(config, !*liveBalances)
+	}
+
+	var marketsData []market.Market
+	for _, exchange := range markets.Registered() {
+		exchange.Init()
+		if d, ok := depths[exchange.Name()]; ok {
+			exchange.SetDepth(d)
+		}
+		exchange.GetPairsList(ctx)
+		exchange.GetPairsDetails(ctx)
+		exchange.GetAllOrderBook(ctx)
+		data := exchange.GetMarketsData()
+		zap.S().Warnf("%s: %f - %f", exchange.Name(), data.MakerFee, data.TakerFee)
+		if _, ok := disabledMarkets[exchange.Name()]; ok {
+			zap.S().Infof("Market [%s] is disabled, skipping arbitrage", exchange.Name())
+			continue
+		}
+		marketsData = append(marketsData, data)
+	}
+
+	symbols := engine.GetCommonSymbols(marketsData...)
+	currencies := utils.ExtractCurrenciesFromSymbols(symbols)
+	if err = balance.InitWallets(ctx, provider, marketsData, currencies); err != nil {
+		zap.S().Warnf("%s, the markets will not be used for trade", err.Error())
+	}
+	zap.S().Infof("Common pairs: %v", symbols)
+	// The scans read the order books from the markets, the data of the arbitrage are updated by the main loop
+	names := make([]string, len(marketsData))
+	for i := range marketsData {
+		names[i] = marketsData[i].MarketName
+	}
+	if *triangular > 0 {
+		go scanCycles(ctx, names, *triangular, func(data []market.Market) {
+			for i := range data {
+				engine.Triangular(data[i])
+			}
+		})
+	}
+	if *multiHop > 0 {
+		go scanCycles(ctx, names, *multiHop, engine.MultiHop)
+	}
+	if *stream {
+		// The pairs are scanned when their order book change, instead of scanning all the pairs in sequence
+		updates := make(chan markets.Update, 1024)
+		startStreams(ctx, marketsData, symbols, updates)
+		engine.Watch(ctx, updates, symbols, &marketsData, *debounce, *timeout)
+	}
+
+	for ctx.Err() == nil {
+		// The transfers are planned once per round, never during the scan of a pair
+		engine.Rebalance(marketsData)
+		for _, symbol := range symbols {
+			scan, cancel := context.WithTimeout(ctx, *timeout)
+			engine.Arbitrage(scan, symbol, &marketsData)
+			cancel()
+			if ctx.Err() != nil {
+				break
+			}
+		}
+	}
+
+	if err := engine.SaveWallets(marketsData); err != nil {
+		zap.S().Errorf("Unable to save the wallets: %s", err.Error())
+	} else {
+		zap.S().Infof("Wallets saved in [%s]", engine.WalletsFile)
+	}
+}
 
+// startStreams is delegated to subscribe the order books of the given symbols for every market that support the
+// websocket. The changes are sent over the updates channel. The scan request the order book only for the pairs
+// that are not synchronized with the stream
+func startStreams(ctx context.Context, marketsData []market.Market, symbols []market.Symbol, updates chan<- markets.Update) {
+	for _, data := range marketsData {
+		exchange, ok := markets.Get(data.MarketName)
+		if !ok {
+			continue
+		}
+		streamer, ok := exchange.(markets.Streamer)
+		if !ok {
+			zap.S().Infof("Market [%s] does not support the stream, the order books will be requested", data.MarketName)
+			continue
+		}
+		pairs := make([]string, len(symbols))
+		for i := range symbols {
+			pairs[i] = exchange.EncodeSymbol(symbols[i])
+		}
+		go func(name string) {
+			if err := streamer.Stream(ctx, pairs, updates); err != nil && ctx.Err() == nil {
+				zap.S().Errorf("Stream of %s stopped: %s", name, err.Error())
+			}
+		}(data.MarketName)
+	}
+}
+
+// scanCycles is delegated to run the given scan (triangular or multi hop) at the given interval, using all the order
+// books currently saved by the given markets. The scan does not request the books: the books that are not updated by
+// the stream or by the pairs scan are discarded only when the max age of the staleness policy is set
+func scanCycles(ctx context.Context, names []string, interval time.Duration, scan func(data []market.Market)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 	for {
-		for _, pair := range pairs {
-			engine.Arbitrage(pair, &markets)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		var data []market.Market
+		for _, name := range names {
+			if exchange, ok := markets.Get(name); ok {
+				data = append(data, exchange.GetMarketsData())
+			}
+		}
+		scan(data)
+	}
+}
+
+// initBalanceProvider is delegated to set the credentials of the markets and to create the provider of the balances:
+// the balances of the markets or the simulated ones, configured by the given file
+func initBalanceProvider(balances, credentials string, live bool) (balance.Provider, error) {
+	if credentials != "" {
+		keys, err := markets.LoadCredentials(credentials)
+		if err != nil {
+			return nil, err
+		}
+		for _, exchange := range markets.Registered() {
+			if trader, ok := exchange.(markets.Trader); ok {
+				if key, ok := keys[exchange.Name()]; ok {
+					trader.SetCredentials(key)
+				}
+			}
+		}
+	}
+	if live {
+		if credentials == "" {
+			return nil, markets.ErrMissingCredentials
+		}
+		return balance.Live{}, nil
+	}
+	if balances == "" {
+		return balance.NewDummy(), nil
+	}
+	return balance.LoadDummy(balances)
+}
+
+// parseDepth is delegated to parse the depth of the order book for every market (KRAKEN=25,BITFINEX=10)
+func parseDepth(depth string) map[string]int {
+	var depths = make(map[string]int)
+	for _, item := range strings.Split(depth, ",") {
+		if item == "" {
+			continue
+		}
+		data := strings.Split(item, "=")
+		if len(data) != 2 {
+			zap.S().Warnf("Unable to parse depth [%s]", item)
+			continue
+		}
+		d, err := strconv.Atoi(data[1])
+		if err != nil || d <= 0 {
+			zap.S().Warnf("Unable to parse depth [%s]", item)
+			continue
 		}
+		depths[strings.ToUpper(strings.TrimSpace(data[0]))] = d
 	}
+	return depths
 }
 
 func initZapLog(logLevel zapcore.Level) *zap.Logger {
@@ -115,7 +283,7 @@ func initDataFolder() {
 		os.MkdirAll(kraken.KRAKEN_ORDERBOOK_DATA, os.ModePerm)
 	}
 	// Write the initial json character
-	if f, err := os.OpenFile("data.json", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err == nil {
+	if f, err := os.OpenFile(engine.OpportunitiesFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err == nil {
 		defer f.Close()
 		f.WriteString("[")
 	}
@@ -1,12 +1,15 @@
 package bitfinex
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
+	"net/http"
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/alessiosavi/GoArbitrage/utils"
@@ -15,15 +18,23 @@ import (
 	datastructure "github.com/alessiosavi/GoArbitrage/datastructure/bitfinex"
 	"github.com/alessiosavi/GoArbitrage/datastructure/constants"
 	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"github.com/alessiosavi/GoArbitrage/markets/stream"
+	"github.com/alessiosavi/GoArbitrage/network"
 	fileutils "github.com/alessiosavi/GoGPUtils/files"
-	req "github.com/alessiosavi/Requests"
 )
 
-const BITFINEX_PAIRS_URL string = `https://api.bitfinex.com/v1/symbols`
-const BITFINEX_PAIRS_DETAILS_URL string = `https://api.bitfinex.com/v1/symbols_details`
-const BITFINEX_ORDER_BOOK_URL string = `https://api.bitfinex.com/v1/book/`
+// BITFINEX_API is the base url of the bitfinex API
+const BITFINEX_API string = `https://api.bitfinex.com`
 
-const BITFINEX_TICKERS_DETAILS string = `https://api-pub.bitfinex.com/v2/conf/pub:map:currency:sym`
+// BITFINEX_PUB_API is the base url of the bitfinex public API (v2)
+const BITFINEX_PUB_API string = `https://api-pub.bitfinex.com`
+
+const BITFINEX_PAIRS_URL string = BITFINEX_API + `/v1/symbols`
+const BITFINEX_PAIRS_DETAILS_URL string = BITFINEX_API + `/v1/symbols_details`
+const BITFINEX_ORDER_BOOK_URL string = BITFINEX_API + `/v1/book/`
+
+const BITFINEX_TICKERS_DETAILS string = BITFINEX_PUB_API + `/v2/conf/pub:map:currency:sym`
 
 var BITFINEX_PAIRS_DATA = path.Join(constants.BITFINEX_PATH, "pairs_list.json")
 var BITFINEX_PAIRS_DETAILS = path.Join(constants.BITFINEX_PATH, "pairs_info.json")
@@ -39,7 +50,43 @@ type Bitfinex struct {
 	TakerFees  float64                                    `json:"taker_fee"`
 	// FeePercent is delegated to save if the fee is in percent or in coin
 	FeePercent bool `json:"fee_percent"`
-	Tickers    []string
+	// Fees contains the fee schedule (tiers by 30 days volume) of the market
+	Fees    market.MarketFee `json:"fees"`
+	Tickers []string
+	// Assets contains the bitfinex currency code as key and the standard ticker as value (ust -> usdt)
+	Assets map[string]string `json:"assets"`
+	// Depth is the number of levels of the order book to request
+	Depth int `json:"depth"`
+	// mutex protect the order book, updated and read by the engine from different goroutines
+	mutex sync.RWMutex
+	// baseURL replace the base url of the API, if set
+	baseURL string
+	// client is used for send the requests, if set. The defaultClient is used otherwise
+	client *network.Client
+	// streamURL replace the url of the websocket, if set
+	streamURL string
+	// streaming save the pairs whose order book is updated by the websocket
+	streaming stream.Status
+	// credentials contains the API key used for sign the requests of the authenticated API
+	credentials markets.Credentials
+}
+
+// BITFINEX_RATE_LIMIT is the number of requests per second allowed by the bitfinex public API (30 requests per minute)
+const BITFINEX_RATE_LIMIT float64 = 0.5
+
+// BITFINEX_RATE_BURST is the number of requests that can be sent without wait
+const BITFINEX_RATE_BURST int = 1
+
+// defaultClient is shared by all the requests sent to the market, in order to respect the rate limit
+var defaultClient = network.NewClient(BITFINEX_RATE_LIMIT, BITFINEX_RATE_BURST)
+
+func init() {
+	markets.Register(&Bitfinex{})
+}
+
+// Name return the name of the market
+func (b *Bitfinex) Name() string {
+	return `BITFINEX`
 }
 
 // Init is delegated to initialize the map for the given market
@@ -49,24 +96,75 @@ func (b *Bitfinex) Init() {
 	b.SetFees()
 }
 
+// SetBaseURL is delegated to set the base url used for send the requests in place of the bitfinex API
+func (b *Bitfinex) SetBaseURL(baseURL string) {
+	b.baseURL = strings.TrimSuffix(baseURL, "/")
+}
+
+// SetHTTPClient is delegated to set the HTTP client used for send the requests.
+// The market will use its own rate limiter, not shared with the other instances. A nil client restore the default one
+func (b *Bitfinex) SetHTTPClient(httpClient *http.Client) {
+	if httpClient == nil {
+		b.client = nil
+		return
+	}
+	b.client = network.NewClient(BITFINEX_RATE_LIMIT, BITFINEX_RATE_BURST)
+	b.client.HTTPClient = httpClient
+}
+
+// getClient return the client used for send the requests
+func (b *Bitfinex) getClient() *network.Client {
+	if b.client != nil {
+		return b.client
+	}
+	return defaultClient
+}
+
+// url is delegated to replace the base url of the given endpoint with the one configured
+func (b *Bitfinex) url(endpoint string) string {
+	if b.baseURL == "" {
+		return endpoint
+	}
+	for _, api := range []string{BITFINEX_API, BITFINEX_PUB_API} {
+		if strings.HasPrefix(endpoint, api) {
+			return b.baseURL + strings.TrimPrefix(endpoint, api)
+		}
+	}
+	return endpoint
+}
+
+// SetDepth is delegated to set the number of levels of the order book to request
+func (b *Bitfinex) SetDepth(depth int) {
+	b.Depth = depth
+}
+
+// depth return the number of levels of the order book to request
+func (b *Bitfinex) depth() int {
+	if b.Depth > 0 {
+		return b.Depth
+	}
+	return constants.DEFAULT_DEPTH
+}
+
 // SetFees is delegated to initialize the fee type/amount for the given market
 func (b *Bitfinex) SetFees() {
 	b.MakerFee = 0.1
 	b.TakerFees = 0.2
 	b.FeePercent = true
+	b.Fees = market.MarketFee{IsPercent: b.FeePercent, Tiers: []market.FeeTier{{Volume: 0, Maker: b.MakerFee, Taker: b.TakerFees}}}
 }
 
-// GetTickers is delegated to retrive the list of tickers tradable on Bitfinex
-func (b *Bitfinex) GetTickers() error {
+// GetTickers is delegated to retrive the list of tickers tradable on Bitfinex.
+// The currency map is used for build the alias table that normalize the bitfinex currencies (ust -> usdt)
+func (b *Bitfinex) GetTickers(ctx context.Context) error {
 	var (
-		request req.Request
 		data    []byte
 		err     error
 		tickers BtfinexTickers
 	)
 	zap.S().Debugw("Sending request to [" + BITFINEX_TICKERS_DETAILS + "]")
 	// Call the HTTP method for retrieve the pairs
-	resp := request.SendRequest(BITFINEX_TICKERS_DETAILS, "GET", nil, nil, false, 10*time.Second)
+	resp := b.getClient().Get(ctx, b.url(BITFINEX_TICKERS_DETAILS))
 	if resp.Error != nil {
 		zap.S().Warnw("Error during http request. Err: " + resp.Error.Error())
 		return resp.Error
@@ -82,21 +180,65 @@ func (b *Bitfinex) GetTickers() error {
 		zap.S().Infof("Data: %s", string(data))
 		return err
 	}
+	// The tickers traded with their own code (btc:cnht) are not aliases of other currencies (cnh)
+	codes := make(map[string]bool)
+	for _, pair := range b.PairsNames {
+		for _, currency := range splitPair(pair) {
+			codes[currency] = true
+		}
+	}
 	var t = make([]string, len(tickers[0]))
+	b.Assets = make(map[string]string, len(tickers[0]))
 	for i := range tickers[0] {
 		t[i] = tickers[0][i][0]
+		code, ticker := strings.ToLower(tickers[0][i][0]), strings.ToLower(tickers[0][i][1])
+		if !codes[ticker] {
+			b.Assets[code] = ticker
+		}
 	}
 	b.Tickers = t
 	return nil
 }
 
+// Asset is delegated to convert the given bitfinex currency code into the standard ticker
+func (b *Bitfinex) Asset(code string) string {
+	if asset, ok := b.Assets[code]; ok {
+		return asset
+	}
+	return code
+}
+
+// Code is delegated to convert the given standard ticker into the bitfinex currency code
+func (b *Bitfinex) Code(ticker string) string {
+	for code, asset := range b.Assets {
+		if asset == ticker {
+			return code
+		}
+	}
+	return ticker
+}
+
+// splitPair is delegated to split the given bitfinex pair into the currencies codes. Return nil if the pair is not valid
+func splitPair(pair string) []string {
+	if currencies := strings.Split(pair, ":"); len(currencies) == 2 {
+		if currencies[0] == "" || currencies[1] == "" {
+			return nil
+		}
+		return currencies
+	}
+	// Pairs without separator are composed by two 3 characters currencies
+	if len(pair) != 6 {
+		return nil
+	}
+	return []string{pair[:3], pair[3:]}
+}
+
 // GetPairsList is delegated to retrieve the type of pairs in the Bitfinex market
-func (b *Bitfinex) GetPairsList() error {
+func (b *Bitfinex) GetPairsList(ctx context.Context) error {
 	var (
-		request req.Request
-		pairs   []string
-		data    []byte
-		err     error
+		pairs []string
+		data  []byte
+		err   error
 	)
 
 	// Avoid to call the HTTP api if the data are present
@@ -110,7 +252,7 @@ func (b *Bitfinex) GetPairsList() error {
 	} else {
 		zap.S().Debugw("Sending request to [" + BITFINEX_PAIRS_URL + "]")
 		// Call the HTTP method for retrieve the pairs
-		resp := request.SendRequest(BITFINEX_PAIRS_URL, "GET", nil, nil, false, constants.TIMEOUT_REQ*time.Second)
+		resp := b.getClient().Get(ctx, b.url(BITFINEX_PAIRS_URL))
 		if resp.Error != nil {
 			zap.S().Debugw("Error during http request. Err: " + resp.Error.Error())
 			return err
@@ -132,12 +274,15 @@ func (b *Bitfinex) GetPairsList() error {
 
 	// Update the file with the new data
 	utils.DumpStruct(pairs, BITFINEX_PAIRS_DATA)
+	// The currency map is necessary for decode the currencies of the pairs
+	if err = b.GetTickers(ctx); err != nil {
+		zap.S().Warnf("Unable to load bitfinex currencies, using the bitfinex codes: %s", err.Error())
+	}
 	return nil
 }
 
 // GetPairsDetails is delegated to retrieve the information related to all pairs for execute order
-func (b *Bitfinex) GetPairsDetails() error {
-	var request req.Request
+func (b *Bitfinex) GetPairsDetails(ctx context.Context) error {
 	var pairsInfo []datastructure.BitfinexPair
 	var data []byte
 	var err error
@@ -153,7 +298,7 @@ func (b *Bitfinex) GetPairsDetails() error {
 	} else {
 		zap.S().Debugw("Sending request to [" + BITFINEX_PAIRS_DETAILS_URL + "]")
 		// Call the HTTP method for retrieve the pairs
-		resp := request.SendRequest(BITFINEX_PAIRS_DETAILS_URL, "GET", nil, nil, false, constants.TIMEOUT_REQ*time.Second)
+		resp := b.getClient().Get(ctx, b.url(BITFINEX_PAIRS_DETAILS_URL))
 		if resp.Error != nil {
 			zap.S().Warnw("Error during http request. Err: " + resp.Error.Error())
 			return resp.Error
@@ -183,12 +328,16 @@ func (b *Bitfinex) GetPairsDetails() error {
 }
 
 // GetAllOrderBook is delegated to retrieve the order book for all the currencies
-func (b *Bitfinex) GetAllOrderBook() error {
-	var request req.Request
+func (b *Bitfinex) GetAllOrderBook(ctx context.Context) error {
 	var data []byte
 	var err error
 
 	for _, pair := range b.PairsNames {
+		// Stop the download if the context is cancelled
+		if ctx.Err() != nil {
+			zap.S().Warnf("Stopping the download of the order books: %s", ctx.Err().Error())
+			break
+		}
 		zap.S().Debugw("Managin pair: [" + pair + "]")
 		if strings.Contains(pair, ":") {
 			zap.S().Info("[" + pair + "] is not a tradable pair")
@@ -206,11 +355,10 @@ func (b *Bitfinex) GetAllOrderBook() error {
 				continue
 			}
 		} else {
-			time.Sleep(2 * time.Second)
-			url := BITFINEX_ORDER_BOOK_URL + pair + "?limit_bids=1&limit_asks=1"
+			url := BITFINEX_ORDER_BOOK_URL + pair + "?limit_bids=" + strconv.Itoa(b.depth()) + "&limit_asks=" + strconv.Itoa(b.depth())
 			zap.S().Debugw("Sending request to [" + url + "]")
 			// Call the HTTP method for retrieve the pairs
-			resp := request.SendRequest(url, "GET", nil, nil, false, constants.TIMEOUT_REQ*time.Second)
+			resp := b.getClient().Get(ctx, b.url(url))
 			if resp.Error != nil {
 				zap.S().Warnw("Error during http request. Err: " + resp.Error.Error())
 				// return resp.Error
@@ -221,6 +369,7 @@ func (b *Bitfinex) GetAllOrderBook() error {
 				continue
 			}
 			data = resp.Body
+			orderbook.Received = time.Now()
 		}
 
 		err = json.Unmarshal(data, &orderbook)
@@ -230,22 +379,28 @@ func (b *Bitfinex) GetAllOrderBook() error {
 			continue
 		}
 
+		b.mutex.Lock()
 		b.OrderBook[pair] = orderbook
+		b.mutex.Unlock()
 		// Update the file with the new data
-		utils.DumpStruct(b.OrderBook[pair], file_data)
+		utils.DumpStruct(orderbook, file_data)
 	}
 
 	// Update the file with the new data
 	utils.DumpStruct(b.OrderBook, path.Join(constants.BITFINEX_PATH, "orders_all.json"))
-	return nil
+	// The order books already retrieved are kept also if the context is cancelled
+	return ctx.Err()
 }
 
 // GetMarketData is delegated to convert the order book into a standard `market` struct
 func (b *Bitfinex) GetMarketData(pair string) (market.Market, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
 	var markets market.Market
 	markets.Asks = make(map[string][]market.MarketOrder, len(b.OrderBook))
 	markets.Bids = make(map[string][]market.MarketOrder, len(b.OrderBook))
-	markets.MarketName = `BITFINEX`
+	markets.Times = make(map[string]market.BookTime, len(b.OrderBook))
+	markets.MarketName = b.Name()
 	minVolume, _ := strconv.ParseFloat(b.Pairs[pair].MinOrder, 64)
 	var order market.MarketOrder
 	if orders, ok := b.OrderBook[pair]; ok {
@@ -269,27 +424,72 @@ func (b *Bitfinex) GetMarketData(pair string) (market.Market, error) {
 		}
 		markets.Asks[pair] = asks
 		markets.Bids[pair] = bids
+		markets.Times[pair] = bitfinexBookTime(orders)
 		markets.MakerFee = b.MakerFee
 		markets.TakerFee = b.TakerFees
+		markets.Fees = b.Fees
 		return markets, nil
 	}
 	return markets, errors.New("unable to find pair [" + pair + "]")
 }
 
+// Constraint is delegated to retrieve the order rules (min/max order, price precision) of the given pair
+func (b *Bitfinex) Constraint(pair string) market.OrderConstraint {
+	var constraint market.OrderConstraint
+	if info, ok := b.Pairs[pair]; ok {
+		constraint.MinVolume, _ = strconv.ParseFloat(info.MinOrder, 64)
+		constraint.MaxVolume, _ = strconv.ParseFloat(info.MaxOrder, 64)
+		constraint.PricePrecision = info.PricePrecision
+	}
+	return constraint
+}
+
+// bitfinexBookTime is delegated to retrieve the times of the given order book. The timestamp (in seconds) of every
+// level is sent by bitfinex, the time of the book is the most recent one
+func bitfinexBookTime(book datastructure.BitfinexOrderBook) market.BookTime {
+	t := market.BookTime{Received: book.Received}
+	for _, orders := range [][]datastructure.BitfinexOrder{book.Asks, book.Bids} {
+		for i := range orders {
+			seconds, err := strconv.ParseFloat(orders[i].Timestamp, 64)
+			if err != nil {
+				continue
+			}
+			if timestamp := time.Unix(0, int64(seconds*1e9)); timestamp.After(t.Exchange) {
+				t.Exchange = timestamp
+			}
+		}
+	}
+	return t
+}
+
 // GetMarketsData is delegated to convert the internal asks and bids struct to the common "market" struct
 func (b *Bitfinex) GetMarketsData() market.Market {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
 	var markets market.Market
 	// Standardize key for common coin
 	var key_standard string
 	markets.Asks = make(map[string][]market.MarketOrder, len(b.OrderBook))
 	markets.Bids = make(map[string][]market.MarketOrder, len(b.OrderBook))
+	markets.Times = make(map[string]market.BookTime, len(b.OrderBook))
 
-	markets.MarketName = `BITFINEX`
+	markets.Symbols = make(map[string]market.Symbol, len(b.OrderBook))
+	markets.Constraints = make(map[string]market.OrderConstraint, len(b.OrderBook))
+	markets.MarketName = b.Name()
+	markets.MakerFee = b.MakerFee
+	markets.TakerFee = b.TakerFees
+	markets.Fees = b.Fees
 
 	var order market.MarketOrder
 	for key := range b.OrderBook {
-
-		key_standard = strings.Replace(strings.ToLower(key), "-", "", 1)
+		symbol, err := b.DecodeSymbol(key)
+		if err != nil {
+			zap.S().Debugf("Skipping pair [%s]: %s", key, err.Error())
+			continue
+		}
+		key_standard = symbol.String()
+		markets.Symbols[key_standard] = symbol
+		markets.Constraints[key_standard] = b.Constraint(key)
 		var asks = make([]market.MarketOrder, len(b.OrderBook[key].Asks))
 		for i, ask := range b.OrderBook[key].Asks {
 			price, _ := strconv.ParseFloat(ask.Price, 64)
@@ -309,14 +509,14 @@ func (b *Bitfinex) GetMarketsData() market.Market {
 		//markets.MinPrice
 		markets.Asks[key_standard] = asks
 		markets.Bids[key_standard] = bids
+		markets.Times[key_standard] = bitfinexBookTime(b.OrderBook[key])
 	}
 
 	return markets
 }
 
 // GetOrderBook is delegated to retrieve the order book for the given pair
-func (b *Bitfinex) GetOrderBook(pair string) error {
-	var request req.Request
+func (b *Bitfinex) GetOrderBook(ctx context.Context, pair string) error {
 	var data []byte
 	var orderbook datastructure.BitfinexOrderBook
 	var err error
@@ -328,10 +528,10 @@ func (b *Bitfinex) GetOrderBook(pair string) error {
 	}
 	orderbook.Pair = pair
 
-	url := BITFINEX_ORDER_BOOK_URL + pair + "?limit_bids=1&limit_asks=1"
+	url := BITFINEX_ORDER_BOOK_URL + pair + "?limit_bids=" + strconv.Itoa(b.depth()) + "&limit_asks=" + strconv.Itoa(b.depth())
 	zap.S().Debugw("Sending request to [" + url + "]")
 	// Call the HTTP method for retrieve the pairs
-	resp := request.SendRequest(url, "GET", nil, nil, false, constants.TIMEOUT_REQ*time.Second)
+	resp := b.getClient().Get(ctx, b.url(url))
 	if resp.Error != nil {
 		zap.S().Warnw("Error during http request. Err: " + resp.Error.Error())
 		return resp.Error
@@ -348,13 +548,48 @@ func (b *Bitfinex) GetOrderBook(pair string) error {
 		zap.S().Debugw("Error during unmarshal pair [" + pair + "]! Err: " + err.Error())
 		return err
 	}
+	orderbook.Received = time.Now()
 
+	b.mutex.Lock()
 	if len(b.OrderBook) == 0 {
 		b.OrderBook = make(map[string]datastructure.BitfinexOrderBook)
 	}
 	b.OrderBook[pair] = orderbook
+	b.mutex.Unlock()
 	// Update the file with the new data
 	// utils.DumpStruct(b.OrderBook[pair], path.Join(BITFINEX_ORDERBOOK_DATA, pair+".json"))
 
 	return nil
 }
+
+// ParsePair is delegated to convert the given pair into the pair compliant with bitfinex
+func (b *Bitfinex) ParsePair(pair string) string {
+	return strings.ToLower(pair)
+}
+
+// EncodeSymbol is delegated to convert the given symbol into the pair compliant with bitfinex.
+// The tickers are converted into the bitfinex codes (usdt -> ust). Currencies longer than 3 characters are separated
+// by `:` (dusk:usd)
+func (b *Bitfinex) EncodeSymbol(symbol market.Symbol) string {
+	base, quote := b.Code(symbol.Base), b.Code(symbol.Quote)
+	if len(base) > 3 || len(quote) > 3 {
+		return base + ":" + quote
+	}
+	return base + quote
+}
+
+// DecodeSymbol is delegated to extract the base and the quote currencies from the given pair.
+// The bitfinex codes are converted into the standard tickers (ust -> usdt)
+func (b *Bitfinex) DecodeSymbol(pair string) (market.Symbol, error) {
+	pair = strings.ToLower(pair)
+	if len(b.Pairs) > 0 {
+		if _, ok := b.Pairs[pair]; !ok {
+			return market.Symbol{}, errors.New("pair [" + pair + "] not found in bitfinex pairs")
+		}
+	}
+	currencies := splitPair(pair)
+	if currencies == nil {
+		return market.Symbol{}, errors.New("unable to extract the currencies from pair [" + pair + "]")
+	}
+	return market.NewSymbol(b.Asset(currencies[0]), b.Asset(currencies[1])), nil
+}
@@ -1,8 +1,16 @@
 package bitfinex
 
 import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 
+	datastructure "github.com/alessiosavi/GoArbitrage/datastructure/bitfinex"
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/markets/fakeserver"
+
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -20,12 +28,140 @@ func Test_GetTickers(t *testing.T) {
 	loggerMgr := initZapLog(zap.DebugLevel)
 	zap.ReplaceGlobals(loggerMgr)
 	defer loggerMgr.Sync() // flushes buffer, if any
-	var err error
+	server, err := fakeserver.NewMarket("BITFINEX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
 	var b Bitfinex
-	if err = b.GetTickers(); err != nil {
+	b.SetBaseURL(server.URL)
+	b.SetHTTPClient(server.Client())
+	if err = b.GetTickers(context.Background()); err != nil {
 		t.Error(err)
 	}
 	if len(b.Tickers) != 46 {
 		t.Error("Different size ..")
 	}
 }
+
+// FIXTURES_PATH contains the data captured from the bitfinex API
+const FIXTURES_PATH = "../../data/BITFINEX"
+
+// loadFixture is delegated to unmarshal the given captured file
+func loadFixture(t *testing.T, file string, v interface{}) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_MarketDataFixtures(t *testing.T) {
+	type TestCase struct {
+		Pair       string
+		Standard   string
+		Ask        market.MarketOrder
+		Bid        market.MarketOrder
+		Constraint market.OrderConstraint
+		Number     int
+	}
+
+	var b Bitfinex
+	b.Init()
+	var pairs []datastructure.BitfinexPair
+	loadFixture(t, filepath.Join(fakeserver.TestData(), "BITFINEX", "symbols_details.json"), &pairs)
+	for i := range pairs {
+		b.Pairs[pairs[i].Pair] = pairs[i]
+	}
+	// abseth is not present in the pairs details
+	for _, pair := range []string{"btcusd", "ethbtc", "abseth"} {
+		var book datastructure.BitfinexOrderBook
+		loadFixture(t, filepath.Join(FIXTURES_PATH, "orders", pair+".json"), &book)
+		b.OrderBook[pair] = book
+	}
+
+	cases := []TestCase{
+		{Pair: "btcusd", Standard: "btcusd", Ask: market.MarketOrder{Price: 10240, Volume: 12.41815766, MinVolume: 0.0006},
+			Bid:        market.MarketOrder{Price: 10239, Volume: 0.02918992, MinVolume: 0.0006},
+			Constraint: market.OrderConstraint{MinVolume: 0.0006, MaxVolume: 2000, PricePrecision: 5}, Number: 1},
+		{Pair: "ethbtc", Standard: "ethbtc", Ask: market.MarketOrder{Price: 0.027651, Volume: 16.14115825, MinVolume: 0.02},
+			Bid:        market.MarketOrder{Price: 0.02765, Volume: 24.4848282, MinVolume: 0.02},
+			Constraint: market.OrderConstraint{MinVolume: 0.02, MaxVolume: 5000, PricePrecision: 5}, Number: 2},
+	}
+
+	all := b.GetMarketsData()
+	if len(all.Asks) != len(cases) {
+		t.Errorf("Received %d pairs, expected %d", len(all.Asks), len(cases))
+	}
+	for _, c := range cases {
+		data, err := b.GetMarketData(c.Pair)
+		if err != nil {
+			t.Errorf("Received %v, expected no error [test n. %d]", err, c.Number)
+			continue
+		}
+		if len(data.Asks[c.Pair]) != 1 || data.Asks[c.Pair][0] != c.Ask || len(data.Bids[c.Pair]) != 1 || data.Bids[c.Pair][0] != c.Bid {
+			t.Errorf("Received %+v/%+v, expected %+v/%+v [test n. %d]", data.Asks[c.Pair], data.Bids[c.Pair], c.Ask, c.Bid, c.Number)
+		}
+		if len(all.Asks[c.Standard]) != 1 || all.Asks[c.Standard][0].Price != c.Ask.Price || all.Bids[c.Standard][0].Volume != c.Bid.Volume {
+			t.Errorf("Received %+v/%+v, expected %+v/%+v [test n. %d]", all.Asks[c.Standard], all.Bids[c.Standard], c.Ask, c.Bid, c.Number)
+		}
+		if all.Constraints[c.Standard] != c.Constraint {
+			t.Errorf("Received %+v, expected %+v [test n. %d]", all.Constraints[c.Standard], c.Constraint, c.Number)
+		}
+	}
+}
+
+func Test_SymbolAliases(t *testing.T) {
+	type TestCase struct {
+		Pair     string
+		Expected market.Symbol
+		Number   int
+	}
+
+	server, err := fakeserver.NewMarket("BITFINEX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	var b Bitfinex
+	b.SetBaseURL(server.URL)
+	b.SetHTTPClient(server.Client())
+	loadFixture(t, filepath.Join(FIXTURES_PATH, "pairs_list.json"), &b.PairsNames)
+	if err = b.GetTickers(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []TestCase{
+		{Pair: "btcust", Expected: market.NewSymbol("btc", "usdt"), Number: 1},
+		{Pair: "ethust", Expected: market.NewSymbol("eth", "usdt"), Number: 2},
+		{Pair: "algusd", Expected: market.NewSymbol("algo", "usd"), Number: 3},
+		{Pair: "dshusd", Expected: market.NewSymbol("dash", "usd"), Number: 4},
+		{Pair: "eususd", Expected: market.NewSymbol("eurs", "usd"), Number: 5},
+		{Pair: "btcusd", Expected: market.NewSymbol("btc", "usd"), Number: 6},
+		// cnht is traded with its own code, cnh is not an alias
+		{Pair: "btc:cnht", Expected: market.NewSymbol("btc", "cnht"), Number: 7},
+	}
+	for _, c := range cases {
+		symbol, err := b.DecodeSymbol(c.Pair)
+		if err != nil || symbol != c.Expected {
+			t.Errorf("Received %v %v, expected %v [test n. %d]", symbol, err, c.Expected, c.Number)
+		}
+		if pair := b.EncodeSymbol(c.Expected); pair != c.Pair {
+			t.Errorf("Received %v, expected %v [test n. %d]", pair, c.Pair, c.Number)
+		}
+	}
+
+	// Every captured pair is encoded back from its symbol
+	for _, pair := range b.PairsNames {
+		symbol, err := b.DecodeSymbol(pair)
+		if err != nil {
+			t.Errorf("Received %v, expected no error for pair %s", err, pair)
+			continue
+		}
+		if encoded := b.EncodeSymbol(symbol); encoded != pair {
+			t.Errorf("Received %v, expected %v", encoded, pair)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package bitfinex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	datastructure "github.com/alessiosavi/GoArbitrage/datastructure/bitfinex"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"github.com/alessiosavi/GoArbitrage/markets/stream"
+	"github.com/alessiosavi/GoArbitrage/network/websocket"
+	"github.com/alessiosavi/GoArbitrage/orderbook"
+	"go.uber.org/zap"
+)
+
+// BITFINEX_WEBSOCKET_URL is the url of the bitfinex public websocket
+const BITFINEX_WEBSOCKET_URL string = `wss://api-pub.bitfinex.com/ws/2`
+
+// BITFINEX_BOOK_LENGTH is the number of levels for side subscribed, also used for compute the checksum
+const BITFINEX_BOOK_LENGTH = 25
+
+// BITFINEX_CHECKSUM_FLAG enable the checksum message after every update of the book
+const BITFINEX_CHECKSUM_FLAG = 131072
+
+// SetStreamURL is delegated to set the url used for the websocket in place of the bitfinex one
+func (b *Bitfinex) SetStreamURL(url string) {
+	b.streamURL = url
+}
+
+// Streaming return true if the order book of the given pair is updated by the websocket
+func (b *Bitfinex) Streaming(pair string) bool {
+	return b.streaming.Streaming(pair)
+}
+
+// Stream is delegated to keep the order books of the given pairs updated through the bitfinex websocket.
+// The method block until the context is done
+func (b *Bitfinex) Stream(ctx context.Context, pairs []string, updates chan<- markets.Update) error {
+	url := b.streamURL
+	if url == "" {
+		url = BITFINEX_WEBSOCKET_URL
+	}
+	handler := &bitfinexStream{url: url}
+	handler.Reset()
+
+	s := stream.New(b.Name(), handler)
+	s.OnUpdate = func(book *orderbook.Book) {
+		order := datastructure.BitfinexOrderBook{Pair: book.Pair, Bids: bitfinexOrders(book.Bids(b.depth())), Asks: bitfinexOrders(book.Asks(b.depth())),
+			Received: time.Now()}
+		b.mutex.Lock()
+		if b.OrderBook == nil {
+			b.OrderBook = make(map[string]datastructure.BitfinexOrderBook)
+		}
+		b.OrderBook[book.Pair] = order
+		b.mutex.Unlock()
+		b.streaming.Set(book.Pair)
+		symbol, _ := b.DecodeSymbol(book.Pair)
+		stream.Notify(updates, markets.Update{Market: b.Name(), Pair: book.Pair, Symbol: symbol})
+	}
+	s.OnReset = b.streaming.Reset
+	return s.Run(ctx, pairs)
+}
+
+// bitfinexOrders is delegated to convert the levels of the book into the bitfinex orders.
+// The volume of the asks is sent as a negative amount by the websocket
+func bitfinexOrders(levels []orderbook.Level) []datastructure.BitfinexOrder {
+	orders := make([]datastructure.BitfinexOrder, len(levels))
+	for i, level := range levels {
+		orders[i] = datastructure.BitfinexOrder{Price: level.PriceText, Volume: strings.TrimPrefix(level.VolumeText, "-")}
+	}
+	return orders
+}
+
+// bitfinexSymbol is delegated to convert the given pair into the symbol used by the websocket (btcusd -> tBTCUSD)
+func bitfinexSymbol(pair string) string {
+	return "t" + strings.ToUpper(pair)
+}
+
+// bitfinexStream is the protocol of the book channel of the bitfinex websocket
+type bitfinexStream struct {
+	url string
+	// channels contains the book of every channel subscribed
+	channels map[int64]*orderbook.Book
+}
+
+// bitfinexEvent is a message of the bitfinex websocket that is not related to a channel
+type bitfinexEvent struct {
+	Event   string `json:"event"`
+	Channel string `json:"channel"`
+	ChanID  int64  `json:"chanId"`
+	Symbol  string `json:"symbol"`
+	Msg     string `json:"msg"`
+	Code    int    `json:"code"`
+}
+
+func (h *bitfinexStream) URL() string {
+	return h.url
+}
+
+func (h *bitfinexStream) Reset() {
+	h.channels = make(map[int64]*orderbook.Book)
+}
+
+func (h *bitfinexStream) Subscribe(conn *websocket.Conn, pairs []string) error {
+	messages := []interface{}{map[string]interface{}{"event": "conf", "flags": BITFINEX_CHECKSUM_FLAG}}
+	for _, pair := range pairs {
+		messages = append(messages, map[string]interface{}{"event": "subscribe", "channel": "book", "symbol": bitfinexSymbol(pair),
+			"prec": "P0", "freq": "F0", "len": "25"})
+	}
+	for _, message := range messages {
+		data, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		if err = conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *bitfinexStream) Handle(opcode int, message []byte) ([]*orderbook.Book, error) {
+	if len(message) > 0 && message[0] == '{' {
+		var event bitfinexEvent
+		if err := json.Unmarshal(message, &event); err != nil {
+			return nil, err
+		}
+		switch event.Event {
+		case "subscribed":
+			pair := strings.ToLower(strings.TrimPrefix(event.Symbol, "t"))
+			h.channels[event.ChanID] = orderbook.New(pair)
+		case "error":
+			zap.S().Warnf("Bitfinex subscription of [%s] failed: %s", event.Symbol, event.Msg)
+		case "info":
+			// The server is restarting, the books have to be subscribed again
+			if event.Code == 20051 {
+				return nil, errors.New("RECONNECTION_REQUESTED")
+			}
+		}
+		return nil, nil
+	}
+
+	// [chanId, data] or [chanId, "cs", checksum]
+	var fields []json.RawMessage
+	if err := json.Unmarshal(message, &fields); err != nil {
+		return nil, err
+	}
+	if len(fields) < 2 {
+		return nil, errors.New("UNEXPECTED_MESSAGE")
+	}
+	var chanID int64
+	if err := json.Unmarshal(fields[0], &chanID); err != nil {
+		return nil, err
+	}
+	book, ok := h.channels[chanID]
+	if !ok {
+		return nil, nil
+	}
+
+	// Heartbeat ("hb") and checksum ("cs")
+	var kind string
+	if json.Unmarshal(fields[1], &kind) == nil {
+		if kind == "cs" && len(fields) == 3 {
+			var checksum int32
+			if err := json.Unmarshal(fields[2], &checksum); err != nil {
+				return nil, err
+			}
+			if checksum != stream.InterleavedChecksum(book, BITFINEX_BOOK_LENGTH) {
+				return nil, stream.ErrChecksum
+			}
+		}
+		return nil, nil
+	}
+
+	var levels [][]json.Number
+	if err := json.Unmarshal(fields[1], &levels); err != nil {
+		// Single update
+		var level []json.Number
+		if err = json.Unmarshal(fields[1], &level); err != nil {
+			return nil, err
+		}
+		if err = bitfinexUpdate(book, level); err != nil {
+			return nil, err
+		}
+		return []*orderbook.Book{book}, nil
+	}
+	// Snapshot
+	book.Snapshot(nil, nil)
+	for _, level := range levels {
+		if err := bitfinexUpdate(book, level); err != nil {
+			return nil, err
+		}
+	}
+	return []*orderbook.Book{book}, nil
+}
+
+// bitfinexUpdate is delegated to apply the level [price, count, amount] to the book. The positive amount are bids,
+// the negative are asks, a level without orders is removed
+func bitfinexUpdate(book *orderbook.Book, data []json.Number) error {
+	if len(data) != 3 {
+		return errors.New("UNEXPECTED_LEVEL")
+	}
+	level, err := orderbook.ParseLevel(data[0].String(), data[2].String())
+	if err != nil {
+		return err
+	}
+	bid := level.Volume > 0
+	if level.Volume < 0 {
+		level.Volume = -level.Volume
+	}
+	if data[1].String() == "0" {
+		level.Volume = 0
+	}
+	if bid {
+		book.SetBid(level)
+	} else {
+		book.SetAsk(level)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package bitfinex
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"github.com/alessiosavi/GoArbitrage/markets/fakeserver"
+)
+
+func Test_Stream(t *testing.T) {
+	type TestCase struct {
+		Bids   []market.MarketOrder
+		Asks   []market.MarketOrder
+		Number int
+	}
+
+	messages, err := fakeserver.LoadMessages("BITFINEX", "stream.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := fakeserver.NewStream(func(conn *fakeserver.StreamConn, n int) {
+		// Configuration and subscription
+		for i := 0; i < 2; i++ {
+			if _, err := conn.Read(); err != nil {
+				return
+			}
+		}
+		if n == 0 {
+			// The checksum of the snapshot does not match, a new subscription is sent
+			conn.Send(messages[0], messages[1], messages[2], messages[3], []byte(`[17082,"cs",1]`))
+		} else {
+			conn.Send(messages...)
+		}
+		conn.Wait()
+	})
+	defer server.Close()
+
+	b := &Bitfinex{Depth: 2}
+	b.SetStreamURL(server.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := make(chan markets.Update, 16)
+	done := make(chan error)
+	go func() { done <- b.Stream(ctx, []string{"btcusd"}, updates) }()
+
+	// 1 snapshot before the checksum error, the snapshot and 3 updates after the new subscription
+	for i := 0; i < 5; i++ {
+		select {
+		case update := <-updates:
+			if update.Market != b.Name() || update.Pair != "btcusd" || update.Symbol != market.NewSymbol("btc", "usd") {
+				t.Errorf("Received %v, expected an update of %s [test n. %d]", update, "btcusd", 1)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Received %d updates, expected 5", i)
+		}
+	}
+	if !b.Streaming("btcusd") {
+		t.Errorf("Expected the pair in streaming [test n. %d]", 2)
+	}
+	c := TestCase{
+		Bids:   []market.MarketOrder{{Price: 9100.5, Volume: 0.8}, {Price: 9100, Volume: 0.5}},
+		Asks:   []market.MarketOrder{{Price: 9101, Volume: 0.4}, {Price: 9101.5, Volume: 1.6}},
+		Number: 3,
+	}
+	m, err := b.GetMarketData("btcusd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalOrders(m.Bids["btcusd"], c.Bids) || !equalOrders(m.Asks["btcusd"], c.Asks) {
+		t.Errorf("Received %v/%v, expected %v/%v [test n. %d]", m.Bids["btcusd"], m.Asks["btcusd"], c.Bids, c.Asks, c.Number)
+	}
+	// The checksum of the valid messages match
+	if server.Connections() != 2 {
+		t.Errorf("Received %d connections, expected %d [test n. %d]", server.Connections(), 2, 4)
+	}
+	expected := []string{`{"event":"conf","flags":131072}`, `{"channel":"book","event":"subscribe","freq":"F0","len":"25","prec":"P0","symbol":"tBTCUSD"}`}
+	if received := server.Received(1); len(received) < 2 || received[0] != expected[0] || received[1] != expected[1] {
+		t.Errorf("Received %v, expected %v [test n. %d]", received, expected, 5)
+	}
+
+	cancel()
+	if err = <-done; err != context.Canceled {
+		t.Errorf("Received %v, expected %v [test n. %d]", err, context.Canceled, 6)
+	}
+	if b.Streaming("btcusd") {
+		t.Errorf("Expected the pair not in streaming after the stop [test n. %d]", 7)
+	}
+}
+
+func equalOrders(a, b []market.MarketOrder) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Price != b[i].Price || a[i].Volume != b[i].Volume {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,213 @@
+package bitfinex
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"go.uber.org/zap"
+)
+
+// BITFINEX_AUTH_PATH is the path of the bitfinex authenticated API (v2)
+const BITFINEX_AUTH_PATH string = `/v2/auth/`
+
+// The fields of the order array of the v2 API
+const (
+	bitfinexOrderID          = 0
+	bitfinexOrderSymbol      = 3
+	bitfinexOrderAmount      = 6
+	bitfinexOrderAmountOrig  = 7
+	bitfinexOrderStatus      = 13
+	bitfinexOrderPrice       = 16
+	bitfinexOrderPriceAvg    = 17
+	bitfinexOrderFieldsCount = 18
+)
+
+// SetCredentials is delegated to set the API key used for sign the requests of the authenticated API
+func (b *Bitfinex) SetCredentials(credentials markets.Credentials) {
+	b.credentials = credentials
+}
+
+// bitfinexSign is delegated to compute the bfx-signature header: the HMAC-SHA384 (hex) of `/api` followed by the
+// path, the nonce and the body
+func bitfinexSign(secret, path string, nonce int64, body string) string {
+	mac := hmac.New(sha512.New384, []byte(secret))
+	mac.Write([]byte("/api" + path + strconv.FormatInt(nonce, 10) + body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// auth is delegated to send a signed request to the given endpoint of the authenticated API, decoding the result.
+// The numbers are decoded as json.Number
+func (b *Bitfinex) auth(ctx context.Context, endpoint string, params interface{}, result *[]interface{}) error {
+	if b.credentials.Key == "" || b.credentials.Secret == "" {
+		return markets.ErrMissingCredentials
+	}
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	nonce := markets.Nonce()
+	path := BITFINEX_AUTH_PATH + endpoint
+	header := http.Header{"bfx-nonce": {strconv.FormatInt(nonce, 10)}, "bfx-apikey": {b.credentials.Key},
+		"bfx-signature": {bitfinexSign(b.credentials.Secret, path, nonce, string(body))}, "Content-Type": {"application/json"}}
+	resp := b.getClient().Send(ctx, "POST", b.url(BITFINEX_API+path), header, body)
+	if resp.Error != nil {
+		return resp.Error
+	}
+	decoder := json.NewDecoder(bytes.NewReader(resp.Body))
+	decoder.UseNumber()
+	if resp.StatusCode != 200 {
+		// The errors are sent as ["error", code, "message"]
+		var message []interface{}
+		if decoder.Decode(&message) == nil && len(message) == 3 {
+			return errors.New(strings.ToUpper(strings.Replace(fmt.Sprint(message[2]), " ", "_", -1)))
+		}
+		zap.S().Warnw("Received a non 200 status code: " + strconv.Itoa(resp.StatusCode))
+		return errors.New("NON_200_STATUS_CODE")
+	}
+	return decoder.Decode(result)
+}
+
+// bitfinexNotification is delegated to extract the orders of a notification ([MTS, TYPE, MESSAGE_ID, null, DATA,
+// CODE, STATUS, TEXT]), returning the text as error if the status is not SUCCESS
+func bitfinexNotification(notification []interface{}) ([]interface{}, error) {
+	if len(notification) < 8 {
+		return nil, errors.New("INVALID_NOTIFICATION")
+	}
+	if status := fmt.Sprint(notification[6]); status != "SUCCESS" {
+		return nil, errors.New(status + ": " + fmt.Sprint(notification[7]))
+	}
+	data, _ := notification[4].([]interface{})
+	return data, nil
+}
+
+// bitfinexNumber return the value of the given json.Number field, 0 for null
+func bitfinexNumber(field interface{}) float64 {
+	if number, ok := field.(json.Number); ok {
+		value, _ := number.Float64()
+		return value
+	}
+	return 0
+}
+
+// bitfinexOrderState is delegated to convert the status of the order (ACTIVE, EXECUTED @ 107.6(-0.2),
+// PARTIALLY FILLED @ ..., CANCELED ...) into the standard state
+func bitfinexOrderState(status string) markets.OrderState {
+	switch {
+	case strings.HasPrefix(status, "ACTIVE"), strings.HasPrefix(status, "PARTIALLY FILLED"):
+		return markets.Open
+	case strings.HasPrefix(status, "EXECUTED"):
+		return markets.Closed
+	}
+	return markets.Canceled
+}
+
+// bitfinexOrder is delegated to convert the given order array into the order status. The amounts are negative for
+// the sell orders, the amount is the volume not executed
+func bitfinexOrder(symbol market.Symbol, fields interface{}) (markets.OrderStatus, error) {
+	order, ok := fields.([]interface{})
+	if !ok || len(order) < bitfinexOrderFieldsCount {
+		return markets.OrderStatus{}, errors.New("INVALID_ORDER")
+	}
+	remaining, original := bitfinexNumber(order[bitfinexOrderAmount]), bitfinexNumber(order[bitfinexOrderAmountOrig])
+	status := markets.OrderStatus{ID: fmt.Sprint(order[bitfinexOrderID]), Symbol: symbol, Side: markets.Buy,
+		Price: bitfinexNumber(order[bitfinexOrderPrice]), Volume: math.Abs(original), Filled: math.Abs(original) - math.Abs(remaining),
+		AveragePrice: bitfinexNumber(order[bitfinexOrderPriceAvg]), State: bitfinexOrderState(fmt.Sprint(order[bitfinexOrderStatus]))}
+	if original < 0 {
+		status.Side = markets.Sell
+	}
+	return status, nil
+}
+
+// bitfinexSymbol is delegated to convert the given symbol into the trading symbol of the v2 API (tBTCUSD)
+func (b *Bitfinex) bitfinexSymbol(symbol market.Symbol) string {
+	return "t" + strings.ToUpper(b.EncodeSymbol(symbol))
+}
+
+// PlaceOrder is delegated to place the given limit order on the exchange wallet, returning the id of the order. The
+// price is rounded to the significant digits allowed by the pair
+func (b *Bitfinex) PlaceOrder(ctx context.Context, order markets.Order) (string, error) {
+	order = markets.RoundOrder(order, b.Constraint(b.EncodeSymbol(order.Symbol)))
+	amount := markets.FormatFloat(order.Volume)
+	if order.Side == markets.Sell {
+		amount = "-" + amount
+	}
+	params := map[string]string{"type": "EXCHANGE LIMIT", "symbol": b.bitfinexSymbol(order.Symbol), "amount": amount,
+		"price": markets.FormatFloat(order.Price)}
+	var notification []interface{}
+	if err := b.auth(ctx, "w/order/submit", params, &notification); err != nil {
+		return "", err
+	}
+	orders, err := bitfinexNotification(notification)
+	if err != nil {
+		return "", err
+	}
+	if len(orders) == 0 {
+		return "", errors.New("MISSING_ORDER_ID")
+	}
+	status, err := bitfinexOrder(order.Symbol, orders[0])
+	return status.ID, err
+}
+
+// GetOrder is delegated to retrieve the state of the order with the given id, searching it in the active orders
+// and then in the history
+func (b *Bitfinex) GetOrder(ctx context.Context, symbol market.Symbol, id string) (markets.OrderStatus, error) {
+	orderID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return markets.OrderStatus{}, markets.ErrOrderNotFound
+	}
+	for _, endpoint := range []string{"r/orders", "r/orders/" + b.bitfinexSymbol(symbol) + "/hist"} {
+		var orders []interface{}
+		if err = b.auth(ctx, endpoint, map[string][]int64{"id": {orderID}}, &orders); err != nil {
+			return markets.OrderStatus{}, err
+		}
+		if len(orders) > 0 {
+			return bitfinexOrder(symbol, orders[0])
+		}
+	}
+	return markets.OrderStatus{}, markets.ErrOrderNotFound
+}
+
+// CancelOrder is delegated to cancel the order with the given id
+func (b *Bitfinex) CancelOrder(ctx context.Context, symbol market.Symbol, id string) error {
+	orderID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return markets.ErrOrderNotFound
+	}
+	var notification []interface{}
+	if err = b.auth(ctx, "w/order/cancel", map[string]int64{"id": orderID}, &notification); err != nil {
+		return err
+	}
+	_, err = bitfinexNotification(notification)
+	return err
+}
+
+// GetBalances is delegated to retrieve the available balance (without the amount held by the open orders) of the
+// exchange wallet
+func (b *Bitfinex) GetBalances(ctx context.Context) (map[string]float64, error) {
+	var wallets []interface{}
+	if err := b.auth(ctx, "r/wallets", map[string]string{}, &wallets); err != nil {
+		return nil, err
+	}
+	balances := make(map[string]float64, len(wallets))
+	// Every wallet is [WALLET_TYPE, CURRENCY, BALANCE, UNSETTLED_INTEREST, AVAILABLE_BALANCE, ...]
+	for _, fields := range wallets {
+		wallet, ok := fields.([]interface{})
+		if !ok || len(wallet) < 5 || fmt.Sprint(wallet[0]) != "exchange" {
+			continue
+		}
+		balances[b.Asset(strings.ToLower(fmt.Sprint(wallet[1])))] = bitfinexNumber(wallet[4])
+	}
+	return balances, nil
+}
@@ -0,0 +1,110 @@
+package bitfinex
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"github.com/alessiosavi/GoArbitrage/markets/fakeserver"
+	"github.com/alessiosavi/GoArbitrage/network"
+)
+
+const testSecret = "bitfinex-secret"
+
+// verifyBitfinex is the verification of the signature done by the server
+func verifyBitfinex(r *http.Request, body []byte) error {
+	if r.Method != "POST" || r.Header.Get("bfx-apikey") != "key" || r.Header.Get("bfx-nonce") == "" {
+		return errors.New("apikey: invalid")
+	}
+	mac := hmac.New(sha512.New384, []byte(testSecret))
+	mac.Write([]byte("/api" + r.URL.Path + r.Header.Get("bfx-nonce") + string(body)))
+	if r.Header.Get("bfx-signature") != hex.EncodeToString(mac.Sum(nil)) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+func Test_BitfinexTrade(t *testing.T) {
+	order := `[1185815098,null,1585565297,"tBTCUSD",1585565297000,1585565297000,%s,1.25,"EXCHANGE LIMIT",null,null,null,0,"%s",null,null,37500,%s,0,0,null,null,null,0,0,null,null,null,"API>BFX",null,null,null]`
+	server := fakeserver.New()
+	defer server.Close()
+	server.SetVerifier(verifyBitfinex)
+	server.Handle("/v2/auth/w/order/submit", fakeserver.Response{StatusCode: 200,
+		Body: []byte(`[1585565297000,"on-req",null,null,[` + fmt.Sprintf(order, "1.25", "ACTIVE", "0") + `],null,"SUCCESS","Submitting 1 orders."]`)})
+	// The order is not active, it is found in the history
+	server.Handle("/v2/auth/r/orders", fakeserver.Response{StatusCode: 200, Body: []byte(`[]`)})
+	server.Handle("/v2/auth/r/orders/tBTCUSD/hist", fakeserver.Response{StatusCode: 200,
+		Body: []byte(`[` + fmt.Sprintf(order, "0.75", "CANCELED was: PARTIALLY FILLED @ 37490.0(0.5)", "37490") + `]`)})
+	server.Handle("/v2/auth/w/order/cancel", fakeserver.Response{StatusCode: 200,
+		Body: []byte(`[1585565297000,"oc-req",null,null,[],null,"ERROR","Order not found."]`)})
+	server.Handle("/v2/auth/r/wallets", fakeserver.Response{StatusCode: 200,
+		Body: []byte(`[["exchange","BTC",1.5,0,1.25,null,null],["exchange","UST",100.25,0,90.25,null,null],["margin","USD",7,0,7,null,null]]`)})
+
+	var b Bitfinex
+	b.Init()
+	b.SetBaseURL(server.URL)
+	b.SetHTTPClient(server.Client())
+	b.Assets = map[string]string{"ust": "usdt"}
+	// The rate limit of the market is not tested here
+	b.client.Limiter = network.NewLimiter(1000, 1000)
+	ctx := context.Background()
+	symbol := market.NewSymbol("btc", "usd")
+	if _, err := b.GetBalances(ctx); err != markets.ErrMissingCredentials {
+		t.Errorf("Received %v, expected %v [test n. %d]", err, markets.ErrMissingCredentials, 1)
+	}
+
+	b.SetCredentials(markets.Credentials{Key: "key", Secret: testSecret})
+	id, err := b.PlaceOrder(ctx, markets.Order{Symbol: symbol, Side: markets.Sell, Price: 37500, Volume: 1.25})
+	if err != nil || id != "1185815098" {
+		t.Errorf("Received %s (%v), expected %s [test n. %d]", id, err, "1185815098", 2)
+	}
+	var params map[string]string
+	if json.Unmarshal([]byte(server.Bodies()[0]), &params); params["symbol"] != "tBTCUSD" || params["amount"] != "-1.25" || params["type"] != "EXCHANGE LIMIT" {
+		t.Errorf("Received %v, expected the parameters of the order [test n. %d]", params, 3)
+	}
+	status, err := b.GetOrder(ctx, symbol, id)
+	expected := markets.OrderStatus{ID: id, Symbol: symbol, Side: markets.Buy, Price: 37500, Volume: 1.25, Filled: 0.5, AveragePrice: 37490, State: markets.Canceled}
+	if err != nil || status != expected {
+		t.Errorf("Received %+v (%v), expected %+v [test n. %d]", status, err, expected, 4)
+	}
+	if err = b.CancelOrder(ctx, symbol, id); err == nil || err.Error() != "ERROR: Order not found." {
+		t.Errorf("Received %v, expected the error of the notification [test n. %d]", err, 5)
+	}
+	balances, err := b.GetBalances(ctx)
+	if err != nil || len(balances) != 2 || balances["btc"] != 1.25 || balances["usdt"] != 90.25 {
+		t.Errorf("Received %v (%v), expected the available balances of the exchange wallet [test n. %d]", balances, err, 6)
+	}
+
+	b.SetCredentials(markets.Credentials{Key: "key", Secret: "wrong"})
+	if _, err = b.GetBalances(ctx); err == nil {
+		t.Errorf("Expected an error for an invalid signature [test n. %d]", 7)
+	}
+}
+
+func Test_BitfinexOrderState(t *testing.T) {
+	type TestCase struct {
+		Status   string
+		Expected markets.OrderState
+		Number   int
+	}
+	cases := []TestCase{
+		{Status: "ACTIVE", Expected: markets.Open, Number: 1},
+		{Status: "PARTIALLY FILLED @ 107.6(-0.2)", Expected: markets.Open, Number: 2},
+		{Status: "EXECUTED @ 107.6(-0.2)", Expected: markets.Closed, Number: 3},
+		{Status: "CANCELED", Expected: markets.Canceled, Number: 4},
+		{Status: "INSUFFICIENT BALANCE (U1)", Expected: markets.Canceled, Number: 5},
+	}
+	for _, c := range cases {
+		if state := bitfinexOrderState(c.Status); state != c.Expected {
+			t.Errorf("Received %s, expected %s [test n. %d]", state, c.Expected, c.Number)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+// Package fakeserver contains a local stand-in of the exchanges API, used for test the markets without the network.
+// The server reply with the responses recorded in the testdata folder, one folder for every market
+package fakeserver
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ROUTES_FILE is the file, in the folder of the market, that map the path of the requests to the recorded responses
+const ROUTES_FILE = "routes.json"
+
+// Response is the response sent by the server for a given path
+type Response struct {
+	StatusCode int
+	Headers    map[string]string
+	Body       []byte
+	// Delay is the time waited before the response, e.g. for test the timeout of the requests. The wait stop if the
+	// client close the request
+	Delay time.Duration
+}
+
+// Server is an HTTP server that reply with the responses registered for the path of the request
+type Server struct {
+	*httptest.Server
+	mutex     sync.Mutex
+	responses map[string]Response
+	// requests save the URL (path and query) of every request received, bodies the body of every request
+	requests []string
+	bodies   []string
+	verifier Verifier
+}
+
+// Verifier is called with every request (and its body) before the response, e.g. for verify the signature of the
+// private API. The request is refused with a 401 status code if an error is returned
+type Verifier func(r *http.Request, body []byte) error
+
+// New is delegated to start a new server without any response registered.
+// The server have to be closed by the caller
+func New() *Server {
+	s := &Server{responses: make(map[string]Response)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// NewMarket is delegated to start a new server that reply with the responses recorded for the given market
+func NewMarket(market string) (*Server, error) {
+	s := New()
+	if err := s.Load(filepath.Join(TestData(), market)); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// TestData return the folder that contains the recorded responses
+func TestData() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "testdata")
+}
+
+// Load is delegated to register the responses recorded in the given folder, using the routes file
+func (s *Server) Load(folder string) error {
+	data, err := ioutil.ReadFile(filepath.Join(folder, ROUTES_FILE))
+	if err != nil {
+		return err
+	}
+	var routes map[string]string
+	if err = json.Unmarshal(data, &routes); err != nil {
+		return err
+	}
+	if len(routes) == 0 {
+		return errors.New("EMPTY_ROUTES")
+	}
+	for pattern, file := range routes {
+		body, err := ioutil.ReadFile(filepath.Join(folder, file))
+		if err != nil {
+			return err
+		}
+		s.Handle(pattern, Response{StatusCode: http.StatusOK, Body: body})
+	}
+	return nil
+}
+
+// Handle is delegated to register the response for the given path.
+// The path can be a pattern (e.g. `/v1/book/*`), see path.Match for the syntax
+func (s *Server) Handle(pattern string, response Response) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.responses[pattern] = response
+}
+
+// SetVerifier is delegated to set the verifier of the requests, nil disable the verification
+func (s *Server) SetVerifier(verifier Verifier) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.verifier = verifier
+}
+
+// Bodies return the body of the requests received by the server
+func (s *Server) Bodies() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.bodies...)
+}
+
+// Requests return the URL of the requests received by the server
+func (s *Server) Requests() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	requests := make([]string, len(s.requests))
+	copy(requests, s.requests)
+	return requests
+}
+
+// serve reply with the response registered for the path of the request, the query is ignored
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	s.mutex.Lock()
+	s.requests = append(s.requests, r.URL.RequestURI())
+	s.bodies = append(s.bodies, string(body))
+	response, ok := s.match(r.URL.Path)
+	verifier := s.verifier
+	s.mutex.Unlock()
+	if verifier != nil {
+		if err := verifier(r, body); err != nil {
+			http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusUnauthorized)
+			return
+		}
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if response.Delay > 0 {
+		select {
+		case <-time.After(response.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	for key, value := range response.Headers {
+		w.Header().Set(key, value)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(response.StatusCode)
+	w.Write(response.Body)
+}
+
+// match return the response of the given path. The exact path have the precedence over the patterns, the patterns
+// are tried in lexicographic order
+func (s *Server) match(urlPath string) (Response, bool) {
+	if response, ok := s.responses[urlPath]; ok {
+		return response, true
+	}
+	patterns := make([]string, 0, len(s.responses))
+	for pattern := range s.responses {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, urlPath); ok {
+			return s.responses[pattern], true
+		}
+	}
+	return Response{}, false
+}
@@ -0,0 +1,51 @@
+package fakeserver
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func Test_NewMarket(t *testing.T) {
+	type TestCase struct {
+		Market     string
+		Path       string
+		StatusCode int
+		Number     int
+	}
+
+	cases := []TestCase{
+		{Market: "KRAKEN", Path: "/0/public/Depth?pair=XBTUSD&count=10", StatusCode: 200, Number: 1},
+		{Market: "BITFINEX", Path: "/v2/conf/pub:map:currency:sym", StatusCode: 200, Number: 2},
+		{Market: "BITFINEX", Path: "/v1/book/btcusd", StatusCode: 200, Number: 3},
+		// The pattern does not match the nested path
+		{Market: "GEMINI", Path: "/v1/book/btcusd/trades", StatusCode: 404, Number: 4},
+		// The exact path have the precedence over the pattern
+		{Market: "OKCOIN", Path: "/api/spot/v3/instruments/", StatusCode: 200, Number: 5},
+		{Market: "OKCOIN", Path: "/api/spot/v3/instruments/BTC-USD/book?size=5", StatusCode: 200, Number: 6},
+	}
+
+	for _, c := range cases {
+		server, err := NewMarket(c.Market)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := server.Client().Get(server.URL + c.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != c.StatusCode || (c.StatusCode == http.StatusOK && len(body) == 0) {
+			t.Errorf("Received %d, expected %d [test n. %d]", resp.StatusCode, c.StatusCode, c.Number)
+		}
+		if requests := server.Requests(); len(requests) != 1 || requests[0] != c.Path {
+			t.Errorf("Received %v, expected %v [test n. %d]", requests, c.Path, c.Number)
+		}
+		server.Close()
+	}
+
+	if _, err := NewMarket("UNKNOWN"); err == nil {
+		t.Errorf("Expected an error for an unknown market [test n. %d]", len(cases)+1)
+	}
+}
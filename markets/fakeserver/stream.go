@@ -0,0 +1,120 @@
+package fakeserver
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/alessiosavi/GoArbitrage/network/websocket"
+)
+
+// StreamServer is a websocket server that run the given handler for every connection
+type StreamServer struct {
+	*httptest.Server
+	// URL is the websocket url of the server
+	URL   string
+	mutex sync.Mutex
+	// connections is the number of connections accepted
+	connections int
+	// received save the messages sent by the clients, for every connection
+	received [][]string
+}
+
+// NewStream is delegated to start a websocket server. The handler receive the connection and its number, starting
+// from 0, so every connection can reply differently (e.g. for test the reconnection)
+func NewStream(handler func(conn *StreamConn, n int)) *StreamServer {
+	s := &StreamServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		s.mutex.Lock()
+		n := s.connections
+		s.connections++
+		s.received = append(s.received, nil)
+		s.mutex.Unlock()
+		handler(&StreamConn{Conn: conn, server: s, n: n}, n)
+	}))
+	s.URL = "ws" + strings.TrimPrefix(s.Server.URL, "http")
+	return s
+}
+
+// Connections return the number of connections accepted
+func (s *StreamServer) Connections() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.connections
+}
+
+// Received return the messages sent by the client in the given connection
+func (s *StreamServer) Received(n int) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if n >= len(s.received) {
+		return nil
+	}
+	return append([]string(nil), s.received[n]...)
+}
+
+// StreamConn is a connection of the stream server, that record the messages received
+type StreamConn struct {
+	*websocket.Conn
+	server *StreamServer
+	n      int
+}
+
+// Read is delegated to read the next message sent by the client
+func (c *StreamConn) Read() (string, error) {
+	_, message, err := c.ReadMessage()
+	if err != nil {
+		return "", err
+	}
+	c.server.mutex.Lock()
+	c.server.received[c.n] = append(c.server.received[c.n], string(message))
+	c.server.mutex.Unlock()
+	return string(message), nil
+}
+
+// Send is delegated to send the given text messages
+func (c *StreamConn) Send(messages ...[]byte) error {
+	for _, message := range messages {
+		if err := c.WriteMessage(websocket.TextMessage, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Wait is delegated to read (and record) the messages until the client close the connection
+func (c *StreamConn) Wait() {
+	for {
+		if _, err := c.Read(); err != nil {
+			return
+		}
+	}
+}
+
+// LoadMessages is delegated to load the recorded websocket messages of the given market, one message per line
+func LoadMessages(market, file string) ([][]byte, error) {
+	f, err := os.Open(filepath.Join(TestData(), market, file))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var messages [][]byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			messages = append(messages, append([]byte(nil), line...))
+		}
+	}
+	return messages, scanner.Err()
+}
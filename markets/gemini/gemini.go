@@ -1,12 +1,15 @@
 package gemini
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
+	"net/http"
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
@@ -14,19 +17,28 @@ import (
 	"github.com/alessiosavi/GoArbitrage/datastructure/constants"
 	datastructure "github.com/alessiosavi/GoArbitrage/datastructure/gemini"
 	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"github.com/alessiosavi/GoArbitrage/markets/stream"
+	"github.com/alessiosavi/GoArbitrage/network"
 	"github.com/alessiosavi/GoArbitrage/utils"
 	fileutils "github.com/alessiosavi/GoGPUtils/files"
-	req "github.com/alessiosavi/Requests"
 )
 
+// GEMINI_API is the base url of the gemini API (sandbox)
+const GEMINI_API string = `https://api.sandbox.gemini.com`
+
 // URL for understand the pairs traded in the market
-const GEMINI_PAIRS_URL string = `https://api.sandbox.gemini.com/v1/symbols`
-const GEMINI_ORDER_BOOK_URL string = `https://api.sandbox.gemini.com/v1/book/`
+const GEMINI_PAIRS_URL string = GEMINI_API + `/v1/symbols`
+const GEMINI_ORDER_BOOK_URL string = GEMINI_API + `/v1/book/`
 
 var GEMINI_PAIRS_DATA = path.Join(constants.GEMINI_PATH, "pairs_list.json")
 var GEMINI_PAIRS_DETAILS = path.Join(constants.GEMINI_PATH, "pairs_info.json")
 var GEMINI_ORDERBOOK_DATA = path.Join(constants.GEMINI_PATH, "orders/")
 
+// geminiQuotes contains the currencies that can be used as quote in the gemini pairs.
+// The quotes that end with another quote (gusd) are matched first
+var geminiQuotes = []string{"gusd", "usd", "btc", "eth", "bch", "ltc", "dai", "eur", "gbp", "sgd"}
+
 type Gemini struct {
 	PairsNames []string                                 `json:"pairs_name"`
 	OrderBook  map[string]datastructure.GeminiOrderBook `json:"orderbook"`
@@ -35,24 +47,104 @@ type Gemini struct {
 	TakerFees  float64                                  `json:"taker_fee"`
 	// FeePercent is delegated to save if the fee is in percent or in coin
 	FeePercent bool `json:"fee_percent"`
+	// Fees contains the fee schedule (tiers by 30 days volume) of the market
+	Fees market.MarketFee `json:"fees"`
+	// Depth is the number of levels of the order book to request
+	Depth int `json:"depth"`
+	// mutex protect the order book, updated and read by the engine from different goroutines
+	mutex sync.RWMutex
+	// baseURL replace the base url of the API, if set
+	baseURL string
+	// client is used for send the requests, if set. The defaultClient is used otherwise
+	client *network.Client
+	// streamURL replace the url of the websocket, if set
+	streamURL string
+	// streaming save the pairs whose order book is updated by the websocket
+	streaming stream.Status
+	// credentials contains the API key used for sign the requests of the private API
+	credentials markets.Credentials
+}
+
+// GEMINI_RATE_LIMIT is the number of requests per second suggested by gemini for the public API
+const GEMINI_RATE_LIMIT float64 = 1
+
+// GEMINI_RATE_BURST is the number of requests that can be sent without wait
+const GEMINI_RATE_BURST int = 1
+
+// defaultClient is shared by all the requests sent to the market, in order to respect the rate limit
+var defaultClient = network.NewClient(GEMINI_RATE_LIMIT, GEMINI_RATE_BURST)
+
+func init() {
+	markets.Register(&Gemini{})
 }
 
+// Name return the name of the market
+func (g *Gemini) Name() string {
+	return `GEMINI`
+}
+
+// Init is delegated to initialize the maps for the given market
 func (g *Gemini) Init() {
 	g.OrderBook = make(map[string]datastructure.GeminiOrderBook)
 	g.PairsInfo = make(map[string]datastructure.GeminiPairs)
 	g.SetFees()
 }
 
+// SetBaseURL is delegated to set the base url used for send the requests in place of the gemini API
+func (g *Gemini) SetBaseURL(baseURL string) {
+	g.baseURL = strings.TrimSuffix(baseURL, "/")
+}
+
+// SetHTTPClient is delegated to set the HTTP client used for send the requests.
+// The market will use its own rate limiter, not shared with the other instances. A nil client restore the default one
+func (g *Gemini) SetHTTPClient(httpClient *http.Client) {
+	if httpClient == nil {
+		g.client = nil
+		return
+	}
+	g.client = network.NewClient(GEMINI_RATE_LIMIT, GEMINI_RATE_BURST)
+	g.client.HTTPClient = httpClient
+}
+
+// getClient return the client used for send the requests
+func (g *Gemini) getClient() *network.Client {
+	if g.client != nil {
+		return g.client
+	}
+	return defaultClient
+}
+
+// url is delegated to replace the base url of the given endpoint with the one configured
+func (g *Gemini) url(endpoint string) string {
+	if g.baseURL == "" {
+		return endpoint
+	}
+	return g.baseURL + strings.TrimPrefix(endpoint, GEMINI_API)
+}
+
+// SetDepth is delegated to set the number of levels of the order book to request
+func (g *Gemini) SetDepth(depth int) {
+	g.Depth = depth
+}
+
+// depth return the number of levels of the order book to request
+func (g *Gemini) depth() int {
+	if g.Depth > 0 {
+		return g.Depth
+	}
+	return constants.DEFAULT_DEPTH
+}
+
 // SetFees is delegated to initialize the fee type/amount for the given market
 func (g *Gemini) SetFees() {
 	g.MakerFee = 0.1
 	g.TakerFees = 0.35
 	g.FeePercent = true
+	g.Fees = market.MarketFee{IsPercent: g.FeePercent, Tiers: []market.FeeTier{{Volume: 0, Maker: g.MakerFee, Taker: g.TakerFees}}}
 }
 
 // GetPairsList is delegated to retrieve the type of pairs in the Gemini market
-func (g *Gemini) GetPairsList() error {
-	var request req.Request
+func (g *Gemini) GetPairsList(ctx context.Context) error {
 	var pairs []string
 	var data []byte
 	var err error
@@ -77,7 +169,7 @@ func (g *Gemini) GetPairsList() error {
 	} else {
 		zap.S().Debugw("Sendind request to [" + GEMINI_PAIRS_URL + "]")
 		// Call the HTTP method for retrieve the pairs
-		resp := request.SendRequest(GEMINI_PAIRS_URL, "GET", nil, nil, false, constants.TIMEOUT_REQ*time.Second)
+		resp := g.getClient().Get(ctx, g.url(GEMINI_PAIRS_URL))
 		if resp.Error != nil {
 			zap.S().Warnw("Error during http request. Err: " + resp.Error.Error())
 			return resp.Error
@@ -104,7 +196,7 @@ func (g *Gemini) GetPairsList() error {
 }
 
 // GetPairsDetails is delegated to read the file that contains the min order for the given pair
-func (g *Gemini) GetPairsDetails() error {
+func (g *Gemini) GetPairsDetails(ctx context.Context) error {
 	var err error
 	var data []byte
 
@@ -135,13 +227,17 @@ func (g *Gemini) GetPairsDetails() error {
 	return nil
 }
 
-func (g *Gemini) GetAllOrderBook() error {
-	var request req.Request
+func (g *Gemini) GetAllOrderBook(ctx context.Context) error {
 	var orders []datastructure.GeminiOrderBook
 	var data []byte
 	var err error
 
 	for _, pair := range g.PairsNames {
+		// Stop the download if the context is cancelled
+		if ctx.Err() != nil {
+			zap.S().Warnf("Stopping the download of the order books: %s", ctx.Err().Error())
+			break
+		}
 		zap.S().Debugw("Managin pair: [" + pair + "]")
 		var orderbook datastructure.GeminiOrderBook
 		orderbook.Pair = pair
@@ -155,11 +251,10 @@ func (g *Gemini) GetAllOrderBook() error {
 				continue
 			}
 		} else {
-			// NOTE: limit the response to only 3 orders
-			url := GEMINI_ORDER_BOOK_URL + pair + "?limit_bids=1&limit_asks=1"
+			url := GEMINI_ORDER_BOOK_URL + pair + "?limit_bids=" + strconv.Itoa(g.depth()) + "&limit_asks=" + strconv.Itoa(g.depth())
 			zap.S().Debugw("Sendind request to [" + url + "]")
 			// Call the HTTP method for retrieve the pairs
-			resp := request.SendRequest(url, "GET", nil, nil, false, constants.TIMEOUT_REQ*time.Second)
+			resp := g.getClient().Get(ctx, g.url(url))
 			if resp.Error != nil {
 				zap.S().Warnw("Error during http request. Err: " + resp.Error.Error())
 				continue
@@ -169,6 +264,7 @@ func (g *Gemini) GetAllOrderBook() error {
 				continue
 			}
 			data = resp.Body
+			orderbook.Received = time.Now()
 		}
 
 		err = json.Unmarshal(data, &orderbook)
@@ -182,20 +278,26 @@ func (g *Gemini) GetAllOrderBook() error {
 		}
 	}
 
+	g.mutex.Lock()
 	for i := range orders {
 		g.OrderBook[orders[i].Pair] = orders[i]
 	}
+	g.mutex.Unlock()
 
 	// Update the file with the new data
 	utils.DumpStruct(g.OrderBook, path.Join(constants.GEMINI_PATH, "orders_all.json"))
-	return nil
+	// The order books already retrieved are kept also if the context is cancelled
+	return ctx.Err()
 }
 
 func (g *Gemini) GetMarketData(pair string) (market.Market, error) {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
 	var markets market.Market
 	markets.Asks = make(map[string][]market.MarketOrder, len(g.OrderBook))
 	markets.Bids = make(map[string][]market.MarketOrder, len(g.OrderBook))
-	markets.MarketName = `GEMINI`
+	markets.Times = make(map[string]market.BookTime, len(g.OrderBook))
+	markets.MarketName = g.Name()
 	var order market.MarketOrder
 	if orders, ok := g.OrderBook[pair]; ok {
 		var asks = make([]market.MarketOrder, len(orders.Asks))
@@ -216,25 +318,78 @@ func (g *Gemini) GetMarketData(pair string) (market.Market, error) {
 		}
 		markets.Asks[pair] = asks
 		markets.Bids[pair] = bids
+		markets.Times[pair] = geminiBookTime(orders)
 		markets.MakerFee = g.MakerFee
 		markets.TakerFee = g.TakerFees
+		markets.Fees = g.Fees
 		return markets, nil
 	}
 	return markets, errors.New("unable to find pair [" + pair + "]")
 }
 
+// Constraint is delegated to retrieve the order rules (min order, order and price increment) of the given pair
+func (g *Gemini) Constraint(pair string) market.OrderConstraint {
+	var constraint market.OrderConstraint
+	if info, ok := g.PairsInfo[pair]; ok {
+		constraint.MinVolume = toFloat64(info.MinOrder)
+		constraint.VolumeIncrement = toFloat64(info.MinOrderIncrement)
+		constraint.PriceIncrement = toFloat64(info.MinPriceIncrement)
+	}
+	return constraint
+}
+
+// toFloat64 is delegated to convert the float32 of the pairs info without the conversion error (0.01 is converted in
+// 0.009999999776482582), otherwise the orders are rounded to a wrong increment
+func toFloat64(value float32) float64 {
+	converted, _ := strconv.ParseFloat(strconv.FormatFloat(float64(value), 'f', -1, 32), 64)
+	return converted
+}
+
+// geminiBookTime is delegated to retrieve the times of the given order book. The timestamp (in seconds) of every
+// level is sent by gemini, the time of the book is the most recent one
+func geminiBookTime(book datastructure.GeminiOrderBook) market.BookTime {
+	t := market.BookTime{Received: book.Received}
+	for _, orders := range [][]datastructure.GeminiOrder{book.Asks, book.Bids} {
+		for i := range orders {
+			seconds, err := strconv.ParseFloat(orders[i].Timestamp, 64)
+			if err != nil {
+				continue
+			}
+			if timestamp := time.Unix(0, int64(seconds*1e9)); timestamp.After(t.Exchange) {
+				t.Exchange = timestamp
+			}
+		}
+	}
+	return t
+}
+
 // GetMarketsData is delegated to convert the internal asks and bids struct to the common "market" struct
 func (g *Gemini) GetMarketsData() market.Market {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
 	var markets market.Market
 	// Standardize key for common coin
 	var key_standard string
 	markets.Asks = make(map[string][]market.MarketOrder, len(g.OrderBook))
 	markets.Bids = make(map[string][]market.MarketOrder, len(g.OrderBook))
-	markets.MarketName = `GEMINI`
+	markets.Times = make(map[string]market.BookTime, len(g.OrderBook))
+	markets.Symbols = make(map[string]market.Symbol, len(g.OrderBook))
+	markets.Constraints = make(map[string]market.OrderConstraint, len(g.OrderBook))
+	markets.MarketName = g.Name()
+	markets.MakerFee = g.MakerFee
+	markets.TakerFee = g.TakerFees
+	markets.Fees = g.Fees
 	// var i int
 	var order market.MarketOrder
 	for key := range g.OrderBook {
-		key_standard = strings.Replace(strings.ToLower(key), "-", "", 1)
+		symbol, err := g.DecodeSymbol(key)
+		if err != nil {
+			zap.S().Debugf("Skipping pair [%s]: %s", key, err.Error())
+			continue
+		}
+		key_standard = symbol.String()
+		markets.Symbols[key_standard] = symbol
+		markets.Constraints[key_standard] = g.Constraint(key)
 		var asks = make([]market.MarketOrder, len(g.OrderBook[key].Asks))
 		for i, ask := range g.OrderBook[key].Asks {
 			price, _ := strconv.ParseFloat(ask.Price, 64)
@@ -253,25 +408,24 @@ func (g *Gemini) GetMarketsData() market.Market {
 		}
 		markets.Asks[key_standard] = asks
 		markets.Bids[key_standard] = bids
+		markets.Times[key_standard] = geminiBookTime(g.OrderBook[key])
 	}
 
 	return markets
 }
 
-func (g *Gemini) GetOrderBook(pair string) error {
-	var request req.Request
+func (g *Gemini) GetOrderBook(ctx context.Context, pair string) error {
 	var order datastructure.GeminiOrderBook
 	var data []byte
 	var err error
 
-	// NOTE: limit the response to only 3 orders
-	url := GEMINI_ORDER_BOOK_URL + pair + "?limit_bids=1&limit_asks=1"
+	url := GEMINI_ORDER_BOOK_URL + pair + "?limit_bids=" + strconv.Itoa(g.depth()) + "&limit_asks=" + strconv.Itoa(g.depth())
 	zap.S().Debugw("Sendind request to [" + url + "]")
 	// Call the HTTP method for retrieve the pairs
-	resp := request.SendRequest(url, "GET", nil, nil, false, constants.TIMEOUT_REQ*time.Second)
+	resp := g.getClient().Get(ctx, g.url(url))
 	if resp.Error != nil {
 		zap.S().Warnw("Error during http request. Err: " + resp.Error.Error())
-		return err
+		return resp.Error
 	}
 
 	if resp.StatusCode != 200 {
@@ -286,12 +440,43 @@ func (g *Gemini) GetOrderBook(pair string) error {
 		return err
 	}
 
+	order.Pair = pair
+	order.Received = time.Now()
+	g.mutex.Lock()
 	if len(g.OrderBook) == 0 {
 		g.OrderBook = make(map[string]datastructure.GeminiOrderBook)
 	}
+	g.OrderBook[pair] = order
+	g.mutex.Unlock()
 	// Update the file with the new data
 	//utils.DumpStruct(order, path.Join(GEMINI_ORDERBOOK_DATA, pair+".json"))
 
-	// Update the file with the new data
 	return nil
 }
+
+// ParsePair is delegated to convert the given pair into the pair compliant with gemini
+func (g *Gemini) ParsePair(pair string) string {
+	return strings.ToLower(pair)
+}
+
+// EncodeSymbol is delegated to convert the given symbol into the pair compliant with gemini
+func (g *Gemini) EncodeSymbol(symbol market.Symbol) string {
+	return symbol.Base + symbol.Quote
+}
+
+// DecodeSymbol is delegated to extract the base and the quote currencies from the given pair.
+// Gemini pairs does not contain a separator, so the quote is matched against the allowed quote currencies
+func (g *Gemini) DecodeSymbol(pair string) (market.Symbol, error) {
+	pair = strings.ToLower(pair)
+	if len(g.PairsInfo) > 0 {
+		if _, ok := g.PairsInfo[pair]; !ok {
+			return market.Symbol{}, errors.New("pair [" + pair + "] not found in gemini pairs")
+		}
+	}
+	for _, quote := range geminiQuotes {
+		if strings.HasSuffix(pair, quote) && len(pair) > len(quote) {
+			return market.NewSymbol(strings.TrimSuffix(pair, quote), quote), nil
+		}
+	}
+	return market.Symbol{}, errors.New("unable to extract the currencies from pair [" + pair + "]")
+}
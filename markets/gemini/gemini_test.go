@@ -0,0 +1,126 @@
+package gemini
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	datastructure "github.com/alessiosavi/GoArbitrage/datastructure/gemini"
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+)
+
+// FIXTURES_PATH contains the data captured from the gemini API
+const FIXTURES_PATH = "../../data/GEMINI"
+
+// loadFixture is delegated to unmarshal the given captured file
+func loadFixture(t *testing.T, file string, v interface{}) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_MarketDataFixtures(t *testing.T) {
+	type TestCase struct {
+		Pair       string
+		Asks       []market.MarketOrder
+		Bids       []market.MarketOrder
+		Constraint market.OrderConstraint
+		Number     int
+	}
+
+	var g Gemini
+	g.Init()
+	var pairs []datastructure.GeminiPairs
+	loadFixture(t, filepath.Join(FIXTURES_PATH, "pairs_info.json"), &pairs)
+	for i := range pairs {
+		g.PairsInfo[pairs[i].Pair] = pairs[i]
+	}
+	for _, pair := range []string{"btcusd", "ethusd", "bcheth"} {
+		var book datastructure.GeminiOrderBook
+		loadFixture(t, filepath.Join(FIXTURES_PATH, "orders", pair+".json"), &book)
+		g.OrderBook[pair] = book
+	}
+
+	cases := []TestCase{
+		{Pair: "btcusd", Asks: []market.MarketOrder{{Price: 10232.09, Volume: 7.9814654}}, Bids: []market.MarketOrder{{Price: 10232.08, Volume: 0.024862}},
+			Constraint: market.OrderConstraint{MinVolume: 0.00001, VolumeIncrement: 0.00000001, PriceIncrement: 0.01}, Number: 1},
+		{Pair: "ethusd", Asks: []market.MarketOrder{{Price: 270, Volume: 0.001}}, Bids: []market.MarketOrder{{Price: 202.5, Volume: 0.001}},
+			Constraint: market.OrderConstraint{MinVolume: 0.001, VolumeIncrement: 0.000001, PriceIncrement: 0.01}, Number: 2},
+		// Empty side of the order book
+		{Pair: "bcheth", Asks: []market.MarketOrder{}, Bids: []market.MarketOrder{{Price: 3633, Volume: 15}},
+			Constraint: market.OrderConstraint{MinVolume: 0.001, VolumeIncrement: 0.000001, PriceIncrement: 0.0001}, Number: 3},
+	}
+
+	all := g.GetMarketsData()
+	if len(all.Asks) != len(cases) {
+		t.Errorf("Received %d pairs, expected %d", len(all.Asks), len(cases))
+	}
+	for _, c := range cases {
+		data, err := g.GetMarketData(c.Pair)
+		if err != nil {
+			t.Errorf("Received %v, expected no error [test n. %d]", err, c.Number)
+			continue
+		}
+		if !equalOrders(data.Asks[c.Pair], c.Asks) || !equalOrders(data.Bids[c.Pair], c.Bids) {
+			t.Errorf("Received %+v/%+v, expected %+v/%+v [test n. %d]", data.Asks[c.Pair], data.Bids[c.Pair], c.Asks, c.Bids, c.Number)
+		}
+		if !equalOrders(all.Asks[c.Pair], c.Asks) || !equalOrders(all.Bids[c.Pair], c.Bids) {
+			t.Errorf("Received %+v/%+v, expected %+v/%+v [test n. %d]", all.Asks[c.Pair], all.Bids[c.Pair], c.Asks, c.Bids, c.Number)
+		}
+		// The pairs info are saved as float32
+		constraint := all.Constraints[c.Pair]
+		if !equalFloat(constraint.MinVolume, c.Constraint.MinVolume) || !equalFloat(constraint.VolumeIncrement, c.Constraint.VolumeIncrement) ||
+			!equalFloat(constraint.PriceIncrement, c.Constraint.PriceIncrement) {
+			t.Errorf("Received %+v, expected %+v [test n. %d]", constraint, c.Constraint, c.Number)
+		}
+	}
+
+	if _, err := g.GetMarketData("zecusd"); err == nil {
+		t.Errorf("Expected an error for a pair without order book [test n. %d]", len(cases)+1)
+	}
+}
+
+func equalOrders(a, b []market.MarketOrder) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// equalFloat compare the values with a relative tolerance, the float32 keep only 7 significant digits
+func equalFloat(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-6*math.Abs(b)
+}
+
+func Test_GeminiBookTime(t *testing.T) {
+	type TestCase struct {
+		Book     datastructure.GeminiOrderBook
+		Expected time.Time
+		Number   int
+	}
+
+	received := time.Now()
+	cases := []TestCase{
+		{Book: datastructure.GeminiOrderBook{Bids: []datastructure.GeminiOrder{{Timestamp: "1586445700"}}, Asks: []datastructure.GeminiOrder{{Timestamp: "1586445702"}}, Received: received},
+			Expected: time.Unix(1586445702, 0), Number: 1},
+		// Invalid timestamps are ignored
+		{Book: datastructure.GeminiOrderBook{Bids: []datastructure.GeminiOrder{{Timestamp: "abc"}}, Received: received}, Expected: time.Time{}, Number: 2},
+	}
+	for _, c := range cases {
+		if times := geminiBookTime(c.Book); !times.Exchange.Equal(c.Expected) || !times.Received.Equal(received) {
+			t.Errorf("Received %+v, expected %v [test n. %d]", times, c.Expected, c.Number)
+		}
+	}
+}
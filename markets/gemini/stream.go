@@ -0,0 +1,147 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	datastructure "github.com/alessiosavi/GoArbitrage/datastructure/gemini"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"github.com/alessiosavi/GoArbitrage/markets/stream"
+	"github.com/alessiosavi/GoArbitrage/network/websocket"
+	"github.com/alessiosavi/GoArbitrage/orderbook"
+	"go.uber.org/zap"
+)
+
+// GEMINI_WEBSOCKET_URL is the url of the gemini market data (v2) websocket
+const GEMINI_WEBSOCKET_URL string = `wss://api.sandbox.gemini.com/v2/marketdata`
+
+// SetStreamURL is delegated to set the url used for the websocket in place of the gemini one
+func (g *Gemini) SetStreamURL(url string) {
+	g.streamURL = url
+}
+
+// Streaming return true if the order book of the given pair is updated by the websocket
+func (g *Gemini) Streaming(pair string) bool {
+	return g.streaming.Streaming(pair)
+}
+
+// Stream is delegated to keep the order books of the given pairs updated through the gemini websocket.
+// The method block until the context is done
+func (g *Gemini) Stream(ctx context.Context, pairs []string, updates chan<- markets.Update) error {
+	url := g.streamURL
+	if url == "" {
+		url = GEMINI_WEBSOCKET_URL
+	}
+	handler := &geminiStream{url: url}
+	handler.Reset()
+
+	s := stream.New(g.Name(), handler)
+	s.OnUpdate = func(book *orderbook.Book) {
+		order := datastructure.GeminiOrderBook{Pair: book.Pair, Bids: geminiOrders(book.Bids(g.depth())), Asks: geminiOrders(book.Asks(g.depth())),
+			Received: time.Now()}
+		g.mutex.Lock()
+		if g.OrderBook == nil {
+			g.OrderBook = make(map[string]datastructure.GeminiOrderBook)
+		}
+		g.OrderBook[book.Pair] = order
+		g.mutex.Unlock()
+		g.streaming.Set(book.Pair)
+		symbol, _ := g.DecodeSymbol(book.Pair)
+		stream.Notify(updates, markets.Update{Market: g.Name(), Pair: book.Pair, Symbol: symbol})
+	}
+	s.OnReset = g.streaming.Reset
+	return s.Run(ctx, pairs)
+}
+
+// geminiOrders is delegated to convert the levels of the book into the gemini orders
+func geminiOrders(levels []orderbook.Level) []datastructure.GeminiOrder {
+	orders := make([]datastructure.GeminiOrder, len(levels))
+	for i, level := range levels {
+		orders[i] = datastructure.GeminiOrder{Price: level.PriceText, Volume: level.VolumeText}
+	}
+	return orders
+}
+
+// geminiStream is the protocol of the l2 channel of the gemini websocket. Gemini does not send a checksum, the
+// first update of every symbol contains the full book
+type geminiStream struct {
+	url   string
+	books map[string]*orderbook.Book
+}
+
+// geminiMessage is a message of the gemini websocket
+type geminiMessage struct {
+	Type   string `json:"type"`
+	Symbol string `json:"symbol"`
+	// Changes contains the levels updated, as [side, price, quantity]
+	Changes [][]string `json:"changes"`
+	Reason  string     `json:"reason"`
+}
+
+func (h *geminiStream) URL() string {
+	return h.url
+}
+
+func (h *geminiStream) Reset() {
+	h.books = make(map[string]*orderbook.Book)
+}
+
+func (h *geminiStream) Subscribe(conn *websocket.Conn, pairs []string) error {
+	symbols := make([]string, len(pairs))
+	for i := range pairs {
+		symbols[i] = strings.ToUpper(pairs[i])
+	}
+	subscription := map[string]interface{}{
+		"type":          "subscribe",
+		"subscriptions": []interface{}{map[string]interface{}{"name": "l2", "symbols": symbols}},
+	}
+	data, err := json.Marshal(subscription)
+	if err != nil {
+		return err
+	}
+	return conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (h *geminiStream) Handle(opcode int, message []byte) ([]*orderbook.Book, error) {
+	var data geminiMessage
+	if err := json.Unmarshal(message, &data); err != nil {
+		return nil, err
+	}
+	switch data.Type {
+	case "l2_updates":
+	case "error":
+		zap.S().Warnf("Gemini subscription failed: %s", data.Reason)
+		return nil, nil
+	default:
+		// heartbeat, trade and auction_result
+		return nil, nil
+	}
+
+	pair := strings.ToLower(data.Symbol)
+	book, ok := h.books[pair]
+	if !ok {
+		book = orderbook.New(pair)
+		h.books[pair] = book
+	}
+	for _, change := range data.Changes {
+		if len(change) != 3 {
+			return nil, errors.New("UNEXPECTED_LEVEL")
+		}
+		level, err := orderbook.ParseLevel(change[1], change[2])
+		if err != nil {
+			return nil, err
+		}
+		switch change[0] {
+		case "buy":
+			book.SetBid(level)
+		case "sell":
+			book.SetAsk(level)
+		default:
+			return nil, errors.New("UNEXPECTED_SIDE")
+		}
+	}
+	return []*orderbook.Book{book}, nil
+}
@@ -0,0 +1,83 @@
+package gemini
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"github.com/alessiosavi/GoArbitrage/markets/fakeserver"
+)
+
+func Test_Stream(t *testing.T) {
+	type TestCase struct {
+		Bids   []market.MarketOrder
+		Asks   []market.MarketOrder
+		Number int
+	}
+
+	messages, err := fakeserver.LoadMessages("GEMINI", "stream.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := fakeserver.NewStream(func(conn *fakeserver.StreamConn, n int) {
+		if _, err := conn.Read(); err != nil {
+			return
+		}
+		if n == 0 {
+			// The connection is closed by the server after the snapshot
+			conn.Send(messages[0])
+			return
+		}
+		conn.Send(messages...)
+		conn.Wait()
+	})
+	defer server.Close()
+
+	g := &Gemini{Depth: 2}
+	g.SetStreamURL(server.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := make(chan markets.Update, 16)
+	done := make(chan error)
+	go func() { done <- g.Stream(ctx, []string{"btcusd"}, updates) }()
+
+	// 1 snapshot before the close, the snapshot and 1 update after the new subscription
+	for i := 0; i < 3; i++ {
+		select {
+		case update := <-updates:
+			if update.Market != g.Name() || update.Pair != "btcusd" || update.Symbol != market.NewSymbol("btc", "usd") {
+				t.Errorf("Received %v, expected an update of %s [test n. %d]", update, "btcusd", 1)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Received %d updates, expected 3", i)
+		}
+	}
+	if !g.Streaming("btcusd") {
+		t.Errorf("Expected the pair in streaming [test n. %d]", 2)
+	}
+	c := TestCase{
+		Bids:   []market.MarketOrder{{Price: 9122, Volume: 0.5}, {Price: 9121.5, Volume: 1.2}},
+		Asks:   []market.MarketOrder{{Price: 9122.1, Volume: 0.7}, {Price: 9122.25, Volume: 0.2}},
+		Number: 3,
+	}
+	m, err := g.GetMarketData("btcusd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalOrders(m.Bids["btcusd"], c.Bids) || !equalOrders(m.Asks["btcusd"], c.Asks) {
+		t.Errorf("Received %v/%v, expected %v/%v [test n. %d]", m.Bids["btcusd"], m.Asks["btcusd"], c.Bids, c.Asks, c.Number)
+	}
+	if subscription := `{"subscriptions":[{"name":"l2","symbols":["BTCUSD"]}],"type":"subscribe"}`; server.Received(1)[0] != subscription {
+		t.Errorf("Received %s, expected %s [test n. %d]", server.Received(1)[0], subscription, 4)
+	}
+
+	cancel()
+	if err = <-done; err != context.Canceled {
+		t.Errorf("Received %v, expected %v [test n. %d]", err, context.Canceled, 5)
+	}
+	if g.Streaming("btcusd") {
+		t.Errorf("Expected the pair not in streaming after the stop [test n. %d]", 6)
+	}
+}
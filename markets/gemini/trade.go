@@ -0,0 +1,142 @@
+package gemini
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	datastructure "github.com/alessiosavi/GoArbitrage/datastructure/gemini"
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"go.uber.org/zap"
+)
+
+// SetCredentials is delegated to set the API key used for sign the requests of the private API
+func (g *Gemini) SetCredentials(credentials markets.Credentials) {
+	g.credentials = credentials
+}
+
+// geminiSign is delegated to encode the payload and compute its signature: the payload is sent in base64 in the
+// X-GEMINI-PAYLOAD header, the signature is the HMAC-SHA384 (hex) of the encoded payload
+func geminiSign(secret string, payload []byte) (string, string) {
+	encoded := base64.StdEncoding.EncodeToString(payload)
+	mac := hmac.New(sha512.New384, []byte(secret))
+	mac.Write([]byte(encoded))
+	return encoded, hex.EncodeToString(mac.Sum(nil))
+}
+
+// private is delegated to send a signed request to the given endpoint of the private API, decoding the result.
+// The parameters are sent in the payload together with the endpoint and the nonce, the body is empty
+func (g *Gemini) private(ctx context.Context, endpoint string, params map[string]interface{}, result interface{}) error {
+	if g.credentials.Key == "" || g.credentials.Secret == "" {
+		return markets.ErrMissingCredentials
+	}
+	params["request"] = endpoint
+	params["nonce"] = strconv.FormatInt(markets.Nonce(), 10)
+	payload, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	encoded, signature := geminiSign(g.credentials.Secret, payload)
+	header := http.Header{"Content-Type": {"text/plain"}, "Cache-Control": {"no-cache"}, "X-GEMINI-APIKEY": {g.credentials.Key},
+		"X-GEMINI-PAYLOAD": {encoded}, "X-GEMINI-SIGNATURE": {signature}}
+	resp := g.getClient().Send(ctx, "POST", g.url(GEMINI_API+endpoint), header, nil)
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if resp.StatusCode != 200 {
+		var e datastructure.GeminiError
+		if json.Unmarshal(resp.Body, &e) == nil && e.Reason != "" {
+			if e.Reason == "OrderNotFound" {
+				return markets.ErrOrderNotFound
+			}
+			return errors.New(e.Reason)
+		}
+		zap.S().Warnw("Received a non 200 status code: " + strconv.Itoa(resp.StatusCode))
+		return errors.New("NOT_200_HTTP_STATUS")
+	}
+	return json.Unmarshal(resp.Body, result)
+}
+
+// geminiOrder is delegated to convert the state of the order returned by gemini
+func geminiOrder(symbol market.Symbol, order datastructure.GeminiOrderStatus) markets.OrderStatus {
+	status := markets.OrderStatus{ID: order.OrderID, Symbol: symbol, Side: markets.Side(order.Side), State: markets.Open}
+	switch {
+	case order.IsCancelled:
+		status.State = markets.Canceled
+	case !order.IsLive:
+		status.State = markets.Closed
+	}
+	status.Price, _ = strconv.ParseFloat(order.Price, 64)
+	status.Volume, _ = strconv.ParseFloat(order.OriginalAmount, 64)
+	status.Filled, _ = strconv.ParseFloat(order.ExecutedAmount, 64)
+	status.AveragePrice, _ = strconv.ParseFloat(order.AvgExecutionPrice, 64)
+	return status
+}
+
+// PlaceOrder is delegated to place the given limit order, returning the id of the order. The amount and the price are
+// rounded to the increments of the symbol
+func (g *Gemini) PlaceOrder(ctx context.Context, order markets.Order) (string, error) {
+	order = markets.RoundOrder(order, g.Constraint(g.EncodeSymbol(order.Symbol)))
+	params := map[string]interface{}{"symbol": g.EncodeSymbol(order.Symbol), "amount": markets.FormatFloat(order.Volume),
+		"price": markets.FormatFloat(order.Price), "side": string(order.Side), "type": "exchange limit"}
+	var result datastructure.GeminiOrderStatus
+	if err := g.private(ctx, "/v1/order/new", params, &result); err != nil {
+		return "", err
+	}
+	if result.OrderID == "" {
+		return "", errors.New("MISSING_ORDER_ID")
+	}
+	return result.OrderID, nil
+}
+
+// GetOrder is delegated to retrieve the state of the order with the given id
+func (g *Gemini) GetOrder(ctx context.Context, symbol market.Symbol, id string) (markets.OrderStatus, error) {
+	orderID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return markets.OrderStatus{}, markets.ErrOrderNotFound
+	}
+	var result datastructure.GeminiOrderStatus
+	if err = g.private(ctx, "/v1/order/status", map[string]interface{}{"order_id": orderID}, &result); err != nil {
+		return markets.OrderStatus{}, err
+	}
+	return geminiOrder(symbol, result), nil
+}
+
+// CancelOrder is delegated to cancel the order with the given id
+func (g *Gemini) CancelOrder(ctx context.Context, symbol market.Symbol, id string) error {
+	orderID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return markets.ErrOrderNotFound
+	}
+	var result datastructure.GeminiOrderStatus
+	return g.private(ctx, "/v1/order/cancel", map[string]interface{}{"order_id": orderID}, &result)
+}
+
+// GetBalances is delegated to retrieve the available balance (without the amount held by the open orders) of the
+// exchange account
+func (g *Gemini) GetBalances(ctx context.Context) (map[string]float64, error) {
+	var result []datastructure.GeminiBalance
+	if err := g.private(ctx, "/v1/balances", map[string]interface{}{}, &result); err != nil {
+		return nil, err
+	}
+	balances := make(map[string]float64, len(result))
+	for _, balance := range result {
+		if balance.Type != "exchange" {
+			continue
+		}
+		amount, err := strconv.ParseFloat(balance.Available, 64)
+		if err != nil {
+			return nil, err
+		}
+		balances[strings.ToLower(balance.Currency)] = amount
+	}
+	return balances, nil
+}
@@ -0,0 +1,111 @@
+package gemini
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	datastructure "github.com/alessiosavi/GoArbitrage/datastructure/gemini"
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"github.com/alessiosavi/GoArbitrage/markets/fakeserver"
+	"github.com/alessiosavi/GoArbitrage/network"
+)
+
+const testSecret = "gemini-secret"
+
+// verifyGemini is the verification of the signature done by the server, the payload have to contain the endpoint
+func verifyGemini(r *http.Request, body []byte) error {
+	if r.Method != "POST" || r.Header.Get("X-GEMINI-APIKEY") != "key" || len(body) != 0 {
+		return errors.New("InvalidApiKey")
+	}
+	mac := hmac.New(sha512.New384, []byte(testSecret))
+	mac.Write([]byte(r.Header.Get("X-GEMINI-PAYLOAD")))
+	if r.Header.Get("X-GEMINI-SIGNATURE") != hex.EncodeToString(mac.Sum(nil)) {
+		return errors.New("InvalidSignature")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(r.Header.Get("X-GEMINI-PAYLOAD"))
+	if err != nil {
+		return err
+	}
+	var payload map[string]interface{}
+	if err = json.Unmarshal(decoded, &payload); err != nil || payload["request"] != r.URL.Path || payload["nonce"] == nil {
+		return errors.New("InvalidPayload")
+	}
+	return nil
+}
+
+func Test_GeminiTrade(t *testing.T) {
+	order := `{"order_id":"106817811","id":"106817811","symbol":"btcusd","exchange":"gemini","avg_execution_price":"37490.00","side":"buy",` +
+		`"type":"exchange limit","is_live":%s,"is_cancelled":%s,"executed_amount":"0.5","remaining_amount":"0.75","original_amount":"1.25","price":"37500.00"}`
+	server := fakeserver.New()
+	defer server.Close()
+	server.SetVerifier(verifyGemini)
+	server.Handle("/v1/order/new", fakeserver.Response{StatusCode: 200, Body: []byte(fmt.Sprintf(order, "true", "false"))})
+	server.Handle("/v1/order/status", fakeserver.Response{StatusCode: 200, Body: []byte(fmt.Sprintf(order, "true", "false"))})
+	server.Handle("/v1/order/cancel", fakeserver.Response{StatusCode: 400,
+		Body: []byte(`{"result":"error","reason":"OrderNotFound","message":"Order 106817811 not found"}`)})
+	server.Handle("/v1/balances", fakeserver.Response{StatusCode: 200,
+		Body: []byte(`[{"type":"exchange","currency":"BTC","amount":"1.5","available":"1.25"},{"type":"exchange","currency":"USD","amount":"100.25","available":"90.25"}]`)})
+
+	var g Gemini
+	g.Init()
+	g.SetBaseURL(server.URL)
+	g.SetHTTPClient(server.Client())
+	// The rate limit of the market is not tested here
+	g.client.Limiter = network.NewLimiter(1000, 1000)
+	ctx := context.Background()
+	symbol := market.NewSymbol("btc", "usd")
+	if _, err := g.GetOrder(ctx, symbol, "106817811"); err != markets.ErrMissingCredentials {
+		t.Errorf("Received %v, expected %v [test n. %d]", err, markets.ErrMissingCredentials, 1)
+	}
+
+	g.SetCredentials(markets.Credentials{Key: "key", Secret: testSecret})
+	id, err := g.PlaceOrder(ctx, markets.Order{Symbol: symbol, Side: markets.Buy, Price: 37500, Volume: 1.25})
+	if err != nil || id != "106817811" {
+		t.Errorf("Received %s (%v), expected %s [test n. %d]", id, err, "106817811", 2)
+	}
+	status, err := g.GetOrder(ctx, symbol, id)
+	expected := markets.OrderStatus{ID: id, Symbol: symbol, Side: markets.Buy, Price: 37500, Volume: 1.25, Filled: 0.5, AveragePrice: 37490, State: markets.Open}
+	if err != nil || status != expected {
+		t.Errorf("Received %+v (%v), expected %+v [test n. %d]", status, err, expected, 3)
+	}
+	if err = g.CancelOrder(ctx, symbol, id); err != markets.ErrOrderNotFound {
+		t.Errorf("Received %v, expected %v [test n. %d]", err, markets.ErrOrderNotFound, 4)
+	}
+	balances, err := g.GetBalances(ctx)
+	if err != nil || len(balances) != 2 || balances["btc"] != 1.25 || balances["usd"] != 90.25 {
+		t.Errorf("Received %v (%v), expected the available balances [test n. %d]", balances, err, 5)
+	}
+
+	g.SetCredentials(markets.Credentials{Key: "key", Secret: "wrong"})
+	if _, err = g.GetBalances(ctx); err == nil {
+		t.Errorf("Expected an error for an invalid signature [test n. %d]", 6)
+	}
+}
+
+func Test_GeminiOrderState(t *testing.T) {
+	type TestCase struct {
+		Live      bool
+		Cancelled bool
+		Expected  markets.OrderState
+		Number    int
+	}
+	cases := []TestCase{
+		{Live: true, Expected: markets.Open, Number: 1},
+		{Live: false, Expected: markets.Closed, Number: 2},
+		{Live: false, Cancelled: true, Expected: markets.Canceled, Number: 3},
+	}
+	for _, c := range cases {
+		if status := geminiOrder(market.NewSymbol("btc", "usd"), datastructure.GeminiOrderStatus{IsLive: c.Live, IsCancelled: c.Cancelled}); status.State != c.Expected {
+			t.Errorf("Received %s, expected %s [test n. %d]", status.State, c.Expected, c.Number)
+		}
+	}
+}
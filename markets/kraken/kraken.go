@@ -1,13 +1,17 @@
 package kraken
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
+	"math"
+	"net/http"
 	"path"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
@@ -15,10 +19,11 @@ import (
 	"github.com/alessiosavi/GoArbitrage/datastructure/constants"
 	datastructure "github.com/alessiosavi/GoArbitrage/datastructure/kraken"
 	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"github.com/alessiosavi/GoArbitrage/markets/stream"
+	"github.com/alessiosavi/GoArbitrage/network"
 	"github.com/alessiosavi/GoArbitrage/utils"
 	fileutils "github.com/alessiosavi/GoGPUtils/files"
-
-	req "github.com/alessiosavi/Requests"
 )
 
 type Kraken struct {
@@ -29,22 +34,125 @@ type Kraken struct {
 	TakerFees  float64                                  `json:"taker_fee"`
 	// FeePercent is delegated to save if the fee is in percent or in coin
 	FeePercent bool `json:"fee_percent"`
-	Tickers    []string
+	// Fees contains the fee schedule (tiers by 30 days volume) of the market
+	Fees    market.MarketFee `json:"fees"`
+	Tickers []string
+	// Assets contains the kraken asset code (and altname) as key and the standard ticker as value
+	Assets map[string]string `json:"assets"`
+	// Depth is the number of levels of the order book to request
+	Depth int `json:"depth"`
+	// mutex protect the order book, updated and read by the engine from different goroutines
+	mutex sync.RWMutex
+	// baseURL replace the base url of the API, if set
+	baseURL string
+	// client is used for send the requests, if set. The defaultClient is used otherwise
+	client *network.Client
+	// streamURL replace the url of the websocket, if set
+	streamURL string
+	// streaming save the pairs whose order book is updated by the websocket
+	streaming stream.Status
+	// credentials contains the API key used for sign the requests of the private API
+	credentials markets.Credentials
+	// minAmounts contains the minimum volume of the orders for every kraken altname (XBT, XDG)
+	minAmounts map[string]float64
 }
 
-const KRAKEN_TICKERS_URL string = `https://api.kraken.com/0/public/Assets`
-const KRAKEN_PAIRS_DETAILS_URL string = `https://api.kraken.com/0/public/AssetPairs`
-const KRAKEN_ORDER_BOOK_URL string = `https://api.kraken.com/0/public/Depth?pair=`
+// KRAKEN_API is the base url of the kraken public API
+const KRAKEN_API string = `https://api.kraken.com`
+
+const KRAKEN_TICKERS_URL string = KRAKEN_API + `/0/public/Assets`
+const KRAKEN_PAIRS_DETAILS_URL string = KRAKEN_API + `/0/public/AssetPairs`
+const KRAKEN_ORDER_BOOK_URL string = KRAKEN_API + `/0/public/Depth?pair=`
 
 var KRAKEN_PAIRS_DATA = path.Join(constants.KRAKEN_PATH, "pairs_list.json")
 var KRAKEN_PAIRS_DETAILS = path.Join(constants.KRAKEN_PATH, "pairs_info.json")
 var KRAKEN_ORDERBOOK_DATA = path.Join(constants.KRAKEN_PATH, "orders/")
+var KRAKEN_ASSETS_DATA = path.Join(constants.KRAKEN_PATH, "assets.json")
+var KRAKEN_MIN_AMOUNT = path.Join(constants.KRAKEN_PATH, "min_amount.txt")
+
+// krakenAliases contains the kraken altname that differs from the ticker used by the other markets
+var krakenAliases = map[string]string{"xbt": "btc", "xdg": "doge"}
+
+// KRAKEN_RATE_LIMIT is the number of requests per second allowed by the kraken public API
+const KRAKEN_RATE_LIMIT float64 = 1
+
+// KRAKEN_RATE_BURST is the number of requests that can be sent without wait
+const KRAKEN_RATE_BURST int = 1
+
+// defaultClient is shared by all the requests sent to the market, in order to respect the rate limit
+var defaultClient = network.NewClient(KRAKEN_RATE_LIMIT, KRAKEN_RATE_BURST)
+
+func init() {
+	markets.Register(&Kraken{})
+}
+
+// Name return the name of the market
+func (k *Kraken) Name() string {
+	return `KRAKEN`
+}
 
 // Init is delegated to initialize the maps for the kraken
 func (k *Kraken) Init() {
 	k.Pairs = make(map[string]datastructure.KrakenPair)
 	k.OrderBook = make(map[string]datastructure.KrakenOrderBook)
 	k.SetFees()
+	k.loadMinAmounts()
+}
+
+// loadMinAmounts is delegated to load the minimum volume of the orders from the KRAKEN_MIN_AMOUNT file. The amounts
+// already loaded are kept if the file can not be read
+func (k *Kraken) loadMinAmounts() {
+	amounts, err := utils.LoadMinAmountKraken(KRAKEN_MIN_AMOUNT)
+	if err != nil {
+		zap.S().Warnf("Unable to load the min amounts of [%s], keeping the ones already loaded: %s", KRAKEN_MIN_AMOUNT, err.Error())
+		return
+	}
+	k.minAmounts = amounts
+}
+
+// SetBaseURL is delegated to set the base url used for send the requests in place of the kraken API
+func (k *Kraken) SetBaseURL(baseURL string) {
+	k.baseURL = strings.TrimSuffix(baseURL, "/")
+}
+
+// SetHTTPClient is delegated to set the HTTP client used for send the requests.
+// The market will use its own rate limiter, not shared with the other instances. A nil client restore the default one
+func (k *Kraken) SetHTTPClient(httpClient *http.Client) {
+	if httpClient == nil {
+		k.client = nil
+		return
+	}
+	k.client = network.NewClient(KRAKEN_RATE_LIMIT, KRAKEN_RATE_BURST)
+	k.client.HTTPClient = httpClient
+}
+
+// getClient return the client used for send the requests
+func (k *Kraken) getClient() *network.Client {
+	if k.client != nil {
+		return k.client
+	}
+	return defaultClient
+}
+
+// url is delegated to replace the base url of the given endpoint with the one configured
+func (k *Kraken) url(endpoint string) string {
+	if k.baseURL == "" {
+		return endpoint
+	}
+	return k.baseURL + strings.TrimPrefix(endpoint, KRAKEN_API)
+}
+
+// SetDepth is delegated to set the number of levels of the order book to request
+func (k *Kraken) SetDepth(depth int) {
+	k.Depth = depth
+}
+
+// depth return the number of levels of the order book to request
+func (k *Kraken) depth() int {
+	if k.Depth > 0 {
+		return k.Depth
+	}
+	return constants.DEFAULT_DEPTH
 }
 
 // SetFees is delegated to initialize the fee type/amount for the given market
@@ -52,43 +160,101 @@ func (k *Kraken) SetFees() {
 	k.MakerFee = 0.16
 	k.TakerFees = 0.26
 	k.FeePercent = true
+	// Default schedule, the pairs with a different one are loaded from the pairs info
+	k.Fees = market.MarketFee{IsPercent: k.FeePercent, Tiers: []market.FeeTier{
+		{Volume: 0, Maker: 0.16, Taker: 0.26},
+		{Volume: 50000, Maker: 0.14, Taker: 0.24},
+		{Volume: 100000, Maker: 0.12, Taker: 0.22},
+		{Volume: 250000, Maker: 0.10, Taker: 0.20},
+		{Volume: 500000, Maker: 0.08, Taker: 0.18},
+		{Volume: 1000000, Maker: 0.06, Taker: 0.16},
+		{Volume: 2500000, Maker: 0.04, Taker: 0.14},
+		{Volume: 5000000, Maker: 0.02, Taker: 0.12},
+		{Volume: 10000000, Maker: 0, Taker: 0.10},
+	}}
 }
 
-// GetTickers is delegated to retrieve the list of tickers tradable in the exchange
-func (k *Kraken) GetTickers() error {
+// GetTickers is delegated to retrieve the list of tickers tradable in the exchange.
+// The assets are used for build the alias table that normalize the kraken currencies (XXBT -> btc)
+func (k *Kraken) GetTickers(ctx context.Context) error {
 	res := datastructure.Tickers{}
 	var err error
-	var request req.Request
 	var data []byte
 	var tickers []string
-	resp := request.SendRequest(KRAKEN_TICKERS_URL, "GET", nil, nil, false, 10*time.Second)
-	if resp.Error != nil {
-		zap.S().Debugw("Error during http request. Err: " + resp.Error.Error())
-		return resp.Error
-	}
-	if resp.StatusCode != 200 {
-		zap.S().Warnw("Received a non 200 status code: " + strconv.Itoa(resp.StatusCode))
-		return errors.New("NON_200_STATUS_CODE")
+
+	// Avoid to call the HTTP api if the data are present
+	if fileutils.FileExists(KRAKEN_ASSETS_DATA) {
+		zap.S().Debugw("Data alredy present, avoiding to call the service")
+		data, err = ioutil.ReadFile(KRAKEN_ASSETS_DATA)
+		if err != nil {
+			zap.S().Warnw("Error reading data: " + err.Error())
+			return err
+		}
+	} else {
+		resp := k.getClient().Get(ctx, k.url(KRAKEN_TICKERS_URL))
+		if resp.Error != nil {
+			zap.S().Debugw("Error during http request. Err: " + resp.Error.Error())
+			return resp.Error
+		}
+		if resp.StatusCode != 200 {
+			zap.S().Warnw("Received a non 200 status code: " + strconv.Itoa(resp.StatusCode))
+			return errors.New("NON_200_STATUS_CODE")
+		}
+		data = resp.Body
 	}
-	data = resp.Body
 	if err = json.Unmarshal(data, &res); err != nil {
 		zap.S().Warn("ERROR! :" + err.Error())
 		return err
 	}
 	zap.S().Infof("Data: %v", res.Result)
 	tickers = make([]string, len(res.Result))
+	k.Assets = make(map[string]string, len(res.Result)*2)
 	i := 0
 	for key := range res.Result {
 		tickers[i] = res.Result[key].Altname
+		// Save both the asset code (XXBT) and the altname (XBT)
+		k.Assets[key] = normalizeAsset(res.Result[key].Altname)
+		k.Assets[res.Result[key].Altname] = k.Assets[key]
 		i++
 	}
 	k.Tickers = tickers
+	utils.DumpStruct(res, KRAKEN_ASSETS_DATA)
 	return nil
 }
 
+// normalizeAsset is delegated to convert the kraken currency into the standard lowercase ticker
+func normalizeAsset(altname string) string {
+	altname = strings.ToLower(altname)
+	if alias, ok := krakenAliases[altname]; ok {
+		return alias
+	}
+	return altname
+}
+
+// Asset is delegated to convert the given kraken asset code (XXBT, ZEUR, XETH, USDT) into the standard ticker.
+// If the assets are not loaded, the legacy `X`/`Z` prefix is removed from the 4 characters codes
+func (k *Kraken) Asset(code string) string {
+	if asset, ok := k.Assets[code]; ok {
+		return asset
+	}
+	if len(code) == 4 && (code[0] == 'X' || code[0] == 'Z') {
+		code = code[1:]
+	}
+	return normalizeAsset(code)
+}
+
+// GetPairsList is delegated to retrieve the pairs traded in the market.
+// Kraken expose the pairs names together with the pairs details
+func (k *Kraken) GetPairsList(ctx context.Context) error {
+	// The assets are necessary for decode the currencies of the pairs
+	if err := k.GetTickers(ctx); err != nil {
+		zap.S().Warnf("Unable to load kraken assets, using the legacy asset code: %s", err.Error())
+	}
+	return k.GetPairsDetails(ctx)
+}
+
 // GetPairsDetails is delegated to retrieve the pairs detail and the pairs names
-func (k *Kraken) GetPairsDetails() error {
-	var request req.Request
+func (k *Kraken) GetPairsDetails(ctx context.Context) error {
 	var data []byte
 	var err error
 
@@ -117,7 +283,7 @@ func (k *Kraken) GetPairsDetails() error {
 
 	zap.S().Debugw("Sendind request to [" + KRAKEN_PAIRS_DETAILS_URL + "]")
 	// Call the HTTP method for retrieve the pairs
-	resp := request.SendRequest(KRAKEN_PAIRS_DETAILS_URL, "GET", nil, nil, false, constants.TIMEOUT_REQ*time.Second)
+	resp := k.getClient().Get(ctx, k.url(KRAKEN_PAIRS_DETAILS_URL))
 	if resp.Error != nil {
 		zap.S().Debugw("Error during http request. Err: " + resp.Error.Error())
 		return resp.Error
@@ -146,12 +312,16 @@ func (k *Kraken) GetPairsDetails() error {
 }
 
 // GetAllOrderBook is delegated to download all the order book related to the pair traded
-func (k *Kraken) GetAllOrderBook() error {
-	var request req.Request
+func (k *Kraken) GetAllOrderBook(ctx context.Context) error {
 	var err error
 	var data []byte
 
 	for _, pair := range k.PairsNames {
+		// Stop the download if the context is cancelled
+		if ctx.Err() != nil {
+			zap.S().Warnf("Stopping the download of the order books: %s", ctx.Err().Error())
+			break
+		}
 		var order datastructure.KrakenOrderBook
 		zap.S().Debugw("Managin pair: [" + pair + "]")
 		file := path.Join(KRAKEN_ORDERBOOK_DATA, pair+".json")
@@ -169,13 +339,15 @@ func (k *Kraken) GetAllOrderBook() error {
 				continue
 			} else {
 				//order.Pair = pair
+				k.mutex.Lock()
 				k.OrderBook[pair] = order
+				k.mutex.Unlock()
 			}
 		} else {
-			url := KRAKEN_ORDER_BOOK_URL + pair + `&count=1`
+			url := KRAKEN_ORDER_BOOK_URL + pair + `&count=` + strconv.Itoa(k.depth())
 			zap.S().Debugw("Sendind request to [" + url + "]")
 			// Call the HTTP method for retrieve the pairs
-			resp := request.SendRequest(url, "GET", nil, nil, false, constants.TIMEOUT_REQ*time.Second)
+			resp := k.getClient().Get(ctx, k.url(url))
 			if resp.Error != nil {
 				zap.S().Warnw("Error during http request. Err: " + resp.Error.Error())
 				continue
@@ -191,14 +363,18 @@ func (k *Kraken) GetAllOrderBook() error {
 				zap.S().Warnw("Error during retrieve of pair [" + pair + "]!")
 			} else {
 				order.Pair = pair
+				order.Received = time.Now()
+				k.mutex.Lock()
 				k.OrderBook[pair] = order
+				k.mutex.Unlock()
 				utils.DumpStruct(order, file)
 			}
 		}
 	}
 
 	utils.DumpStruct(k.OrderBook, path.Join(constants.KRAKEN_PATH, "orders_all.json"))
-	return nil
+	// The order books already retrieved are kept also if the context is cancelled
+	return ctx.Err()
 }
 
 func loadOrderBook(data []byte) (datastructure.KrakenOrderBook, error) {
@@ -264,10 +440,13 @@ func loadKrakenPairs(data []byte) map[string]datastructure.KrakenPair {
 
 // GetMarketData is delegated to convert the order book into a standard `market` struct
 func (k *Kraken) GetMarketData(pair string) (market.Market, error) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
 	var markets market.Market
 	markets.Asks = make(map[string][]market.MarketOrder, len(k.OrderBook))
 	markets.Bids = make(map[string][]market.MarketOrder, len(k.OrderBook))
-	markets.MarketName = `KRAKEN`
+	markets.Times = make(map[string]market.BookTime, len(k.OrderBook))
+	markets.MarketName = k.Name()
 	var order market.MarketOrder
 	if orders, ok := k.OrderBook[pair]; ok {
 		var asks = make([]market.MarketOrder, len(orders.Asks))
@@ -289,27 +468,62 @@ func (k *Kraken) GetMarketData(pair string) (market.Market, error) {
 		}
 		markets.Asks[pair] = asks
 		markets.Bids[pair] = bids
+		markets.Times[pair] = krakenBookTime(orders)
 		return markets, nil
 	}
 	return markets, errors.New("unable to find pair [" + pair + "]")
 }
 
+// krakenBookTime is delegated to retrieve the times of the given order book. Kraken send the time of the last
+// update of every level, so the time of the book is the most recent one
+func krakenBookTime(book datastructure.KrakenOrderBook) market.BookTime {
+	t := market.BookTime{Received: book.Received}
+	for _, orders := range [][]datastructure.KrakenOrder{book.Asks, book.Bids} {
+		for i := range orders {
+			if orders[i].Timestamp.After(t.Exchange) {
+				t.Exchange = orders[i].Timestamp
+			}
+		}
+	}
+	return t
+}
+
 // GetMarketsData is delegated to convert the internal asks and bids struct to the common "market" struct
 func (k *Kraken) GetMarketsData() market.Market {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
 	var markets market.Market
 	// Standardize key for common coin
 	var key_standard string
 	markets.Asks = make(map[string][]market.MarketOrder, len(k.OrderBook))
 	markets.Bids = make(map[string][]market.MarketOrder, len(k.OrderBook))
-	markets.MarketName = `KRAKEN`
+	markets.Times = make(map[string]market.BookTime, len(k.OrderBook))
+	markets.Symbols = make(map[string]market.Symbol, len(k.OrderBook))
+	markets.Constraints = make(map[string]market.OrderConstraint, len(k.OrderBook))
+	markets.MarketName = k.Name()
 	markets.MakerFee = k.MakerFee
 	markets.TakerFee = k.TakerFees
+	markets.Fees = k.Fees
+	markets.Fees.Pairs = k.pairsFees()
 	// var i int
 	var order market.MarketOrder
-	amounts := utils.LoadMinAmountKraken(path.Join(constants.KRAKEN_PATH, "min_amount.txt"))
+	amounts := make(map[string]float64)
+	// The min amount file use the kraken altname (XBT, XDG)
+	for currency, amount := range k.minAmounts {
+		amounts[k.Asset(strings.ToUpper(currency))] = amount
+	}
 
 	for key := range k.OrderBook {
-		key_standard = strings.Replace(strings.ToLower(key), "-", "", 1)
+		symbol, err := k.DecodeSymbol(key)
+		if err != nil {
+			zap.S().Debugf("Skipping pair [%s]: %s", key, err.Error())
+			continue
+		}
+		key_standard = symbol.String()
+		markets.Symbols[key_standard] = symbol
+		constraint := k.Constraint(key)
+		constraint.MinVolume = amounts[symbol.Base]
+		markets.Constraints[key_standard] = constraint
 		var asks = make([]market.MarketOrder, len(k.OrderBook[key].Asks))
 
 		for i, ask := range k.OrderBook[key].Asks {
@@ -329,14 +543,14 @@ func (k *Kraken) GetMarketsData() market.Market {
 		}
 		markets.Asks[key_standard] = asks
 		markets.Bids[key_standard] = bids
+		markets.Times[key_standard] = krakenBookTime(k.OrderBook[key])
 
-		for key := range amounts {
-			if strings.HasPrefix(key_standard, key) {
-				for i := range markets.Asks[key_standard] {
-					markets.Asks[key_standard][i].MinVolume = amounts[key]
-					markets.Bids[key_standard][i].MinVolume = amounts[key]
-				}
-				break
+		if amount, ok := amounts[symbol.Base]; ok {
+			for i := range markets.Asks[key_standard] {
+				markets.Asks[key_standard][i].MinVolume = amount
+			}
+			for i := range markets.Bids[key_standard] {
+				markets.Bids[key_standard][i].MinVolume = amount
 			}
 		}
 	}
@@ -344,20 +558,52 @@ func (k *Kraken) GetMarketsData() market.Market {
 	return markets
 }
 
-func (k *Kraken) GetOrderBook(pair string) error {
-	var request req.Request
+// pairsFees is delegated to convert the fee schedules of the pairs info into the tiers of the market.
+// The key is the standard pair, the pairs without a schedule use the default one
+func (k *Kraken) pairsFees() map[string][]market.FeeTier {
+	var fees = make(map[string][]market.FeeTier)
+	for key := range k.Pairs {
+		symbol, err := k.DecodeSymbol(key)
+		if err != nil || len(k.Pairs[key].Fees) == 0 {
+			continue
+		}
+		fees[symbol.String()] = krakenFeeTiers(k.Pairs[key].Fees, k.Pairs[key].FeesMaker)
+	}
+	return fees
+}
+
+// krakenFeeTiers is delegated to merge the taker and maker schedule ([volume, fee]) of a pair.
+// If the maker schedule is not present, the taker fee is used also for the maker orders
+func krakenFeeTiers(taker, maker [][]float64) []market.FeeTier {
+	var tiers []market.FeeTier
+	for i := range taker {
+		if len(taker[i]) != 2 {
+			continue
+		}
+		tier := market.FeeTier{Volume: taker[i][0], Maker: taker[i][1], Taker: taker[i][1]}
+		for j := range maker {
+			if len(maker[j]) == 2 && maker[j][0] == tier.Volume {
+				tier.Maker = maker[j][1]
+			}
+		}
+		tiers = append(tiers, tier)
+	}
+	return tiers
+}
+
+func (k *Kraken) GetOrderBook(ctx context.Context, pair string) error {
 	var err error
 	var data []byte
 
 	var order datastructure.KrakenOrderBook
 	zap.S().Debugw("Managin pair: [" + pair + "]")
-	url := KRAKEN_ORDER_BOOK_URL + pair + `&count=1`
+	url := KRAKEN_ORDER_BOOK_URL + pair + `&count=` + strconv.Itoa(k.depth())
 	zap.S().Debugw("Sendind request to [" + url + "]")
 	// Call the HTTP method for retrieve the pairs
-	resp := request.SendRequest(url, "GET", nil, nil, false, constants.TIMEOUT_REQ*time.Second)
+	resp := k.getClient().Get(ctx, k.url(url))
 	if resp.Error != nil {
 		zap.S().Warnw("Error during http request. Err: " + resp.Error.Error())
-		return err
+		return resp.Error
 	}
 	if resp.StatusCode != 200 {
 		zap.S().Warnw("Received a non 200 status code: " + strconv.Itoa(resp.StatusCode))
@@ -371,10 +617,13 @@ func (k *Kraken) GetOrderBook(pair string) error {
 		return err
 	}
 	order.Pair = pair
+	order.Received = time.Now()
+	k.mutex.Lock()
 	if len(k.OrderBook) == 0 {
 		k.OrderBook = map[string]datastructure.KrakenOrderBook{}
 	}
 	k.OrderBook[pair] = order
+	k.mutex.Unlock()
 	//utils.DumpStruct(order, path.Join(KRAKEN_ORDERBOOK_DATA, pair+".json"))
 	return nil
 }
@@ -383,3 +632,64 @@ func (k *Kraken) GetOrderBook(pair string) error {
 func (k *Kraken) ParsePair(pair string) string {
 	return strings.ToUpper(pair)
 }
+
+// EncodeSymbol is delegated to convert the given symbol into the pair name (altname) compliant with kraken
+func (k *Kraken) EncodeSymbol(symbol market.Symbol) string {
+	for key := range k.Pairs {
+		if s, err := k.DecodeSymbol(key); err == nil && s == symbol {
+			return k.Pairs[key].Altname
+		}
+	}
+	// Pairs not loaded, use the kraken altname of the currencies
+	base, quote := symbol.Base, symbol.Quote
+	for altname, alias := range krakenAliases {
+		if base == alias {
+			base = altname
+		}
+		if quote == alias {
+			quote = altname
+		}
+	}
+	return strings.ToUpper(base + quote)
+}
+
+// pairInfo is delegated to retrieve the information of the given pair, using the pair key (XETHZEUR) or the altname (ETHEUR)
+func (k *Kraken) pairInfo(pair string) (datastructure.KrakenPair, bool) {
+	if info, ok := k.Pairs[pair]; ok {
+		return info, true
+	}
+	for key := range k.Pairs {
+		if k.Pairs[key].Altname == pair {
+			return k.Pairs[key], true
+		}
+	}
+	return datastructure.KrakenPair{}, false
+}
+
+// Constraint is delegated to retrieve the order rules (lot and price decimals) of the given pair.
+// The minimum order depends on the base currency and is loaded from the min amount file
+func (k *Kraken) Constraint(pair string) market.OrderConstraint {
+	var constraint market.OrderConstraint
+	if info, ok := k.pairInfo(pair); ok {
+		constraint.VolumeIncrement = math.Pow10(-info.LotDecimals)
+		constraint.PriceIncrement = math.Pow10(-info.PairDecimals)
+	}
+	return constraint
+}
+
+// DecodeSymbol is delegated to extract the base and the quote currencies from the given pair.
+// The pair can be both the pair key (XETHZEUR) or the altname (ETHEUR)
+func (k *Kraken) DecodeSymbol(pair string) (market.Symbol, error) {
+	info, ok := k.pairInfo(pair)
+	if !ok {
+		return market.Symbol{}, errors.New("pair [" + pair + "] not found in kraken pairs")
+	}
+	// Dark pool pairs (XETHXXBT.d) does not have a public order book
+	if strings.HasSuffix(info.Altname, ".d") {
+		return market.Symbol{}, errors.New("pair [" + pair + "] is a dark pool pair")
+	}
+	if info.Base == "" || info.Quote == "" {
+		return market.Symbol{}, errors.New("unable to extract the currencies from pair [" + pair + "]")
+	}
+	return market.NewSymbol(k.Asset(info.Base), k.Asset(info.Quote)), nil
+}
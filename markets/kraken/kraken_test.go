@@ -1,7 +1,18 @@
 package kraken
 
 import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"path/filepath"
 	"testing"
+	"time"
+
+	datastructure "github.com/alessiosavi/GoArbitrage/datastructure/kraken"
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/fees"
+	"github.com/alessiosavi/GoArbitrage/markets/fakeserver"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -20,8 +31,222 @@ func Test_RetrieveTickers(t *testing.T) {
 	loggerMgr := initZapLog(zap.DebugLevel)
 	zap.ReplaceGlobals(loggerMgr)
 	defer loggerMgr.Sync() // flushes buffer, if any
+	server, err := fakeserver.NewMarket("KRAKEN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
 	var k Kraken
-	if err := k.GetTickers(); err != nil {
+	k.SetBaseURL(server.URL)
+	k.SetHTTPClient(server.Client())
+	if err := k.GetTickers(context.Background()); err != nil {
 		t.Error(err)
 	}
+	if len(k.Tickers) != 6 || k.Assets["XXBT"] != "btc" {
+		t.Errorf("Received %v %v, expected 6 tickers", k.Tickers, k.Assets)
+	}
+}
+
+func Test_PairsFees(t *testing.T) {
+	type TestCase struct {
+		Pair   string
+		Volume float64
+		Maker  float64
+		Taker  float64
+		Number int
+	}
+	var k Kraken
+	k.Init()
+	k.Pairs = map[string]datastructure.KrakenPair{
+		"XETHZUSD": {Altname: "ETHUSD", Base: "XETH", Quote: "ZUSD",
+			Fees:      [][]float64{{0, 0.26}, {50000, 0.24}},
+			FeesMaker: [][]float64{{0, 0.16}, {50000, 0.14}}},
+		"USDTZUSD": {Altname: "USDTUSD", Base: "USDT", Quote: "ZUSD",
+			Fees: [][]float64{{0, 0.2}, {50000, 0.16}}},
+	}
+
+	cases := []TestCase{
+		{Pair: "ethusd", Volume: 0, Maker: 0.16, Taker: 0.26, Number: 1},
+		{Pair: "ethusd", Volume: 60000, Maker: 0.14, Taker: 0.24, Number: 2},
+		// Without the maker schedule, the taker fee is used
+		{Pair: "usdtusd", Volume: 0, Maker: 0.2, Taker: 0.2, Number: 3},
+		{Pair: "usdtusd", Volume: 50000, Maker: 0.16, Taker: 0.16, Number: 4},
+		// Pair without a schedule, the default one is used
+		{Pair: "btcusd", Volume: 100000, Maker: 0.12, Taker: 0.22, Number: 5},
+	}
+
+	var m market.Market
+	m.Fees = k.Fees
+	m.Fees.Pairs = k.pairsFees()
+	for _, c := range cases {
+		m.Volume30d = c.Volume
+		maker, taker := fees.Rate(m, c.Pair, fees.Maker), fees.Rate(m, c.Pair, fees.Taker)
+		if maker != c.Maker || taker != c.Taker {
+			t.Errorf("Received %v/%v, expected %v/%v [test n. %d]", maker, taker, c.Maker, c.Taker, c.Number)
+		}
+	}
+}
+
+// FIXTURES_PATH contains the data captured from the kraken API
+const FIXTURES_PATH = "../../data/KRAKEN"
+
+// loadFixture is delegated to unmarshal the given captured file
+func loadFixture(t *testing.T, file string, v interface{}) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_KrakenOrderUnmarshal(t *testing.T) {
+	type TestCase struct {
+		Data     string
+		Expected datastructure.KrakenOrder
+		Error    bool
+		Number   int
+	}
+
+	cases := []TestCase{
+		// Format of the API response
+		{Data: `["10180.5","1.204",1581765528]`,
+			Expected: datastructure.KrakenOrder{Price: "10180.5", Volume: "1.204", Timestamp: time.Unix(1581765528, 0)}, Number: 1},
+		// Format of the data saved on file
+		{Data: `{"price":"10227.00000","volume":"2.000","timestamp":"2020-02-15T12:19:43+01:00"}`,
+			Expected: datastructure.KrakenOrder{Price: "10227.00000", Volume: "2.000", Timestamp: time.Date(2020, 2, 15, 11, 19, 43, 0, time.UTC)}, Number: 2},
+		{Data: `["10180.5","1.204","now"]`, Error: true, Number: 3},
+		{Data: `"10180.5"`, Error: true, Number: 4},
+	}
+
+	for _, c := range cases {
+		var order datastructure.KrakenOrder
+		err := json.Unmarshal([]byte(c.Data), &order)
+		if (err != nil) != c.Error {
+			t.Errorf("Received error %v, expected error %v [test n. %d]", err, c.Error, c.Number)
+			continue
+		}
+		if !c.Error && (order.Price != c.Expected.Price || order.Volume != c.Expected.Volume || !order.Timestamp.Equal(c.Expected.Timestamp)) {
+			t.Errorf("Received %+v, expected %+v [test n. %d]", order, c.Expected, c.Number)
+		}
+	}
+}
+
+func Test_LoadOrderBook(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join(fakeserver.TestData(), "KRAKEN", "depth.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	book, err := loadOrderBook(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := datastructure.KrakenOrderBook{
+		Asks: []datastructure.KrakenOrder{{Price: "10180.5", Volume: "1.204"}, {Price: "10181.0", Volume: "0.500"}, {Price: "10182.4", Volume: "2.000"}},
+		Bids: []datastructure.KrakenOrder{{Price: "10180.4", Volume: "0.341"}, {Price: "10179.9", Volume: "1.000"}, {Price: "10178.0", Volume: "3.100"}},
+	}
+	if len(book.Asks) != len(expected.Asks) || len(book.Bids) != len(expected.Bids) {
+		t.Fatalf("Received %+v, expected %+v", book, expected)
+	}
+	for i := range expected.Asks {
+		if book.Asks[i].Price != expected.Asks[i].Price || book.Asks[i].Volume != expected.Asks[i].Volume {
+			t.Errorf("Received %+v, expected %+v [test n. %d]", book.Asks[i], expected.Asks[i], i+1)
+		}
+		if book.Bids[i].Price != expected.Bids[i].Price || book.Bids[i].Volume != expected.Bids[i].Volume {
+			t.Errorf("Received %+v, expected %+v [test n. %d]", book.Bids[i], expected.Bids[i], i+1)
+		}
+	}
+	if book.Asks[0].Timestamp.Unix() != 1581765528 {
+		t.Errorf("Received %v, expected %v", book.Asks[0].Timestamp.Unix(), 1581765528)
+	}
+
+	if _, err = loadOrderBook([]byte(`{"error":["EQuery:Unknown asset pair"],"result":[]}`)); err == nil {
+		t.Error("Expected an error for a response without order book")
+	}
+}
+
+func Test_LoadKrakenPairs(t *testing.T) {
+	type TestCase struct {
+		Pair     string
+		Expected datastructure.KrakenPair
+		Number   int
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(fakeserver.TestData(), "KRAKEN", "asset_pairs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pairs := loadKrakenPairs(data)
+	if len(pairs) != 7 {
+		t.Fatalf("Received %d pairs, expected %d", len(pairs), 7)
+	}
+
+	cases := []TestCase{
+		{Pair: "XXBTZUSD", Expected: datastructure.KrakenPair{Altname: "XBTUSD", Base: "XXBT", Quote: "ZUSD", PairDecimals: 1, LotDecimals: 8}, Number: 1},
+		{Pair: "XETHXXBT", Expected: datastructure.KrakenPair{Altname: "ETHXBT", Base: "XETH", Quote: "XXBT", PairDecimals: 5, LotDecimals: 8}, Number: 2},
+	}
+	for _, c := range cases {
+		pair := pairs[c.Pair]
+		if pair.Altname != c.Expected.Altname || pair.Base != c.Expected.Base || pair.Quote != c.Expected.Quote ||
+			pair.PairDecimals != c.Expected.PairDecimals || pair.LotDecimals != c.Expected.LotDecimals {
+			t.Errorf("Received %+v, expected %+v [test n. %d]", pair, c.Expected, c.Number)
+		}
+		if len(pair.Fees) != 9 || pair.Fees[0][1] != 0.26 || len(pair.FeesMaker) != 9 || pair.FeesMaker[0][1] != 0.16 {
+			t.Errorf("Fees of pair %s not loaded: %v %v [test n. %d]", c.Pair, pair.Fees, pair.FeesMaker, c.Number)
+		}
+	}
+
+	if pairs = loadKrakenPairs([]byte(`not json`)); pairs != nil {
+		t.Errorf("Received %v, expected nil", pairs)
+	}
+}
+
+func Test_MarketsDataFixtures(t *testing.T) {
+	type TestCase struct {
+		Pair      string
+		Ask       market.MarketOrder
+		Bid       market.MarketOrder
+		Increment float64
+		Number    int
+	}
+
+	defer func(file string) { KRAKEN_MIN_AMOUNT = file }(KRAKEN_MIN_AMOUNT)
+	KRAKEN_MIN_AMOUNT = filepath.Join(FIXTURES_PATH, "min_amount.txt")
+
+	var k Kraken
+	k.Init()
+	loadFixture(t, filepath.Join(FIXTURES_PATH, "pairs_info.json"), &k.Pairs)
+	for _, pair := range []string{"XBTUSD", "ETHXBT", "XRPUSD", "XBTUSD.d"} {
+		var book datastructure.KrakenOrderBook
+		loadFixture(t, filepath.Join(FIXTURES_PATH, "orders", pair+".json"), &book)
+		k.OrderBook[pair] = book
+	}
+	data := k.GetMarketsData()
+
+	cases := []TestCase{
+		{Pair: "btcusd", Ask: market.MarketOrder{Price: 10227, Volume: 2, MinVolume: 0.002},
+			Bid: market.MarketOrder{Price: 10226.3, Volume: 0.014, MinVolume: 0.002}, Increment: 0.1, Number: 1},
+		{Pair: "ethbtc", Ask: market.MarketOrder{Price: 0.02749, Volume: 42.189, MinVolume: 0.02},
+			Bid: market.MarketOrder{Price: 0.02747, Volume: 5.8, MinVolume: 0.02}, Increment: 0.00001, Number: 2},
+		{Pair: "xrpusd", Ask: market.MarketOrder{Price: 0.33471, Volume: 10000, MinVolume: 30},
+			Bid: market.MarketOrder{Price: 0.33463, Volume: 1440.702, MinVolume: 30}, Increment: 0.00001, Number: 3},
+	}
+
+	// The dark pool pair is skipped
+	if len(data.Asks) != len(cases) || len(data.Bids) != len(cases) {
+		t.Errorf("Received %d/%d pairs, expected %d", len(data.Asks), len(data.Bids), len(cases))
+	}
+	for _, c := range cases {
+		if len(data.Asks[c.Pair]) != 1 || len(data.Bids[c.Pair]) != 1 {
+			t.Errorf("Order book of %s not converted [test n. %d]", c.Pair, c.Number)
+			continue
+		}
+		if data.Asks[c.Pair][0] != c.Ask || data.Bids[c.Pair][0] != c.Bid {
+			t.Errorf("Received %+v/%+v, expected %+v/%+v [test n. %d]", data.Asks[c.Pair][0], data.Bids[c.Pair][0], c.Ask, c.Bid, c.Number)
+		}
+		if constraint := data.Constraints[c.Pair]; constraint.MinVolume != c.Ask.MinVolume || math.Abs(constraint.PriceIncrement-c.Increment) > 1e-12 {
+			t.Errorf("Received %+v, expected min %v and increment %v [test n. %d]", constraint, c.Ask.MinVolume, c.Increment, c.Number)
+		}
+	}
 }
@@ -0,0 +1,269 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"strconv"
+	"strings"
+	"time"
+
+	datastructure "github.com/alessiosavi/GoArbitrage/datastructure/kraken"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"github.com/alessiosavi/GoArbitrage/markets/stream"
+	"github.com/alessiosavi/GoArbitrage/network/websocket"
+	"github.com/alessiosavi/GoArbitrage/orderbook"
+	"go.uber.org/zap"
+)
+
+// KRAKEN_WEBSOCKET_URL is the url of the kraken public websocket
+const KRAKEN_WEBSOCKET_URL string = `wss://ws.kraken.com`
+
+// KRAKEN_CHECKSUM_DEPTH is the number of levels used for compute the checksum of the book
+const KRAKEN_CHECKSUM_DEPTH = 10
+
+// krakenBookDepths contains the depths allowed by the book channel
+var krakenBookDepths = []int{10, 25, 100, 500, 1000}
+
+// SetStreamURL is delegated to set the url used for the websocket in place of the kraken one
+func (k *Kraken) SetStreamURL(url string) {
+	k.streamURL = url
+}
+
+// Streaming return true if the order book of the given pair is updated by the websocket
+func (k *Kraken) Streaming(pair string) bool {
+	return k.streaming.Streaming(pair)
+}
+
+// Stream is delegated to keep the order books of the given pairs (altname) updated through the kraken websocket.
+// The method block until the context is done
+func (k *Kraken) Stream(ctx context.Context, pairs []string, updates chan<- markets.Update) error {
+	url := k.streamURL
+	if url == "" {
+		url = KRAKEN_WEBSOCKET_URL
+	}
+	handler := &krakenStream{url: url, depth: krakenBookDepth(k.depth()), pairs: make(map[string]string, len(pairs))}
+	var wsnames = make([]string, len(pairs))
+	for i, pair := range pairs {
+		wsnames[i] = k.wsName(pair)
+		handler.pairs[wsnames[i]] = pair
+	}
+	handler.Reset()
+
+	s := stream.New(k.Name(), handler)
+	s.OnUpdate = func(book *orderbook.Book) {
+		order := datastructure.KrakenOrderBook{Pair: book.Pair, Asks: krakenOrders(book.Asks(k.depth())), Bids: krakenOrders(book.Bids(k.depth())),
+			Received: time.Now()}
+		k.mutex.Lock()
+		if k.OrderBook == nil {
+			k.OrderBook = make(map[string]datastructure.KrakenOrderBook)
+		}
+		k.OrderBook[book.Pair] = order
+		k.mutex.Unlock()
+		k.streaming.Set(book.Pair)
+		symbol, _ := k.DecodeSymbol(book.Pair)
+		stream.Notify(updates, markets.Update{Market: k.Name(), Pair: book.Pair, Symbol: symbol})
+	}
+	s.OnReset = k.streaming.Reset
+	return s.Run(ctx, wsnames)
+}
+
+// wsName is delegated to convert the given pair into the name used by the websocket (XBT/USD)
+func (k *Kraken) wsName(pair string) string {
+	if info, ok := k.pairInfo(pair); ok && info.Wsname != "" {
+		return info.Wsname
+	}
+	symbol, err := k.DecodeSymbol(pair)
+	if err != nil {
+		return pair
+	}
+	return krakenAltname(symbol.Base) + "/" + krakenAltname(symbol.Quote)
+}
+
+// krakenAltname is delegated to convert the standard ticker into the kraken one (btc -> XBT)
+func krakenAltname(ticker string) string {
+	for altname, alias := range krakenAliases {
+		if alias == ticker {
+			return strings.ToUpper(altname)
+		}
+	}
+	return strings.ToUpper(ticker)
+}
+
+// krakenBookDepth return the smallest depth allowed by the book channel that contains the given depth
+func krakenBookDepth(depth int) int {
+	for _, allowed := range krakenBookDepths {
+		if allowed >= depth {
+			return allowed
+		}
+	}
+	return krakenBookDepths[len(krakenBookDepths)-1]
+}
+
+// krakenOrders is delegated to convert the levels of the book into the kraken orders
+func krakenOrders(levels []orderbook.Level) []datastructure.KrakenOrder {
+	orders := make([]datastructure.KrakenOrder, len(levels))
+	for i, level := range levels {
+		orders[i] = datastructure.KrakenOrder{Price: level.PriceText, Volume: level.VolumeText, Timestamp: level.Time}
+	}
+	return orders
+}
+
+// krakenStream is the protocol of the book channel of the kraken websocket
+type krakenStream struct {
+	url   string
+	depth int
+	// pairs contains the websocket name as key and the pair as value
+	pairs map[string]string
+	// books contains the books by websocket name
+	books map[string]*orderbook.Book
+}
+
+// krakenEvent is a message of the kraken websocket that is not related to a channel
+type krakenEvent struct {
+	Event        string `json:"event"`
+	Status       string `json:"status"`
+	Pair         string `json:"pair"`
+	ErrorMessage string `json:"errorMessage"`
+}
+
+// krakenBookMessage contains the levels sent by the book channel, the snapshot use `as` and `bs`
+type krakenBookMessage struct {
+	As       [][]string `json:"as"`
+	Bs       [][]string `json:"bs"`
+	A        [][]string `json:"a"`
+	B        [][]string `json:"b"`
+	Checksum string     `json:"c"`
+}
+
+func (h *krakenStream) URL() string {
+	return h.url
+}
+
+func (h *krakenStream) Reset() {
+	h.books = make(map[string]*orderbook.Book, len(h.pairs))
+}
+
+func (h *krakenStream) Subscribe(conn *websocket.Conn, pairs []string) error {
+	subscription := map[string]interface{}{
+		"event":        "subscribe",
+		"pair":         pairs,
+		"subscription": map[string]interface{}{"name": "book", "depth": h.depth},
+	}
+	data, err := json.Marshal(subscription)
+	if err != nil {
+		return err
+	}
+	return conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (h *krakenStream) Handle(opcode int, message []byte) ([]*orderbook.Book, error) {
+	if len(message) > 0 && message[0] == '{' {
+		var event krakenEvent
+		if err := json.Unmarshal(message, &event); err != nil {
+			return nil, err
+		}
+		if event.Status == "error" {
+			zap.S().Warnf("Kraken subscription of [%s] failed: %s", event.Pair, event.ErrorMessage)
+		}
+		return nil, nil
+	}
+
+	// [channelID, {book}, ({book},) channelName, pair]
+	var fields []json.RawMessage
+	if err := json.Unmarshal(message, &fields); err != nil {
+		return nil, err
+	}
+	if len(fields) < 4 {
+		return nil, errors.New("UNEXPECTED_MESSAGE")
+	}
+	var wsname string
+	if err := json.Unmarshal(fields[len(fields)-1], &wsname); err != nil {
+		return nil, err
+	}
+	pair, ok := h.pairs[wsname]
+	if !ok {
+		return nil, nil
+	}
+	book, ok := h.books[wsname]
+	if !ok {
+		book = orderbook.New(pair)
+		h.books[wsname] = book
+	}
+
+	var checksum string
+	for _, field := range fields[1 : len(fields)-2] {
+		var data krakenBookMessage
+		if err := json.Unmarshal(field, &data); err != nil {
+			return nil, err
+		}
+		// The snapshot replace the book
+		if data.As != nil || data.Bs != nil {
+			book.Snapshot(nil, nil)
+			data.B, data.A = data.Bs, data.As
+		}
+		bids, err := krakenLevels(data.B)
+		if err != nil {
+			return nil, err
+		}
+		asks, err := krakenLevels(data.A)
+		if err != nil {
+			return nil, err
+		}
+		for _, level := range bids {
+			book.SetBid(level)
+		}
+		for _, level := range asks {
+			book.SetAsk(level)
+		}
+		for _, level := range append(bids, asks...) {
+			if level.Time.After(book.Time) {
+				book.Time = level.Time
+			}
+		}
+		if data.Checksum != "" {
+			checksum = data.Checksum
+		}
+	}
+	// The levels that go out of the subscribed depth are not deleted by kraken
+	book.Truncate(h.depth)
+	if checksum != "" && checksum != strconv.FormatUint(uint64(krakenChecksum(book)), 10) {
+		return nil, stream.ErrChecksum
+	}
+	return []*orderbook.Book{book}, nil
+}
+
+// krakenLevels is delegated to parse the levels [price, volume, timestamp, (update type)]
+func krakenLevels(data [][]string) ([]orderbook.Level, error) {
+	levels := make([]orderbook.Level, 0, len(data))
+	for _, l := range data {
+		if len(l) < 3 {
+			return nil, errors.New("UNEXPECTED_LEVEL")
+		}
+		level, err := orderbook.ParseLevel(l[0], l[1])
+		if err != nil {
+			return nil, err
+		}
+		seconds, err := strconv.ParseFloat(l[2], 64)
+		if err != nil {
+			return nil, err
+		}
+		level.Time = time.Unix(0, int64(seconds*1e9))
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
+// krakenChecksum is delegated to compute the CRC32 of the first 10 asks (from the lowest) and bids (from the
+// highest), concatenating price and volume without the decimal point and the leading zeros
+func krakenChecksum(book *orderbook.Book) uint32 {
+	var b strings.Builder
+	for _, levels := range [][]orderbook.Level{book.Asks(KRAKEN_CHECKSUM_DEPTH), book.Bids(KRAKEN_CHECKSUM_DEPTH)} {
+		for _, level := range levels {
+			b.WriteString(strings.TrimLeft(strings.Replace(level.PriceText, ".", "", 1), "0"))
+			b.WriteString(strings.TrimLeft(strings.Replace(level.VolumeText, ".", "", 1), "0"))
+		}
+	}
+	return crc32.ChecksumIEEE([]byte(b.String()))
+}
@@ -0,0 +1,130 @@
+package kraken
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"github.com/alessiosavi/GoArbitrage/markets/fakeserver"
+)
+
+func Test_Stream(t *testing.T) {
+	type TestCase struct {
+		Bids   []market.MarketOrder
+		Asks   []market.MarketOrder
+		Number int
+	}
+
+	messages, err := fakeserver.LoadMessages("KRAKEN", "stream.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first update with a wrong checksum force a new subscription
+	corrupted := bytes.Replace(messages[3], []byte(`"c":"`), []byte(`"c":"1`), 1)
+	server := fakeserver.NewStream(func(conn *fakeserver.StreamConn, n int) {
+		if _, err := conn.Read(); err != nil {
+			return
+		}
+		if n == 0 {
+			conn.Send(messages[0], messages[1], messages[2], corrupted)
+		} else {
+			conn.Send(messages...)
+		}
+		conn.Wait()
+	})
+	defer server.Close()
+
+	data, err := ioutil.ReadFile(filepath.Join(fakeserver.TestData(), "KRAKEN", "asset_pairs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &Kraken{Pairs: loadKrakenPairs(data), Depth: 2}
+	k.SetStreamURL(server.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := make(chan markets.Update, 16)
+	done := make(chan error)
+	go func() { done <- k.Stream(ctx, []string{"XXBTZUSD"}, updates) }()
+
+	// 1 snapshot before the checksum error, the snapshot and 2 updates after the new subscription
+	for i := 0; i < 4; i++ {
+		select {
+		case update := <-updates:
+			if update.Market != k.Name() || update.Pair != "XXBTZUSD" {
+				t.Errorf("Received %v, expected an update of %s [test n. %d]", update, "XXBTZUSD", 1)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Received %d updates, expected 4", i)
+		}
+	}
+	if !k.Streaming("XXBTZUSD") {
+		t.Errorf("Expected the pair in streaming [test n. %d]", 2)
+	}
+	c := TestCase{
+		Bids:   []market.MarketOrder{{Price: 9099.6, Volume: 0.75}, {Price: 9099.5, Volume: 3}},
+		Asks:   []market.MarketOrder{{Price: 9099.8, Volume: 1.5}, {Price: 9100, Volume: 0.1}},
+		Number: 3,
+	}
+	m, err := k.GetMarketData("XXBTZUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalOrders(m.Bids["XXBTZUSD"], c.Bids) || !equalOrders(m.Asks["XXBTZUSD"], c.Asks) {
+		t.Errorf("Received %v/%v, expected %v/%v [test n. %d]", m.Bids["XXBTZUSD"], m.Asks["XXBTZUSD"], c.Bids, c.Asks, c.Number)
+	}
+	// The time of the book is the last update of the levels
+	if times := m.Times["XXBTZUSD"]; !times.Exchange.Equal(time.Unix(1586445702, 3e8)) || times.Received.IsZero() {
+		t.Errorf("Received %+v, expected %v [test n. %d]", times, time.Unix(1586445702, 3e8), c.Number)
+	}
+	// The checksum of the valid updates match
+	if server.Connections() != 2 {
+		t.Errorf("Received %d connections, expected %d [test n. %d]", server.Connections(), 2, 4)
+	}
+	if subscription := `{"event":"subscribe","pair":["XBT/USD"],"subscription":{"depth":10,"name":"book"}}`; server.Received(1)[0] != subscription {
+		t.Errorf("Received %s, expected %s [test n. %d]", server.Received(1)[0], subscription, 5)
+	}
+
+	cancel()
+	if err = <-done; err != context.Canceled {
+		t.Errorf("Received %v, expected %v [test n. %d]", err, context.Canceled, 6)
+	}
+	if k.Streaming("XXBTZUSD") {
+		t.Errorf("Expected the pair not in streaming after the stop [test n. %d]", 7)
+	}
+}
+
+func equalOrders(a, b []market.MarketOrder) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Price != b[i].Price || a[i].Volume != b[i].Volume {
+			return false
+		}
+	}
+	return true
+}
+
+func Test_KrakenBookDepth(t *testing.T) {
+	type TestCase struct {
+		Depth    int
+		Expected int
+		Number   int
+	}
+	cases := []TestCase{
+		{Depth: 1, Expected: 10, Number: 1},
+		{Depth: 10, Expected: 10, Number: 2},
+		{Depth: 20, Expected: 25, Number: 3},
+		{Depth: 5000, Expected: 1000, Number: 4},
+	}
+	for _, c := range cases {
+		if depth := krakenBookDepth(c.Depth); depth != c.Expected {
+			t.Errorf("Received %d, expected %d [test n. %d]", depth, c.Expected, c.Number)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package kraken
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	datastructure "github.com/alessiosavi/GoArbitrage/datastructure/kraken"
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"go.uber.org/zap"
+)
+
+// KRAKEN_PRIVATE_PATH is the path of the kraken private API, used in the signature
+const KRAKEN_PRIVATE_PATH string = `/0/private/`
+
+// krakenOrderStates map the status of the orders to the standard states
+var krakenOrderStates = map[string]markets.OrderState{"pending": markets.Open, "open": markets.Open, "closed": markets.Closed,
+	"canceled": markets.Canceled, "expired": markets.Canceled}
+
+// SetCredentials is delegated to set the API key used for sign the requests of the private API
+func (k *Kraken) SetCredentials(credentials markets.Credentials) {
+	k.credentials = credentials
+}
+
+// krakenSign is delegated to compute the API-Sign header: the HMAC-SHA512 (keyed with the decoded secret) of the
+// path followed by the SHA256 of the nonce and the post data, encoded in base64
+func krakenSign(secret, path string, nonce int64, postData string) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256([]byte(strconv.FormatInt(nonce, 10) + postData))
+	mac := hmac.New(sha512.New, key)
+	mac.Write([]byte(path))
+	mac.Write(digest[:])
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// private is delegated to send a signed request to the given method of the private API, decoding the result
+func (k *Kraken) private(ctx context.Context, method string, params url.Values, result interface{}) error {
+	if k.credentials.Key == "" || k.credentials.Secret == "" {
+		return markets.ErrMissingCredentials
+	}
+	nonce := markets.Nonce()
+	params.Set("nonce", strconv.FormatInt(nonce, 10))
+	postData := params.Encode()
+	sign, err := krakenSign(k.credentials.Secret, KRAKEN_PRIVATE_PATH+method, nonce, postData)
+	if err != nil {
+		return err
+	}
+	header := http.Header{"API-Key": {k.credentials.Key}, "API-Sign": {sign}, "Content-Type": {"application/x-www-form-urlencoded"}}
+	resp := k.getClient().Send(ctx, "POST", k.url(KRAKEN_API+KRAKEN_PRIVATE_PATH+method), header, []byte(postData))
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if resp.StatusCode != 200 {
+		zap.S().Warnw("Received a non 200 status code: " + strconv.Itoa(resp.StatusCode))
+		return errors.New("NOT_200_HTTP_STATUS")
+	}
+	var response datastructure.PrivateResponse
+	if err = json.Unmarshal(resp.Body, &response); err != nil {
+		return err
+	}
+	if len(response.Error) > 0 {
+		for _, e := range response.Error {
+			if e == "EOrder:Unknown order" || e == "EOrder:Invalid order" {
+				return markets.ErrOrderNotFound
+			}
+		}
+		return errors.New(strings.Join(response.Error, ","))
+	}
+	return json.Unmarshal(response.Result, result)
+}
+
+// PlaceOrder is delegated to place the given limit order, returning the transaction id. The price and the volume are
+// rounded to the decimals of the pair
+func (k *Kraken) PlaceOrder(ctx context.Context, order markets.Order) (string, error) {
+	order = markets.RoundOrder(order, k.Constraint(k.EncodeSymbol(order.Symbol)))
+	params := url.Values{"pair": {k.EncodeSymbol(order.Symbol)}, "type": {string(order.Side)}, "ordertype": {"limit"},
+		"price": {markets.FormatFloat(order.Price)}, "volume": {markets.FormatFloat(order.Volume)}}
+	var result datastructure.AddOrderResult
+	if err := k.private(ctx, "AddOrder", params, &result); err != nil {
+		return "", err
+	}
+	if len(result.Txid) == 0 {
+		return "", errors.New("MISSING_ORDER_ID")
+	}
+	return result.Txid[0], nil
+}
+
+// GetOrder is delegated to retrieve the state of the order with the given transaction id
+func (k *Kraken) GetOrder(ctx context.Context, symbol market.Symbol, id string) (markets.OrderStatus, error) {
+	var result map[string]datastructure.OrderInfo
+	if err := k.private(ctx, "QueryOrders", url.Values{"txid": {id}}, &result); err != nil {
+		return markets.OrderStatus{}, err
+	}
+	info, ok := result[id]
+	if !ok {
+		return markets.OrderStatus{}, markets.ErrOrderNotFound
+	}
+	status := markets.OrderStatus{ID: id, Symbol: symbol, Side: markets.Side(info.Descr.Type), State: krakenOrderStates[info.Status]}
+	status.Price, _ = strconv.ParseFloat(info.Descr.Price, 64)
+	status.Volume, _ = strconv.ParseFloat(info.Vol, 64)
+	status.Filled, _ = strconv.ParseFloat(info.VolExec, 64)
+	status.AveragePrice, _ = strconv.ParseFloat(info.Price, 64)
+	return status, nil
+}
+
+// CancelOrder is delegated to cancel the order with the given transaction id
+func (k *Kraken) CancelOrder(ctx context.Context, symbol market.Symbol, id string) error {
+	var result datastructure.CancelOrderResult
+	if err := k.private(ctx, "CancelOrder", url.Values{"txid": {id}}, &result); err != nil {
+		return err
+	}
+	if result.Count == 0 {
+		return markets.ErrOrderNotFound
+	}
+	return nil
+}
+
+// GetBalances is delegated to retrieve the balance of every asset, using the standard tickers
+func (k *Kraken) GetBalances(ctx context.Context) (map[string]float64, error) {
+	var result map[string]string
+	if err := k.private(ctx, "Balance", url.Values{}, &result); err != nil {
+		return nil, err
+	}
+	balances := make(map[string]float64, len(result))
+	for code, amount := range result {
+		value, err := strconv.ParseFloat(amount, 64)
+		if err != nil {
+			return nil, err
+		}
+		balances[k.Asset(code)] += value
+	}
+	return balances, nil
+}
@@ -0,0 +1,103 @@
+package kraken
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	datastructure "github.com/alessiosavi/GoArbitrage/datastructure/kraken"
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"github.com/alessiosavi/GoArbitrage/markets/fakeserver"
+	"github.com/alessiosavi/GoArbitrage/network"
+)
+
+const testSecret = "kQH5HW/8p1uGOVjbgWA7FunAmGO8lsSUXNsu3eow76sz84Q18fWxnyRzBHCd3pd5nE9qa99HAZtuZuj6F1huXg=="
+
+func Test_KrakenSign(t *testing.T) {
+	// Example of the kraken documentation
+	postData := "nonce=1616492376594&ordertype=limit&pair=XBTUSD&price=37500&type=buy&volume=1.25"
+	sign, err := krakenSign(testSecret, "/0/private/AddOrder", 1616492376594, postData)
+	if expected := "4/dpxb3iT4tp/ZCVEwSnEsLxx0bqyhLpdfOpc6fn7OR8+UClSV5n9E6aSS8MPtnRfp32bAb0nmbRn6H8ndwLUQ=="; err != nil || sign != expected {
+		t.Errorf("Received %s (%v), expected %s", sign, err, expected)
+	}
+}
+
+// verifyKraken is the verification of the signature done by the server
+func verifyKraken(r *http.Request, body []byte) error {
+	if r.Method != "POST" || r.Header.Get("API-Key") != "key" {
+		return errors.New("EAPI:Invalid key")
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil || form.Get("nonce") == "" {
+		return errors.New("EAPI:Invalid nonce")
+	}
+	secret, _ := base64.StdEncoding.DecodeString(testSecret)
+	digest := sha256.Sum256([]byte(form.Get("nonce") + string(body)))
+	mac := hmac.New(sha512.New, secret)
+	mac.Write(append([]byte(r.URL.Path), digest[:]...))
+	if r.Header.Get("API-Sign") != base64.StdEncoding.EncodeToString(mac.Sum(nil)) {
+		return errors.New("EAPI:Invalid signature")
+	}
+	return nil
+}
+
+func Test_KrakenTrade(t *testing.T) {
+	server := fakeserver.New()
+	defer server.Close()
+	server.SetVerifier(verifyKraken)
+	server.Handle("/0/private/AddOrder", fakeserver.Response{StatusCode: 200,
+		Body: []byte(`{"error":[],"result":{"descr":{"order":"buy 1.25 XBTUSD @ limit 37500"},"txid":["OUF4EM-FRGI2-MQMWZD"]}}`)})
+	server.Handle("/0/private/QueryOrders", fakeserver.Response{StatusCode: 200,
+		Body: []byte(`{"error":[],"result":{"OUF4EM-FRGI2-MQMWZD":{"status":"open","vol":"1.25000000","vol_exec":"0.50000000","price":"37490.0",` +
+			`"descr":{"pair":"XBTUSD","type":"buy","ordertype":"limit","price":"37500.0"}}}}`)})
+	server.Handle("/0/private/CancelOrder", fakeserver.Response{StatusCode: 200, Body: []byte(`{"error":[],"result":{"count":1}}`)})
+	server.Handle("/0/private/Balance", fakeserver.Response{StatusCode: 200, Body: []byte(`{"error":[],"result":{"XXBT":"1.5","ZUSD":"100.25","XETH":"0"}}`)})
+
+	var k Kraken
+	k.Init()
+	k.SetBaseURL(server.URL)
+	k.SetHTTPClient(server.Client())
+	// The rate limit of the market is not tested here
+	k.client.Limiter = network.NewLimiter(1000, 1000)
+	ctx := context.Background()
+	symbol := market.NewSymbol("btc", "usd")
+	if _, err := k.PlaceOrder(ctx, markets.Order{Symbol: symbol, Side: markets.Buy, Price: 37500, Volume: 1.25}); err != markets.ErrMissingCredentials {
+		t.Errorf("Received %v, expected %v [test n. %d]", err, markets.ErrMissingCredentials, 1)
+	}
+
+	k.SetCredentials(markets.Credentials{Key: "key", Secret: testSecret})
+	// The price and the volume are rounded to the decimals of the pair
+	k.Pairs = map[string]datastructure.KrakenPair{"XXBTZUSD": {Altname: "XBTUSD", Base: "XXBT", Quote: "ZUSD", PairDecimals: 1, LotDecimals: 8}}
+	id, err := k.PlaceOrder(ctx, markets.Order{Symbol: symbol, Side: markets.Buy, Price: 37499.97, Volume: 1.250000009})
+	if err != nil || id != "OUF4EM-FRGI2-MQMWZD" {
+		t.Errorf("Received %s (%v), expected %s [test n. %d]", id, err, "OUF4EM-FRGI2-MQMWZD", 2)
+	}
+	if form, _ := url.ParseQuery(server.Bodies()[0]); form.Get("pair") != "XBTUSD" || form.Get("type") != "buy" || form.Get("price") != "37500" || form.Get("volume") != "1.25" {
+		t.Errorf("Received %v, expected the parameters of the order [test n. %d]", form, 3)
+	}
+	status, err := k.GetOrder(ctx, symbol, id)
+	expected := markets.OrderStatus{ID: id, Symbol: symbol, Side: markets.Buy, Price: 37500, Volume: 1.25, Filled: 0.5, AveragePrice: 37490, State: markets.Open}
+	if err != nil || status != expected {
+		t.Errorf("Received %+v (%v), expected %+v [test n. %d]", status, err, expected, 4)
+	}
+	if err = k.CancelOrder(ctx, symbol, id); err != nil {
+		t.Errorf("Received %v, expected no error [test n. %d]", err, 5)
+	}
+	balances, err := k.GetBalances(ctx)
+	if err != nil || len(balances) != 3 || balances["btc"] != 1.5 || balances["usd"] != 100.25 {
+		t.Errorf("Received %v (%v), expected the balances [test n. %d]", balances, err, 6)
+	}
+
+	// The server refuse the requests signed with another secret
+	k.SetCredentials(markets.Credentials{Key: "key", Secret: base64.StdEncoding.EncodeToString([]byte("wrong"))})
+	if _, err = k.GetBalances(ctx); err == nil {
+		t.Errorf("Expected an error for an invalid signature [test n. %d]", 7)
+	}
+}
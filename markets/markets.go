@@ -0,0 +1,106 @@
+// Package markets contains the common interface implemented by every exchange adapter and the registry used
+// for retrieve them by name
+package markets
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+)
+
+// Exchange is the set of methods that every market adapter have to expose in order to be used by the engine
+type Exchange interface {
+	// Name return the name of the market (e.g. `KRAKEN`), the same used in market.Market.MarketName
+	Name() string
+	// Init is delegated to initialize the internal structure of the market
+	Init()
+	// SetFees is delegated to initialize the fee type/amount for the market
+	SetFees()
+	// SetDepth is delegated to set the number of levels of the order book to request
+	SetDepth(depth int)
+	// SetBaseURL is delegated to replace the base url of the market API (e.g. with a local stand-in)
+	SetBaseURL(baseURL string)
+	// SetHTTPClient is delegated to set the HTTP client used for send the requests
+	SetHTTPClient(httpClient *http.Client)
+	// GetPairsList is delegated to retrieve the list of pairs traded in the market
+	GetPairsList(ctx context.Context) error
+	// GetPairsDetails is delegated to retrieve the information related to the pairs (min order, precision ...)
+	GetPairsDetails(ctx context.Context) error
+	// GetAllOrderBook is delegated to retrieve the order book for all the pairs traded
+	GetAllOrderBook(ctx context.Context) error
+	// GetOrderBook is delegated to retrieve the order book for the given pair
+	GetOrderBook(ctx context.Context, pair string) error
+	// GetMarketData is delegated to convert the order book of the given pair into a standard `market` struct
+	GetMarketData(pair string) (market.Market, error)
+	// GetMarketsData is delegated to convert all the order books into a standard `market` struct
+	GetMarketsData() market.Market
+	// ParsePair is delegated to convert the standard lowercase pair into the one compliant with the market
+	ParsePair(pair string) string
+	// DecodeSymbol is delegated to extract the currencies from the given market pair, using the pairs metadata
+	DecodeSymbol(pair string) (market.Symbol, error)
+	// EncodeSymbol is delegated to convert the given symbol into the pair compliant with the market
+	EncodeSymbol(symbol market.Symbol) string
+}
+
+// Update is sent by the markets that stream the order books every time that the book of a pair change
+type Update struct {
+	// Market is the name of the market
+	Market string
+	// Pair is the pair in the format of the market
+	Pair string
+	// Symbol is the standard symbol of the pair
+	Symbol market.Symbol
+}
+
+// Streamer is implemented by the markets that can keep the order books updated through a websocket, instead of
+// requesting them for every scan
+type Streamer interface {
+	// Stream is delegated to subscribe the order books of the given pairs (in the format of the market) and keep them
+	// updated until the context is done, reconnecting when the connection is lost. An Update is sent for every change,
+	// the update is dropped if the channel is full (the order book is updated anyway)
+	Stream(ctx context.Context, pairs []string, updates chan<- Update) error
+	// Streaming return true if the order book of the given pair is currently updated by the stream
+	Streaming(pair string) bool
+	// SetStreamURL is delegated to replace the url of the websocket (e.g. with a local stand-in)
+	SetStreamURL(url string)
+}
+
+var (
+	mutex    sync.RWMutex
+	registry = make(map[string]Exchange)
+	// names save the registration order, in order to iterate the markets always in the same order
+	names []string
+)
+
+// Register is delegated to save the given exchange in the registry.
+// Registering a market with a name already present will replace the previous one
+func Register(exchange Exchange) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	name := exchange.Name()
+	if _, ok := registry[name]; !ok {
+		names = append(names, name)
+	}
+	registry[name] = exchange
+}
+
+// Get is delegated to retrieve the exchange registered with the given name
+func Get(name string) (Exchange, bool) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	exchange, ok := registry[name]
+	return exchange, ok
+}
+
+// Registered is delegated to return all the registered exchanges, in registration order
+func Registered() []Exchange {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	var exchanges = make([]Exchange, len(names))
+	for i := range names {
+		exchanges[i] = registry[names[i]]
+	}
+	return exchanges
+}
@@ -0,0 +1,164 @@
+package markets_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/engine"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"github.com/alessiosavi/GoArbitrage/markets/fakeserver"
+	"github.com/alessiosavi/GoArbitrage/markets/kraken"
+	"github.com/alessiosavi/GoArbitrage/markets/okcoin"
+)
+
+// savedCycle contains the fields of the cycles saved in the opportunities file checked by the tests
+type savedCycle struct {
+	Type string `json:"type"`
+	Legs []struct {
+		Market   string `json:"market"`
+		ToMarket string `json:"to_market"`
+		Pair     string `json:"pair"`
+		Side     string `json:"side"`
+	} `json:"legs"`
+}
+
+// initEngineTest is delegated to redirect the files of the markets and the opportunities file to a temporary folder.
+// Return the function that restore them
+func initEngineTest(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "engine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assets, details, opportunities := kraken.KRAKEN_ASSETS_DATA, kraken.KRAKEN_PAIRS_DETAILS, engine.OpportunitiesFile
+	okcoinPairs, okcoinDetails := okcoin.OKCOIN_PAIRS_DATA, okcoin.OKCOIN_PAIRS_DETAILS
+	kraken.KRAKEN_ASSETS_DATA = filepath.Join(dir, "kraken_assets.json")
+	kraken.KRAKEN_PAIRS_DETAILS = filepath.Join(dir, "kraken_pairs_info.json")
+	okcoin.OKCOIN_PAIRS_DATA = filepath.Join(dir, "okcoin_pairs_list.json")
+	okcoin.OKCOIN_PAIRS_DETAILS = filepath.Join(dir, "okcoin_pairs_info.json")
+	engine.OpportunitiesFile = filepath.Join(dir, "data.json")
+	return engine.OpportunitiesFile, func() {
+		kraken.KRAKEN_ASSETS_DATA, kraken.KRAKEN_PAIRS_DETAILS, engine.OpportunitiesFile = assets, details, opportunities
+		okcoin.OKCOIN_PAIRS_DATA, okcoin.OKCOIN_PAIRS_DETAILS = okcoinPairs, okcoinDetails
+		os.RemoveAll(dir)
+	}
+}
+
+// initFakeExchange is delegated to connect the registered market to a fakeserver and to load its pairs. Return the
+// function that disconnect it
+func initFakeExchange(t *testing.T, name string) (markets.Exchange, *fakeserver.Server, func()) {
+	server, err := fakeserver.NewMarket(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exchange, _ := markets.Get(name)
+	exchange.Init()
+	exchange.SetBaseURL(server.URL)
+	exchange.SetHTTPClient(server.Client())
+	exchange.SetDepth(1)
+	if err = exchange.GetPairsList(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err = exchange.GetPairsDetails(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return exchange, server, func() {
+		exchange.SetBaseURL("")
+		exchange.SetHTTPClient(nil)
+		exchange.Init()
+		server.Close()
+	}
+}
+
+// loadBook is delegated to serve the given body at the given path and to request the order book of the pair
+func loadBook(t *testing.T, exchange markets.Exchange, server *fakeserver.Server, path, pair, body string) {
+	server.Handle(path, fakeserver.Response{StatusCode: 200, Body: []byte(body)})
+	if err := exchange.GetOrderBook(context.Background(), pair); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// loadCycles is delegated to read the cycles saved in the opportunities file
+func loadCycles(t *testing.T, file string) []savedCycle {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	var cycles []savedCycle
+	if err = json.Unmarshal([]byte("["+strings.TrimSuffix(string(data), ",\n")+"]"), &cycles); err != nil {
+		t.Fatal(err)
+	}
+	return cycles
+}
+
+// krakenBook return the body of the kraken depth with a single level for the given pair
+func krakenBook(pair, ask, bid string) string {
+	return `{"error":[],"result":{"` + pair + `":{"asks":[["` + ask + `","100",1581765528]],"bids":[["` + bid + `","100",1581765528]]}}}`
+}
+
+func Test_TriangularAdapter(t *testing.T) {
+	file, restore := initEngineTest(t)
+	defer restore()
+	exchange, server, reset := initFakeExchange(t, "KRAKEN")
+	defer reset()
+	// 10000 usd buy 1 btc, converted in 50 eth and sold for 11000 usd. The depth of all the pairs use the same path
+	loadBook(t, exchange, server, "/0/public/Depth", "XBTUSD", krakenBook("XXBTZUSD", "10000", "9990"))
+	loadBook(t, exchange, server, "/0/public/Depth", "ETHXBT", krakenBook("XETHXXBT", "0.02", "0.019"))
+	loadBook(t, exchange, server, "/0/public/Depth", "ETHUSD", krakenBook("XETHZUSD", "230", "220"))
+
+	engine.Triangular(exchange.GetMarketsData())
+	cycles := loadCycles(t, file)
+	if len(cycles) != 1 || cycles[0].Type != engine.TRIANGULAR {
+		t.Fatalf("Received %+v, expected a triangular opportunity", cycles)
+	}
+	expected := map[string]string{"ethbtc": "buy", "ethusd": "sell", "btcusd": "buy"}
+	if len(cycles[0].Legs) != len(expected) {
+		t.Errorf("Received %+v, expected %v", cycles[0].Legs, expected)
+	}
+	for i, leg := range cycles[0].Legs {
+		if leg.Market != "KRAKEN" || leg.Side != expected[leg.Pair] {
+			t.Errorf("Received %+v, expected %v [test n. %d]", leg, expected, i+1)
+		}
+	}
+}
+
+func Test_MultiHopAdapters(t *testing.T) {
+	file, restore := initEngineTest(t)
+	defer restore()
+	krakenExchange, krakenServer, resetKraken := initFakeExchange(t, "KRAKEN")
+	defer resetKraken()
+	okcoinExchange, okcoinServer, resetOkCoin := initFakeExchange(t, "OKCOIN")
+	defer resetOkCoin()
+	// The btc bought on OkCoin at 10000 usd are moved and sold on Kraken at 10500 usd
+	loadBook(t, krakenExchange, krakenServer, "/0/public/Depth", "XBTUSD", krakenBook("XXBTZUSD", "10510", "10500"))
+	loadBook(t, okcoinExchange, okcoinServer, "/api/spot/v3/instruments/BTC-USD/book", "BTC-USD",
+		`{"asks":[["10000","100","1"]],"bids":[["9990","100","1"]],"timestamp":"2020-02-15T11:18:29.022Z"}`)
+
+	engine.MultiHop([]market.Market{krakenExchange.GetMarketsData(), okcoinExchange.GetMarketsData()})
+	cycles := loadCycles(t, file)
+	if len(cycles) != 1 || cycles[0].Type != engine.MULTI_HOP {
+		t.Fatalf("Received %+v, expected a multi hop opportunity", cycles)
+	}
+	expected := map[string]string{"OKCOIN": "buy", "KRAKEN": "sell"}
+	var orders, transfers int
+	for i, leg := range cycles[0].Legs {
+		if leg.Side == "transfer" {
+			transfers++
+			continue
+		}
+		orders++
+		if leg.Pair != "btcusd" || leg.Side != expected[leg.Market] {
+			t.Errorf("Received %+v, expected %v [test n. %d]", leg, expected, i+1)
+		}
+	}
+	if orders != 2 || transfers != 2 {
+		t.Errorf("Received %d orders and %d transfers, expected %d and %d", orders, transfers, 2, 2)
+	}
+}
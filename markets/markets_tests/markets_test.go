@@ -0,0 +1,170 @@
+package markets_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alessiosavi/GoArbitrage/markets"
+	_ "github.com/alessiosavi/GoArbitrage/markets/bitfinex"
+	"github.com/alessiosavi/GoArbitrage/markets/fakeserver"
+	_ "github.com/alessiosavi/GoArbitrage/markets/gemini"
+	_ "github.com/alessiosavi/GoArbitrage/markets/kraken"
+	_ "github.com/alessiosavi/GoArbitrage/markets/okcoin"
+)
+
+func Test_Registry(t *testing.T) {
+	type TestCase struct {
+		Name   string
+		Number int
+	}
+
+	cases := []TestCase{
+		{Name: "BITFINEX", Number: 1},
+		{Name: "GEMINI", Number: 2},
+		{Name: "KRAKEN", Number: 3},
+		{Name: "OKCOIN", Number: 4}}
+
+	for _, c := range cases {
+		exchange, ok := markets.Get(c.Name)
+		if !ok {
+			t.Errorf("Market %v not registered [test n. %d]", c.Name, c.Number)
+			continue
+		}
+		if exchange.Name() != c.Name {
+			t.Errorf("Received %v, expected %v [test n. %d]", exchange.Name(), c.Name, c.Number)
+		}
+	}
+
+	if len(markets.Registered()) != len(cases) {
+		t.Errorf("Received %d markets, expected %d", len(markets.Registered()), len(cases))
+	}
+
+	if _, ok := markets.Get("UNKNOWN"); ok {
+		t.Error("Market UNKNOWN should not be registered")
+	}
+}
+
+func Test_LoadCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "credentials.json")
+	data := `{"kraken": {"key": "k", "secret": "s"}, "OKCOIN": {"key": "k", "secret": "s", "passphrase": "p"}}`
+	if err = ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	credentials, err := markets.LoadCredentials(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]markets.Credentials{
+		"KRAKEN": {Key: "k", Secret: "s"},
+		"OKCOIN": {Key: "k", Secret: "s", Passphrase: "p"},
+	}
+	if len(credentials) != len(expected) {
+		t.Errorf("Received %v, expected %v", credentials, expected)
+	}
+	for name := range expected {
+		if credentials[name] != expected[name] {
+			t.Errorf("Received %v, expected %v for %s", credentials[name], expected[name], name)
+		}
+	}
+	if _, err = markets.LoadCredentials(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func Test_RegistryTrader(t *testing.T) {
+	for i, exchange := range markets.Registered() {
+		if _, ok := exchange.(markets.Trader); !ok {
+			t.Errorf("Market %v does not expose the private API [test n. %d]", exchange.Name(), i+1)
+		}
+	}
+}
+
+func Test_FakeServerOrderBook(t *testing.T) {
+	type TestCase struct {
+		Name    string
+		Pair    string
+		BestAsk float64
+		BestBid float64
+		Request string
+		Number  int
+	}
+
+	cases := []TestCase{
+		{Name: "BITFINEX", Pair: "btcusd", BestAsk: 10176, BestBid: 10175, Request: "/v1/book/btcusd?limit_bids=1&limit_asks=1", Number: 1},
+		{Name: "GEMINI", Pair: "btcusd", BestAsk: 10172.25, BestBid: 10170, Request: "/v1/book/btcusd?limit_bids=1&limit_asks=1", Number: 2},
+		{Name: "KRAKEN", Pair: "XBTUSD", BestAsk: 10180.5, BestBid: 10180.4, Request: "/0/public/Depth?pair=XBTUSD&count=1", Number: 3},
+		{Name: "OKCOIN", Pair: "BTC-USD", BestAsk: 10181.12, BestBid: 10179.87, Request: "/api/spot/v3/instruments/BTC-USD/book?size=1", Number: 4},
+	}
+
+	for _, c := range cases {
+		server, err := fakeserver.NewMarket(c.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exchange, _ := markets.Get(c.Name)
+		exchange.SetBaseURL(server.URL)
+		exchange.SetHTTPClient(server.Client())
+		exchange.SetDepth(1)
+		if err = exchange.GetOrderBook(context.Background(), c.Pair); err != nil {
+			t.Errorf("Received %v, expected no error [test n. %d]", err, c.Number)
+		}
+		data, err := exchange.GetMarketData(c.Pair)
+		if err != nil {
+			t.Errorf("Received %v, expected no error [test n. %d]", err, c.Number)
+		} else if len(data.Asks[c.Pair]) == 0 || len(data.Bids[c.Pair]) == 0 {
+			t.Errorf("Order book of %s not loaded [test n. %d]", c.Pair, c.Number)
+		} else if data.Asks[c.Pair][0].Price != c.BestAsk || data.Bids[c.Pair][0].Price != c.BestBid {
+			t.Errorf("Received %v/%v, expected %v/%v [test n. %d]", data.Asks[c.Pair][0].Price, data.Bids[c.Pair][0].Price, c.BestAsk, c.BestBid, c.Number)
+		}
+		if requests := server.Requests(); len(requests) != 1 || requests[0] != c.Request {
+			t.Errorf("Received %v, expected %v [test n. %d]", requests, c.Request, c.Number)
+		}
+		exchange.SetBaseURL("")
+		exchange.SetHTTPClient(nil)
+		server.Close()
+	}
+}
+
+func Test_FakeServerOrderBookTimeout(t *testing.T) {
+	type TestCase struct {
+		Name    string
+		Pair    string
+		Pattern string
+		Number  int
+	}
+
+	cases := []TestCase{
+		{Name: "BITFINEX", Pair: "btcusd", Pattern: "/v1/book/*", Number: 1},
+		{Name: "GEMINI", Pair: "btcusd", Pattern: "/v1/book/*", Number: 2},
+		{Name: "KRAKEN", Pair: "XBTUSD", Pattern: "/0/public/Depth", Number: 3},
+		{Name: "OKCOIN", Pair: "BTC-USD", Pattern: "/api/spot/v3/instruments/*/book", Number: 4},
+	}
+
+	for _, c := range cases {
+		server, err := fakeserver.NewMarket(c.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server.Handle(c.Pattern, fakeserver.Response{StatusCode: 200, Body: []byte(`{}`), Delay: time.Second})
+		exchange, _ := markets.Get(c.Name)
+		exchange.SetBaseURL(server.URL)
+		exchange.SetHTTPClient(server.Client())
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		if err = exchange.GetOrderBook(ctx, c.Pair); err == nil {
+			t.Errorf("Received no error, expected the timeout of the request [test n. %d]", c.Number)
+		}
+		cancel()
+		exchange.SetBaseURL("")
+		exchange.SetHTTPClient(nil)
+		server.Close()
+	}
+}
@@ -0,0 +1,208 @@
+package markets_test
+
+import (
+	"testing"
+
+	bitfinexds "github.com/alessiosavi/GoArbitrage/datastructure/bitfinex"
+	geminids "github.com/alessiosavi/GoArbitrage/datastructure/gemini"
+	krakends "github.com/alessiosavi/GoArbitrage/datastructure/kraken"
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	datastructure "github.com/alessiosavi/GoArbitrage/datastructure/okcoin"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"github.com/alessiosavi/GoArbitrage/markets/bitfinex"
+	"github.com/alessiosavi/GoArbitrage/markets/gemini"
+	"github.com/alessiosavi/GoArbitrage/markets/kraken"
+	"github.com/alessiosavi/GoArbitrage/markets/okcoin"
+)
+
+type symbolTestCase struct {
+	Exchange markets.Exchange
+	Pair     string
+	Expected market.Symbol
+	Error    bool
+	Number   int
+}
+
+func Test_DecodeSymbol(t *testing.T) {
+	var k kraken.Kraken
+	k.Pairs = map[string]krakends.KrakenPair{
+		"ALGOEUR":    {Altname: "ALGOEUR", Base: "ALGO", Quote: "ZEUR"},
+		"XETHXXBT":   {Altname: "ETHXBT", Base: "XETH", Quote: "XXBT"},
+		"DAIUSDT":    {Altname: "DAIUSDT", Base: "DAI", Quote: "USDT"},
+		"USDTZUSD":   {Altname: "USDTUSD", Base: "USDT", Quote: "ZUSD"},
+		"XETHXXBT.d": {Altname: "ETHXBT.d", Base: "XETH", Quote: "XXBT"},
+		"XDGEUR":     {Altname: "XDGEUR", Base: "XXDG", Quote: "ZEUR"},
+	}
+	var o okcoin.OkCoin
+	o.Pairs = map[string]datastructure.OkCoinPairs{
+		"BTC-EURS": {Pair: "BTC-EURS", BaseCurrency: "BTC", QuoteCurrency: "EURS"},
+	}
+	var b bitfinex.Bitfinex
+	var g gemini.Gemini
+
+	cases := []symbolTestCase{
+		{Exchange: &k, Pair: "ALGOEUR", Expected: market.NewSymbol("algo", "eur"), Number: 1},
+		{Exchange: &k, Pair: "ETHXBT", Expected: market.NewSymbol("eth", "btc"), Number: 2},
+		{Exchange: &k, Pair: "XETHXXBT", Expected: market.NewSymbol("eth", "btc"), Number: 3},
+		{Exchange: &k, Pair: "DAIUSDT", Expected: market.NewSymbol("dai", "usdt"), Number: 4},
+		{Exchange: &k, Pair: "USDTUSD", Expected: market.NewSymbol("usdt", "usd"), Number: 5},
+		{Exchange: &k, Pair: "ETHXBT.d", Error: true, Number: 6},
+		{Exchange: &k, Pair: "UNKNOWN", Error: true, Number: 7},
+		{Exchange: &k, Pair: "XDGEUR", Expected: market.NewSymbol("doge", "eur"), Number: 17},
+		{Exchange: &o, Pair: "BTC-EURS", Expected: market.NewSymbol("btc", "eurs"), Number: 8},
+		{Exchange: &o, Pair: "EURS-EUR", Expected: market.NewSymbol("eurs", "eur"), Number: 9},
+		{Exchange: &o, Pair: "BTCUSD", Error: true, Number: 10},
+		{Exchange: &b, Pair: "btcusd", Expected: market.NewSymbol("btc", "usd"), Number: 11},
+		{Exchange: &b, Pair: "dusk:usd", Expected: market.NewSymbol("dusk", "usd"), Number: 12},
+		{Exchange: &b, Pair: "btcusdt", Error: true, Number: 13},
+		{Exchange: &g, Pair: "zecbch", Expected: market.NewSymbol("zec", "bch"), Number: 14},
+		{Exchange: &g, Pair: "linkusd", Expected: market.NewSymbol("link", "usd"), Number: 15},
+		{Exchange: &g, Pair: "usd", Error: true, Number: 16},
+		{Exchange: &g, Pair: "btcgusd", Expected: market.NewSymbol("btc", "gusd"), Number: 18},
+		{Exchange: &g, Pair: "gusdusd", Expected: market.NewSymbol("gusd", "usd"), Number: 19},
+	}
+
+	for _, c := range cases {
+		result, err := c.Exchange.DecodeSymbol(c.Pair)
+		if c.Error {
+			if err == nil {
+				t.Errorf("Expected an error for %v, received %v [test n. %d]", c.Pair, result, c.Number)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Received error %v [test n. %d]", err, c.Number)
+			continue
+		}
+		if result != c.Expected {
+			t.Errorf("Received %v, expected %v [test n. %d]", result, c.Expected, c.Number)
+		}
+	}
+}
+
+func Test_EncodeSymbol(t *testing.T) {
+	type TestCase struct {
+		Exchange markets.Exchange
+		Symbol   market.Symbol
+		Expected string
+		Number   int
+	}
+
+	cases := []TestCase{
+		{Exchange: &kraken.Kraken{}, Symbol: market.NewSymbol("algo", "eur"), Expected: "ALGOEUR", Number: 1},
+		{Exchange: &kraken.Kraken{}, Symbol: market.NewSymbol("btc", "eur"), Expected: "XBTEUR", Number: 6},
+		{Exchange: &okcoin.OkCoin{}, Symbol: market.NewSymbol("btc", "usdt"), Expected: "BTC-USDT", Number: 2},
+		{Exchange: &bitfinex.Bitfinex{}, Symbol: market.NewSymbol("btc", "usd"), Expected: "btcusd", Number: 3},
+		{Exchange: &bitfinex.Bitfinex{}, Symbol: market.NewSymbol("xaut", "usd"), Expected: "xaut:usd", Number: 4},
+		{Exchange: &gemini.Gemini{}, Symbol: market.NewSymbol("link", "usd"), Expected: "linkusd", Number: 5},
+	}
+
+	for _, c := range cases {
+		result := c.Exchange.EncodeSymbol(c.Symbol)
+		if result != c.Expected {
+			t.Errorf("Received %v, expected %v [test n. %d]", result, c.Expected, c.Number)
+		}
+	}
+}
+
+func Test_KrakenAsset(t *testing.T) {
+	type TestCase struct {
+		Code     string
+		Expected string
+		Number   int
+	}
+
+	var k kraken.Kraken
+	k.Assets = map[string]string{"XXBT": "btc", "XBT": "btc", "XTZ": "xtz"}
+	cases := []TestCase{
+		{Code: "XXBT", Expected: "btc", Number: 1},
+		{Code: "XBT", Expected: "btc", Number: 2},
+		{Code: "XTZ", Expected: "xtz", Number: 3},
+		{Code: "ZEUR", Expected: "eur", Number: 4},
+		{Code: "XXDG", Expected: "doge", Number: 5},
+		{Code: "USDT", Expected: "usdt", Number: 6},
+		{Code: "ALGO", Expected: "algo", Number: 7}}
+
+	for _, c := range cases {
+		result := k.Asset(c.Code)
+		if result != c.Expected {
+			t.Errorf("Received %v, expected %v [test n. %d]", result, c.Expected, c.Number)
+		}
+	}
+}
+
+func Test_Constraint(t *testing.T) {
+	type TestCase struct {
+		Constraint market.OrderConstraint
+		Expected   market.OrderConstraint
+		Number     int
+	}
+	var k kraken.Kraken
+	k.Pairs = map[string]krakends.KrakenPair{
+		"XXBTZUSD": {Altname: "XBTUSD", Base: "XXBT", Quote: "ZUSD", PairDecimals: 1, LotDecimals: 8},
+	}
+	var o okcoin.OkCoin
+	o.Pairs = map[string]datastructure.OkCoinPairs{
+		"BTC-USD": {Pair: "BTC-USD", MinSize: "0.001", SizeIncrement: "0.0001", TickSize: "0.01"},
+	}
+	var b bitfinex.Bitfinex
+	b.Pairs = map[string]bitfinexds.BitfinexPair{
+		"btcusd": {Pair: "btcusd", MinOrder: "0.0006", MaxOrder: "2000.0", PricePrecision: 5},
+	}
+	var g gemini.Gemini
+	g.PairsInfo = map[string]geminids.GeminiPairs{
+		"btcusd": {Pair: "btcusd", MinOrder: 0.5, MinOrderIncrement: 0.25, MinPriceIncrement: 0.125},
+		"ethusd": {Pair: "ethusd", MinOrder: 0.001, MinOrderIncrement: 0.000001, MinPriceIncrement: 0.01},
+	}
+
+	cases := []TestCase{
+		{Constraint: k.Constraint("XBTUSD"), Expected: market.OrderConstraint{VolumeIncrement: 1e-8, PriceIncrement: 0.1}, Number: 1},
+		{Constraint: k.Constraint("XXBTZUSD"), Expected: market.OrderConstraint{VolumeIncrement: 1e-8, PriceIncrement: 0.1}, Number: 2},
+		{Constraint: o.Constraint("BTC-USD"), Expected: market.OrderConstraint{MinVolume: 0.001, VolumeIncrement: 0.0001, PriceIncrement: 0.01}, Number: 3},
+		{Constraint: b.Constraint("btcusd"), Expected: market.OrderConstraint{MinVolume: 0.0006, MaxVolume: 2000, PricePrecision: 5}, Number: 4},
+		{Constraint: g.Constraint("btcusd"), Expected: market.OrderConstraint{MinVolume: 0.5, VolumeIncrement: 0.25, PriceIncrement: 0.125}, Number: 5},
+		// Unknown pair, no rules
+		{Constraint: k.Constraint("ETHUSD"), Expected: market.OrderConstraint{}, Number: 6},
+		{Constraint: o.Constraint("ETH-USD"), Expected: market.OrderConstraint{}, Number: 7},
+		// The float32 of gemini are converted without error
+		{Constraint: g.Constraint("ethusd"), Expected: market.OrderConstraint{MinVolume: 0.001, VolumeIncrement: 0.000001, PriceIncrement: 0.01}, Number: 8},
+	}
+
+	for _, c := range cases {
+		if c.Constraint != c.Expected {
+			t.Errorf("Received %+v, expected %+v [test n. %d]", c.Constraint, c.Expected, c.Number)
+		}
+	}
+}
+
+func Test_RoundOrder(t *testing.T) {
+	type TestCase struct {
+		Constraint market.OrderConstraint
+		Order      markets.Order
+		Price      string
+		Volume     string
+		Number     int
+	}
+
+	increments := market.OrderConstraint{VolumeIncrement: 0.1, PriceIncrement: 0.01}
+	precision := market.OrderConstraint{PricePrecision: 5}
+	cases := []TestCase{
+		// No rules
+		{Order: markets.Order{Side: markets.Buy, Price: 100.123, Volume: 1.23456}, Price: "100.123", Volume: "1.23456", Number: 1},
+		// The buy price is rounded up, the volume down and without the float error (3 * 0.1)
+		{Constraint: increments, Order: markets.Order{Side: markets.Buy, Price: 100.001, Volume: 0.35}, Price: "100.01", Volume: "0.3", Number: 2},
+		{Constraint: increments, Order: markets.Order{Side: markets.Sell, Price: 100.009, Volume: 0.35}, Price: "100", Volume: "0.3", Number: 3},
+		{Constraint: increments, Order: markets.Order{Side: markets.Sell, Price: 0.07, Volume: 0.7}, Price: "0.07", Volume: "0.7", Number: 4},
+		// Significant digits
+		{Constraint: precision, Order: markets.Order{Side: markets.Buy, Price: 7123.456, Volume: 1}, Price: "7123.5", Volume: "1", Number: 5},
+		{Constraint: precision, Order: markets.Order{Side: markets.Buy, Price: 123456.7, Volume: 1}, Price: "123460", Volume: "1", Number: 6},
+		{Constraint: precision, Order: markets.Order{Side: markets.Sell, Price: 0.000123456, Volume: 1}, Price: "0.00012345", Volume: "1", Number: 7},
+	}
+
+	for _, c := range cases {
+		order := markets.RoundOrder(c.Order, c.Constraint)
+		if price, volume := markets.FormatFloat(order.Price), markets.FormatFloat(order.Volume); price != c.Price || volume != c.Volume {
+			t.Errorf("Received %s/%s, expected %s/%s [test n. %d]", price, volume, c.Price, c.Volume, c.Number)
+		}
+	}
+}
@@ -1,14 +1,17 @@
 package okcoin
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"net/url"
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/alessiosavi/GoArbitrage/utils"
@@ -17,14 +20,17 @@ import (
 	"github.com/alessiosavi/GoArbitrage/datastructure/constants"
 	"github.com/alessiosavi/GoArbitrage/datastructure/market"
 	datastructure "github.com/alessiosavi/GoArbitrage/datastructure/okcoin"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"github.com/alessiosavi/GoArbitrage/markets/stream"
+	"github.com/alessiosavi/GoArbitrage/network"
 	fileutils "github.com/alessiosavi/GoGPUtils/files"
-	req "github.com/alessiosavi/Requests"
 )
 
-// `https://www.okcoin.com/api/spot/v3/instruments`
+// OKCOIN_API is the base url of the okcoin API
+const OKCOIN_API string = `https://www.okcoin.com`
 
-const OKCOIN_PAIRS_URL string = `https://www.okcoin.com/api/spot/v3/instruments/ticker`
-const OKCOIN_PAIRS_DETAILS_URL string = `https://www.okcoin.com/api/spot/v3/instruments/`
+const OKCOIN_PAIRS_URL string = OKCOIN_API + `/api/spot/v3/instruments/ticker`
+const OKCOIN_PAIRS_DETAILS_URL string = OKCOIN_API + `/api/spot/v3/instruments/`
 
 var OKCOIN_PAIRS_DATA = path.Join(constants.OKCOIN_PATH, "pairs_list.json")
 var OKCOIN_PAIRS_DETAILS = path.Join(constants.OKCOIN_PATH, "pairs_info.json")
@@ -37,25 +43,106 @@ type OkCoin struct {
 	MakerFee  float64                                  `json:"maker_fee"`
 	TakerFees float64                                  `json:"taker_fee"`
 	// FeePercent is delegated to save if the fee is in percent or in coin
-	FeePercent bool     `json:"fee_percent"`
-	Tickers    []string `json:"tickers"`
+	FeePercent bool `json:"fee_percent"`
+	// Fees contains the fee schedule (tiers by 30 days volume) of the market
+	Fees    market.MarketFee `json:"fees"`
+	Tickers []string         `json:"tickers"`
+	// Depth is the number of levels of the order book to request
+	Depth int `json:"depth"`
+	// mutex protect the order book, updated and read by the engine from different goroutines
+	mutex sync.RWMutex
+	// baseURL replace the base url of the API, if set
+	baseURL string
+	// client is used for send the requests, if set. The defaultClient is used otherwise
+	client *network.Client
+	// streamURL replace the url of the websocket, if set
+	streamURL string
+	// streaming save the pairs whose order book is updated by the websocket
+	streaming stream.Status
+	// credentials contains the API key used for sign the requests of the private API
+	credentials markets.Credentials
 }
 
+// OKCOIN_RATE_LIMIT is the number of requests per second allowed by the okcoin public API (20 requests every 2 seconds)
+const OKCOIN_RATE_LIMIT float64 = 10
+
+// OKCOIN_RATE_BURST is the number of requests that can be sent without wait
+const OKCOIN_RATE_BURST int = 20
+
+// defaultClient is shared by all the requests sent to the market, in order to respect the rate limit
+var defaultClient = network.NewClient(OKCOIN_RATE_LIMIT, OKCOIN_RATE_BURST)
+
+func init() {
+	markets.Register(&OkCoin{})
+}
+
+// Name return the name of the market
+func (o *OkCoin) Name() string {
+	return `OKCOIN`
+}
+
+// Init is delegated to initialize the maps for the given market
 func (o *OkCoin) Init() {
 	o.Pairs = make(map[string]datastructure.OkCoinPairs)
 	o.OrderBook = make(map[string]datastructure.OkCoinOrderBook)
 	o.SetFees()
 }
 
+// SetBaseURL is delegated to set the base url used for send the requests in place of the okcoin API
+func (o *OkCoin) SetBaseURL(baseURL string) {
+	o.baseURL = strings.TrimSuffix(baseURL, "/")
+}
+
+// SetHTTPClient is delegated to set the HTTP client used for send the requests.
+// The market will use its own rate limiter, not shared with the other instances. A nil client restore the default one
+func (o *OkCoin) SetHTTPClient(httpClient *http.Client) {
+	if httpClient == nil {
+		o.client = nil
+		return
+	}
+	o.client = network.NewClient(OKCOIN_RATE_LIMIT, OKCOIN_RATE_BURST)
+	o.client.HTTPClient = httpClient
+}
+
+// getClient return the client used for send the requests
+func (o *OkCoin) getClient() *network.Client {
+	if o.client != nil {
+		return o.client
+	}
+	return defaultClient
+}
+
+// url is delegated to replace the base url of the given endpoint with the one configured
+func (o *OkCoin) url(endpoint string) string {
+	if o.baseURL == "" {
+		return endpoint
+	}
+	return o.baseURL + strings.TrimPrefix(endpoint, OKCOIN_API)
+}
+
+// SetDepth is delegated to set the number of levels of the order book to request
+func (o *OkCoin) SetDepth(depth int) {
+	o.Depth = depth
+}
+
+// depth return the number of levels of the order book to request
+func (o *OkCoin) depth() int {
+	if o.Depth > 0 {
+		return o.Depth
+	}
+	return constants.DEFAULT_DEPTH
+}
+
 // SetFees is delegated to initialize the fee type/amount for the given market
 func (o *OkCoin) SetFees() {
 	o.MakerFee = 0.1
 	o.TakerFees = 0.2
 	o.FeePercent = true
+	o.Fees = market.MarketFee{IsPercent: o.FeePercent, Tiers: []market.FeeTier{{Volume: 0, Maker: o.MakerFee, Taker: o.TakerFees}}}
 }
 
 // GetTickers is delegated to retrieve the list of tickers tradable in the exchange
-func (o *OkCoin) GetTickers() error {
+func (o *OkCoin) GetTickers(ctx context.Context) error {
 	if len(o.PairsName) > 0 {
 		var tickers = make([]string, len(o.PairsName))
 		for i := range o.PairsName {
@@ -69,10 +156,13 @@ func (o *OkCoin) GetTickers() error {
 
 // GetMarketData is delegated to convert the order book into a standard `market` struct
 func (o *OkCoin) GetMarketData(pair string) (market.Market, error) {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
 	var markets market.Market
 	markets.Asks = make(map[string][]market.MarketOrder, len(o.OrderBook))
 	markets.Bids = make(map[string][]market.MarketOrder, len(o.OrderBook))
-	markets.MarketName = `OKCOIN`
+	markets.Times = make(map[string]market.BookTime, len(o.OrderBook))
+	markets.MarketName = o.Name()
 	var minVolume float64
 	if min, ok := o.Pairs[pair]; ok {
 		m, _ := strconv.ParseFloat(min.MinSize, 64)
@@ -100,23 +190,52 @@ func (o *OkCoin) GetMarketData(pair string) (market.Market, error) {
 		}
 		markets.Asks[pair] = asks
 		markets.Bids[pair] = bids
+		markets.Times[pair] = okcoinBookTime(orders)
 		return markets, nil
 	}
 	return markets, errors.New("unable to find pair [" + pair + "]")
 }
 
+// Constraint is delegated to retrieve the order rules (min size, lot size, tick size) of the given pair
+func (o *OkCoin) Constraint(pair string) market.OrderConstraint {
+	var constraint market.OrderConstraint
+	if info, ok := o.Pairs[pair]; ok {
+		constraint.MinVolume, _ = strconv.ParseFloat(info.MinSize, 64)
+		constraint.VolumeIncrement, _ = strconv.ParseFloat(info.SizeIncrement, 64)
+		constraint.PriceIncrement, _ = strconv.ParseFloat(info.TickSize, 64)
+	}
+	return constraint
+}
+
+// okcoinBookTime is delegated to retrieve the times of the given order book
+func okcoinBookTime(book datastructure.OkCoinOrderBook) market.BookTime {
+	return market.BookTime{Exchange: book.Timestamp, Received: book.Received}
+}
+
 // GetMarketsData is delegated to convert the internal asks and bids struct to the common "market" struct
 func (o *OkCoin) GetMarketsData() market.Market {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
 	var markets market.Market
 	// Standardize key for common coin
 	var key_standard string
 	markets.Asks = make(map[string][]market.MarketOrder, len(o.OrderBook))
 	markets.Bids = make(map[string][]market.MarketOrder, len(o.OrderBook))
-	markets.MarketName = `OKCOIN`
+	markets.Times = make(map[string]market.BookTime, len(o.OrderBook))
+	markets.Symbols = make(map[string]market.Symbol, len(o.OrderBook))
+	markets.Constraints = make(map[string]market.OrderConstraint, len(o.OrderBook))
+	markets.MarketName = o.Name()
 	// var i int
 	var order market.MarketOrder
 	for key := range o.OrderBook {
-		key_standard = strings.Replace(strings.ToLower(key), "-", "", 1)
+		symbol, err := o.DecodeSymbol(key)
+		if err != nil {
+			zap.S().Debugf("Skipping pair [%s]: %s", key, err.Error())
+			continue
+		}
+		key_standard = symbol.String()
+		markets.Symbols[key_standard] = symbol
+		markets.Constraints[key_standard] = o.Constraint(key)
 		var asks = make([]market.MarketOrder, len(o.OrderBook[key].Asks))
 		for i, ask := range o.OrderBook[key].Asks {
 			price, _ := strconv.ParseFloat(ask[0], 64)
@@ -135,16 +254,17 @@ func (o *OkCoin) GetMarketsData() market.Market {
 		}
 		markets.Asks[key_standard] = asks
 		markets.Bids[key_standard] = bids
+		markets.Times[key_standard] = okcoinBookTime(o.OrderBook[key])
 		markets.MakerFee = o.MakerFee
 		markets.TakerFee = o.TakerFees
+		markets.Fees = o.Fees
 	}
 
 	return markets
 }
 
 // GetPairsList is delegated to retrieve the type of pairs in the Bitfinex market
-func (o *OkCoin) GetPairsList() error {
-	var request req.Request
+func (o *OkCoin) GetPairsList(ctx context.Context) error {
 	var data []byte
 	var err error
 	var pairs_raw []datastructure.OkCoinPair
@@ -169,7 +289,7 @@ func (o *OkCoin) GetPairsList() error {
 	}
 	zap.S().Debugw("Sendind request to [" + OKCOIN_PAIRS_URL + "]")
 	// Call the HTTP method for retrieve the pairs
-	resp := request.SendRequest(OKCOIN_PAIRS_URL, "GET", nil, nil, false, constants.TIMEOUT_REQ*time.Second)
+	resp := o.getClient().Get(ctx, o.url(OKCOIN_PAIRS_URL))
 	if resp.Error != nil {
 		zap.S().Warnw("Error during http request. Err: " + resp.Error.Error())
 		return resp.Error
@@ -196,8 +316,7 @@ func (o *OkCoin) GetPairsList() error {
 }
 
 // GetPairsDetails is delegated to retrieve the information related to the pairs
-func (o *OkCoin) GetPairsDetails() error {
-	var request req.Request
+func (o *OkCoin) GetPairsDetails(ctx context.Context) error {
 	var pairsInfo []datastructure.OkCoinPairs
 	var data []byte
 	var err error
@@ -213,7 +332,7 @@ func (o *OkCoin) GetPairsDetails() error {
 	} else {
 		zap.S().Debugw("Sendind request to [" + OKCOIN_PAIRS_DETAILS_URL + "]")
 		// Call the HTTP method for retrieve the pairs
-		resp := request.SendRequest(OKCOIN_PAIRS_DETAILS_URL, "GET", nil, nil, false, constants.TIMEOUT_REQ*time.Second)
+		resp := o.getClient().Get(ctx, o.url(OKCOIN_PAIRS_DETAILS_URL))
 		if resp.Error != nil {
 			zap.S().Debugw("Error during http request. Err: " + resp.Error.Error())
 			return resp.Error
@@ -244,23 +363,21 @@ func (o *OkCoin) GetPairsDetails() error {
 	return nil
 }
 
-func (o *OkCoin) GetOrderBook(pair string) error {
-	var request req.Request
+func (o *OkCoin) GetOrderBook(ctx context.Context, pair string) error {
 	var order datastructure.OkCoinOrderBook
 	var data []byte
 	var err error
 
-	url := OKCOIN_PAIRS_DETAILS_URL + pair + "/book?size=1"
+	url := getBookURL(pair, o.depth(), 0)
 	zap.S().Debug("Sendind request to [" + url + "]")
 	// Call the HTTP method for retrieve the pairs
-	resp := request.SendRequest(url, "GET", nil, nil, false, constants.TIMEOUT_REQ*time.Second)
+	resp := o.getClient().Get(ctx, o.url(url))
 	if resp.Error != nil {
 		zap.S().Debug("Error during http request. Err: " + resp.Error.Error())
 		return resp.Error
 	}
 	if resp.StatusCode != 200 {
 		zap.S().Warnw("Received a non 200 status code: " + strconv.Itoa(resp.StatusCode) + " for pair [" + pair + "]")
-		log.Println("Request -> ", request)
 		log.Println("Response -> ", resp.Dump())
 		return errors.New("NOT_200_HTTP_STATUS")
 	}
@@ -271,24 +388,31 @@ func (o *OkCoin) GetOrderBook(pair string) error {
 		zap.S().Debugw("Error during unmarshal! Err: " + err.Error())
 		return err
 	}
+	order.Received = time.Now()
 
+	o.mutex.Lock()
 	if len(o.OrderBook) == 0 {
 		o.OrderBook = make(map[string]datastructure.OkCoinOrderBook)
 	}
 	o.OrderBook[pair] = order
+	o.mutex.Unlock()
 
 	// Update the file with the new data
 	//utils.DumpStruct(order, path.Join(OKCOIN_ORDERBOOK_DATA, pair+".json"))
 	return nil
 }
 
-func (o *OkCoin) GetAllOrderBook() error {
-	var request req.Request
+func (o *OkCoin) GetAllOrderBook(ctx context.Context) error {
 	var orders = make(map[string]datastructure.OkCoinOrderBook, len(o.PairsName))
 	var data []byte
 	var err error
 
 	for _, pair := range o.PairsName {
+		// Stop the download if the context is cancelled
+		if ctx.Err() != nil {
+			zap.S().Warnf("Stopping the download of the order books: %s", ctx.Err().Error())
+			break
+		}
 		zap.S().Debugw("Managin pair: [" + pair + "]")
 		if strings.Contains(pair, ":") {
 			zap.S().Warnw("[" + pair + "] is not a tradable pair")
@@ -306,22 +430,21 @@ func (o *OkCoin) GetAllOrderBook() error {
 				continue
 			}
 		} else {
-			time.Sleep(100 * time.Millisecond)
-			url := OKCOIN_PAIRS_DETAILS_URL + pair + "/book?size=1"
+			url := getBookURL(pair, o.depth(), 0)
 			zap.S().Debugw("Sendind request to [" + url + "]")
 			// Call the HTTP method for retrieve the pairs
-			resp := request.SendRequest(url, "GET", nil, nil, false, constants.TIMEOUT_REQ*time.Second)
+			resp := o.getClient().Get(ctx, o.url(url))
 			if resp.Error != nil {
 				zap.S().Debugw("Error during http request. Err: " + resp.Error.Error())
 				continue
 			}
 			if resp.StatusCode != 200 {
 				zap.S().Warnw("Received a non 200 status code: " + strconv.Itoa(resp.StatusCode) + " for pair [" + pair + "]")
-				log.Println("Request -> ", request)
 				log.Println("Response -> ", resp.Dump())
 				continue
 			}
 			data = resp.Body
+			orderbook.Received = time.Now()
 
 		}
 
@@ -335,12 +458,15 @@ func (o *OkCoin) GetAllOrderBook() error {
 		}
 	}
 
+	o.mutex.Lock()
 	o.OrderBook = orders
+	o.mutex.Unlock()
 
 	// Update the file with the new data
-	utils.DumpStruct(o.OrderBook, path.Join(constants.OKCOIN_PATH, "orders_all.json"))
+	utils.DumpStruct(orders, path.Join(constants.OKCOIN_PATH, "orders_all.json"))
 
-	return nil
+	// The order books already retrieved are kept also if the context is cancelled
+	return ctx.Err()
 }
 
 // getBookURL is delegated to generate the URL for the given pairs
@@ -362,12 +488,18 @@ func getBookURL(pairs string, size int, depth float64) string {
 
 var allowed_base = []string{"EUR", "EURS", "USD", "USDT", "SGD"}
 
-// ParsePair is delegated to convert the given pair into the pair compliant with kraken
+// ParsePair is delegated to convert the given pair into the pair compliant with okcoin
 func (o *OkCoin) ParsePair(pair string) string {
 	// Expected PAIR-BASE => adausd --> ADA-USD
 	if strings.Contains(pair, "-") {
 		return pair
 	}
+	// Use the pairs metadata if available
+	for key := range o.Pairs {
+		if symbol, err := o.DecodeSymbol(key); err == nil && symbol.String() == strings.ToLower(pair) {
+			return key
+		}
+	}
 	// 1 Extract the last 3 char from the string
 	lastchars := strings.ToUpper(pair[len(pair)-3:])
 	var newpair string
@@ -383,3 +515,21 @@ func (o *OkCoin) ParsePair(pair string) string {
 	newpair = strings.ToUpper(pair[:len(pair)-4] + "-" + pair[len(pair)-4:])
 	return newpair
 }
+
+// EncodeSymbol is delegated to convert the given symbol into the pair compliant with okcoin (BTC-USD)
+func (o *OkCoin) EncodeSymbol(symbol market.Symbol) string {
+	return strings.ToUpper(symbol.Base) + "-" + strings.ToUpper(symbol.Quote)
+}
+
+// DecodeSymbol is delegated to extract the base and the quote currencies from the given pair
+func (o *OkCoin) DecodeSymbol(pair string) (market.Symbol, error) {
+	if info, ok := o.Pairs[pair]; ok && info.BaseCurrency != "" && info.QuoteCurrency != "" {
+		return market.NewSymbol(info.BaseCurrency, info.QuoteCurrency), nil
+	}
+	// OkCoin pairs contains the separator between base and quote currencies
+	currencies := strings.Split(pair, "-")
+	if len(currencies) != 2 || currencies[0] == "" || currencies[1] == "" {
+		return market.Symbol{}, errors.New("unable to extract the currencies from pair [" + pair + "]")
+	}
+	return market.NewSymbol(currencies[0], currencies[1]), nil
+}
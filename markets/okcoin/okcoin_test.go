@@ -1,9 +1,17 @@
 package okcoin
 
 import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	datastructure "github.com/alessiosavi/GoArbitrage/datastructure/okcoin"
+	"github.com/alessiosavi/GoArbitrage/markets/fakeserver"
+
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -43,21 +51,112 @@ func Test_GetPairsList(t *testing.T) {
 	loggerMgr := initZapLog(zap.DebugLevel)
 	zap.ReplaceGlobals(loggerMgr)
 	defer loggerMgr.Sync() // flushes buffer, if any
+	server, err := fakeserver.NewMarket("OKCOIN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
 	var o OkCoin
-	err := o.GetPairsList()
+	o.SetBaseURL(server.URL)
+	o.SetHTTPClient(server.Client())
+	err = o.GetPairsList(context.Background())
 	if err != nil {
 		t.Error(err)
 	}
-	t.Log(o.PairsName)
+	if len(o.PairsName) != 7 || o.PairsName[0] != "BTC-USD" {
+		t.Errorf("Received %v, expected 7 pairs", o.PairsName)
+	}
 }
 
 func Test_RetrieveTickers(t *testing.T) {
 	loggerMgr := initZapLog(zap.DebugLevel)
 	zap.ReplaceGlobals(loggerMgr)
 	defer loggerMgr.Sync() // flushes buffer, if any
+	server, err := fakeserver.NewMarket("OKCOIN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
 	var o OkCoin
-	if err := o.GetPairsList(); err != nil {
+	o.SetBaseURL(server.URL)
+	o.SetHTTPClient(server.Client())
+	if err := o.GetPairsList(context.Background()); err != nil {
+		t.Error(err)
+	}
+	if err := o.GetTickers(context.Background()); err != nil {
 		t.Error(err)
 	}
-	t.Log(o.GetTickers())
+	t.Log(o.Tickers)
+}
+
+// FIXTURES_PATH contains the data captured from the okcoin API
+const FIXTURES_PATH = "../../data/OKCOIN"
+
+// loadFixture is delegated to unmarshal the given captured file
+func loadFixture(t *testing.T, file string, v interface{}) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_MarketDataFixtures(t *testing.T) {
+	type TestCase struct {
+		Pair       string
+		Standard   string
+		Ask        market.MarketOrder
+		Bid        market.MarketOrder
+		Constraint market.OrderConstraint
+		Number     int
+	}
+
+	var o OkCoin
+	o.Init()
+	var pairs []datastructure.OkCoinPairs
+	loadFixture(t, filepath.Join(FIXTURES_PATH, "pairs_info.json"), &pairs)
+	for i := range pairs {
+		o.Pairs[pairs[i].Pair] = pairs[i]
+	}
+	o.OrderBook = make(map[string]datastructure.OkCoinOrderBook)
+	for _, pair := range []string{"BTC-USD", "ETH-USD", "BTC-EUR"} {
+		var book datastructure.OkCoinOrderBook
+		loadFixture(t, filepath.Join(FIXTURES_PATH, "orders", pair+".json"), &book)
+		o.OrderBook[pair] = book
+	}
+
+	cases := []TestCase{
+		{Pair: "BTC-USD", Standard: "btcusd", Ask: market.MarketOrder{Price: 10232.41, Volume: 2, MinVolume: 0.001},
+			Bid:        market.MarketOrder{Price: 10228.37, Volume: 0.0257, MinVolume: 0.001},
+			Constraint: market.OrderConstraint{MinVolume: 0.001, VolumeIncrement: 0.0001, PriceIncrement: 0.01}, Number: 1},
+		{Pair: "ETH-USD", Standard: "ethusd", Ask: market.MarketOrder{Price: 280.94, Volume: 3.52, MinVolume: 0.01},
+			Bid:        market.MarketOrder{Price: 280.63, Volume: 15, MinVolume: 0.01},
+			Constraint: market.OrderConstraint{MinVolume: 0.01, VolumeIncrement: 0.0001, PriceIncrement: 0.01}, Number: 2},
+		{Pair: "BTC-EUR", Standard: "btceur", Ask: market.MarketOrder{Price: 9466.14, Volume: 0.2158, MinVolume: 0.001},
+			Bid:        market.MarketOrder{Price: 9451.94, Volume: 0.2198, MinVolume: 0.001},
+			Constraint: market.OrderConstraint{MinVolume: 0.001, VolumeIncrement: 0.0001, PriceIncrement: 0.01}, Number: 3},
+	}
+
+	all := o.GetMarketsData()
+	if len(all.Asks) != len(cases) {
+		t.Errorf("Received %d pairs, expected %d", len(all.Asks), len(cases))
+	}
+	for _, c := range cases {
+		data, err := o.GetMarketData(c.Pair)
+		if err != nil {
+			t.Errorf("Received %v, expected no error [test n. %d]", err, c.Number)
+			continue
+		}
+		if len(data.Asks[c.Pair]) != 1 || data.Asks[c.Pair][0] != c.Ask || len(data.Bids[c.Pair]) != 1 || data.Bids[c.Pair][0] != c.Bid {
+			t.Errorf("Received %+v/%+v, expected %+v/%+v [test n. %d]", data.Asks[c.Pair], data.Bids[c.Pair], c.Ask, c.Bid, c.Number)
+		}
+		if len(all.Asks[c.Standard]) != 1 || all.Asks[c.Standard][0].Price != c.Ask.Price || all.Bids[c.Standard][0].Volume != c.Bid.Volume {
+			t.Errorf("Received %+v/%+v, expected %+v/%+v [test n. %d]", all.Asks[c.Standard], all.Bids[c.Standard], c.Ask, c.Bid, c.Number)
+		}
+		if all.Constraints[c.Standard] != c.Constraint {
+			t.Errorf("Received %+v, expected %+v [test n. %d]", all.Constraints[c.Standard], c.Constraint, c.Number)
+		}
+	}
 }
@@ -0,0 +1,201 @@
+package okcoin
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"time"
+
+	datastructure "github.com/alessiosavi/GoArbitrage/datastructure/okcoin"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"github.com/alessiosavi/GoArbitrage/markets/stream"
+	"github.com/alessiosavi/GoArbitrage/network/websocket"
+	"github.com/alessiosavi/GoArbitrage/orderbook"
+	"go.uber.org/zap"
+)
+
+// OKCOIN_WEBSOCKET_URL is the url of the okcoin public websocket (v3)
+const OKCOIN_WEBSOCKET_URL string = `wss://real.okcoin.com:8443/ws/v3`
+
+// OKCOIN_CHECKSUM_DEPTH is the number of levels used for compute the checksum of the book
+const OKCOIN_CHECKSUM_DEPTH = 25
+
+// OKCOIN_PING_INTERVAL is the interval between the ping, okcoin close the connection after 30 seconds without messages
+const OKCOIN_PING_INTERVAL = 25 * time.Second
+
+// SetStreamURL is delegated to set the url used for the websocket in place of the okcoin one
+func (o *OkCoin) SetStreamURL(url string) {
+	o.streamURL = url
+}
+
+// Streaming return true if the order book of the given pair is updated by the websocket
+func (o *OkCoin) Streaming(pair string) bool {
+	return o.streaming.Streaming(pair)
+}
+
+// Stream is delegated to keep the order books of the given pairs (BTC-USD) updated through the okcoin websocket.
+// The method block until the context is done
+func (o *OkCoin) Stream(ctx context.Context, pairs []string, updates chan<- markets.Update) error {
+	url := o.streamURL
+	if url == "" {
+		url = OKCOIN_WEBSOCKET_URL
+	}
+	handler := &okcoinStream{url: url}
+	handler.Reset()
+
+	s := stream.New(o.Name(), handler)
+	s.OnUpdate = func(book *orderbook.Book) {
+		order := datastructure.OkCoinOrderBook{Pair: book.Pair, Bids: okcoinOrders(book.Bids(o.depth())), Asks: okcoinOrders(book.Asks(o.depth())),
+			Timestamp: book.Time, Received: time.Now()}
+		o.mutex.Lock()
+		if o.OrderBook == nil {
+			o.OrderBook = make(map[string]datastructure.OkCoinOrderBook)
+		}
+		o.OrderBook[book.Pair] = order
+		o.mutex.Unlock()
+		o.streaming.Set(book.Pair)
+		symbol, _ := o.DecodeSymbol(book.Pair)
+		stream.Notify(updates, markets.Update{Market: o.Name(), Pair: book.Pair, Symbol: symbol})
+	}
+	s.OnReset = o.streaming.Reset
+	return s.Run(ctx, pairs)
+}
+
+// okcoinOrders is delegated to convert the levels of the book into the okcoin orders [price, size]
+func okcoinOrders(levels []orderbook.Level) [][]string {
+	orders := make([][]string, len(levels))
+	for i, level := range levels {
+		orders[i] = []string{level.PriceText, level.VolumeText}
+	}
+	return orders
+}
+
+// okcoinStream is the protocol of the depth channel of the okcoin websocket
+type okcoinStream struct {
+	url   string
+	books map[string]*orderbook.Book
+}
+
+// okcoinMessage is a message of the okcoin websocket
+type okcoinMessage struct {
+	Event     string `json:"event"`
+	Message   string `json:"message"`
+	ErrorCode int    `json:"errorCode"`
+	Table     string `json:"table"`
+	// Action is `partial` for the snapshot and `update` for the deltas
+	Action string              `json:"action"`
+	Data   []okcoinDepthUpdate `json:"data"`
+}
+
+// okcoinDepthUpdate contains the levels as [price, size, number of orders]
+type okcoinDepthUpdate struct {
+	InstrumentID string     `json:"instrument_id"`
+	Asks         [][]string `json:"asks"`
+	Bids         [][]string `json:"bids"`
+	Timestamp    time.Time  `json:"timestamp"`
+	Checksum     int32      `json:"checksum"`
+}
+
+func (h *okcoinStream) URL() string {
+	return h.url
+}
+
+func (h *okcoinStream) Reset() {
+	h.books = make(map[string]*orderbook.Book)
+}
+
+// Ping return the keep alive message, answered with `pong`
+func (h *okcoinStream) Ping() ([]byte, time.Duration) {
+	return []byte("ping"), OKCOIN_PING_INTERVAL
+}
+
+func (h *okcoinStream) Subscribe(conn *websocket.Conn, pairs []string) error {
+	args := make([]string, len(pairs))
+	for i := range pairs {
+		args[i] = "spot/depth:" + pairs[i]
+	}
+	data, err := json.Marshal(map[string]interface{}{"op": "subscribe", "args": args})
+	if err != nil {
+		return err
+	}
+	return conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (h *okcoinStream) Handle(opcode int, message []byte) ([]*orderbook.Book, error) {
+	// The messages are compressed with deflate
+	if opcode == websocket.BinaryMessage {
+		reader := flate.NewReader(bytes.NewReader(message))
+		data, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, err
+		}
+		message = data
+	}
+	if string(message) == "pong" {
+		return nil, nil
+	}
+
+	var data okcoinMessage
+	if err := json.Unmarshal(message, &data); err != nil {
+		return nil, err
+	}
+	if data.Event == "error" {
+		zap.S().Warnf("OkCoin subscription failed: %d %s", data.ErrorCode, data.Message)
+		return nil, nil
+	}
+	if data.Table != "spot/depth" {
+		return nil, nil
+	}
+
+	var books []*orderbook.Book
+	for _, update := range data.Data {
+		book, ok := h.books[update.InstrumentID]
+		if data.Action == "partial" {
+			book = orderbook.New(update.InstrumentID)
+			h.books[update.InstrumentID] = book
+		} else if !ok {
+			// Update received before the snapshot
+			return nil, errors.New("SNAPSHOT_NOT_RECEIVED")
+		}
+		bids, err := okcoinLevels(update.Bids)
+		if err != nil {
+			return nil, err
+		}
+		asks, err := okcoinLevels(update.Asks)
+		if err != nil {
+			return nil, err
+		}
+		for _, level := range bids {
+			book.SetBid(level)
+		}
+		for _, level := range asks {
+			book.SetAsk(level)
+		}
+		book.Time = update.Timestamp
+		if update.Checksum != stream.InterleavedChecksum(book, OKCOIN_CHECKSUM_DEPTH) {
+			return nil, stream.ErrChecksum
+		}
+		books = append(books, book)
+	}
+	return books, nil
+}
+
+// okcoinLevels is delegated to parse the levels [price, size, number of orders]
+func okcoinLevels(data [][]string) ([]orderbook.Level, error) {
+	levels := make([]orderbook.Level, 0, len(data))
+	for _, l := range data {
+		if len(l) < 2 {
+			return nil, errors.New("UNEXPECTED_LEVEL")
+		}
+		level, err := orderbook.ParseLevel(l[0], l[1])
+		if err != nil {
+			return nil, err
+		}
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
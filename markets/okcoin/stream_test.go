@@ -0,0 +1,126 @@
+package okcoin
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"github.com/alessiosavi/GoArbitrage/markets/fakeserver"
+	"github.com/alessiosavi/GoArbitrage/network/websocket"
+)
+
+// deflate is delegated to compress the message as sent by okcoin
+func deflate(t *testing.T, message []byte) []byte {
+	var buf bytes.Buffer
+	writer, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Write(message)
+	writer.Close()
+	return buf.Bytes()
+}
+
+func Test_Stream(t *testing.T) {
+	type TestCase struct {
+		Bids   []market.MarketOrder
+		Asks   []market.MarketOrder
+		Number int
+	}
+
+	messages, err := fakeserver.LoadMessages("OKCOIN", "stream.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The sign of the checksum is inverted
+	corrupted := bytes.Replace(messages[2], []byte(`"checksum":`), []byte(`"checksum":-`), 1)
+	server := fakeserver.NewStream(func(conn *fakeserver.StreamConn, n int) {
+		if _, err := conn.Read(); err != nil {
+			return
+		}
+		sent := messages
+		if n == 0 {
+			// The update with a wrong checksum force a new subscription
+			sent = [][]byte{messages[0], messages[1], corrupted}
+		}
+		for _, message := range sent {
+			conn.WriteMessage(websocket.BinaryMessage, deflate(t, message))
+		}
+		// Answer to the keep alive
+		conn.Send([]byte("pong"))
+		conn.Wait()
+	})
+	defer server.Close()
+
+	o := &OkCoin{Depth: 2}
+	o.SetStreamURL(server.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := make(chan markets.Update, 16)
+	done := make(chan error)
+	go func() { done <- o.Stream(ctx, []string{"BTC-USD"}, updates) }()
+
+	// 1 snapshot before the checksum error, the snapshot and 1 update after the new subscription
+	for i := 0; i < 3; i++ {
+		select {
+		case update := <-updates:
+			if update.Market != o.Name() || update.Pair != "BTC-USD" || update.Symbol != market.NewSymbol("btc", "usd") {
+				t.Errorf("Received %v, expected an update of %s [test n. %d]", update, "BTC-USD", 1)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Received %d updates, expected 3", i)
+		}
+	}
+	if !o.Streaming("BTC-USD") {
+		t.Errorf("Expected the pair in streaming [test n. %d]", 2)
+	}
+	c := TestCase{
+		Bids:   []market.MarketOrder{{Price: 9099.9, Volume: 1.1}, {Price: 9099.2, Volume: 2}},
+		Asks:   []market.MarketOrder{{Price: 9100.3, Volume: 0.9}, {Price: 9100.5, Volume: 1.2}},
+		Number: 3,
+	}
+	m, err := o.GetMarketData("BTC-USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalOrders(m.Bids["BTC-USD"], c.Bids) || !equalOrders(m.Asks["BTC-USD"], c.Asks) {
+		t.Errorf("Received %v/%v, expected %v/%v [test n. %d]", m.Bids["BTC-USD"], m.Asks["BTC-USD"], c.Bids, c.Asks, c.Number)
+	}
+	// The checksum of the valid messages match
+	if server.Connections() != 2 {
+		t.Errorf("Received %d connections, expected %d [test n. %d]", server.Connections(), 2, 4)
+	}
+	if subscription := `{"args":["spot/depth:BTC-USD"],"op":"subscribe"}`; server.Received(1)[0] != subscription {
+		t.Errorf("Received %s, expected %s [test n. %d]", server.Received(1)[0], subscription, 5)
+	}
+	o.mutex.RLock()
+	timestamp := o.OrderBook["BTC-USD"].Timestamp
+	o.mutex.RUnlock()
+	if expected := time.Date(2020, 4, 9, 15, 21, 41, 456e6, time.UTC); !timestamp.Equal(expected) {
+		t.Errorf("Received %v, expected %v [test n. %d]", timestamp, expected, 6)
+	}
+
+	cancel()
+	if err = <-done; err != context.Canceled {
+		t.Errorf("Received %v, expected %v [test n. %d]", err, context.Canceled, 7)
+	}
+	if o.Streaming("BTC-USD") {
+		t.Errorf("Expected the pair not in streaming after the stop [test n. %d]", 8)
+	}
+}
+
+func equalOrders(a, b []market.MarketOrder) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Price != b[i].Price || a[i].Volume != b[i].Volume {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,146 @@
+package okcoin
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	datastructure "github.com/alessiosavi/GoArbitrage/datastructure/okcoin"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"go.uber.org/zap"
+)
+
+// OKCOIN_TIMESTAMP_FORMAT is the format of the timestamp used in the signature (ISO 8601 with milliseconds)
+const OKCOIN_TIMESTAMP_FORMAT = "2006-01-02T15:04:05.000Z"
+
+// OKCOIN_ORDER_NOT_FOUND is the error code returned for the unknown orders
+const OKCOIN_ORDER_NOT_FOUND = 33014
+
+// okcoinOrderStates map the state of the orders to the standard states
+var okcoinOrderStates = map[string]markets.OrderState{"-2": markets.Canceled, "-1": markets.Canceled, "0": markets.Open,
+	"1": markets.Open, "2": markets.Closed, "3": markets.Open, "4": markets.Open}
+
+// SetCredentials is delegated to set the API key (with the passphrase) used for sign the requests of the private API
+func (o *OkCoin) SetCredentials(credentials markets.Credentials) {
+	o.credentials = credentials
+}
+
+// okcoinSign is delegated to compute the OK-ACCESS-SIGN header: the HMAC-SHA256 (base64) of the timestamp, the
+// method, the path (with the query) and the body
+func okcoinSign(secret, timestamp, method, requestPath, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + method + requestPath + body))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// private is delegated to send a signed request to the given path of the private API, decoding the result
+func (o *OkCoin) private(ctx context.Context, method, requestPath string, params interface{}, result interface{}) error {
+	if o.credentials.Key == "" || o.credentials.Secret == "" || o.credentials.Passphrase == "" {
+		return markets.ErrMissingCredentials
+	}
+	var body []byte
+	if params != nil {
+		var err error
+		if body, err = json.Marshal(params); err != nil {
+			return err
+		}
+	}
+	timestamp := time.Now().UTC().Format(OKCOIN_TIMESTAMP_FORMAT)
+	header := http.Header{"OK-ACCESS-KEY": {o.credentials.Key}, "OK-ACCESS-SIGN": {okcoinSign(o.credentials.Secret, timestamp, method, requestPath, string(body))},
+		"OK-ACCESS-TIMESTAMP": {timestamp}, "OK-ACCESS-PASSPHRASE": {o.credentials.Passphrase}, "Content-Type": {"application/json"}}
+	resp := o.getClient().Send(ctx, method, o.url(OKCOIN_API+requestPath), header, body)
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if resp.StatusCode != 200 {
+		var e datastructure.OkCoinError
+		if json.Unmarshal(resp.Body, &e) == nil && e.Code != 0 {
+			if e.Code == OKCOIN_ORDER_NOT_FOUND {
+				return markets.ErrOrderNotFound
+			}
+			return errors.New(strconv.Itoa(e.Code) + ": " + e.Message)
+		}
+		zap.S().Warnw("Received a non 200 status code: " + strconv.Itoa(resp.StatusCode))
+		return errors.New("NOT_200_HTTP_STATUS")
+	}
+	return json.Unmarshal(resp.Body, result)
+}
+
+// orderResult is delegated to verify the result of the placement or of the cancellation of an order
+func orderResult(result datastructure.OkCoinOrderResult) error {
+	if !result.Result {
+		if code, _ := strconv.Atoi(result.ErrorCode); code == OKCOIN_ORDER_NOT_FOUND {
+			return markets.ErrOrderNotFound
+		}
+		return errors.New(result.ErrorCode + ": " + result.ErrorMessage)
+	}
+	return nil
+}
+
+// PlaceOrder is delegated to place the given limit order, returning the id of the order. The size and the price are
+// rounded to the size increment and the tick size of the instrument
+func (o *OkCoin) PlaceOrder(ctx context.Context, order markets.Order) (string, error) {
+	order = markets.RoundOrder(order, o.Constraint(o.EncodeSymbol(order.Symbol)))
+	params := map[string]string{"type": "limit", "side": string(order.Side), "instrument_id": o.EncodeSymbol(order.Symbol),
+		"size": markets.FormatFloat(order.Volume), "price": markets.FormatFloat(order.Price)}
+	var result datastructure.OkCoinOrderResult
+	if err := o.private(ctx, "POST", "/api/spot/v3/orders", params, &result); err != nil {
+		return "", err
+	}
+	if err := orderResult(result); err != nil {
+		return "", err
+	}
+	return result.OrderID, nil
+}
+
+// GetOrder is delegated to retrieve the state of the order with the given id
+func (o *OkCoin) GetOrder(ctx context.Context, symbol market.Symbol, id string) (markets.OrderStatus, error) {
+	requestPath := "/api/spot/v3/orders/" + url.PathEscape(id) + "?instrument_id=" + url.QueryEscape(o.EncodeSymbol(symbol))
+	var result datastructure.OkCoinOrderStatus
+	if err := o.private(ctx, "GET", requestPath, nil, &result); err != nil {
+		return markets.OrderStatus{}, err
+	}
+	status := markets.OrderStatus{ID: result.OrderID, Symbol: symbol, Side: markets.Side(strings.ToLower(result.Side)), State: okcoinOrderStates[result.State]}
+	status.Price, _ = strconv.ParseFloat(result.Price, 64)
+	status.Volume, _ = strconv.ParseFloat(result.Size, 64)
+	status.Filled, _ = strconv.ParseFloat(result.FilledSize, 64)
+	status.AveragePrice, _ = strconv.ParseFloat(result.PriceAvg, 64)
+	return status, nil
+}
+
+// CancelOrder is delegated to cancel the order with the given id
+func (o *OkCoin) CancelOrder(ctx context.Context, symbol market.Symbol, id string) error {
+	var result datastructure.OkCoinOrderResult
+	params := map[string]string{"instrument_id": o.EncodeSymbol(symbol)}
+	if err := o.private(ctx, "POST", "/api/spot/v3/cancel_orders/"+url.PathEscape(id), params, &result); err != nil {
+		return err
+	}
+	return orderResult(result)
+}
+
+// GetBalances is delegated to retrieve the available balance (without the amount held by the open orders) of the
+// spot account
+func (o *OkCoin) GetBalances(ctx context.Context) (map[string]float64, error) {
+	var result []datastructure.OkCoinAccount
+	if err := o.private(ctx, "GET", "/api/spot/v3/accounts", nil, &result); err != nil {
+		return nil, err
+	}
+	balances := make(map[string]float64, len(result))
+	for _, account := range result {
+		balance, err := strconv.ParseFloat(account.Available, 64)
+		if err != nil {
+			return nil, err
+		}
+		balances[strings.ToLower(account.Currency)] = balance
+	}
+	return balances, nil
+}
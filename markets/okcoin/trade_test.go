@@ -0,0 +1,98 @@
+package okcoin
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	datastructure "github.com/alessiosavi/GoArbitrage/datastructure/okcoin"
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"github.com/alessiosavi/GoArbitrage/markets/fakeserver"
+	"github.com/alessiosavi/GoArbitrage/network"
+)
+
+const testSecret = "okcoin-secret"
+
+// verifyOkCoin is the verification of the signature done by the server
+func verifyOkCoin(r *http.Request, body []byte) error {
+	if r.Header.Get("OK-ACCESS-KEY") != "key" || r.Header.Get("OK-ACCESS-PASSPHRASE") != "passphrase" {
+		return errors.New("invalid key")
+	}
+	timestamp := r.Header.Get("OK-ACCESS-TIMESTAMP")
+	if _, err := time.Parse(time.RFC3339Nano, timestamp); err != nil {
+		return errors.New("invalid timestamp")
+	}
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write([]byte(timestamp + r.Method + r.URL.RequestURI() + string(body)))
+	if r.Header.Get("OK-ACCESS-SIGN") != base64.StdEncoding.EncodeToString(mac.Sum(nil)) {
+		return errors.New("invalid sign")
+	}
+	return nil
+}
+
+func Test_OkCoinTrade(t *testing.T) {
+	server := fakeserver.New()
+	defer server.Close()
+	server.SetVerifier(verifyOkCoin)
+	server.Handle("/api/spot/v3/orders", fakeserver.Response{StatusCode: 200,
+		Body: []byte(`{"order_id":"2510789768709120","client_oid":"","result":true,"error_code":"","error_message":""}`)})
+	server.Handle("/api/spot/v3/orders/2510789768709120", fakeserver.Response{StatusCode: 200,
+		Body: []byte(`{"order_id":"2510789768709120","instrument_id":"BTC-USD","side":"sell","price":"37500","size":"1.25","filled_size":"1.25","price_avg":"37510","state":"2"}`)})
+	server.Handle("/api/spot/v3/cancel_orders/2510789768709120", fakeserver.Response{StatusCode: 400,
+		Body: []byte(`{"code":33014,"message":"Order does not exist"}`)})
+	server.Handle("/api/spot/v3/accounts", fakeserver.Response{StatusCode: 200,
+		Body: []byte(`[{"currency":"BTC","balance":"1.5","hold":"0.25","available":"1.25"},{"currency":"USD","balance":"100.25","hold":"10","available":"90.25"}]`)})
+
+	var o OkCoin
+	o.Init()
+	o.SetBaseURL(server.URL)
+	o.SetHTTPClient(server.Client())
+	// The rate limit of the market is not tested here
+	o.client.Limiter = network.NewLimiter(1000, 1000)
+	ctx := context.Background()
+	symbol := market.NewSymbol("btc", "usd")
+	// The passphrase is required
+	o.SetCredentials(markets.Credentials{Key: "key", Secret: testSecret})
+	if _, err := o.GetBalances(ctx); err != markets.ErrMissingCredentials {
+		t.Errorf("Received %v, expected %v [test n. %d]", err, markets.ErrMissingCredentials, 1)
+	}
+
+	o.SetCredentials(markets.Credentials{Key: "key", Secret: testSecret, Passphrase: "passphrase"})
+	// The size and the price are rounded down to the increments of the instrument
+	o.Pairs["BTC-USD"] = datastructure.OkCoinPairs{Pair: "BTC-USD", SizeIncrement: "0.0001", TickSize: "0.01"}
+	id, err := o.PlaceOrder(ctx, markets.Order{Symbol: symbol, Side: markets.Sell, Price: 37500.009, Volume: 1.25009})
+	if err != nil || id != "2510789768709120" {
+		t.Errorf("Received %s (%v), expected %s [test n. %d]", id, err, "2510789768709120", 2)
+	}
+	var params map[string]string
+	if json.Unmarshal([]byte(server.Bodies()[0]), &params); params["instrument_id"] != "BTC-USD" || params["side"] != "sell" || params["size"] != "1.25" || params["price"] != "37500" {
+		t.Errorf("Received %v, expected the parameters of the order [test n. %d]", params, 3)
+	}
+	status, err := o.GetOrder(ctx, symbol, id)
+	expected := markets.OrderStatus{ID: id, Symbol: symbol, Side: markets.Sell, Price: 37500, Volume: 1.25, Filled: 1.25, AveragePrice: 37510, State: markets.Closed}
+	if err != nil || status != expected {
+		t.Errorf("Received %+v (%v), expected %+v [test n. %d]", status, err, expected, 4)
+	}
+	if requests := server.Requests(); requests[1] != "/api/spot/v3/orders/2510789768709120?instrument_id=BTC-USD" {
+		t.Errorf("Received %s, expected the instrument in the query [test n. %d]", requests[1], 5)
+	}
+	if err = o.CancelOrder(ctx, symbol, id); err != markets.ErrOrderNotFound {
+		t.Errorf("Received %v, expected %v [test n. %d]", err, markets.ErrOrderNotFound, 6)
+	}
+	balances, err := o.GetBalances(ctx)
+	if err != nil || len(balances) != 2 || balances["btc"] != 1.25 || balances["usd"] != 90.25 {
+		t.Errorf("Received %v (%v), expected the available balances [test n. %d]", balances, err, 7)
+	}
+
+	o.SetCredentials(markets.Credentials{Key: "key", Secret: "wrong", Passphrase: "passphrase"})
+	if _, err = o.GetBalances(ctx); err == nil {
+		t.Errorf("Expected an error for an invalid signature [test n. %d]", 8)
+	}
+}
@@ -0,0 +1,219 @@
+// Package stream contains the loop that keep the subscription of the order books to the websocket of the markets
+// alive, reconnecting and subscribing again when the connection is lost or the book is corrupted
+package stream
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alessiosavi/GoArbitrage/markets"
+	"github.com/alessiosavi/GoArbitrage/network"
+	"github.com/alessiosavi/GoArbitrage/network/websocket"
+	"github.com/alessiosavi/GoArbitrage/orderbook"
+	"go.uber.org/zap"
+)
+
+// DEFAULT_TIMEOUT is the max time without messages before considering the connection lost.
+// All the markets send an heartbeat (or answer to the ping) more frequently
+const DEFAULT_TIMEOUT = 60 * time.Second
+
+// ErrChecksum is returned by the handlers when the checksum of the book does not match the one sent by the market
+var ErrChecksum = errors.New("CHECKSUM_MISMATCH")
+
+// Handler is the protocol of the websocket of a market
+type Handler interface {
+	// URL return the url of the websocket
+	URL() string
+	// Subscribe is delegated to send the subscription of the order books of the given pairs
+	Subscribe(conn *websocket.Conn, pairs []string) error
+	// Handle is delegated to apply the given message to the order books, returning the books updated.
+	// An error (e.g. ErrChecksum) force the reconnection, so a new snapshot is received
+	Handle(opcode int, message []byte) ([]*orderbook.Book, error)
+	// Reset is delegated to discard the order books, called when the connection is lost
+	Reset()
+}
+
+// KeepAlive is implemented by the handlers of the markets that close the connection without a periodic message
+type KeepAlive interface {
+	// Ping return the message to send and the interval between the messages
+	Ping() ([]byte, time.Duration)
+}
+
+// Stream is delegated to keep the websocket of a market connected and the order books updated
+type Stream struct {
+	// Name is the name of the market, used for the logs
+	Name    string
+	Handler Handler
+	// Retry is the policy used for wait between the reconnections
+	Retry network.RetryPolicy
+	// Timeout is the max time without messages before reconnecting
+	Timeout time.Duration
+	// OnUpdate is called with every book updated, by the goroutine that read the messages
+	OnUpdate func(book *orderbook.Book)
+	// OnReset is called when the connection is lost, the books are not updated until the next snapshot
+	OnReset func()
+	dial    func(ctx context.Context, url string) (*websocket.Conn, error)
+}
+
+// New is delegated to initialize a stream for the given market
+func New(name string, handler Handler) *Stream {
+	return &Stream{Name: name, Handler: handler, Retry: network.DefaultRetryPolicy, Timeout: DEFAULT_TIMEOUT,
+		dial: func(ctx context.Context, url string) (*websocket.Conn, error) { return websocket.Dial(ctx, url, nil) }}
+}
+
+// Run is delegated to subscribe the given pairs and apply the messages until the context is done.
+// The connection is opened again, with an exponential backoff, every time that it is lost
+func (s *Stream) Run(ctx context.Context, pairs []string) error {
+	var attempt int
+	for {
+		received, err := s.session(ctx, pairs)
+		s.Handler.Reset()
+		if s.OnReset != nil {
+			s.OnReset()
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// The backoff is restarted after a working connection
+		if received {
+			attempt = 0
+		}
+		delay := s.Retry.Backoff(attempt)
+		attempt++
+		zap.S().Warnf("Stream of %s interrupted: %s. Reconnecting in %v", s.Name, err.Error(), delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// session is delegated to open the connection, subscribe the pairs and read the messages until an error.
+// The returned flag is true if at least a book was updated
+func (s *Stream) session(ctx context.Context, pairs []string) (bool, error) {
+	conn, err := s.dial(ctx, s.Handler.URL())
+	if err != nil {
+		return false, err
+	}
+	// The read is interrupted by closing the connection
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		conn.Close()
+	}()
+	if err = s.Handler.Subscribe(conn, pairs); err != nil {
+		return false, err
+	}
+	if keepAlive, ok := s.Handler.(KeepAlive); ok {
+		go s.ping(conn, keepAlive, done)
+	}
+
+	var received bool
+	for {
+		conn.SetReadDeadline(time.Now().Add(s.Timeout))
+		opcode, message, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return received, ctx.Err()
+			}
+			return received, err
+		}
+		books, err := s.Handler.Handle(opcode, message)
+		if err != nil {
+			return received, err
+		}
+		for _, book := range books {
+			received = true
+			if s.OnUpdate != nil {
+				s.OnUpdate(book)
+			}
+		}
+	}
+}
+
+// ping is delegated to send the keep alive message until the session is closed
+func (s *Stream) ping(conn *websocket.Conn, keepAlive KeepAlive, done <-chan struct{}) {
+	message, interval := keepAlive.Ping()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// InterleavedChecksum is delegated to compute the checksum used by bitfinex and okcoin: the CRC32 (signed) of the
+// first depth bids and asks, interleaved, in the format `bid price:bid volume:ask price:ask volume:...`, using the
+// values as sent by the market
+func InterleavedChecksum(book *orderbook.Book, depth int) int32 {
+	bids, asks := book.Bids(depth), book.Asks(depth)
+	values := make([]string, 0, 4*depth)
+	for i := 0; i < depth; i++ {
+		if i < len(bids) {
+			values = append(values, bids[i].PriceText, bids[i].VolumeText)
+		}
+		if i < len(asks) {
+			values = append(values, asks[i].PriceText, asks[i].VolumeText)
+		}
+	}
+	return int32(crc32.ChecksumIEEE([]byte(strings.Join(values, ":"))))
+}
+
+// Status keep track of the pairs whose order book is synchronized with the stream
+type Status struct {
+	mutex sync.RWMutex
+	pairs map[string]bool
+}
+
+// Set is delegated to mark the given pair as synchronized
+func (s *Status) Set(pair string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.pairs == nil {
+		s.pairs = make(map[string]bool)
+	}
+	s.pairs[pair] = true
+}
+
+// Reset is delegated to mark all the pairs as not synchronized, called when the connection is lost
+func (s *Status) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pairs = nil
+}
+
+// Streaming return true if the order book of the given pair is synchronized
+func (s *Status) Streaming(pair string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.pairs[pair]
+}
+
+// Notify is delegated to send the update without blocking the stream, the update is dropped if the channel is full
+func Notify(updates chan<- markets.Update, update markets.Update) {
+	if updates == nil {
+		return
+	}
+	select {
+	case updates <- update:
+	default:
+		zap.S().Debugf("Update of %s %s dropped, channel full", update.Market, update.Pair)
+	}
+}
@@ -0,0 +1,135 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alessiosavi/GoArbitrage/markets/fakeserver"
+	"github.com/alessiosavi/GoArbitrage/network"
+	"github.com/alessiosavi/GoArbitrage/network/websocket"
+	"github.com/alessiosavi/GoArbitrage/orderbook"
+)
+
+func equal(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// echoHandler is a simple protocol: every message is a bid level, the message `corrupted` simulate a checksum error
+type echoHandler struct {
+	url   string
+	books map[string]*orderbook.Book
+}
+
+func (h *echoHandler) URL() string { return h.url }
+func (h *echoHandler) Reset()      { h.books = make(map[string]*orderbook.Book) }
+func (h *echoHandler) Subscribe(conn *websocket.Conn, pairs []string) error {
+	data, _ := json.Marshal(pairs)
+	return conn.WriteMessage(websocket.TextMessage, data)
+}
+func (h *echoHandler) Handle(opcode int, message []byte) ([]*orderbook.Book, error) {
+	if string(message) == "corrupted" {
+		return nil, ErrChecksum
+	}
+	var update struct{ Pair, Price, Volume string }
+	if err := json.Unmarshal(message, &update); err != nil {
+		return nil, err
+	}
+	book, ok := h.books[update.Pair]
+	if !ok {
+		book = orderbook.New(update.Pair)
+		h.books[update.Pair] = book
+	}
+	level, err := orderbook.ParseLevel(update.Price, update.Volume)
+	if err != nil {
+		return nil, err
+	}
+	book.SetBid(level)
+	return []*orderbook.Book{book}, nil
+}
+
+func Test_Run(t *testing.T) {
+	server := fakeserver.NewStream(func(conn *fakeserver.StreamConn, n int) {
+		if _, err := conn.Read(); err != nil {
+			return
+		}
+		switch n {
+		case 0:
+			conn.Send([]byte(`{"Pair":"btcusd","Price":"100","Volume":"1"}`), []byte("corrupted"))
+		case 1:
+			// The connection is closed by the server
+			conn.Send([]byte(`{"Pair":"btcusd","Price":"101","Volume":"1"}`))
+			return
+		default:
+			conn.Send([]byte(`{"Pair":"ethusd","Price":"10","Volume":"1"}`))
+		}
+		conn.Wait()
+	})
+	defer server.Close()
+
+	var mutex sync.Mutex
+	var updates []float64
+	var resets int
+	ctx, cancel := context.WithCancel(context.Background())
+	s := New("FAKE", &echoHandler{url: server.URL, books: make(map[string]*orderbook.Book)})
+	s.Retry = network.RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+	s.OnUpdate = func(book *orderbook.Book) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		updates = append(updates, book.Bids(1)[0].Price)
+		if len(updates) == 3 {
+			cancel()
+		}
+	}
+	s.OnReset = func() {
+		mutex.Lock()
+		resets++
+		mutex.Unlock()
+	}
+
+	if err := s.Run(ctx, []string{"btcusd", "ethusd"}); err != context.Canceled {
+		t.Errorf("Received %v, expected %v", err, context.Canceled)
+	}
+	// The book of the previous connection is discarded, the checksum error and the close force a new subscription
+	if expected := []float64{100, 101, 10}; !equal(updates, expected) {
+		t.Errorf("Received %v, expected %v [test n. %d]", updates, expected, 1)
+	}
+	if resets != 3 || server.Connections() != 3 {
+		t.Errorf("Received %d resets and %d connections, expected 3 [test n. %d]", resets, server.Connections(), 2)
+	}
+	for n := 0; n < 3; n++ {
+		if received := server.Received(n); len(received) == 0 || received[0] != `["btcusd","ethusd"]` {
+			t.Errorf("Received %v, expected the subscription [test n. %d]", received, 3+n)
+		}
+	}
+}
+
+func Test_RunTimeout(t *testing.T) {
+	// The server does not send any message after the subscription
+	server := fakeserver.NewStream(func(conn *fakeserver.StreamConn, n int) {
+		conn.Wait()
+	})
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	s := New("FAKE", &echoHandler{url: server.URL, books: make(map[string]*orderbook.Book)})
+	s.Retry = network.RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	s.Timeout = 20 * time.Millisecond
+	if err := s.Run(ctx, []string{"btcusd"}); err != context.DeadlineExceeded {
+		t.Errorf("Received %v, expected %v", err, context.DeadlineExceeded)
+	}
+	if server.Connections() < 2 {
+		t.Errorf("Received %d connections, expected a reconnection after the timeout", server.Connections())
+	}
+}
@@ -0,0 +1,133 @@
+package markets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+)
+
+// ErrMissingCredentials is returned by the private API when the credentials of the market are not set
+var ErrMissingCredentials = errors.New("MISSING_CREDENTIALS")
+
+// ErrOrderNotFound is returned when the market does not know the requested order
+var ErrOrderNotFound = errors.New("ORDER_NOT_FOUND")
+
+// Credentials contains the API key of a market. Passphrase is required only by okcoin
+type Credentials struct {
+	Key        string `json:"key"`
+	Secret     string `json:"secret"`
+	Passphrase string `json:"passphrase"`
+}
+
+// Side is the side of the order, referred to the base currency of the pair
+type Side string
+
+const (
+	Buy  Side = "buy"
+	Sell Side = "sell"
+)
+
+// OrderState is the state of an order placed in a market
+type OrderState string
+
+const (
+	// Open means that the order is in the order book, it can be partially filled
+	Open OrderState = "open"
+	// Closed means that the order is completely filled
+	Closed OrderState = "closed"
+	// Canceled means that the order was removed from the order book, it can be partially filled
+	Canceled OrderState = "canceled"
+)
+
+// Order is a limit order to place in a market
+type Order struct {
+	Symbol market.Symbol
+	Side   Side
+	Price  float64
+	Volume float64
+}
+
+// OrderStatus contains the state of an order as reported by the market
+type OrderStatus struct {
+	ID     string        `json:"id"`
+	Symbol market.Symbol `json:"symbol"`
+	Side   Side          `json:"side"`
+	Price  float64       `json:"price"`
+	Volume float64       `json:"volume"`
+	// Filled is the volume executed, AveragePrice the average price of the executions
+	Filled       float64    `json:"filled"`
+	AveragePrice float64    `json:"average_price"`
+	State        OrderState `json:"state"`
+}
+
+// Trader is implemented by the markets that expose the private API, used for place the orders with the API key
+// of the account. The balances use the standard currencies (lowercase) as key
+type Trader interface {
+	// SetCredentials is delegated to set the API key used for sign the requests
+	SetCredentials(credentials Credentials)
+	// PlaceOrder is delegated to place the given limit order, returning the id assigned by the market
+	PlaceOrder(ctx context.Context, order Order) (string, error)
+	// GetOrder is delegated to retrieve the state of the order with the given id of the given symbol
+	GetOrder(ctx context.Context, symbol market.Symbol, id string) (OrderStatus, error)
+	// CancelOrder is delegated to cancel the order with the given id of the given symbol
+	CancelOrder(ctx context.Context, symbol market.Symbol, id string) error
+	// GetBalances is delegated to retrieve the currencies available for trade
+	GetBalances(ctx context.Context) (map[string]float64, error)
+}
+
+// LoadCredentials is delegated to load the credentials of the markets from the given json file, using the name of
+// the market as key, e.g.: {"KRAKEN": {"key": "...", "secret": "..."}}
+func LoadCredentials(filepath string) (map[string]Credentials, error) {
+	data, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	var file map[string]Credentials
+	if err = json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	var credentials = make(map[string]Credentials, len(file))
+	for name := range file {
+		credentials[strings.ToUpper(name)] = file[name]
+	}
+	return credentials, nil
+}
+
+var (
+	nonceMutex sync.Mutex
+	lastNonce  int64
+)
+
+// Nonce return an always increasing number, the current time in microseconds, used by the private API for refuse
+// the replayed requests. The requests signed in the same microsecond receive consecutive numbers
+func Nonce() int64 {
+	nonceMutex.Lock()
+	defer nonceMutex.Unlock()
+	nonce := time.Now().UnixNano() / int64(time.Microsecond)
+	if nonce <= lastNonce {
+		nonce = lastNonce + 1
+	}
+	lastNonce = nonce
+	return nonce
+}
+
+// RoundOrder is delegated to round the price and the volume of the order to the given constraint of the pair, as the
+// OrderValidator of the engine: the volume is rounded down, the buy price up and the sell price down
+func RoundOrder(order Order, constraint market.OrderConstraint) Order {
+	order.Volume = constraint.RoundVolume(order.Volume)
+	order.Price = constraint.RoundPrice(order.Price, order.Side == Buy)
+	return order
+}
+
+// FormatFloat is delegated to format the price and the volume of the orders, without exponent and trailing zeros.
+// The values have to be rounded with RoundOrder before, the market refuse the values not aligned to the increments
+func FormatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,247 @@
+// Package network contains the HTTP client shared by the requests of a market, that respect the rate limit of the
+// market and retry the requests failed for a temporary error
+package network
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/constants"
+	"github.com/alessiosavi/Requests/datastructure"
+	"go.uber.org/zap"
+)
+
+// Limiter is a token bucket rate limiter. Every request consume a token, the tokens are refilled at the given rate
+// up to the burst size
+type Limiter struct {
+	mutex sync.Mutex
+	// rate is the number of tokens added every second
+	rate float64
+	// burst is the max number of tokens that can be saved
+	burst float64
+	// tokens is the number of tokens available, a negative value means that there are requests waiting
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// NewLimiter is delegated to initialize a limiter that allow rate requests per second, with the given burst
+func NewLimiter(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{rate: rate, burst: float64(burst), tokens: float64(burst), now: time.Now}
+}
+
+// Wait is delegated to block until a token is available. If the context is done before, the token is released and
+// the error of the context is returned
+func (l *Limiter) Wait(ctx context.Context) error {
+	delay := l.reserve()
+	if delay <= 0 {
+		return nil
+	}
+	if err := sleep(ctx, delay); err != nil {
+		l.release()
+		return err
+	}
+	return nil
+}
+
+// release is delegated to give back a token not used
+func (l *Limiter) release() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.tokens++
+}
+
+// sleep is delegated to wait for the given time or until the context is done
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reserve is delegated to consume a token, returning the time to wait before that the token is available
+func (l *Limiter) reserve() time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 || l.rate <= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// RetryPolicy contains the number of retries and the exponential backoff applied to the failed requests
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// DefaultRetryPolicy is the retry policy used by the markets
+var DefaultRetryPolicy = RetryPolicy{MaxRetries: 3, BaseDelay: 500 * time.Millisecond, MaxDelay: 10 * time.Second}
+
+// Backoff is delegated to calculate the time to wait before the given retry (0 for the first retry)
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 0; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return delay
+}
+
+// IsRetryable return true if the request failed for a temporary error (network error, 429 or 5xx status code)
+func IsRetryable(resp *datastructure.Response) bool {
+	if resp.Error != nil {
+		return true
+	}
+	return resp.StatusCode == 429 || resp.StatusCode >= 500
+}
+
+// retryAfter is delegated to retrieve the delay (in seconds) requested by the server with the Retry-After header
+func retryAfter(resp *datastructure.Response) time.Duration {
+	for _, key := range []string{"Retry-After", "retry-after"} {
+		if value, ok := resp.Headers[key]; ok {
+			if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return 0
+}
+
+// Client is delegated to send the HTTP requests of a market, respecting its rate limit and retrying the requests
+// failed for a temporary error
+type Client struct {
+	Limiter *Limiter
+	Retry   RetryPolicy
+	// Timeout is the max time of a single request, the deadline of the context is used if it is earlier
+	Timeout time.Duration
+	// HTTPClient is the client used for execute the requests, http.DefaultClient is used if nil
+	HTTPClient *http.Client
+	// send is the function used for execute the request
+	send  func(ctx context.Context, url string) *datastructure.Response
+	sleep func(ctx context.Context, delay time.Duration) error
+}
+
+// NewClient is delegated to initialize a client with the given rate limit (requests per second and burst)
+func NewClient(rate float64, burst int) *Client {
+	c := &Client{Limiter: NewLimiter(rate, burst), Retry: DefaultRetryPolicy, Timeout: constants.TIMEOUT_REQ * time.Second, sleep: sleep}
+	c.send = c.sendRequest
+	return c
+}
+
+// sendRequest is delegated to execute a GET request for the given url, the request is cancelled with the context
+func (c *Client) sendRequest(ctx context.Context, url string) *datastructure.Response {
+	return c.request(ctx, "GET", url, nil, nil)
+}
+
+// request is delegated to execute a request with the given method, headers and body
+func (c *Client) request(ctx context.Context, method, url string, header http.Header, body []byte) *datastructure.Response {
+	var response datastructure.Response
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		response.Error = err
+		return &response
+	}
+	for key, values := range header {
+		for _, value := range values {
+			request.Header.Add(key, value)
+		}
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(request)
+	if err != nil {
+		response.Error = err
+		return &response
+	}
+	defer resp.Body.Close()
+	response.StatusCode = resp.StatusCode
+	response.Headers = make(map[string]string, len(resp.Header))
+	for key := range resp.Header {
+		response.Headers[key] = resp.Header.Get(key)
+	}
+	response.Body, response.Error = ioutil.ReadAll(resp.Body)
+	return &response
+}
+
+// Get is delegated to execute a GET request for the given url. The request wait for the rate limiter and is retried
+// with an exponential backoff in case of network error, 429 or 5xx status code.
+// The retries stop when the context is done, the error of the context is returned in the response
+func (c *Client) Get(ctx context.Context, url string) *datastructure.Response {
+	for attempt := 0; ; attempt++ {
+		if err := c.Limiter.Wait(ctx); err != nil {
+			return &datastructure.Response{Error: err}
+		}
+		resp := c.do(ctx, url)
+		if !IsRetryable(resp) || attempt >= c.Retry.MaxRetries || ctx.Err() != nil {
+			return resp
+		}
+		delay := c.Retry.Backoff(attempt)
+		if after := retryAfter(resp); after > delay {
+			delay = after
+		}
+		if resp.Error != nil {
+			zap.S().Warnf("Request to [%s] failed: %s. Retrying in %s", url, resp.Error.Error(), delay)
+		} else {
+			zap.S().Warnf("Request to [%s] received status code %d. Retrying in %s", url, resp.StatusCode, delay)
+		}
+		if err := c.sleep(ctx, delay); err != nil {
+			return &datastructure.Response{Error: err}
+		}
+	}
+}
+
+// do is delegated to execute a single request, limited by the timeout of the client
+func (c *Client) do(ctx context.Context, url string) *datastructure.Response {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	return c.send(ctx, url)
+}
+
+// Send is delegated to execute a request with the given method, headers and body (e.g. the signed requests of the
+// private API). The request wait for the rate limiter but it is never retried: an order could be placed twice
+func (c *Client) Send(ctx context.Context, method, url string, header http.Header, body []byte) *datastructure.Response {
+	if err := c.Limiter.Wait(ctx); err != nil {
+		return &datastructure.Response{Error: err}
+	}
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	return c.request(ctx, method, url, header, body)
+}
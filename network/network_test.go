@@ -0,0 +1,241 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alessiosavi/GoArbitrage/markets/fakeserver"
+	"github.com/alessiosavi/Requests/datastructure"
+)
+
+// fakeClock is used for control the time seen by the limiter
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func Test_Limiter(t *testing.T) {
+	type TestCase struct {
+		// Elapsed is the time passed before the request
+		Elapsed  time.Duration
+		Expected time.Duration
+		Number   int
+	}
+
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	l := NewLimiter(2, 2)
+	l.now = clock.Now
+
+	cases := []TestCase{
+		// The burst is available immediately
+		{Elapsed: 0, Expected: 0, Number: 1},
+		{Elapsed: 0, Expected: 0, Number: 2},
+		// Bucket empty, wait for the next token (2 per second)
+		{Elapsed: 0, Expected: 500 * time.Millisecond, Number: 3},
+		// The previous request is waiting, the next token is available after another 500ms
+		{Elapsed: 0, Expected: time.Second, Number: 4},
+		// After 10 seconds the bucket is refilled, but the tokens can not exceed the burst
+		{Elapsed: 10 * time.Second, Expected: 0, Number: 5},
+		{Elapsed: 0, Expected: 0, Number: 6},
+		{Elapsed: 250 * time.Millisecond, Expected: 250 * time.Millisecond, Number: 7},
+	}
+
+	for _, c := range cases {
+		clock.now = clock.now.Add(c.Elapsed)
+		if delay := l.reserve(); delay != c.Expected {
+			t.Errorf("Received %v, expected %v [test n. %d]", delay, c.Expected, c.Number)
+		}
+	}
+}
+
+func Test_Backoff(t *testing.T) {
+	type TestCase struct {
+		Attempt  int
+		Expected time.Duration
+		Number   int
+	}
+
+	p := RetryPolicy{MaxRetries: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	cases := []TestCase{
+		{Attempt: 0, Expected: 100 * time.Millisecond, Number: 1},
+		{Attempt: 1, Expected: 200 * time.Millisecond, Number: 2},
+		{Attempt: 3, Expected: 800 * time.Millisecond, Number: 3},
+		{Attempt: 4, Expected: time.Second, Number: 4},
+		{Attempt: 60, Expected: time.Second, Number: 5},
+	}
+
+	for _, c := range cases {
+		if delay := p.Backoff(c.Attempt); delay != c.Expected {
+			t.Errorf("Received %v, expected %v [test n. %d]", delay, c.Expected, c.Number)
+		}
+	}
+}
+
+func Test_Get(t *testing.T) {
+	type TestCase struct {
+		Responses []datastructure.Response
+		// Expected is the status code of the response returned
+		Expected int
+		Calls    int
+		Sleeps   []time.Duration
+		Number   int
+	}
+
+	ok := datastructure.Response{StatusCode: 200}
+	cases := []TestCase{
+		{Responses: []datastructure.Response{ok}, Expected: 200, Calls: 1, Number: 1},
+		// Client error are not retried
+		{Responses: []datastructure.Response{{StatusCode: 404}}, Expected: 404, Calls: 1, Number: 2},
+		// 5xx and network errors are retried with exponential backoff
+		{Responses: []datastructure.Response{{StatusCode: 502}, {Error: errors.New("timeout")}, ok}, Expected: 200, Calls: 3,
+			Sleeps: []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}, Number: 3},
+		// The Retry-After header is respected
+		{Responses: []datastructure.Response{{StatusCode: 429, Headers: map[string]string{"Retry-After": "3"}}, ok}, Expected: 200, Calls: 2,
+			Sleeps: []time.Duration{3 * time.Second}, Number: 4},
+		// Max retries reached, the last response is returned
+		{Responses: []datastructure.Response{{StatusCode: 500}, {StatusCode: 503}, {StatusCode: 500}, {StatusCode: 429}}, Expected: 429, Calls: 4,
+			Sleeps: []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond}, Number: 5},
+	}
+
+	for _, c := range cases {
+		var calls int
+		var sleeps []time.Duration
+		client := NewClient(1000, 1000)
+		client.Retry = RetryPolicy{MaxRetries: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+		client.sleep = func(ctx context.Context, d time.Duration) error {
+			sleeps = append(sleeps, d)
+			return nil
+		}
+		client.send = func(ctx context.Context, url string) *datastructure.Response {
+			resp := c.Responses[calls]
+			calls++
+			return &resp
+		}
+		resp := client.Get(context.Background(), "http://localhost")
+		if resp.StatusCode != c.Expected || calls != c.Calls {
+			t.Errorf("Received %d after %d calls, expected %d after %d calls [test n. %d]", resp.StatusCode, calls, c.Expected, c.Calls, c.Number)
+		}
+		if len(sleeps) != len(c.Sleeps) {
+			t.Errorf("Received %v, expected %v [test n. %d]", sleeps, c.Sleeps, c.Number)
+			continue
+		}
+		for i := range sleeps {
+			if sleeps[i] != c.Sleeps[i] {
+				t.Errorf("Received %v, expected %v [test n. %d]", sleeps, c.Sleeps, c.Number)
+				break
+			}
+		}
+	}
+}
+
+func Test_GetCancelled(t *testing.T) {
+	var calls int
+	client := NewClient(1, 1)
+	client.send = func(ctx context.Context, url string) *datastructure.Response {
+		calls++
+		return &datastructure.Response{StatusCode: 503}
+	}
+
+	// The bucket is empty, the request can not wait the next token
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	client.Limiter.reserve()
+	resp := client.Get(ctx, "http://localhost")
+	if resp.Error != context.DeadlineExceeded || calls != 0 {
+		t.Errorf("Received %v after %d calls, expected %v after 0 calls [test n. %d]", resp.Error, calls, context.DeadlineExceeded, 1)
+	}
+
+	// The backoff is interrupted by the context
+	client.Limiter = NewLimiter(1000, 1000)
+	ctx, cancel = context.WithCancel(context.Background())
+	client.sleep = func(ctx context.Context, d time.Duration) error {
+		cancel()
+		return sleep(ctx, d)
+	}
+	resp = client.Get(ctx, "http://localhost")
+	if resp.Error != context.Canceled || calls != 1 {
+		t.Errorf("Received %v after %d calls, expected %v after 1 calls [test n. %d]", resp.Error, calls, context.Canceled, 2)
+	}
+}
+
+func Test_WaitRelease(t *testing.T) {
+	l := NewLimiter(1, 1)
+	l.reserve()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.Wait(ctx); err != context.Canceled {
+		t.Errorf("Received %v, expected %v [test n. %d]", err, context.Canceled, 1)
+	}
+	// The token reserved by the cancelled wait is released
+	if l.tokens > 1e-3 || l.tokens < -1e-3 {
+		t.Errorf("Received %v, expected %v [test n. %d]", l.tokens, 0, 2)
+	}
+}
+
+func Test_SendRequest(t *testing.T) {
+	server := fakeserver.New()
+	defer server.Close()
+	server.Handle("/ok", fakeserver.Response{StatusCode: 200, Body: []byte(`{"result":[]}`)})
+	server.Handle("/busy", fakeserver.Response{StatusCode: 429, Headers: map[string]string{"Retry-After": "1"}})
+
+	type TestCase struct {
+		Path       string
+		StatusCode int
+		Body       string
+		Number     int
+	}
+	cases := []TestCase{
+		{Path: "/ok", StatusCode: 200, Body: `{"result":[]}`, Number: 1},
+		{Path: "/busy", StatusCode: 429, Number: 2},
+		{Path: "/unknown", StatusCode: 404, Body: "404 page not found\n", Number: 3},
+	}
+
+	client := NewClient(1000, 1000)
+	client.HTTPClient = server.Client()
+	for _, c := range cases {
+		resp := client.sendRequest(context.Background(), server.URL+c.Path)
+		if resp.Error != nil || resp.StatusCode != c.StatusCode || string(resp.Body) != c.Body {
+			t.Errorf("Received %d %q (%v), expected %d %q [test n. %d]", resp.StatusCode, resp.Body, resp.Error, c.StatusCode, c.Body, c.Number)
+		}
+	}
+	if retry := retryAfter(client.sendRequest(context.Background(), server.URL+"/busy")); retry != time.Second {
+		t.Errorf("Received %v, expected %v [test n. %d]", retry, time.Second, 4)
+	}
+}
+
+func Test_Send(t *testing.T) {
+	server := fakeserver.New()
+	defer server.Close()
+	server.Handle("/private", fakeserver.Response{StatusCode: 200, Body: []byte(`{"result":{}}`)})
+	server.Handle("/busy", fakeserver.Response{StatusCode: 503})
+	server.SetVerifier(func(r *http.Request, body []byte) error {
+		if r.Method != "POST" || r.Header.Get("API-Key") != "key" {
+			return errors.New("INVALID_KEY")
+		}
+		return nil
+	})
+
+	client := NewClient(1000, 1000)
+	client.HTTPClient = server.Client()
+	header := http.Header{"API-Key": []string{"key"}}
+	resp := client.Send(context.Background(), "POST", server.URL+"/private", header, []byte("nonce=1"))
+	if resp.Error != nil || resp.StatusCode != 200 || string(resp.Body) != `{"result":{}}` {
+		t.Errorf("Received %d %q (%v), expected %d [test n. %d]", resp.StatusCode, resp.Body, resp.Error, 200, 1)
+	}
+	if resp = client.Send(context.Background(), "POST", server.URL+"/private", nil, nil); resp.StatusCode != 401 {
+		t.Errorf("Received %d, expected %d [test n. %d]", resp.StatusCode, 401, 2)
+	}
+	// The requests of the private API are not retried
+	if resp = client.Send(context.Background(), "POST", server.URL+"/busy", header, nil); resp.StatusCode != 503 || len(server.Requests()) != 3 {
+		t.Errorf("Received %d after %d requests, expected %d after %d [test n. %d]", resp.StatusCode, len(server.Requests()), 503, 3, 3)
+	}
+	if bodies := server.Bodies(); bodies[0] != "nonce=1" || bodies[1] != "" {
+		t.Errorf("Received %q, expected the body of the requests [test n. %d]", bodies, 4)
+	}
+}
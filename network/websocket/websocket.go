@@ -0,0 +1,338 @@
+// Package websocket contains a minimal websocket (RFC 6455) implementation, used for receive the order books
+// streamed by the markets. Only the features needed by the market data feeds are supported: text and binary
+// messages, fragmentation, ping/pong and close. Extensions (e.g. permessage-deflate) are not negotiated
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The opcodes of the frames
+const (
+	ContinuationMessage = 0x0
+	TextMessage         = 0x1
+	BinaryMessage       = 0x2
+	CloseMessage        = 0x8
+	PingMessage         = 0x9
+	PongMessage         = 0xA
+)
+
+// MAX_MESSAGE_SIZE is the max size of a message (all the fragments), bigger messages close the connection
+const MAX_MESSAGE_SIZE = 16 << 20
+
+// acceptGUID is concatenated to the key of the handshake for compute the accept header
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// ErrClosed is returned when the peer close the connection
+var ErrClosed = errors.New("WEBSOCKET_CLOSED")
+
+// Conn is a websocket connection. The reads have to be done by a single goroutine, the writes are safe for
+// concurrent use
+type Conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	// client connections mask the frames sent, the server connections expect masked frames
+	client bool
+	mutex  sync.Mutex
+	closed bool
+}
+
+// Dial is delegated to open a websocket connection to the given url (ws:// or wss://)
+func Dial(ctx context.Context, rawURL string, header http.Header) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	switch u.Scheme {
+	case "ws":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+	case "wss":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		}
+	default:
+		return nil, errors.New("UNSUPPORTED_SCHEME")
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "wss" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err = tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	// The handshake is interrupted if the context is done
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	ws, err := handshake(conn, u, header)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return ws, nil
+}
+
+// handshake is delegated to send the upgrade request and validate the response of the server
+func handshake(conn net.Conn, u *url.URL, header http.Header) (*Conn, error) {
+	key, err := newKey()
+	if err != nil {
+		return nil, err
+	}
+	request := &http.Request{Method: "GET", URL: &url.URL{Path: u.Path, RawPath: u.RawPath, RawQuery: u.RawQuery},
+		Proto: "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1, Header: make(http.Header), Host: u.Host}
+	if request.URL.Path == "" {
+		request.URL.Path = "/"
+	}
+	for k, v := range header {
+		request.Header[k] = v
+	}
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Sec-WebSocket-Key", key)
+	request.Header.Set("Sec-WebSocket-Version", "13")
+	if err = request.Write(conn); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, request)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, errors.New("HANDSHAKE_STATUS_" + resp.Status)
+	}
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") || resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		return nil, errors.New("HANDSHAKE_INVALID_ACCEPT")
+	}
+	return &Conn{conn: conn, reader: reader, client: true}, nil
+}
+
+// Accept is delegated to upgrade the given HTTP request to a websocket connection (server side)
+func Accept(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || key == "" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+		http.Error(w, "websocket handshake expected", http.StatusBadRequest)
+		return nil, errors.New("HANDSHAKE_INVALID_REQUEST")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, errors.New("HIJACK_NOT_SUPPORTED")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	response := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err = conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Conn{conn: conn, reader: rw.Reader}, nil
+}
+
+// newKey return a random key for the handshake
+func newKey() (string, error) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// acceptKey return the value of the Sec-WebSocket-Accept header for the given key
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// ReadMessage is delegated to read the next data message, joining the fragments.
+// The ping are answered automatically, ErrClosed is returned when the peer close the connection
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	var opcode int
+	var message []byte
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch op {
+		case PingMessage:
+			if err = c.writeFrame(PongMessage, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			continue
+		case CloseMessage:
+			c.writeFrame(CloseMessage, payload)
+			c.conn.Close()
+			return 0, nil, ErrClosed
+		case ContinuationMessage:
+			if opcode == 0 {
+				return 0, nil, errors.New("UNEXPECTED_CONTINUATION")
+			}
+		case TextMessage, BinaryMessage:
+			if opcode != 0 {
+				return 0, nil, errors.New("UNEXPECTED_DATA_FRAME")
+			}
+			opcode = op
+		default:
+			return 0, nil, errors.New("UNKNOWN_OPCODE")
+		}
+		if len(message)+len(payload) > MAX_MESSAGE_SIZE {
+			return 0, nil, errors.New("MESSAGE_TOO_BIG")
+		}
+		message = append(message, payload...)
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+// readFrame is delegated to read a single frame, unmasking the payload
+func (c *Conn) readFrame() (bool, int, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	opcode := int(header[0] & 0x0F)
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if length > MAX_MESSAGE_SIZE {
+		return false, 0, nil, errors.New("MESSAGE_TOO_BIG")
+	}
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		maskBytes(mask, payload)
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteMessage is delegated to send the given message in a single frame
+func (c *Conn) WriteMessage(opcode int, data []byte) error {
+	return c.writeFrame(opcode, data)
+}
+
+// writeFrame is delegated to send a frame, the client frames are masked
+func (c *Conn) writeFrame(opcode int, payload []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	frame := make([]byte, 0, len(payload)+14)
+	frame = append(frame, 0x80|byte(opcode))
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	switch length := len(payload); {
+	case length < 126:
+		frame = append(frame, maskBit|byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, maskBit|126, byte(length>>8), byte(length))
+	default:
+		var extended [8]byte
+		binary.BigEndian.PutUint64(extended[:], uint64(length))
+		frame = append(frame, maskBit|127)
+		frame = append(frame, extended[:]...)
+	}
+	data := payload
+	if c.client {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		frame = append(frame, mask[:]...)
+		// The payload of the caller is not modified
+		data = append([]byte(nil), payload...)
+		maskBytes(mask, data)
+	}
+	frame = append(frame, data...)
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// maskBytes apply the mask to the data, the same operation is used for mask and unmask
+func maskBytes(mask [4]byte, data []byte) {
+	for i := range data {
+		data[i] ^= mask[i%4]
+	}
+}
+
+// SetReadDeadline is delegated to set the deadline of the reads, a zero value disable the deadline
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// Close is delegated to send the close frame and close the underlying connection
+func (c *Conn) Close() error {
+	c.writeFrame(CloseMessage, []byte{0x03, 0xE8})
+	c.mutex.Lock()
+	c.closed = true
+	c.mutex.Unlock()
+	return c.conn.Close()
+}
@@ -0,0 +1,147 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newServer start a websocket server that run the given handler for every connection
+func newServer(handler func(conn *Conn)) (*httptest.Server, string) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Accept(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handler(conn)
+	}))
+	return server, "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+}
+
+func Test_AcceptKey(t *testing.T) {
+	// Example of the RFC 6455
+	if key := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); key != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Received %s, expected %s", key, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=")
+	}
+}
+
+func Test_Echo(t *testing.T) {
+	type TestCase struct {
+		Opcode int
+		Data   []byte
+		Number int
+	}
+
+	server, url := newServer(func(conn *Conn) {
+		for {
+			opcode, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(opcode, data)
+		}
+	})
+	defer server.Close()
+
+	conn, err := Dial(context.Background(), url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	cases := []TestCase{
+		{Opcode: TextMessage, Data: []byte(`{"event":"subscribe"}`), Number: 1},
+		// 16 bit length
+		{Opcode: BinaryMessage, Data: bytes.Repeat([]byte{0xAB}, 300), Number: 2},
+		// 64 bit length
+		{Opcode: TextMessage, Data: bytes.Repeat([]byte("a"), 70000), Number: 3},
+		{Opcode: TextMessage, Data: []byte{}, Number: 4},
+	}
+	for _, c := range cases {
+		sent := append([]byte(nil), c.Data...)
+		if err = conn.WriteMessage(c.Opcode, c.Data); err != nil {
+			t.Fatal(err)
+		}
+		// The data of the caller are not masked
+		if !bytes.Equal(sent, c.Data) {
+			t.Errorf("Data modified by the write [test n. %d]", c.Number)
+		}
+		opcode, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opcode != c.Opcode || !bytes.Equal(data, c.Data) {
+			t.Errorf("Received %d %d bytes, expected %d %d bytes [test n. %d]", opcode, len(data), c.Opcode, len(c.Data), c.Number)
+		}
+	}
+}
+
+func Test_ControlFrames(t *testing.T) {
+	pong := make(chan []byte, 1)
+	server, url := newServer(func(conn *Conn) {
+		// Fragmented message with a ping between the fragments
+		conn.conn.Write([]byte{TextMessage, 3, 'a', 'b', 'c'})
+		conn.writeFrame(PingMessage, []byte("hb"))
+		conn.conn.Write([]byte{0x80 | ContinuationMessage, 3, 'd', 'e', 'f'})
+		_, opcode, payload, err := conn.readFrame()
+		if err == nil && opcode == PongMessage {
+			pong <- payload
+		}
+		conn.Close()
+	})
+	defer server.Close()
+
+	conn, err := Dial(context.Background(), url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opcode, data, err := conn.ReadMessage()
+	if err != nil || opcode != TextMessage || string(data) != "abcdef" {
+		t.Errorf("Received %d %q %v, expected %d %q [test n. %d]", opcode, data, err, TextMessage, "abcdef", 1)
+	}
+	select {
+	case payload := <-pong:
+		if string(payload) != "hb" {
+			t.Errorf("Received %q, expected %q [test n. %d]", payload, "hb", 2)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Pong not received [test n. %d]", 2)
+	}
+	if _, _, err = conn.ReadMessage(); err != ErrClosed {
+		t.Errorf("Received %v, expected %v [test n. %d]", err, ErrClosed, 3)
+	}
+	if err = conn.WriteMessage(TextMessage, []byte("closed")); err == nil {
+		t.Errorf("Expected an error writing on a closed connection [test n. %d]", 4)
+	}
+}
+
+func Test_DialErrors(t *testing.T) {
+	// Plain HTTP server, the upgrade is refused
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	if _, err := Dial(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http"), nil); err == nil {
+		t.Errorf("Expected an error for a server without websocket [test n. %d]", 1)
+	}
+	if _, err := Dial(context.Background(), server.URL, nil); err == nil {
+		t.Errorf("Expected an error for an http url [test n. %d]", 2)
+	}
+
+	// The server never complete the handshake
+	hang := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hang.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := Dial(ctx, "ws"+strings.TrimPrefix(hang.URL, "http"), nil); err != context.DeadlineExceeded {
+		t.Errorf("Received %v, expected %v [test n. %d]", err, context.DeadlineExceeded, 3)
+	}
+}
@@ -0,0 +1,151 @@
+// Package orderbook contains the local L2 order book of a pair: the price levels of every side are kept sorted
+// (best price first), so the insert, the update and the delete of a level cost O(log n). The book can be built from
+// the snapshot requested by the REST API or updated by the deltas sent by the websocket of the markets
+package orderbook
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+)
+
+// Level is a price level of the order book
+type Level struct {
+	Price  float64
+	Volume float64
+	// PriceText and VolumeText are the values as sent by the market, used for compute the checksum
+	PriceText  string
+	VolumeText string
+	// Time is the time of the last update of the level, if sent by the market
+	Time time.Time
+}
+
+// ParseLevel is delegated to create a level from the price and the volume sent by the market
+func ParseLevel(price, volume string) (Level, error) {
+	p, err := strconv.ParseFloat(price, 64)
+	if err != nil {
+		return Level{}, err
+	}
+	v, err := strconv.ParseFloat(volume, 64)
+	if err != nil {
+		return Level{}, err
+	}
+	return Level{Price: p, Volume: v, PriceText: price, VolumeText: volume}, nil
+}
+
+// Book is the order book of a pair. The book is not safe for concurrent use, the caller have to synchronize the
+// access (e.g. the stream update the book from a single goroutine and publish a copy of the levels)
+type Book struct {
+	// Pair is the pair of the book, in the format of the market
+	Pair string
+	// Time is the time of the last update sent by the market
+	Time     time.Time
+	bids     *side
+	asks     *side
+	sequence uint64
+}
+
+// New is delegated to initialize an empty book for the given pair
+func New(pair string) *Book {
+	return &Book{Pair: pair, bids: newSide(func(x, y float64) bool { return x > y }), asks: newSide(func(x, y float64) bool { return x < y })}
+}
+
+// FromOrders is delegated to create the book of the given pair from the orders retrieved by the REST API
+func FromOrders(pair string, bids, asks []market.MarketOrder) *Book {
+	b := New(pair)
+	b.Snapshot(levels(bids), levels(asks))
+	return b
+}
+
+func levels(orders []market.MarketOrder) []Level {
+	result := make([]Level, len(orders))
+	for i := range orders {
+		result[i] = Level{Price: orders[i].Price, Volume: orders[i].Volume}
+	}
+	return result
+}
+
+// Orders is delegated to convert the given levels into the orders used by the engine
+func Orders(levels []Level) []market.MarketOrder {
+	orders := make([]market.MarketOrder, len(levels))
+	for i := range levels {
+		orders[i] = market.MarketOrder{Price: levels[i].Price, Volume: levels[i].Volume}
+	}
+	return orders
+}
+
+// Snapshot is delegated to replace the content of the book with the given levels
+func (b *Book) Snapshot(bids, asks []Level) {
+	b.bids.clear()
+	b.asks.clear()
+	for _, level := range bids {
+		b.bids.set(level)
+	}
+	for _, level := range asks {
+		b.asks.set(level)
+	}
+	b.sequence++
+}
+
+// SetBid is delegated to insert or update a bid level, a level without volume is removed
+func (b *Book) SetBid(level Level) {
+	b.bids.set(level)
+	b.sequence++
+}
+
+// SetAsk is delegated to insert or update an ask level, a level without volume is removed
+func (b *Book) SetAsk(level Level) {
+	b.asks.set(level)
+	b.sequence++
+}
+
+// Sequence return the number of updates (snapshots and levels) applied to the book, it can be used for know if
+// the book is changed since the last read
+func (b *Book) Sequence() uint64 {
+	return b.sequence
+}
+
+// BestBid return the bid with the highest price, false if the book has no bids
+func (b *Book) BestBid() (Level, bool) {
+	return b.bids.best()
+}
+
+// BestAsk return the ask with the lowest price, false if the book has no asks
+func (b *Book) BestAsk() (Level, bool) {
+	return b.asks.best()
+}
+
+// Bids return the first n bids, from the highest price. All the bids are returned if n is not positive
+func (b *Book) Bids(n int) []Level {
+	return b.bids.first(n)
+}
+
+// Asks return the first n asks, from the lowest price. All the asks are returned if n is not positive
+func (b *Book) Asks(n int) []Level {
+	return b.asks.first(n)
+}
+
+// Depth return the number of levels of the bids and of the asks
+func (b *Book) Depth() (int, int) {
+	return b.bids.length, b.asks.length
+}
+
+// Truncate is delegated to remove the levels after the given depth, for the markets that does not send the
+// deletion of the levels that go out of the subscribed depth
+func (b *Book) Truncate(depth int) {
+	b.bids.truncate(depth)
+	b.asks.truncate(depth)
+}
+
+// BuyCost is delegated to calculate the cost of buy the given volume, walking the asks from the lowest price.
+// The volume filled is lower than the requested one if the book does not contain enough liquidity
+func (b *Book) BuyCost(volume float64) (float64, float64) {
+	return b.asks.walk(volume)
+}
+
+// SellProceeds is delegated to calculate the amount received selling the given volume, walking the bids from the
+// highest price. The volume filled is lower than the requested one if the book does not contain enough liquidity
+func (b *Book) SellProceeds(volume float64) (float64, float64) {
+	return b.bids.walk(volume)
+}
@@ -0,0 +1,185 @@
+package orderbook
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+)
+
+func level(price, volume string) Level {
+	l, _ := ParseLevel(price, volume)
+	return l
+}
+
+func prices(levels []Level) []float64 {
+	var p []float64
+	for i := range levels {
+		p = append(p, levels[i].Price)
+	}
+	return p
+}
+
+func equal(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func Test_Book(t *testing.T) {
+	type TestCase struct {
+		Bid    bool
+		Price  string
+		Volume string
+		Bids   []float64
+		Asks   []float64
+		Number int
+	}
+
+	book := New("btcusd")
+	book.Snapshot([]Level{level("99", "1"), level("100", "2"), level("98", "1")}, []Level{level("102", "1"), level("101", "3")})
+
+	cases := []TestCase{
+		// New level
+		{Bid: true, Price: "100.5", Volume: "1", Bids: []float64{100.5, 100, 99, 98}, Asks: []float64{101, 102}, Number: 1},
+		// Update of an existing level, the price is the same also if the text is different
+		{Bid: false, Price: "101.0", Volume: "5", Bids: []float64{100.5, 100, 99, 98}, Asks: []float64{101, 102}, Number: 2},
+		// Remove
+		{Bid: true, Price: "100", Volume: "0", Bids: []float64{100.5, 99, 98}, Asks: []float64{101, 102}, Number: 3},
+		{Bid: false, Price: "101", Volume: "0.00000000", Bids: []float64{100.5, 99, 98}, Asks: []float64{102}, Number: 4},
+		// Remove a level not present
+		{Bid: false, Price: "150", Volume: "0", Bids: []float64{100.5, 99, 98}, Asks: []float64{102}, Number: 5},
+	}
+
+	for _, c := range cases {
+		if c.Bid {
+			book.SetBid(level(c.Price, c.Volume))
+		} else {
+			book.SetAsk(level(c.Price, c.Volume))
+		}
+		if bids, asks := prices(book.Bids(0)), prices(book.Asks(0)); !equal(bids, c.Bids) || !equal(asks, c.Asks) {
+			t.Errorf("Received %v/%v, expected %v/%v [test n. %d]", bids, asks, c.Bids, c.Asks, c.Number)
+		}
+	}
+
+	if bids := prices(book.Bids(2)); !equal(bids, []float64{100.5, 99}) {
+		t.Errorf("Received %v, expected %v [test n. %d]", bids, []float64{100.5, 99}, 6)
+	}
+	if bid, ok := book.BestBid(); !ok || bid.Price != 100.5 {
+		t.Errorf("Received %v, expected %v [test n. %d]", bid.Price, 100.5, 7)
+	}
+	if ask, ok := book.BestAsk(); !ok || ask.Price != 102 {
+		t.Errorf("Received %v, expected %v [test n. %d]", ask.Price, 102, 8)
+	}
+	// 1 snapshot and 5 updates
+	if book.Sequence() != 6 {
+		t.Errorf("Received %d, expected %d [test n. %d]", book.Sequence(), 6, 9)
+	}
+	book.Truncate(1)
+	if bids, asks := prices(book.Bids(0)), prices(book.Asks(0)); !equal(bids, []float64{100.5}) || !equal(asks, []float64{102}) {
+		t.Errorf("Received %v/%v, expected %v/%v [test n. %d]", bids, asks, []float64{100.5}, []float64{102}, 10)
+	}
+	book.Snapshot(nil, nil)
+	if _, ok := book.BestBid(); ok {
+		t.Errorf("Expected an empty book [test n. %d]", 11)
+	}
+	if _, err := ParseLevel("abc", "1"); err == nil {
+		t.Errorf("Expected an error for an invalid price [test n. %d]", 12)
+	}
+}
+
+// Test_BookRandom compare the book with a map sorted at every read
+func Test_BookRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	book := New("btcusd")
+	expected := make(map[float64]float64)
+	for n := 0; n < 20000; n++ {
+		price := float64(r.Intn(500))
+		volume := float64(r.Intn(3))
+		book.SetAsk(Level{Price: price, Volume: volume})
+		if volume > 0 {
+			expected[price] = volume
+		} else {
+			delete(expected, price)
+		}
+		if n%1000 == 0 {
+			depth := r.Intn(400)
+			book.Truncate(depth)
+			var sorted []float64
+			for p := range expected {
+				sorted = append(sorted, p)
+			}
+			sort.Float64s(sorted)
+			for _, p := range sorted[min(depth, len(sorted)):] {
+				delete(expected, p)
+			}
+		}
+	}
+	var sorted []float64
+	for p := range expected {
+		sorted = append(sorted, p)
+	}
+	sort.Float64s(sorted)
+	asks := book.Asks(0)
+	if !equal(prices(asks), sorted) {
+		t.Fatalf("Received %d levels, expected %d", len(asks), len(sorted))
+	}
+	for _, ask := range asks {
+		if ask.Volume != expected[ask.Price] {
+			t.Errorf("Received %v, expected %v for price %v", ask.Volume, expected[ask.Price], ask.Price)
+		}
+	}
+	if _, depth := book.Depth(); depth != len(sorted) {
+		t.Errorf("Received %d, expected %d", depth, len(sorted))
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func Test_BuyCost(t *testing.T) {
+	type TestCase struct {
+		Buy    bool
+		Volume float64
+		Amount float64
+		Filled float64
+		Number int
+	}
+
+	book := FromOrders("btcusd",
+		[]market.MarketOrder{{Price: 99, Volume: 1}, {Price: 98, Volume: 2}},
+		[]market.MarketOrder{{Price: 101, Volume: 1}, {Price: 102, Volume: 2}})
+	cases := []TestCase{
+		{Buy: true, Volume: 0.5, Amount: 50.5, Filled: 0.5, Number: 1},
+		{Buy: true, Volume: 2, Amount: 101 + 102, Filled: 2, Number: 2},
+		// Not enough liquidity
+		{Buy: true, Volume: 5, Amount: 101 + 204, Filled: 3, Number: 3},
+		{Buy: false, Volume: 1.5, Amount: 99 + 49, Filled: 1.5, Number: 4},
+		{Buy: false, Volume: 0, Amount: 0, Filled: 0, Number: 5},
+	}
+	for _, c := range cases {
+		var amount, filled float64
+		if c.Buy {
+			amount, filled = book.BuyCost(c.Volume)
+		} else {
+			amount, filled = book.SellProceeds(c.Volume)
+		}
+		if amount != c.Amount || filled != c.Filled {
+			t.Errorf("Received %v/%v, expected %v/%v [test n. %d]", amount, filled, c.Amount, c.Filled, c.Number)
+		}
+	}
+	if orders := Orders(book.Bids(1)); len(orders) != 1 || orders[0] != (market.MarketOrder{Price: 99, Volume: 1}) {
+		t.Errorf("Received %v, expected the best bid [test n. %d]", orders, len(cases)+1)
+	}
+}
@@ -0,0 +1,156 @@
+package orderbook
+
+// maxHeight is the max number of lanes of the skip list, enough for millions of levels
+const maxHeight = 24
+
+// node is a price level of the skip list, next contains the following node for every lane
+type node struct {
+	level Level
+	next  []*node
+}
+
+// side is a skip list that keep the levels of a side of the book sorted, from the best price
+type side struct {
+	head   *node
+	height int
+	length int
+	// better return true if the price x come before the price y
+	better func(x, y float64) bool
+	// seed is the state of the generator used for the height of the nodes
+	seed uint64
+}
+
+func newSide(better func(x, y float64) bool) *side {
+	return &side{head: &node{next: make([]*node, maxHeight)}, height: 1, better: better, seed: 0x9E3779B97F4A7C15}
+}
+
+// randomHeight return the height of a new node, every lane contains half of the nodes of the lane below
+func (s *side) randomHeight() int {
+	// xorshift64
+	s.seed ^= s.seed << 13
+	s.seed ^= s.seed >> 7
+	s.seed ^= s.seed << 17
+	height := 1
+	for r := s.seed; height < maxHeight && r&1 == 1; r >>= 1 {
+		height++
+	}
+	return height
+}
+
+// search is delegated to find, for every lane, the last node that come before the given price
+func (s *side) search(price float64, update []*node) *node {
+	current := s.head
+	for i := s.height - 1; i >= 0; i-- {
+		for current.next[i] != nil && s.better(current.next[i].level.Price, price) {
+			current = current.next[i]
+		}
+		update[i] = current
+	}
+	return current.next[0]
+}
+
+// set is delegated to insert, update or remove (volume not positive) the level with the price of the given one
+func (s *side) set(level Level) {
+	var update [maxHeight]*node
+	found := s.search(level.Price, update[:])
+	if found != nil && found.level.Price == level.Price {
+		if level.Volume > 0 {
+			found.level = level
+			return
+		}
+		for i := 0; i < len(found.next); i++ {
+			update[i].next[i] = found.next[i]
+		}
+		for s.height > 1 && s.head.next[s.height-1] == nil {
+			s.height--
+		}
+		s.length--
+		return
+	}
+	if level.Volume <= 0 {
+		return
+	}
+	height := s.randomHeight()
+	for i := s.height; i < height; i++ {
+		update[i] = s.head
+	}
+	if height > s.height {
+		s.height = height
+	}
+	n := &node{level: level, next: make([]*node, height)}
+	for i := 0; i < height; i++ {
+		n.next[i] = update[i].next[i]
+		update[i].next[i] = n
+	}
+	s.length++
+}
+
+// best return the first level
+func (s *side) best() (Level, bool) {
+	if first := s.head.next[0]; first != nil {
+		return first.level, true
+	}
+	return Level{}, false
+}
+
+// first return the first n levels, all the levels if n is not positive
+func (s *side) first(n int) []Level {
+	if n <= 0 || n > s.length {
+		n = s.length
+	}
+	levels := make([]Level, 0, n)
+	for current := s.head.next[0]; current != nil && len(levels) < n; current = current.next[0] {
+		levels = append(levels, current.level)
+	}
+	return levels
+}
+
+// truncate is delegated to remove the levels after the given depth
+func (s *side) truncate(depth int) {
+	if depth < 0 || depth >= s.length {
+		return
+	}
+	// last contains, for every lane, the last node that is kept
+	var last [maxHeight]*node
+	for i := range last {
+		last[i] = s.head
+	}
+	current := s.head
+	for n := 0; n < depth; n++ {
+		current = current.next[0]
+		for i := range current.next {
+			last[i] = current
+		}
+	}
+	for i := 0; i < s.height; i++ {
+		last[i].next[i] = nil
+	}
+	for s.height > 1 && s.head.next[s.height-1] == nil {
+		s.height--
+	}
+	s.length = depth
+}
+
+// clear is delegated to remove all the levels
+func (s *side) clear() {
+	for i := range s.head.next {
+		s.head.next[i] = nil
+	}
+	s.height = 1
+	s.length = 0
+}
+
+// walk is delegated to consume the given volume from the best level, returning the total amount (price * volume)
+// and the volume consumed
+func (s *side) walk(volume float64) (float64, float64) {
+	var amount, filled float64
+	for current := s.head.next[0]; current != nil && filled < volume; current = current.next[0] {
+		v := current.level.Volume
+		if filled+v > volume {
+			v = volume - filled
+		}
+		amount += v * current.level.Price
+		filled += v
+	}
+	return amount, filled
+}
@@ -0,0 +1,322 @@
+// Package rebalance contains the planner of the transfers between the markets: the arbitrage drain the quote currency
+// of the buy market and the base currency of the sell market, the rebalancer compare the funds of every market with
+// the target allocation and propose the withdrawals/deposits that restore it, paying the withdrawal fees and waiting
+// the transfer delays. In paper mode the transfers are applied to the wallets. The pairs that can not be traded with
+// the funds left are paused
+package rebalance
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"go.uber.org/zap"
+)
+
+// DEFAULT_THRESHOLD is the default deviation from the target, relative to the target, tolerated before a transfer
+const DEFAULT_THRESHOLD = 0.2
+
+// epsilon is the amount of currency considered float error
+const epsilon = 1e-9
+
+// Config contains the target allocations and the costs of the transfers. The markets use the uppercase names as
+// key, the currencies the lowercase tickers
+type Config struct {
+	// Threshold is the deviation from the target, relative to the target, tolerated before a transfer
+	Threshold float64 `json:"threshold"`
+	// Targets contains the share (0-1) of the total of every currency that have to be kept in every market. The
+	// markets without a share split equally the rest of the total
+	Targets map[string]map[string]float64 `json:"targets"`
+	// WithdrawalFees contains the flat fee, in the currency withdrawn, paid to the source market
+	WithdrawalFees map[string]map[string]float64 `json:"withdrawal_fees"`
+	// Delays contains the seconds needed for the transfer of every currency
+	Delays map[string]float64 `json:"delays"`
+	// MinBalances contains the amount of every currency under which a market is considered exhausted
+	MinBalances map[string]float64 `json:"min_balances"`
+}
+
+// LoadConfig is delegated to load the configuration from the given json file, e.g.:
+// {"threshold": 0.2, "targets": {"KRAKEN": {"btc": 0.5}}, "withdrawal_fees": {"KRAKEN": {"btc": 0.0005}},
+// "delays": {"btc": 1800}, "min_balances": {"usd": 10}}
+func LoadConfig(filepath string) (Config, error) {
+	data, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return Config{}, err
+	}
+	var config Config
+	config.Threshold = DEFAULT_THRESHOLD
+	if err = json.Unmarshal(data, &config); err != nil {
+		return Config{}, err
+	}
+	config.Targets = normalize(config.Targets)
+	config.WithdrawalFees = normalize(config.WithdrawalFees)
+	config.Delays = lower(config.Delays)
+	config.MinBalances = lower(config.MinBalances)
+	return config, nil
+}
+
+// normalize is delegated to use the uppercase markets and the lowercase currencies as key
+func normalize(values map[string]map[string]float64) map[string]map[string]float64 {
+	var normalized = make(map[string]map[string]float64, len(values))
+	for name := range values {
+		normalized[strings.ToUpper(name)] = lower(values[name])
+	}
+	return normalized
+}
+
+// lower is delegated to use the lowercase currencies as key
+func lower(values map[string]float64) map[string]float64 {
+	var lowered = make(map[string]float64, len(values))
+	for currency, value := range values {
+		lowered[strings.ToLower(currency)] = value
+	}
+	return lowered
+}
+
+// Transfer is a withdrawal of a currency from a market and the deposit into another one
+type Transfer struct {
+	Currency string `json:"currency"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	// Amount is withdrawn from the source market, the Fee is paid from the Amount and the rest is Received
+	Amount   float64   `json:"amount"`
+	Fee      float64   `json:"fee"`
+	Received float64   `json:"received"`
+	Time     time.Time `json:"time"`
+	Arrival  time.Time `json:"arrival"`
+}
+
+// Rebalancer is delegated to monitor the funds of the markets and to plan the transfers
+type Rebalancer struct {
+	mutex  sync.Mutex
+	config Config
+	// paper apply the transfers to the wallets, otherwise the transfers are only proposed
+	paper bool
+	// pending contains the transfers not arrived, history all the transfers planned
+	pending []Transfer
+	history []Transfer
+	// balances contains the funds of the markets at the last update, paused the pairs paused
+	balances map[string]map[string]float64
+	paused   map[string]bool
+}
+
+// New is delegated to initialize a rebalancer with the given configuration. In paper mode the transfers are applied
+// to the wallets of the markets
+func New(config Config, paper bool) *Rebalancer {
+	return &Rebalancer{config: config, paper: paper, paused: make(map[string]bool)}
+}
+
+// Update is delegated to settle the transfers arrived and to plan the transfers needed by the given markets. The
+// transfers in progress are considered already arrived, so they are not planned again. The markets without a wallet
+// are ignored
+func (r *Rebalancer) Update(now time.Time, marketsData []market.Market) []Transfer {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var wallets = make(map[string]map[string]float64, len(marketsData))
+	var names []string
+	for i := range marketsData {
+		if marketsData[i].Wallet.Coins != nil {
+			wallets[marketsData[i].MarketName] = marketsData[i].Wallet.Coins
+			names = append(names, marketsData[i].MarketName)
+		}
+	}
+
+	var pending []Transfer
+	for _, t := range r.pending {
+		if now.Before(t.Arrival) {
+			pending = append(pending, t)
+			continue
+		}
+		if coins, ok := wallets[t.To]; ok && r.paper {
+			coins[t.Currency] += t.Received
+		}
+		zap.S().Infof("Transfer of %f %s from [%s] to [%s] arrived", t.Received, t.Currency, t.From, t.To)
+	}
+	r.pending = pending
+
+	transfers := r.plan(names, wallets)
+	for i := range transfers {
+		transfers[i].Time = now
+		transfers[i].Arrival = now.Add(time.Duration(r.config.Delays[transfers[i].Currency] * float64(time.Second)))
+		if r.paper {
+			wallets[transfers[i].From][transfers[i].Currency] -= transfers[i].Amount
+		}
+		zap.S().Infof("Transfer of %f %s from [%s] to [%s] planned, fee %f, arrival at %s", transfers[i].Amount,
+			transfers[i].Currency, transfers[i].From, transfers[i].To, transfers[i].Fee, transfers[i].Arrival.Format(time.RFC3339))
+	}
+	r.pending = append(r.pending, transfers...)
+	r.history = append(r.history, transfers...)
+
+	r.balances = make(map[string]map[string]float64, len(wallets))
+	for name, coins := range wallets {
+		r.balances[name] = make(map[string]float64, len(coins))
+		for currency, amount := range coins {
+			r.balances[name][currency] = amount
+		}
+	}
+	return transfers
+}
+
+// plan is delegated to create the transfers that move every currency from the markets over the target to the markets
+// under the target. The funds in transit are counted in the destination market, and in paper mode they are already
+// removed from the source market
+func (r *Rebalancer) plan(names []string, wallets map[string]map[string]float64) []Transfer {
+	var balances = make(map[string]map[string]float64, len(names))
+	var currencies []string
+	for _, name := range names {
+		balances[name] = make(map[string]float64, len(wallets[name]))
+		for currency, amount := range wallets[name] {
+			currencies = appendMissing(currencies, currency)
+			balances[name][currency] = amount
+		}
+	}
+	for _, t := range r.pending {
+		if _, ok := balances[t.To]; ok {
+			balances[t.To][t.Currency] += t.Received
+		}
+		if _, ok := balances[t.From]; ok && !r.paper {
+			balances[t.From][t.Currency] -= t.Amount
+		}
+	}
+	sort.Strings(currencies)
+
+	var transfers []Transfer
+	for _, currency := range currencies {
+		transfers = append(transfers, r.planCurrency(currency, names, balances)...)
+	}
+	return transfers
+}
+
+// imbalance is the amount of a currency over (surplus) or under (deficit) the target of a market
+type imbalance struct {
+	market string
+	amount float64
+}
+
+// planCurrency is delegated to match the markets in surplus with the markets in deficit of the given currency, the
+// largest first. The source pay the withdrawal fee, so the amount withdrawn cover the deficit and the fee. The
+// transfers that does not cover the fee are discarded
+func (r *Rebalancer) planCurrency(currency string, names []string, balances map[string]map[string]float64) []Transfer {
+	var total float64
+	for _, name := range names {
+		total += balances[name][currency]
+	}
+	if total <= epsilon {
+		return nil
+	}
+	targets := r.targets(currency, names)
+	var surplus, deficit []imbalance
+	for _, name := range names {
+		target := targets[name] * total
+		deviation := balances[name][currency] - target
+		tolerated := math.Max(r.config.Threshold*target, epsilon)
+		if deviation > tolerated {
+			surplus = append(surplus, imbalance{market: name, amount: deviation})
+		} else if -deviation > tolerated {
+			deficit = append(deficit, imbalance{market: name, amount: -deviation})
+		}
+	}
+	sort.SliceStable(surplus, func(i, j int) bool { return surplus[i].amount > surplus[j].amount })
+	sort.SliceStable(deficit, func(i, j int) bool { return deficit[i].amount > deficit[j].amount })
+
+	var transfers []Transfer
+	for d := range deficit {
+		for s := range surplus {
+			if deficit[d].amount <= epsilon {
+				break
+			}
+			fee := r.config.WithdrawalFees[surplus[s].market][currency]
+			amount := math.Min(surplus[s].amount, deficit[d].amount+fee)
+			if amount-fee <= epsilon {
+				continue
+			}
+			transfers = append(transfers, Transfer{Currency: currency, From: surplus[s].market, To: deficit[d].market, Amount: amount, Fee: fee, Received: amount - fee})
+			surplus[s].amount -= amount
+			deficit[d].amount -= amount - fee
+		}
+	}
+	return transfers
+}
+
+// targets is delegated to retrieve the share of the given currency for every market. The markets not configured
+// split equally the share left by the configured ones
+func (r *Rebalancer) targets(currency string, names []string) map[string]float64 {
+	var targets = make(map[string]float64, len(names))
+	var free []string
+	var left = 1.0
+	for _, name := range names {
+		if share, ok := r.config.Targets[name][currency]; ok {
+			targets[name] = share
+			left -= share
+		} else {
+			free = append(free, name)
+		}
+	}
+	for _, name := range free {
+		targets[name] = math.Max(left, 0) / float64(len(free))
+	}
+	return targets
+}
+
+// Paused return true if no market can buy the given pair (quote currency) while another market can sell it (base
+// currency), using the funds of the last update. The markets under the min balance of a currency are exhausted.
+// The pairs are never paused before the first update or when less than two markets have a wallet
+func (r *Rebalancer) Paused(symbol market.Symbol) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.balances) < 2 {
+		return false
+	}
+	paused := true
+	for buy := range r.balances {
+		for sell := range r.balances {
+			if buy != sell && r.available(buy, symbol.Quote) && r.available(sell, symbol.Base) {
+				paused = false
+			}
+		}
+	}
+	pair := symbol.String()
+	if paused != r.paused[pair] {
+		if paused {
+			zap.S().Warnf("Pair [%s] paused, the inventory of the markets is exhausted", pair)
+		} else {
+			zap.S().Infof("Pair [%s] resumed", pair)
+		}
+		r.paused[pair] = paused
+	}
+	return paused
+}
+
+// available is delegated to verify that the market own more than the min balance of the currency
+func (r *Rebalancer) available(name, currency string) bool {
+	return r.balances[name][currency] > r.config.MinBalances[currency]+epsilon
+}
+
+// Pending return the transfers not arrived
+func (r *Rebalancer) Pending() []Transfer {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]Transfer(nil), r.pending...)
+}
+
+// History return all the transfers planned
+func (r *Rebalancer) History() []Transfer {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]Transfer(nil), r.history...)
+}
+
+// appendMissing is delegated to add the value to the list, if not already present
+func appendMissing(values []string, value string) []string {
+	for i := range values {
+		if values[i] == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
@@ -0,0 +1,198 @@
+package rebalance
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+)
+
+// initMarkets is delegated to create the markets A, B, C ... with the given wallets
+func initMarkets(coins ...map[string]float64) []market.Market {
+	var markets = make([]market.Market, len(coins))
+	for i := range coins {
+		name := string(rune('A' + i))
+		markets[i] = market.Market{MarketName: name, Wallet: market.Wallet{MarketName: name, Coins: coins[i]}}
+	}
+	return markets
+}
+
+func Test_Plan(t *testing.T) {
+	type TestCase struct {
+		Markets   []market.Market
+		Config    Config
+		Transfers []Transfer
+		Number    int
+	}
+
+	threshold := Config{Threshold: DEFAULT_THRESHOLD}
+	cases := []TestCase{
+		{Markets: initMarkets(map[string]float64{"btc": 1, "usd": 1000}, map[string]float64{"btc": 1, "usd": 1000}), Config: threshold, Number: 1},
+		{Markets: initMarkets(map[string]float64{"btc": 2, "usd": 1000}, map[string]float64{"btc": 0, "usd": 1000}), Config: threshold,
+			Transfers: []Transfer{{Currency: "btc", From: "A", To: "B", Amount: 1, Received: 1}}, Number: 2},
+		// The withdrawal fee is paid by the source market, that does not go under the target
+		{Markets: initMarkets(map[string]float64{"btc": 2}, map[string]float64{"btc": 0}),
+			Config:    Config{Threshold: DEFAULT_THRESHOLD, WithdrawalFees: map[string]map[string]float64{"A": {"btc": 0.01}}},
+			Transfers: []Transfer{{Currency: "btc", From: "A", To: "B", Amount: 1, Fee: 0.01, Received: 0.99}}, Number: 3},
+		// The deviation is under the threshold
+		{Markets: initMarkets(map[string]float64{"btc": 1.1}, map[string]float64{"btc": 0.9}), Config: threshold, Number: 4},
+		// A keep the 75% of the total, B the rest
+		{Markets: initMarkets(map[string]float64{"btc": 1}, map[string]float64{"btc": 1}),
+			Config:    Config{Threshold: DEFAULT_THRESHOLD, Targets: map[string]map[string]float64{"A": {"btc": 0.75}}},
+			Transfers: []Transfer{{Currency: "btc", From: "B", To: "A", Amount: 0.5, Received: 0.5}}, Number: 5},
+		{Markets: initMarkets(map[string]float64{"btc": 3}, map[string]float64{"btc": 0}, map[string]float64{"btc": 0}), Config: threshold,
+			Transfers: []Transfer{{Currency: "btc", From: "A", To: "B", Amount: 1, Received: 1}, {Currency: "btc", From: "A", To: "C", Amount: 1, Received: 1}}, Number: 6},
+		// The fee is greater than the amount transferred
+		{Markets: initMarkets(map[string]float64{"btc": 2}, map[string]float64{"btc": 0}),
+			Config: Config{Threshold: DEFAULT_THRESHOLD, WithdrawalFees: map[string]map[string]float64{"A": {"btc": 2}}}, Number: 7},
+		// The currencies are planned in alphabetical order
+		{Markets: initMarkets(map[string]float64{"usd": 0, "btc": 4}, map[string]float64{"usd": 2000, "btc": 0}), Config: threshold,
+			Transfers: []Transfer{{Currency: "btc", From: "A", To: "B", Amount: 2, Received: 2}, {Currency: "usd", From: "B", To: "A", Amount: 1000, Received: 1000}}, Number: 8},
+		// The markets without a wallet are ignored
+		{Markets: append(initMarkets(map[string]float64{"btc": 2}, map[string]float64{"btc": 0}), market.Market{MarketName: "C"}), Config: threshold,
+			Transfers: []Transfer{{Currency: "btc", From: "A", To: "B", Amount: 1, Received: 1}}, Number: 9},
+		// The surplus cover the first deficit and the fee, the rest is sent to the second one
+		{Markets: initMarkets(map[string]float64{"btc": 3}, map[string]float64{"btc": 0}, map[string]float64{"btc": 1}),
+			Config: Config{Threshold: DEFAULT_THRESHOLD, Targets: map[string]map[string]float64{"A": {"btc": 0.25}, "C": {"btc": 0.5}},
+				WithdrawalFees: map[string]map[string]float64{"A": {"btc": 0.01}}},
+			Transfers: []Transfer{{Currency: "btc", From: "A", To: "B", Amount: 1.01, Fee: 0.01, Received: 1}, {Currency: "btc", From: "A", To: "C", Amount: 0.99, Fee: 0.01, Received: 0.98}}, Number: 10},
+	}
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, c := range cases {
+		transfers := New(c.Config, false).Update(now, c.Markets)
+		if len(transfers) != len(c.Transfers) {
+			t.Errorf("Received %+v, expected %+v [test n. %d]", transfers, c.Transfers, c.Number)
+			continue
+		}
+		for i := range transfers {
+			received, expected := transfers[i], c.Transfers[i]
+			if received.Currency != expected.Currency || received.From != expected.From || received.To != expected.To ||
+				!equal(received.Amount, expected.Amount) || !equal(received.Fee, expected.Fee) || !equal(received.Received, expected.Received) {
+				t.Errorf("Received %+v, expected %+v [test n. %d]", received, expected, c.Number)
+			}
+		}
+	}
+}
+
+func Test_UpdatePaper(t *testing.T) {
+	markets := initMarkets(map[string]float64{"btc": 2}, map[string]float64{"btc": 0})
+	config := Config{Threshold: DEFAULT_THRESHOLD, WithdrawalFees: map[string]map[string]float64{"A": {"btc": 0.01}}, Delays: map[string]float64{"btc": 60}}
+	r := New(config, true)
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// The amount leave the source market when the transfer is planned
+	if transfers := r.Update(start, markets); len(transfers) != 1 || !transfers[0].Arrival.Equal(start.Add(time.Minute)) {
+		t.Errorf("Received %+v, expected a transfer arriving after a minute", transfers)
+	}
+	if !equal(markets[0].Wallet.Coins["btc"], 1) || markets[1].Wallet.Coins["btc"] != 0 {
+		t.Errorf("Received %v, expected the amount in transit [test n. %d]", markets, 1)
+	}
+	// The transfer in transit is not planned again
+	if transfers := r.Update(start.Add(30*time.Second), markets); len(transfers) != 0 || len(r.Pending()) != 1 {
+		t.Errorf("Received %+v, expected no transfer [test n. %d]", transfers, 2)
+	}
+	if transfers := r.Update(start.Add(time.Minute), markets); len(transfers) != 0 || len(r.Pending()) != 0 {
+		t.Errorf("Received %+v, expected no transfer [test n. %d]", transfers, 3)
+	}
+	if !equal(markets[0].Wallet.Coins["btc"], 1) || !equal(markets[1].Wallet.Coins["btc"], 0.99) {
+		t.Errorf("Received %v, expected the amount arrived [test n. %d]", markets, 4)
+	}
+	if len(r.History()) != 1 {
+		t.Errorf("Received %d transfers, expected %d", len(r.History()), 1)
+	}
+}
+
+func Test_UpdateProposal(t *testing.T) {
+	markets := initMarkets(map[string]float64{"btc": 2}, map[string]float64{"btc": 0})
+	r := New(Config{Threshold: DEFAULT_THRESHOLD, Delays: map[string]float64{"btc": 60}}, false)
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if transfers := r.Update(start, markets); len(transfers) != 1 {
+		t.Errorf("Received %+v, expected a transfer [test n. %d]", transfers, 1)
+	}
+	// The proposals does not change the wallets, and are not proposed again until the delay
+	if markets[0].Wallet.Coins["btc"] != 2 || markets[1].Wallet.Coins["btc"] != 0 {
+		t.Errorf("Received %v, expected the wallets unchanged [test n. %d]", markets, 2)
+	}
+	if transfers := r.Update(start.Add(30*time.Second), markets); len(transfers) != 0 {
+		t.Errorf("Received %+v, expected no transfer [test n. %d]", transfers, 3)
+	}
+	// The transfer was not executed, the markets are still unbalanced
+	if transfers := r.Update(start.Add(time.Minute), markets); len(transfers) != 1 {
+		t.Errorf("Received %+v, expected a transfer [test n. %d]", transfers, 4)
+	}
+}
+
+func Test_Paused(t *testing.T) {
+	type TestCase struct {
+		Markets []market.Market
+		Paused  bool
+		Number  int
+	}
+
+	cases := []TestCase{
+		{Markets: initMarkets(map[string]float64{"usd": 1000, "btc": 0}, map[string]float64{"usd": 0, "btc": 1}), Paused: false, Number: 1},
+		// No market can buy
+		{Markets: initMarkets(map[string]float64{"usd": 0, "btc": 1}, map[string]float64{"usd": 0, "btc": 1}), Paused: true, Number: 2},
+		// No market can sell
+		{Markets: initMarkets(map[string]float64{"usd": 1000, "btc": 0}, map[string]float64{"usd": 1000, "btc": 0}), Paused: true, Number: 3},
+		// The usd are under the min balance
+		{Markets: initMarkets(map[string]float64{"usd": 5, "btc": 0}, map[string]float64{"usd": 0, "btc": 1}), Paused: true, Number: 4},
+		// A market can not buy and sell the pair with itself
+		{Markets: initMarkets(map[string]float64{"usd": 1000, "btc": 1}, map[string]float64{"usd": 0, "btc": 0}), Paused: true, Number: 5},
+		{Markets: initMarkets(map[string]float64{"usd": 0, "btc": 0}), Paused: false, Number: 6},
+	}
+
+	symbol := market.NewSymbol("btc", "usd")
+	for _, c := range cases {
+		// The threshold avoid any transfer
+		r := New(Config{Threshold: 1000, MinBalances: map[string]float64{"usd": 10}}, false)
+		r.Update(time.Now(), c.Markets)
+		if paused := r.Paused(symbol); paused != c.Paused {
+			t.Errorf("Received %v, expected %v [test n. %d]", paused, c.Paused, c.Number)
+		}
+	}
+	if New(Config{}, false).Paused(symbol) {
+		t.Error("The pairs are paused before the first update")
+	}
+}
+
+func Test_LoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rebalance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "rebalance.json")
+	data := `{"targets": {"kraken": {"BTC": 0.5}}, "withdrawal_fees": {"Kraken": {"btc": 0.0005}}, "delays": {"BTC": 1800}, "min_balances": {"USD": 10}}`
+	if err = ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Config{
+		Threshold:      DEFAULT_THRESHOLD,
+		Targets:        map[string]map[string]float64{"KRAKEN": {"btc": 0.5}},
+		WithdrawalFees: map[string]map[string]float64{"KRAKEN": {"btc": 0.0005}},
+		Delays:         map[string]float64{"btc": 1800},
+		MinBalances:    map[string]float64{"usd": 10},
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("Received %+v, expected %+v", config, expected)
+	}
+	if _, err = LoadConfig(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func equal(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
@@ -0,0 +1,230 @@
+// Package simulator contains the paper trading venue used for the dry runs: the orders are filled against the order
+// book of the market, level by level, the fees are applied using the fee schedule of the market and the wallet of the
+// market is updated only by the fills, so the dry run reflect the liquidity and the funds of a live execution
+package simulator
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+	"github.com/alessiosavi/GoArbitrage/fees"
+)
+
+// ErrInvalidOrder is returned for the orders without a volume or, for the limit orders, without a price
+var ErrInvalidOrder = errors.New("INVALID_ORDER")
+
+// ErrInsufficientFunds is returned when the wallet does not contain the currency needed for the fills of the order
+var ErrInsufficientFunds = errors.New("INSUFFICIENT_FUNDS")
+
+// tolerance is the relative volume not filled that is considered float error
+const tolerance = 1e-12
+
+// Side is the side of the order, referred to the base currency of the pair
+type Side string
+
+const (
+	// Buy lift the asks, paying the quote currency
+	Buy Side = "buy"
+	// Sell hit the bids, receiving the quote currency
+	Sell Side = "sell"
+)
+
+// OrderType is the type of the order
+type OrderType string
+
+const (
+	// Market is filled at any price, until the volume is reached or the order book is exhausted
+	Market OrderType = "market"
+	// Limit is filled only at the levels with a price equal or better than the limit price. The volume not filled is
+	// cancelled (immediate or cancel), the order does not rest in the order book
+	Limit OrderType = "limit"
+)
+
+// Status is the final state of an order
+type Status string
+
+const (
+	// Filled means that all the volume was filled
+	Filled Status = "filled"
+	// PartiallyFilled means that the order book does not contain enough volume, the rest is cancelled
+	PartiallyFilled Status = "partially_filled"
+	// Cancelled means that no level can be filled (empty order book or limit price not reached)
+	Cancelled Status = "cancelled"
+	// Rejected means that the order is invalid or the wallet does not contain the funds
+	Rejected Status = "rejected"
+)
+
+// Order is an order sent to the venue
+type Order struct {
+	Symbol market.Symbol
+	Side   Side
+	Type   OrderType
+	// Price is the limit price, ignored for the market orders
+	Price float64
+	// Volume is the amount of base currency to buy or to sell
+	Volume float64
+}
+
+// Fill is the volume filled at a level of the order book
+type Fill struct {
+	Price  float64 `json:"price"`
+	Volume float64 `json:"volume"`
+}
+
+// Execution contains the result of an order
+type Execution struct {
+	ID     int       `json:"id"`
+	Market string    `json:"market"`
+	Pair   string    `json:"pair"`
+	Side   Side      `json:"side"`
+	Type   OrderType `json:"type"`
+	Price  float64   `json:"price"`
+	Volume float64   `json:"volume"`
+	Status Status    `json:"status"`
+	// Reason is the error of the rejected orders
+	Reason string `json:"reason,omitempty"`
+	// Filled is the volume filled, AveragePrice is the VWAP of the fills
+	Filled       float64 `json:"filled"`
+	AveragePrice float64 `json:"average_price"`
+	// Gross is the amount of quote currency traded, Fee the fee paid and Net the amount that leave the wallet for a
+	// buy (Gross + Fee) or that enter the wallet for a sell (Gross - Fee)
+	Gross float64 `json:"gross"`
+	Fee   float64 `json:"fee"`
+	Net   float64 `json:"net"`
+	Fills []Fill  `json:"fills"`
+	Time  int64   `json:"time"`
+}
+
+// Venue is the simulated execution of a market. The fills update the wallet of the market, the executions are
+// recorded for be saved with the operation
+type Venue struct {
+	mutex      sync.Mutex
+	market     *market.Market
+	executions []Execution
+}
+
+// New is delegated to initialize a venue for the given market, the fees are taken from the fee schedule of the
+// market and the fills are applied to its wallet
+func New(m *market.Market) *Venue {
+	return &Venue{market: m}
+}
+
+// Bind is delegated to replace the market of the venue with the last data of the market (order books, fees and
+// wallet), the executions already recorded are kept
+func (v *Venue) Bind(m *market.Market) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.market = m
+}
+
+// Submit is delegated to fill the given order against the given levels of the order book: the asks for a buy and
+// the bids for a sell, best price first. All the orders are taker orders. The order is rejected, without changing the
+// wallet, if the wallet does not contain the quote currency needed for the fills of a buy (fee included) or the
+// base currency sold. The error is returned together with the rejected execution
+func (v *Venue) Submit(order Order, levels []market.MarketOrder) (Execution, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	pair := order.Symbol.String()
+	e := Execution{ID: len(v.executions) + 1, Market: v.market.MarketName, Pair: pair, Side: order.Side, Type: order.Type,
+		Price: order.Price, Volume: order.Volume, Time: time.Now().UnixNano()}
+
+	if err := validate(order); err != nil {
+		return v.record(e, err), err
+	}
+	e.Fills = match(order, levels)
+	for _, fill := range e.Fills {
+		e.Filled += fill.Volume
+		e.Gross += fill.Volume * fill.Price
+	}
+	switch {
+	case e.Filled <= 0:
+		e.Status = Cancelled
+		return v.record(e, nil), nil
+	case order.Volume-e.Filled > order.Volume*tolerance:
+		e.Status = PartiallyFilled
+	default:
+		e.Status = Filled
+	}
+	e.AveragePrice = e.Gross / e.Filled
+	e.Fee = fees.Compute(*v.market, pair, fees.Taker, e.Gross)
+	if order.Side == Buy {
+		e.Net = e.Gross + e.Fee
+	} else {
+		e.Net = e.Gross - e.Fee
+	}
+
+	coins := v.market.Wallet.Coins
+	if (order.Side == Buy && coins[order.Symbol.Quote] < e.Net) || (order.Side == Sell && coins[order.Symbol.Base] < e.Filled) {
+		return v.record(e, ErrInsufficientFunds), ErrInsufficientFunds
+	}
+	if order.Side == Buy {
+		coins[order.Symbol.Quote] -= e.Net
+		coins[order.Symbol.Base] += e.Filled
+	} else {
+		coins[order.Symbol.Base] -= e.Filled
+		coins[order.Symbol.Quote] += e.Net
+	}
+	return v.record(e, nil), nil
+}
+
+// Executions return the executions of the orders submitted to the venue, rejected orders included
+func (v *Venue) Executions() []Execution {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return append([]Execution(nil), v.executions...)
+}
+
+// record is delegated to save the execution, the rejected executions does not contain fills
+func (v *Venue) record(e Execution, err error) Execution {
+	if err != nil {
+		e.Status = Rejected
+		e.Reason = err.Error()
+		e.Fills, e.Filled, e.AveragePrice, e.Gross, e.Fee, e.Net = nil, 0, 0, 0, 0, 0
+	}
+	v.executions = append(v.executions, e)
+	return e
+}
+
+// validate is delegated to verify the parameters of the order
+func validate(order Order) error {
+	if order.Volume <= 0 || !order.Symbol.IsValid() || (order.Side != Buy && order.Side != Sell) {
+		return ErrInvalidOrder
+	}
+	switch order.Type {
+	case Market:
+		return nil
+	case Limit:
+		if order.Price <= 0 {
+			return ErrInvalidOrder
+		}
+		return nil
+	}
+	return ErrInvalidOrder
+}
+
+// match is delegated to consume the levels until the volume of the order is filled, the limit price is not
+// reached or the order book is exhausted
+func match(order Order, levels []market.MarketOrder) []Fill {
+	var fills []Fill
+	remaining := order.Volume
+	for _, level := range levels {
+		if remaining <= 0 {
+			break
+		}
+		if order.Type == Limit && ((order.Side == Buy && level.Price > order.Price) || (order.Side == Sell && level.Price < order.Price)) {
+			break
+		}
+		if level.Volume <= 0 {
+			continue
+		}
+		volume := level.Volume
+		if volume > remaining {
+			volume = remaining
+		}
+		fills = append(fills, Fill{Price: level.Price, Volume: volume})
+		remaining -= volume
+	}
+	return fills
+}
@@ -0,0 +1,118 @@
+package simulator
+
+import (
+	"math"
+	"testing"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+)
+
+var symbol = market.NewSymbol("btc", "usd")
+
+var asks = []market.MarketOrder{{Price: 100, Volume: 1}, {Price: 101, Volume: 2}, {Price: 103, Volume: 1}}
+var bids = []market.MarketOrder{{Price: 99, Volume: 1}, {Price: 98, Volume: 2}}
+
+// initMarket is delegated to initialize a market with the given taker fee (percent) and wallet
+func initMarket(fee, btc, usd float64) *market.Market {
+	return &market.Market{MarketName: "A", TakerFee: fee, Wallet: market.Wallet{MarketName: "A", Coins: map[string]float64{"btc": btc, "usd": usd}}}
+}
+
+func Test_Submit(t *testing.T) {
+	type TestCase struct {
+		Market *market.Market
+		Order  Order
+		Levels []market.MarketOrder
+		Status Status
+		Error  error
+		Filled float64
+		Net    float64
+		// BTC and USD are the wallet after the order
+		BTC    float64
+		USD    float64
+		Number int
+	}
+
+	cases := []TestCase{
+		// Two levels: 100 + 2 * 101
+		{Market: initMarket(0, 0, 1000), Order: Order{Symbol: symbol, Side: Buy, Type: Market, Volume: 3}, Levels: asks,
+			Status: Filled, Filled: 3, Net: 302, BTC: 3, USD: 698, Number: 1},
+		// The fee (0.5%) is paid in addition to the amount bought
+		{Market: initMarket(0.5, 0, 1000), Order: Order{Symbol: symbol, Side: Buy, Type: Market, Volume: 1}, Levels: asks,
+			Status: Filled, Filled: 1, Net: 100.5, BTC: 1, USD: 899.5, Number: 2},
+		// The order book is exhausted
+		{Market: initMarket(0, 0, 1000), Order: Order{Symbol: symbol, Side: Buy, Type: Market, Volume: 5}, Levels: asks,
+			Status: PartiallyFilled, Filled: 4, Net: 405, BTC: 4, USD: 595, Number: 3},
+		// The limit stop the fill at the second level
+		{Market: initMarket(0, 0, 1000), Order: Order{Symbol: symbol, Side: Buy, Type: Limit, Price: 101, Volume: 5}, Levels: asks,
+			Status: PartiallyFilled, Filled: 3, Net: 302, BTC: 3, USD: 698, Number: 4},
+		{Market: initMarket(0, 0, 1000), Order: Order{Symbol: symbol, Side: Buy, Type: Limit, Price: 99, Volume: 1}, Levels: asks,
+			Status: Cancelled, Filled: 0, Net: 0, BTC: 0, USD: 1000, Number: 5},
+		// The fee is subtracted from the amount received
+		{Market: initMarket(1, 2, 0), Order: Order{Symbol: symbol, Side: Sell, Type: Limit, Price: 98, Volume: 2}, Levels: bids,
+			Status: Filled, Filled: 2, Net: 195.03, BTC: 0, USD: 195.03, Number: 6},
+		// The wallet does not contain the quote for the fills (302) nor the base sold
+		{Market: initMarket(0, 0, 300), Order: Order{Symbol: symbol, Side: Buy, Type: Market, Volume: 3}, Levels: asks,
+			Status: Rejected, Error: ErrInsufficientFunds, BTC: 0, USD: 300, Number: 7},
+		{Market: initMarket(0, 1, 0), Order: Order{Symbol: symbol, Side: Sell, Type: Market, Volume: 2}, Levels: bids,
+			Status: Rejected, Error: ErrInsufficientFunds, BTC: 1, USD: 0, Number: 8},
+		// The funds are checked on the volume filled, not on the volume requested
+		{Market: initMarket(0, 1, 0), Order: Order{Symbol: symbol, Side: Sell, Type: Limit, Price: 99, Volume: 2}, Levels: bids,
+			Status: PartiallyFilled, Filled: 1, Net: 99, BTC: 0, USD: 99, Number: 9},
+		{Market: initMarket(0, 0, 1000), Order: Order{Symbol: symbol, Side: Buy, Type: Limit, Volume: 1}, Levels: asks,
+			Status: Rejected, Error: ErrInvalidOrder, BTC: 0, USD: 1000, Number: 10},
+		{Market: initMarket(0, 0, 1000), Order: Order{Symbol: symbol, Side: Buy, Type: Market}, Levels: asks,
+			Status: Rejected, Error: ErrInvalidOrder, BTC: 0, USD: 1000, Number: 11},
+		{Market: initMarket(0, 0, 1000), Order: Order{Symbol: symbol, Side: Buy, Type: Market, Volume: 1},
+			Status: Cancelled, BTC: 0, USD: 1000, Number: 12},
+	}
+
+	for _, c := range cases {
+		venue := New(c.Market)
+		e, err := venue.Submit(c.Order, c.Levels)
+		if err != c.Error || e.Status != c.Status {
+			t.Errorf("Received %s %v, expected %s %v [test n. %d]", e.Status, err, c.Status, c.Error, c.Number)
+		}
+		if math.Abs(e.Filled-c.Filled) > 1e-9 || math.Abs(e.Net-c.Net) > 1e-9 {
+			t.Errorf("Received filled %f net %f, expected filled %f net %f [test n. %d]", e.Filled, e.Net, c.Filled, c.Net, c.Number)
+		}
+		coins := c.Market.Wallet.Coins
+		if math.Abs(coins["btc"]-c.BTC) > 1e-9 || math.Abs(coins["usd"]-c.USD) > 1e-9 {
+			t.Errorf("Received wallet %v, expected btc %f usd %f [test n. %d]", coins, c.BTC, c.USD, c.Number)
+		}
+		if executions := venue.Executions(); len(executions) != 1 || executions[0].Status != c.Status {
+			t.Errorf("Received %+v, expected the execution recorded [test n. %d]", executions, c.Number)
+		}
+	}
+}
+
+func Test_SubmitFlatFee(t *testing.T) {
+	m := initMarket(0, 0, 1000)
+	m.Fees = market.MarketFee{IsPercent: false, Tiers: []market.FeeTier{{Taker: 2}}}
+	venue := New(m)
+	// The flat fee is paid once for the order, not for every fill
+	e, err := venue.Submit(Order{Symbol: symbol, Side: Buy, Type: Market, Volume: 2}, asks)
+	if err != nil || e.Fee != 2 || e.Net != 203 || len(e.Fills) != 2 {
+		t.Errorf("Received %+v %v, expected a fee of 2 and a net of 203", e, err)
+	}
+	if e.AveragePrice != 100.5 || e.ID != 1 {
+		t.Errorf("Received %+v, expected an average price of 100.5", e)
+	}
+}
+
+func Test_Bind(t *testing.T) {
+	first := initMarket(0, 0, 1000)
+	venue := New(first)
+	if _, err := venue.Submit(Order{Symbol: symbol, Side: Buy, Type: Market, Volume: 1}, asks); err != nil {
+		t.Fatal(err)
+	}
+	// The fills of the new market update its wallet, the ids continue from the executions recorded
+	second := initMarket(0, 2, 0)
+	venue.Bind(second)
+	e, err := venue.Submit(Order{Symbol: symbol, Side: Sell, Type: Market, Volume: 1}, bids)
+	if err != nil || e.ID != 2 || len(venue.Executions()) != 2 {
+		t.Errorf("Received %+v %v, expected the second execution", e, err)
+	}
+	if second.Wallet.Coins["btc"] != 1 || second.Wallet.Coins["usd"] != 99 || first.Wallet.Coins["btc"] != 1 {
+		t.Errorf("Received %v and %v, expected the sell on the new market", first.Wallet.Coins, second.Wallet.Coins)
+	}
+}
@@ -2,11 +2,13 @@ package utils
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"strconv"
 	"strings"
 
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
 	fileutils "github.com/alessiosavi/GoGPUtils/files"
 	"github.com/go-redis/redis/v7"
 	"go.uber.org/zap"
@@ -25,9 +27,10 @@ func DumpStruct(data interface{}, filepath string) {
 }
 
 // LoadMinAmountKraken : is delegated to load the minimum amount for Kraken
-func LoadMinAmountKraken(filepath string) map[string]float64 {
+func LoadMinAmountKraken(filepath string) (map[string]float64, error) {
 	if !fileutils.FileExists(filepath) {
-		zap.S().Fatalf("unable to find file %s\n", filepath)
+		zap.S().Warnf("unable to find file %s", filepath)
+		return nil, errors.New("MIN_AMOUNT_FILE_NOT_FOUND")
 	}
 
 	var amounts map[string]float64
@@ -35,12 +38,16 @@ func LoadMinAmountKraken(filepath string) map[string]float64 {
 
 	amounts = make(map[string]float64, len(lines))
 	for i := range lines {
-		d := strings.Split(lines[i], " ")
+		// Fields remove also the carriage return of the file saved with CRLF line ending
+		d := strings.Fields(lines[i])
+		if len(d) != 2 {
+			continue
+		}
 		f, _ := strconv.ParseFloat(d[0], 64)
 		amounts[strings.ToLower(d[1])] = f
 	}
 	zap.S().Infof("Min amount for kraken: %v", amounts)
-	return amounts
+	return amounts, nil
 }
 
 // InitClient initialize a new dummy RedisClient
@@ -57,26 +64,17 @@ func InitClient() *redis.Client {
 	return client
 }
 
-// extractCurrenciesFromPair is delegated to return the base and the quote currencies
-func extractCurrenciesFromPair(pair string) (string, string) {
-	//pair := "btcusd"
-	quote := pair[len(pair)-3:]         // usd
-	base := pair[:len(pair)-len(quote)] // btc
-	return base, quote
-}
-
-func ExtractCurrenciesFromPairs(pairs []string) []string {
+// ExtractCurrenciesFromSymbols is delegated to return the list of distinct currencies for the given symbols
+func ExtractCurrenciesFromSymbols(symbols []market.Symbol) []string {
 	var c map[string]struct{} = make(map[string]struct{})
-	for i := range pairs {
-		a, b := extractCurrenciesFromPair(pairs[i])
-		c[a] = struct{}{}
-		c[b] = struct{}{}
-	}
-	var currencies []string = make([]string, len(c))
-	i := 0
-	for key := range c {
-		currencies[i] = key
-		i++
+	var currencies []string
+	for i := range symbols {
+		for _, currency := range []string{symbols[i].Base, symbols[i].Quote} {
+			if _, ok := c[currency]; !ok {
+				c[currency] = struct{}{}
+				currencies = append(currencies, currency)
+			}
+		}
 	}
 	return currencies
 }
@@ -1,8 +1,49 @@
 package utils
 
-import "testing"
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/alessiosavi/GoArbitrage/datastructure/market"
+)
 
 func Test_InitClient(t *testing.T) {
 	c := InitClient()
 	c.Close()
 }
+
+func Test_ExtractCurrenciesFromSymbols(t *testing.T) {
+	symbols := []market.Symbol{
+		market.NewSymbol("BTC", "USDT"),
+		market.NewSymbol("algo", "eur"),
+		market.NewSymbol("btc", "eur")}
+	expected := []string{"btc", "usdt", "algo", "eur"}
+	result := ExtractCurrenciesFromSymbols(symbols)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Received %v, expected %v", result, expected)
+	}
+}
+
+func Test_LoadMinAmountKraken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "min_amount")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The file distributed in the data folder use the CRLF line ending
+	file := filepath.Join(dir, "min_amount.txt")
+	if err = ioutil.WriteFile(file, []byte("0.002 XBT\r\n30 XRP\r\n\r\n1 ADA\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]float64{"xbt": 0.002, "xrp": 30, "ada": 1}
+	if result, err := LoadMinAmountKraken(file); err != nil || !reflect.DeepEqual(result, expected) {
+		t.Errorf("Received %v (%v), expected %v", result, err, expected)
+	}
+	if _, err = LoadMinAmountKraken(filepath.Join(dir, "missing.txt")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}